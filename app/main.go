@@ -2,37 +2,57 @@ package main
 
 import (
 	"fmt"
-	"net"
+	"log/slog"
 	"os"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/server"
 )
 
 func main() {
-	fmt.Println("Logs from your program will appear here!")
+	args := os.Args[1:]
+	// --check-config validates the configuration and exits, without binding anything;
+	// --ping checks that the server it configures is alive
+	var mode string
+	if len(args) > 0 && (args[0] == "--check-config" || args[0] == "--ping") {
+		mode, args = args[0], args[1:]
+	}
 
-	// Start TCP server on port 6379
-	listener, err := net.Listen("tcp", "0.0.0.0:6379")
+	config, err := server.ParseArgs(args)
+	if mode == "--check-config" {
+		if err != nil {
+			for _, err := range unjoin(err) {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			fmt.Fprintln(os.Stderr, "Configuration is not valid")
+			os.Exit(1)
+		}
+		fmt.Println("Configuration OK")
+		return
+	}
 	if err != nil {
-		fmt.Println("Failed to bind to port 6379")
+		for _, err := range unjoin(err) {
+			slog.Error("Invalid configuration", "err", err)
+		}
 		os.Exit(1)
 	}
-	defer listener.Close()
-
-	// Create Redis server instance
-	server := NewRedisServer()
-	fmt.Println("Redis server started on :6379")
-
-	// Accept connections
-	for {
-		conn, err := listener.Accept()
-		if err != nil {
-			fmt.Printf("Error accepting connection: %v\n", err)
-			continue
+	if mode == "--ping" {
+		if err := ping(config); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
+		fmt.Println("PONG")
+		return
+	}
+	if err := server.Run(config); err != nil {
+		slog.Error("Server failed", "err", err)
+		os.Exit(1)
+	}
+}
 
-		// Handle each connection in a separate goroutine
-		go func() {
-			connection := NewConnection(conn)
-			connection.Handle(server)
-		}()
+// unjoin splits the errors joined by errors.Join
+func unjoin(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
 	}
+	return []error{err}
 }
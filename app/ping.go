@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/server"
+	"github.com/codecrafters-io/redis-starter-go/redisclient"
+)
+
+// pingTimeout bounds a --ping health check, connection included
+const pingTimeout = 5 * time.Second
+
+// ping checks that the server configured by config answers PING, connecting as a
+// local client would: to the plaintext port, else the TLS port, else the Unix
+// socket, authenticating with requirepass
+func ping(config *server.Config) error {
+	opts := redisclient.Options{Password: config.RequirePass, ClientName: "healthcheck", PoolSize: 1}
+	switch {
+	case config.Port > 0:
+		opts.Addr = net.JoinHostPort(localAddr(config.Bind), strconv.Itoa(config.Port))
+	case config.TLSPort > 0:
+		opts.Addr = net.JoinHostPort(localAddr(config.Bind), strconv.Itoa(config.TLSPort))
+		// The server is only checked for liveness, not authenticated, but it may
+		// require a client certificate
+		tlsConfig := &tls.Config{InsecureSkipVerify: true}
+		if config.TLSCertFile != "" && config.TLSKeyFile != "" {
+			cert, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+			if err != nil {
+				return err
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		opts.Dialer = (&tls.Dialer{Config: tlsConfig}).DialContext
+	case config.UnixSocket != "":
+		opts.Addr = config.UnixSocket
+		opts.Dialer = func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}
+	default:
+		return errors.New("no port or unix socket is configured")
+	}
+
+	client, err := redisclient.New(opts)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	return client.Ping(ctx)
+}
+
+// localAddr picks the address to reach the server on from its bind list: the first
+// one, the loopback address of its family when it is a wildcard
+func localAddr(bind []string) string {
+	if len(bind) == 0 {
+		return "127.0.0.1"
+	}
+	switch addr := strings.TrimPrefix(bind[0], "-"); addr {
+	case "*", "0.0.0.0":
+		return "127.0.0.1"
+	case "::*", "::":
+		return "::1"
+	default:
+		return addr
+	}
+}
@@ -0,0 +1,272 @@
+// Command benchmark is a load generator in the manner of redis-benchmark: -c clients
+// send -n requests of every selected test, -P at a time, and the throughput and the
+// latency percentiles of every test are reported. The command given as arguments, if
+// any, is run instead of the tests.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/redisclient"
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// randPlaceholder is replaced in arguments by a random number below -r, as with
+// redis-benchmark
+const randPlaceholder = "__rand_int__"
+
+// defaultTests are the tests run without -t: those the server implements
+const defaultTests = "ping,set,get,incr"
+
+// test is a named command to benchmark
+type test struct {
+	name string
+	args func(data string) []string
+}
+
+// tests are the tests -t selects from, named as in redis-benchmark. Those beyond
+// defaultTests are for comparing with Redis, as the server lacks their commands.
+var tests = []test{
+	{"ping", func(string) []string { return []string{"PING"} }},
+	{"set", func(data string) []string { return []string{"SET", "key:" + randPlaceholder, data} }},
+	{"get", func(string) []string { return []string{"GET", "key:" + randPlaceholder} }},
+	{"incr", func(string) []string { return []string{"INCR", "counter:" + randPlaceholder} }},
+	{"lpush", func(data string) []string { return []string{"LPUSH", "mylist", data} }},
+	{"rpush", func(data string) []string { return []string{"RPUSH", "mylist", data} }},
+	{"lpop", func(string) []string { return []string{"LPOP", "mylist"} }},
+	{"rpop", func(string) []string { return []string{"RPOP", "mylist"} }},
+	{"sadd", func(string) []string { return []string{"SADD", "myset", "element:" + randPlaceholder} }},
+	{"hset", func(data string) []string { return []string{"HSET", "myhash", "element:" + randPlaceholder, data} }},
+	{"mset", func(data string) []string {
+		args := []string{"MSET"}
+		for range 10 {
+			args = append(args, "key:"+randPlaceholder, data)
+		}
+		return args
+	}},
+}
+
+// options are the benchmark settings shared by every test
+type options struct {
+	clients  int
+	requests int
+	pipeline int
+	keyspace int
+	dataSize int
+}
+
+func main() {
+	flags := flag.NewFlagSet("benchmark", flag.ExitOnError)
+	host := flags.String("h", "127.0.0.1", "server hostname")
+	port := flags.Int("p", 6379, "server port")
+	password := flags.String("a", "", "password to authenticate with")
+	user := flags.String("user", "", "username to authenticate with, default when empty")
+	resp3 := flags.Bool("3", false, "use RESP3")
+	var opts options
+	flags.IntVar(&opts.clients, "c", 50, "number of parallel connections")
+	flags.IntVar(&opts.requests, "n", 100000, "total number of requests of every test")
+	flags.IntVar(&opts.pipeline, "P", 1, "number of requests pipelined together")
+	flags.IntVar(&opts.keyspace, "r", 0, "use random keys below this number for "+randPlaceholder+", the same key when 0")
+	flags.IntVar(&opts.dataSize, "d", 3, "data size of SET and push values, in bytes")
+	selected := flags.String("t", defaultTests, "comma-separated tests to run, among "+testNames())
+	quiet := flags.Bool("q", false, "only print the throughput and median latency of every test")
+	csv := flags.Bool("csv", false, "print the results as CSV")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: benchmark [options] [command [arg ...]]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+	if opts.clients < 1 || opts.requests < 1 || opts.pipeline < 1 || opts.keyspace < 0 || opts.dataSize < 0 {
+		fmt.Fprintln(os.Stderr, "-c, -n and -P must be positive, -r and -d not negative")
+		os.Exit(1)
+	}
+
+	run := tests
+	if flags.NArg() > 0 {
+		args := flags.Args()
+		run = []test{{strings.Join(args, " "), func(string) []string { return args }}}
+	} else {
+		var err error
+		if run, err = selectTests(*selected); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	protocol := resp.RESP2
+	if *resp3 {
+		protocol = resp.RESP3
+	}
+	client, err := redisclient.New(redisclient.Options{
+		Addr:     net.JoinHostPort(*host, strconv.Itoa(*port)),
+		Username: *user,
+		Password: *password,
+		Protocol: protocol,
+		PoolSize: opts.clients,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var report reporter = &fullReporter{opts: opts}
+	switch {
+	case *csv:
+		report = &csvReporter{}
+	case *quiet:
+		report = quietReporter{}
+	}
+	data := strings.Repeat("x", opts.dataSize)
+	for _, t := range run {
+		result, err := benchmark(client, t.args(data), opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		name := t.name
+		if flags.NArg() == 0 {
+			name = strings.ToUpper(name)
+		}
+		report.report(name, result)
+	}
+}
+
+// testNames lists the names of the tests
+func testNames() string {
+	names := make([]string, len(tests))
+	for i, t := range tests {
+		names[i] = t.name
+	}
+	return strings.Join(names, ",")
+}
+
+// selectTests returns the tests named in a comma-separated list, in the order of tests
+func selectTests(list string) ([]test, error) {
+	names := strings.Split(strings.ToLower(list), ",")
+	for _, name := range names {
+		if !slices.ContainsFunc(tests, func(t test) bool { return t.name == name }) {
+			return nil, fmt.Errorf("unknown test %q, expected one of %s", name, testNames())
+		}
+	}
+	var selected []test
+	for _, t := range tests {
+		if slices.Contains(names, t.name) {
+			selected = append(selected, t)
+		}
+	}
+	return selected, nil
+}
+
+// result is the outcome of a test
+type result struct {
+	elapsed   time.Duration
+	latencies []time.Duration // of every request, sorted
+	errors    int64
+}
+
+// benchmark sends opts.requests copies of a command from opts.clients connections,
+// opts.pipeline at a time. The latency of a request is that of its pipeline.
+func benchmark(client *redisclient.Client, template []string, opts options) (result, error) {
+	// Every connection is opened ahead, so that dialing isn't measured
+	ctx := context.Background()
+	var warmup sync.WaitGroup
+	warmupErrors := make([]error, opts.clients)
+	for i := range opts.clients {
+		warmup.Add(1)
+		go func() {
+			defer warmup.Done()
+			pipeline := client.Pipeline()
+			pipeline.Do("PING")
+			_, warmupErrors[i] = pipeline.Exec(ctx)
+		}()
+	}
+	warmup.Wait()
+	for _, err := range warmupErrors {
+		if err != nil {
+			return result{}, err
+		}
+	}
+
+	var (
+		issued    atomic.Int64
+		failed    atomic.Int64
+		wg        sync.WaitGroup
+		mutex     sync.Mutex
+		latencies = make([]time.Duration, 0, opts.requests)
+		firstErr  error
+	)
+	start := time.Now()
+	for range opts.clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var local []time.Duration
+			defer func() {
+				mutex.Lock()
+				latencies = append(latencies, local...)
+				mutex.Unlock()
+			}()
+			pipeline := client.Pipeline()
+			for {
+				claimed := issued.Add(int64(opts.pipeline))
+				n := min(int64(opts.pipeline), int64(opts.requests)-(claimed-int64(opts.pipeline)))
+				if n <= 0 {
+					return
+				}
+				for range n {
+					pipeline.Do(expand(template, opts.keyspace)...)
+				}
+				sent := time.Now()
+				replies, err := pipeline.Exec(ctx)
+				if err != nil {
+					mutex.Lock()
+					firstErr = err
+					mutex.Unlock()
+					return
+				}
+				latency := time.Since(sent)
+				for _, reply := range replies {
+					if _, ok := reply.(redisclient.Error); ok {
+						failed.Add(1)
+					}
+					local = append(local, latency)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	if firstErr != nil {
+		return result{}, firstErr
+	}
+	slices.Sort(latencies)
+	return result{elapsed: elapsed, latencies: latencies, errors: failed.Load()}, nil
+}
+
+// expand replaces the random placeholder in the arguments of a command
+func expand(template []string, keyspace int) []string {
+	args := make([]string, len(template))
+	for i, arg := range template {
+		if strings.Contains(arg, randPlaceholder) {
+			n := 0
+			if keyspace > 0 {
+				n = rand.IntN(keyspace)
+			}
+			arg = strings.ReplaceAll(arg, randPlaceholder, fmt.Sprintf("%012d", n))
+		}
+		args[i] = arg
+	}
+	return args
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// reportPercentiles are the percentiles of the latency distribution printed for
+// every test
+var reportPercentiles = []float64{0, 50, 75, 90, 95, 99, 99.9, 100}
+
+// reporter prints the result of every test
+type reporter interface {
+	report(name string, r result)
+}
+
+// rps returns the throughput of a test in requests per second
+func (r result) rps() float64 {
+	return float64(len(r.latencies)) / r.elapsed.Seconds()
+}
+
+// percentile returns the latency under which p percent of the requests completed
+func (r result) percentile(p float64) time.Duration {
+	i := int(p / 100 * float64(len(r.latencies)-1))
+	return r.latencies[i]
+}
+
+// average returns the mean latency
+func (r result) average() time.Duration {
+	var sum time.Duration
+	for _, latency := range r.latencies {
+		sum += latency
+	}
+	return sum / time.Duration(len(r.latencies))
+}
+
+// msec formats a latency in milliseconds, as redis-benchmark does
+func msec(d time.Duration) string {
+	return fmt.Sprintf("%.3f", float64(d)/float64(time.Millisecond))
+}
+
+// fullReporter prints the settings, the latency distribution and a summary
+type fullReporter struct {
+	opts options
+}
+
+func (f *fullReporter) report(name string, r result) {
+	fmt.Printf("====== %s ======\n", name)
+	fmt.Printf("  %d requests completed in %.2f seconds\n", len(r.latencies), r.elapsed.Seconds())
+	fmt.Printf("  %d parallel clients\n", f.opts.clients)
+	fmt.Printf("  %d bytes payload\n", f.opts.dataSize)
+	fmt.Printf("  %d requests per pipeline\n", f.opts.pipeline)
+	if r.errors > 0 {
+		fmt.Printf("  %d error replies\n", r.errors)
+	}
+	fmt.Println()
+	fmt.Println("Latency by percentile distribution:")
+	for _, p := range reportPercentiles {
+		fmt.Printf("%.3f%% <= %s milliseconds\n", p, msec(r.percentile(p)))
+	}
+	fmt.Println()
+	fmt.Println("Summary:")
+	fmt.Printf("  throughput summary: %.2f requests per second\n", r.rps())
+	fmt.Println("  latency summary (msec):")
+	fmt.Printf("  %9s %9s %9s %9s %9s %9s\n", "avg", "min", "p50", "p95", "p99", "max")
+	fmt.Printf("  %9s %9s %9s %9s %9s %9s\n\n", msec(r.average()), msec(r.percentile(0)), msec(r.percentile(50)),
+		msec(r.percentile(95)), msec(r.percentile(99)), msec(r.percentile(100)))
+}
+
+// quietReporter prints a line per test
+type quietReporter struct{}
+
+func (quietReporter) report(name string, r result) {
+	line := fmt.Sprintf("%s: %.2f requests per second, p50=%s msec", name, r.rps(), msec(r.percentile(50)))
+	if r.errors > 0 {
+		line += fmt.Sprintf(", %d error replies", r.errors)
+	}
+	fmt.Println(line)
+}
+
+// csvReporter prints a CSV row per test, after a header
+type csvReporter struct {
+	headerDone bool
+}
+
+func (c *csvReporter) report(name string, r result) {
+	if !c.headerDone {
+		fmt.Println(`"test","rps","avg_latency_ms","min_latency_ms","p50_latency_ms","p95_latency_ms","p99_latency_ms","max_latency_ms","errors"`)
+		c.headerDone = true
+	}
+	fmt.Printf("%q,\"%.2f\",\"%s\",\"%s\",\"%s\",\"%s\",\"%s\",\"%s\",\"%d\"\n", name, r.rps(), msec(r.average()),
+		msec(r.percentile(0)), msec(r.percentile(50)), msec(r.percentile(95)), msec(r.percentile(99)),
+		msec(r.percentile(100)), r.errors)
+}
@@ -0,0 +1,301 @@
+// Command checkaof validates an append-only file, in the manner of redis-check-aof:
+// it checks that the file is a sequence of complete RESP commands, with every MULTI
+// closed by an EXEC, and reports the offset up to which it is sound. With --fix it
+// truncates the file there, dropping the command cut short by a crash. A file with
+// an RDB preamble, as Redis writes with aof-use-rdb-preamble, has the preamble
+// checked too, although it can't be repaired.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/server"
+)
+
+// maxNameLength bounds the command names read, longer arguments being skipped
+const maxNameLength = 64
+
+func main() {
+	flags := flag.NewFlagSet("checkaof", flag.ExitOnError)
+	fix := flags.Bool("fix", false, "truncate the file to its last valid command, after confirmation")
+	yes := flags.Bool("yes", false, "don't ask for confirmation before fixing")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: checkaof [--fix [--yes]] appendonly.aof")
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	path := flags.Arg(0)
+
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	result, err := check(file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	size := info.Size()
+	fmt.Printf("AOF analyzed: filename=%s, size=%d, ok_up_to=%d, ok_up_to_line=%d, diff=%d\n",
+		path, size, result.okUpTo, result.okUpToLine, size-result.okUpTo)
+	if result.problem == "" {
+		fmt.Printf("AOF %s is valid\n", path)
+		return
+	}
+	fmt.Printf("0x%x: %s\n", result.problemAt, result.problem)
+	if !*fix {
+		fmt.Printf("AOF %s is not valid. Use the --fix option to try fixing it.\n", path)
+		os.Exit(1)
+	}
+	if result.okUpTo < result.rdbSize {
+		fmt.Printf("The RDB preamble of %s is corrupted and can't be fixed.\n", path)
+		os.Exit(1)
+	}
+
+	if !*yes {
+		fmt.Printf("This will shrink the AOF %s from %d bytes, with %d bytes, to %d bytes\nContinue? [y/N]: ",
+			path, size, size-result.okUpTo, result.okUpTo)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+			fmt.Println("Aborting...")
+			os.Exit(1)
+		}
+	}
+	if err := os.Truncate(path, result.okUpTo); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to truncate AOF %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Successfully truncated AOF %s\n", path)
+}
+
+// result is the outcome of checking a file
+type result struct {
+	rdbSize    int64 // of the RDB preamble, 0 without one
+	okUpTo     int64 // offset after the last valid command outside a transaction
+	okUpToLine int   // line number at okUpTo
+	problem    string
+	problemAt  int64
+}
+
+// check reads the commands of an AOF up to the end or the first problem
+func check(file *os.File) (result, error) {
+	var res result
+	in := bufio.NewReader(file)
+	if signature, err := in.Peek(5); err == nil && string(signature) == "REDIS" {
+		size, err := checkPreamble(file)
+		if err != nil {
+			res.problem = "RDB preamble is not valid: " + err.Error()
+			return res, nil
+		}
+		if _, err := file.Seek(size, io.SeekStart); err != nil {
+			return res, err
+		}
+		in.Reset(file)
+		res.rdbSize, res.okUpTo = size, size
+	}
+
+	s := &scanner{in: in, offset: res.okUpTo}
+	inMulti := false
+	for {
+		name, err := s.command()
+		if errors.Is(err, io.EOF) && !inMulti {
+			return res, nil
+		}
+		if err != nil {
+			res.problem, res.problemAt = describe(err), s.offset
+			if errors.Is(err, io.EOF) && inMulti {
+				res.problem = "Reached EOF before reading EXEC for MULTI"
+			}
+			return res, nil
+		}
+
+		switch name = strings.ToUpper(name); {
+		case name == "MULTI" && inMulti:
+			res.problem, res.problemAt = "Unexpected MULTI", s.offset
+			return res, nil
+		case name == "MULTI":
+			inMulti = true
+		case name == "EXEC" && !inMulti:
+			res.problem, res.problemAt = "Unexpected EXEC", s.offset
+			return res, nil
+		case name == "EXEC":
+			inMulti = false
+		}
+		// A transaction is only applied whole, so it is only sound once EXEC is read
+		if !inMulti {
+			res.okUpTo, res.okUpToLine = s.offset, s.line
+		}
+	}
+}
+
+// checkPreamble reads the RDB preamble of file, returning its size
+func checkPreamble(file *os.File) (int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	reader, err := server.NewRDBReader(file)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		if _, err := reader.Next(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return reader.Offset(), nil
+			}
+			return 0, err
+		}
+	}
+}
+
+// describe turns a read error into a problem report
+func describe(err error) string {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return "Unexpected EOF reading the last command"
+	}
+	return err.Error()
+}
+
+// scanner reads the commands of an AOF, strictly in RESP: an array of bulk strings
+// each. Lines starting with '#', the annotations Redis adds, are skipped.
+type scanner struct {
+	in     *bufio.Reader
+	offset int64 // after the last complete command
+	line   int   // lines read up to offset
+
+	read  int64 // bytes read in the command being scanned
+	lines int
+}
+
+// command reads the next command, returning its name. It returns io.EOF at the end
+// of the file, and another error for a truncated or malformed command. Arguments are
+// skipped rather than read, so that a corrupted length can't exhaust memory.
+func (s *scanner) command() (string, error) {
+	s.read, s.lines = 0, 0
+	header, err := s.readLine()
+	for err == nil && strings.HasPrefix(header, "#") {
+		s.commit()
+		header, err = s.readLine()
+	}
+	if err != nil {
+		if errors.Is(err, io.EOF) && s.read == 0 {
+			return "", io.EOF
+		}
+		return "", io.ErrUnexpectedEOF
+	}
+
+	count, err := s.prefixed(header, '*')
+	if err != nil {
+		return "", err
+	}
+	if count < 1 {
+		return "", fmt.Errorf("Invalid argument count %d", count)
+	}
+	var name string
+	for i := range count {
+		line, err := s.readLine()
+		if err != nil {
+			return "", io.ErrUnexpectedEOF
+		}
+		length, err := s.prefixed(line, '$')
+		if err != nil {
+			return "", err
+		}
+		if length < 0 {
+			return "", fmt.Errorf("Invalid bulk length %d", length)
+		}
+		payload, err := s.skip(length)
+		if err != nil {
+			return "", err
+		}
+		if i == 0 {
+			name = payload
+		}
+	}
+	s.commit()
+	return name, nil
+}
+
+// skip reads the payload of a bulk string and its CRLF, returning the payload when it
+// is short enough to be a command name
+func (s *scanner) skip(length int) (string, error) {
+	var payload string
+	for remaining := length; remaining > 0; {
+		chunk, err := s.in.Peek(min(remaining, s.in.Size()))
+		if err != nil {
+			return "", io.ErrUnexpectedEOF
+		}
+		if length <= maxNameLength {
+			payload = string(chunk)
+		}
+		s.lines += bytes.Count(chunk, []byte{'\n'})
+		s.in.Discard(len(chunk))
+		s.read += int64(len(chunk))
+		remaining -= len(chunk)
+	}
+
+	var crlf [2]byte
+	n, err := io.ReadFull(s.in, crlf[:])
+	s.read += int64(n)
+	if err != nil {
+		return "", io.ErrUnexpectedEOF
+	}
+	if crlf != [2]byte{'\r', '\n'} {
+		return "", errors.New("Bulk string isn't terminated by CRLF")
+	}
+	s.lines++
+	return payload, nil
+}
+
+// commit accounts for the bytes and lines of what was read last
+func (s *scanner) commit() {
+	s.offset += s.read
+	s.line += s.lines
+	s.read, s.lines = 0, 0
+}
+
+// readLine reads a line, without its CRLF
+func (s *scanner) readLine() (string, error) {
+	line, err := s.in.ReadString('\n')
+	s.read += int64(len(line))
+	if err != nil {
+		return "", err
+	}
+	s.lines++
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// prefixed parses a "*<count>" or "$<length>" line
+func (s *scanner) prefixed(line string, prefix byte) (int, error) {
+	if line == "" || line[0] != prefix {
+		got := "EOF"
+		if line != "" {
+			got = strconv.Quote(line[:1])
+		}
+		return 0, fmt.Errorf("Expected prefix '%c', got: %s", prefix, got)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return 0, fmt.Errorf("Invalid number %q", line[1:])
+	}
+	return n, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// formatReply renders a reply as redis-cli does: with its type and quoted strings for
+// a person at a terminal, or raw, one value per line, for scripts
+func formatReply(v resp.Value, raw bool) string {
+	if raw {
+		return formatRaw(v)
+	}
+	return formatTyped(v)
+}
+
+// formatTyped renders a reply with its type, aggregates as numbered lists
+func formatTyped(v resp.Value) string {
+	switch v.Type {
+	case resp.SimpleString:
+		return v.Str
+	case resp.Error:
+		return "(error) " + v.Str
+	case resp.Integer:
+		return fmt.Sprintf("(integer) %d", v.Num)
+	case resp.BulkString:
+		if v.IsNull {
+			return "(nil)"
+		}
+		return quote(v.Bulk)
+	case resp.Null:
+		return "(nil)"
+	case resp.Boolean:
+		if v.Num != 0 {
+			return "(true)"
+		}
+		return "(false)"
+	case resp.Double:
+		return "(double) " + strconv.FormatFloat(v.Float, 'g', -1, 64)
+	case resp.BigNumber:
+		return "(big number) " + v.Str
+	case resp.VerbatimString:
+		return v.Bulk
+	case resp.Array, resp.Push:
+		return formatList(v, ")", "(empty array)")
+	case resp.Set:
+		return formatList(v, "~", "(empty set)")
+	case resp.Map:
+		return formatMap(v)
+	}
+	return fmt.Sprintf("(unknown reply type %q)", byte(v.Type))
+}
+
+// formatList numbers the elements of an aggregate, indenting the lines of nested ones
+// under their first
+func formatList(v resp.Value, marker, empty string) string {
+	if v.IsNull {
+		return "(nil)"
+	}
+	if len(v.Array) == 0 {
+		return empty
+	}
+	width := len(strconv.Itoa(len(v.Array)))
+	var b strings.Builder
+	for i, elem := range v.Array {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		prefix := fmt.Sprintf("%*d%s ", width, i+1, marker)
+		b.WriteString(prefix)
+		b.WriteString(indent(formatTyped(elem), len(prefix)))
+	}
+	return b.String()
+}
+
+// formatMap numbers the entries of a map as key => value
+func formatMap(v resp.Value) string {
+	if len(v.Array) == 0 {
+		return "(empty hash)"
+	}
+	pairs := len(v.Array) / 2
+	width := len(strconv.Itoa(pairs))
+	var b strings.Builder
+	for i := range pairs {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		prefix := fmt.Sprintf("%*d# %s => ", width, i+1, formatTyped(v.Array[2*i]))
+		b.WriteString(prefix)
+		b.WriteString(indent(formatTyped(v.Array[2*i+1]), len(prefix)))
+	}
+	return b.String()
+}
+
+// indent indents the lines of s after the first by n spaces
+func indent(s string, n int) string {
+	return strings.ReplaceAll(s, "\n", "\n"+strings.Repeat(" ", n))
+}
+
+// formatRaw renders a reply as its bare values, the elements of aggregates on
+// separate lines
+func formatRaw(v resp.Value) string {
+	switch v.Type {
+	case resp.SimpleString, resp.Error, resp.BigNumber:
+		return v.Str
+	case resp.Integer, resp.Boolean:
+		return strconv.Itoa(v.Num)
+	case resp.BulkString, resp.VerbatimString:
+		return v.Bulk
+	case resp.Double:
+		return strconv.FormatFloat(v.Float, 'g', -1, 64)
+	case resp.Array, resp.Push, resp.Set, resp.Map:
+		elems := make([]string, len(v.Array))
+		for i, elem := range v.Array {
+			elems[i] = formatRaw(elem)
+		}
+		return strings.Join(elems, "\n")
+	}
+	return ""
+}
+
+// quote quotes a string as redis-cli does, escaping quotes, backslashes and bytes
+// outside printable ASCII
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			if c >= 0x20 && c < 0x7f {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
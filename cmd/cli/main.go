@@ -0,0 +1,222 @@
+// Command cli is a command line client for the server, in the manner of redis-cli. It
+// runs the command given as arguments, or one command per line of stdin, or prompts
+// for commands with line editing and history when stdin is a terminal. With --pipe it
+// sends the commands read from stdin, in RESP or inline, as a mass insertion.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/redisclient"
+	"github.com/codecrafters-io/redis-starter-go/resp"
+	"golang.org/x/term"
+)
+
+// pipeBatch is the number of commands --pipe sends before reading their replies
+const pipeBatch = 1000
+
+func main() {
+	flags := flag.NewFlagSet("cli", flag.ExitOnError)
+	host := flags.String("h", "127.0.0.1", "server hostname")
+	port := flags.Int("p", 6379, "server port")
+	password := flags.String("a", "", "password to authenticate with")
+	user := flags.String("user", "", "username to authenticate with, default when empty")
+	resp3 := flags.Bool("3", false, "use RESP3")
+	raw := flags.Bool("raw", false, "print replies raw, the default when stdout isn't a terminal")
+	noRaw := flags.Bool("no-raw", false, "print replies formatted even when stdout isn't a terminal")
+	pipe := flags.Bool("pipe", false, "send the commands read from stdin, in RESP or inline, and report the errors")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: cli [options] [command [arg ...]]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	protocol := resp.RESP2
+	if *resp3 {
+		protocol = resp.RESP3
+	}
+	addr := net.JoinHostPort(*host, strconv.Itoa(*port))
+	client, err := redisclient.New(redisclient.Options{
+		Addr:     addr,
+		Username: *user,
+		Password: *password,
+		Protocol: protocol,
+		PoolSize: 1,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	cli := &cli{
+		client: client,
+		addr:   addr,
+		raw:    *raw || (!*noRaw && !term.IsTerminal(int(os.Stdout.Fd()))),
+	}
+	switch {
+	case *pipe:
+		err = cli.pipe(os.Stdin, os.Stdout)
+	case flags.NArg() > 0:
+		err = cli.run(flags.Args(), os.Stdout)
+	case term.IsTerminal(int(os.Stdin.Fd())):
+		err = cli.repl()
+	default:
+		err = cli.runLines(os.Stdin, os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// cli runs commands on a single connection and prints their replies
+type cli struct {
+	client *redisclient.Client
+	addr   string
+	raw    bool
+}
+
+// run runs a command and prints its reply. Only failing to reach the server is an
+// error; error replies are printed like any other.
+func (c *cli) run(args []string, out io.Writer) error {
+	switch strings.ToUpper(args[0]) {
+	case "SUBSCRIBE", "PSUBSCRIBE":
+		return c.subscribe(args, out)
+	}
+	reply, err := c.client.DoReply(context.Background(), args...)
+	if err != nil {
+		return fmt.Errorf("could not connect to %s: %w", c.addr, err)
+	}
+	fmt.Fprintln(out, formatReply(reply, c.raw))
+	return nil
+}
+
+// runLines runs the command on every line of in
+func (c *cli) runLines(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, resp.DefaultMaxBulkLen)
+	for scanner.Scan() {
+		args, err := resp.SplitArgs(scanner.Text())
+		if err != nil {
+			fmt.Fprintln(out, "Invalid argument(s)")
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if err := c.run(args, out); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// subscribe prints the messages published to the channels or patterns of a SUBSCRIBE
+// or PSUBSCRIBE command until interrupted
+func (c *cli) subscribe(args []string, out io.Writer) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var ps *redisclient.PubSub
+	var err error
+	if strings.EqualFold(args[0], "PSUBSCRIBE") {
+		ps, err = c.client.PSubscribe(ctx, args[1:]...)
+	} else {
+		ps, err = c.client.Subscribe(ctx, args[1:]...)
+	}
+	if err != nil {
+		return fmt.Errorf("could not subscribe at %s: %w", c.addr, err)
+	}
+	defer ps.Close()
+
+	fmt.Fprintln(out, "Reading messages... (press Ctrl-C to quit)")
+	for {
+		message, err := ps.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				fmt.Fprintln(out) // past the ^C
+				return nil
+			}
+			return err
+		}
+		fmt.Fprintln(out, formatReply(messageReply(message), c.raw))
+	}
+}
+
+// messageReply turns a message back into the push the server sent
+func messageReply(message redisclient.Message) resp.Value {
+	parts := []string{"message", message.Channel, message.Payload}
+	if message.Pattern != "" {
+		parts = []string{"pmessage", message.Pattern, message.Channel, message.Payload}
+	}
+	reply := resp.Value{Type: resp.Array, Array: make([]resp.Value, len(parts))}
+	for i, part := range parts {
+		reply.Array[i] = resp.Value{Type: resp.BulkString, Bulk: part}
+	}
+	return reply
+}
+
+// pipe sends the commands read from in, RESP or inline, in batches of pipeBatch, and
+// prints the error replies and a summary. It fails when any command did.
+func (c *cli) pipe(in io.Reader, out io.Writer) error {
+	parser := resp.NewParser(bufio.NewReader(in))
+	pipeline := c.client.Pipeline()
+	var errorCount, replies int
+	flush := func() error {
+		results, err := pipeline.Exec(context.Background())
+		if err != nil {
+			return fmt.Errorf("could not connect to %s: %w", c.addr, err)
+		}
+		for _, result := range results {
+			if replyErr, ok := result.(redisclient.Error); ok {
+				fmt.Fprintln(out, replyErr.Error())
+				errorCount++
+			}
+		}
+		replies += len(results)
+		return nil
+	}
+
+	for {
+		command, err := parser.Parse()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid input: %w", err)
+		}
+		if len(command.Array) == 0 {
+			continue
+		}
+		args := make([]string, len(command.Array))
+		for i, arg := range command.Array {
+			args[i] = arg.Bulk
+		}
+		pipeline.Do(args...)
+		if pipeline.Len() == pipeBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "errors: %d, replies: %d\n", errorCount, replies)
+	if errorCount > 0 {
+		return errors.New("some commands failed")
+	}
+	return nil
+}
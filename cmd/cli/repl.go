@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+	"golang.org/x/term"
+)
+
+// historyMax bounds the lines kept in the history
+const historyMax = 1000
+
+// repl prompts for commands until quit, exit, Ctrl-C or Ctrl-D, with line editing and
+// the history of previous sessions
+func (c *cli) repl() error {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, c.addr+"> ")
+	if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+		terminal.SetSize(width, height)
+	}
+	history := loadHistory(historyPath())
+	defer history.Close()
+	terminal.History = history
+
+	for {
+		line, err := terminal.ReadLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		args, err := resp.SplitArgs(line)
+		if err != nil {
+			fmt.Fprintln(terminal, "Invalid argument(s)")
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		switch strings.ToLower(args[0]) {
+		case "quit", "exit":
+			return nil
+		case "clear":
+			fmt.Fprint(terminal, "\x1b[H\x1b[2J")
+			continue
+		case "subscribe", "psubscribe":
+			// Cooked mode meanwhile, for Ctrl-C to interrupt
+			term.Restore(fd, state)
+			err = c.subscribe(args, os.Stdout)
+			if _, rawErr := term.MakeRaw(fd); rawErr != nil {
+				return rawErr
+			}
+		default:
+			err = c.run(args, terminal)
+		}
+		if err != nil {
+			fmt.Fprintln(terminal, err)
+		}
+	}
+}
+
+// historyPath is the file keeping the history, ~/.rediscli_history as for redis-cli
+// unless REDISCLI_HISTFILE says otherwise
+func historyPath() string {
+	if path, ok := os.LookupEnv("REDISCLI_HISTFILE"); ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".rediscli_history")
+}
+
+// history keeps the lines entered at the prompt for the terminal, appending them to a
+// file for the next session. Lines holding passwords are left out.
+type history struct {
+	lines []string // oldest first
+	file  *os.File // nil when the history isn't saved
+}
+
+// loadHistory reads the history kept in path, which is then extended as lines are
+// entered; an empty path or an unreadable file starts an unsaved history
+func loadHistory(path string) *history {
+	h := &history{}
+	if path == "" {
+		return h
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return h
+	}
+	h.file = file
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		h.lines = append(h.lines, scanner.Text())
+	}
+	if len(h.lines) > historyMax {
+		h.lines = h.lines[len(h.lines)-historyMax:]
+	}
+	return h
+}
+
+func (h *history) Add(line string) {
+	if len(h.lines) > 0 && h.lines[len(h.lines)-1] == line {
+		return
+	}
+	if fields := strings.Fields(line); len(fields) > 0 && (strings.EqualFold(fields[0], "AUTH") || strings.EqualFold(fields[0], "HELLO")) {
+		return
+	}
+	h.lines = append(h.lines, line)
+	if len(h.lines) > historyMax {
+		h.lines = h.lines[1:]
+	}
+	if h.file != nil {
+		fmt.Fprintln(h.file, line)
+	}
+}
+
+func (h *history) Len() int {
+	return len(h.lines)
+}
+
+func (h *history) At(idx int) string {
+	return h.lines[len(h.lines)-1-idx]
+}
+
+// Close closes the history file
+func (h *history) Close() error {
+	if h.file == nil {
+		return nil
+	}
+	return h.file.Close()
+}
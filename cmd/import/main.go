@@ -0,0 +1,223 @@
+// Command import copies the keys of a live Redis into this server, for migrating
+// without a shared snapshot file: it SCANs the source, DUMPs every key along with its
+// remaining TTL and RESTOREs it into the target, with -c batches in flight. Keys that
+// already exist on the target are left alone unless -replace is given. Keys of types
+// the target doesn't support are reported as failures, grouped by error.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/redisclient"
+)
+
+func main() {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	from := flags.String("from", "", "host:port of the source Redis")
+	fromUser := flags.String("from-user", "", "username to authenticate with on the source, default when empty")
+	fromPassword := flags.String("from-password", "", "password to authenticate with on the source")
+	to := flags.String("to", "127.0.0.1:6379", "host:port of the target server")
+	toUser := flags.String("to-user", "", "username to authenticate with on the target, default when empty")
+	toPassword := flags.String("to-password", "", "password to authenticate with on the target")
+	match := flags.String("match", "", "only import the keys matching this glob-style pattern")
+	count := flags.Int("count", 1000, "number of keys asked of every SCAN, and imported per batch")
+	concurrency := flags.Int("c", 8, "number of batches imported in parallel")
+	replace := flags.Bool("replace", false, "overwrite the keys that already exist on the target")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: import -from host:port [options]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+	if *from == "" || flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *count < 1 || *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "-count and -c must be positive")
+		os.Exit(1)
+	}
+
+	source, err := redisclient.New(redisclient.Options{
+		Addr:       *from,
+		Username:   *fromUser,
+		Password:   *fromPassword,
+		ClientName: "import",
+		PoolSize:   *concurrency + 1,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer source.Close()
+	target, err := redisclient.New(redisclient.Options{
+		Addr:       *to,
+		Username:   *toUser,
+		Password:   *toPassword,
+		ClientName: "import",
+		PoolSize:   *concurrency,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer target.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	im := &importer{source: source, target: target, replace: *replace, failures: make(map[string]int)}
+	start := time.Now()
+	err = im.run(ctx, *match, *count, *concurrency)
+
+	fmt.Printf("%d keys imported, %d already existed, %d failed, in %s\n",
+		im.imported.Load(), im.existing.Load(), im.failed.Load(), time.Since(start).Round(time.Millisecond))
+	for _, msg := range slices.Sorted(maps.Keys(im.failures)) {
+		fmt.Fprintf(os.Stderr, "%d keys: %s\n", im.failures[msg], msg)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if im.failed.Load() > 0 {
+		os.Exit(1)
+	}
+}
+
+// importer copies keys from source to target, counting the outcomes
+type importer struct {
+	source, target *redisclient.Client
+	replace        bool
+
+	imported, existing, failed atomic.Int64
+
+	mutex    sync.Mutex
+	failures map[string]int // keys failed by error message
+}
+
+// run scans the source for the keys matching pattern, count at a time, and imports
+// every batch as it comes, concurrency of them at once. It stops at the first I/O
+// error on either side.
+func (im *importer) run(ctx context.Context, pattern string, count, concurrency int) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	batches := make(chan []string, concurrency)
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for keys := range batches {
+				if err := im.batch(ctx, keys); err != nil {
+					cancel(err)
+				}
+			}
+		}()
+	}
+
+	var cursor uint64
+	for {
+		keys, next, err := im.source.Scan(ctx, cursor, pattern, count)
+		if err != nil {
+			cancel(fmt.Errorf("scanning the source: %w", err))
+			break
+		}
+		if len(keys) > 0 {
+			select {
+			case batches <- keys:
+			case <-ctx.Done():
+			}
+		}
+		if cursor = next; cursor == 0 || ctx.Err() != nil {
+			break
+		}
+	}
+	close(batches)
+	wg.Wait()
+	return context.Cause(ctx)
+}
+
+// batch imports keys: their TTLs and payloads are read from the source in a pipeline,
+// then restored into the target in another
+func (im *importer) batch(ctx context.Context, keys []string) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	dumps := im.source.Pipeline()
+	for _, key := range keys {
+		dumps.Do("PTTL", key)
+		dumps.Do("DUMP", key)
+	}
+	replies, err := dumps.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("reading from the source: %w", err)
+	}
+
+	restores := im.target.Pipeline()
+	for i, key := range keys {
+		ttlReply, dumpReply := replies[2*i], replies[2*i+1]
+		if replyErr, ok := ttlReply.(redisclient.Error); ok {
+			im.fail(replyErr)
+			continue
+		}
+		if replyErr, ok := dumpReply.(redisclient.Error); ok {
+			im.fail(replyErr)
+			continue
+		}
+		payload, ok := dumpReply.(string)
+		ttl, _ := ttlReply.(int64)
+		// A key deleted or expired since it was scanned is skipped
+		if !ok || ttl == -2 {
+			continue
+		}
+		switch {
+		case ttl == -1:
+			ttl = 0
+		case ttl <= 0:
+			// About to expire, which 0 would mean never
+			ttl = 1
+		}
+		args := []string{"RESTORE", key, strconv.FormatInt(ttl, 10), payload}
+		if im.replace {
+			args = append(args, "REPLACE")
+		}
+		restores.Do(args...)
+	}
+	if restores.Len() == 0 {
+		return nil
+	}
+	replies, err = restores.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("writing to the target: %w", err)
+	}
+	for _, reply := range replies {
+		replyErr, isErr := reply.(redisclient.Error)
+		switch {
+		case !isErr:
+			im.imported.Add(1)
+		case strings.HasPrefix(string(replyErr), "BUSYKEY"):
+			im.existing.Add(1)
+		default:
+			im.fail(replyErr)
+		}
+	}
+	return nil
+}
+
+// fail records a key that couldn't be imported
+func (im *importer) fail(err redisclient.Error) {
+	im.failed.Add(1)
+	im.mutex.Lock()
+	im.failures[string(err)]++
+	im.mutex.Unlock()
+}
@@ -0,0 +1,205 @@
+// Command rdb inspects an RDB file, for verifying backups and debugging persistence:
+// it lists every key with its database, type, encoding, expiry and size, followed by
+// a summary, or converts the file to JSON with --json. The checksum is verified, and
+// the keys read before a corrupted record are still reported.
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/glob"
+	"github.com/codecrafters-io/redis-starter-go/internal/server"
+)
+
+func main() {
+	flags := flag.NewFlagSet("rdb", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the version, keys with their values and auxiliary fields as JSON")
+	match := flags.String("match", "", "only report the keys matching this glob-style pattern")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: rdb [options] dump.rdb")
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer file.Close()
+	reader, err := server.NewRDBReader(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	var p printer = newTextPrinter(out, reader)
+	if *asJSON {
+		p = &jsonPrinter{out: out, reader: reader}
+	}
+	err = inspect(reader, *match, p)
+	out.Flush()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// printer reports the keys of a file as they are read
+type printer interface {
+	key(entry server.SnapshotEntry) error
+	// end is called once every key was read, whether the file is sound or not
+	end() error
+}
+
+// inspect reads every key of the file, reporting those matching pattern
+func inspect(reader *server.RDBReader, pattern string, p printer) error {
+	for n := 0; ; n++ {
+		entry, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return p.end()
+		}
+		if err != nil {
+			p.end()
+			return fmt.Errorf("after %d keys: %w", n, err)
+		}
+		if pattern != "" {
+			if !glob.Match(pattern, entry.Key) {
+				continue
+			}
+		}
+		if err := p.key(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// textPrinter prints a table of the keys, then a summary
+type textPrinter struct {
+	out    *tabwriter.Writer
+	reader *server.RDBReader
+	now    int64
+
+	keys, expires, expired int
+	bytes                  int64
+}
+
+func newTextPrinter(w io.Writer, reader *server.RDBReader) *textPrinter {
+	out := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(out, "DB\tKEY\tTYPE\tENCODING\tTTL\tLENGTH\tSIZE")
+	return &textPrinter{out: out, reader: reader, now: time.Now().UnixMilli()}
+}
+
+func (t *textPrinter) key(entry server.SnapshotEntry) error {
+	ttl := "-"
+	if entry.ExpiresAt != 0 {
+		t.expires++
+		if remaining := entry.ExpiresAt - t.now; remaining > 0 {
+			ttl = (time.Duration(remaining) * time.Millisecond).String()
+		} else {
+			ttl = "expired"
+			t.expired++
+		}
+	}
+	t.keys++
+	t.bytes += t.reader.EntrySize
+	_, err := fmt.Fprintf(t.out, "%d\t%s\tstring\t%s\t%s\t%d\t%d\n", t.reader.DB, strconv.Quote(entry.Key),
+		t.reader.ValueEncoding, ttl, len(entry.Value), t.reader.EntrySize)
+	return err
+}
+
+func (t *textPrinter) end() error {
+	if err := t.out.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(t.out, "\nRDB version %d, %d keys, %d with an expiry (%d already expired), %d bytes of records\n",
+		t.reader.Version, t.keys, t.expires, t.expired, t.bytes)
+	for _, key := range slices.Sorted(maps.Keys(t.reader.Aux)) {
+		fmt.Fprintf(t.out, "%s\t%s\n", key, t.reader.Aux[key])
+	}
+	return t.out.Flush()
+}
+
+// jsonKey is a key as converted to JSON. Keys and values that aren't valid UTF-8 are
+// given in base64 instead, under the _base64 names; empty ones are left out.
+type jsonKey struct {
+	DB          int    `json:"db"`
+	Key         string `json:"key,omitempty"`
+	KeyBase64   string `json:"key_base64,omitempty"`
+	Type        string `json:"type"`
+	Encoding    string `json:"encoding"`
+	ExpiresAt   int64  `json:"expires_at,omitempty"`
+	Size        int64  `json:"size"`
+	Value       string `json:"value,omitempty"`
+	ValueBase64 string `json:"value_base64,omitempty"`
+}
+
+// jsonPrinter streams the file as a JSON object, the keys in the order of the file
+type jsonPrinter struct {
+	out    io.Writer
+	reader *server.RDBReader
+	count  int
+}
+
+func (j *jsonPrinter) key(entry server.SnapshotEntry) error {
+	if j.count == 0 {
+		fmt.Fprintf(j.out, "{\"version\":%d,\"keys\":[\n", j.reader.Version)
+	} else {
+		fmt.Fprint(j.out, ",\n")
+	}
+	j.count++
+
+	key := jsonKey{
+		DB:        j.reader.DB,
+		Type:      "string",
+		Encoding:  j.reader.ValueEncoding,
+		ExpiresAt: entry.ExpiresAt,
+		Size:      j.reader.EntrySize,
+	}
+	if utf8.ValidString(entry.Key) {
+		key.Key = entry.Key
+	} else {
+		key.KeyBase64 = base64.StdEncoding.EncodeToString([]byte(entry.Key))
+	}
+	if utf8.ValidString(entry.Value) {
+		key.Value = entry.Value
+	} else {
+		key.ValueBase64 = base64.StdEncoding.EncodeToString([]byte(entry.Value))
+	}
+	line, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	_, err = j.out.Write(line)
+	return err
+}
+
+func (j *jsonPrinter) end() error {
+	if j.count == 0 {
+		fmt.Fprintf(j.out, "{\"version\":%d,\"keys\":[", j.reader.Version)
+	}
+	aux, err := json.Marshal(j.reader.Aux)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(j.out, "\n],\"aux\":%s}\n", aux)
+	return err
+}
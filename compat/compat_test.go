@@ -0,0 +1,209 @@
+// Package compat_test runs the command scripts in testdata against this server and a
+// real Redis, failing on every reply that differs. The real Redis is the one at
+// REDIS_COMPAT_ADDR, or else a redis-server started from the PATH; the tests are
+// skipped when there is neither.
+//
+// Scripts hold a command per line, quoted as with redis-cli, and "#" comments. Every
+// script runs on a new connection after a FLUSHALL. A command can be prefixed by a
+// relaxation for replies that legitimately differ:
+//
+//	?type    only the RESP types of the replies must match, e.g. for timings or ids
+//	?error   both replies must be errors, whatever their message
+//	?sorted  aggregates must hold the same elements in any order, e.g. for KEYS
+package compat_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/redisserver"
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+func TestCompatibility(t *testing.T) {
+	redisAddr := realRedis(t)
+	srv, err := redisserver.New(redisserver.Options{Logger: slog.New(slog.DiscardHandler)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Shutdown(context.Background())
+
+	scripts, err := filepath.Glob(filepath.Join("testdata", "*.redis"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, script := range scripts {
+		t.Run(strings.TrimSuffix(filepath.Base(script), ".redis"), func(t *testing.T) {
+			runScript(t, script, dial(t, redisAddr), dial(t, srv.Addr()))
+		})
+	}
+}
+
+// realRedis returns the address of the Redis to compare with, skipping the test
+// when there is none
+func realRedis(t *testing.T) string {
+	if addr := os.Getenv("REDIS_COMPAT_ADDR"); addr != "" {
+		return addr
+	}
+	path, err := exec.LookPath("redis-server")
+	if err != nil {
+		t.Skip("no Redis to compare with: set REDIS_COMPAT_ADDR or install redis-server")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	_, port, _ := net.SplitHostPort(addr)
+	cmd := exec.Command(path, "--port", port, "--bind", "127.0.0.1", "--save", "", "--appendonly", "no", "--dir", t.TempDir())
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return addr
+		}
+	}
+	t.Fatalf("redis-server didn't start listening on %s", addr)
+	return ""
+}
+
+// conn is a raw connection, for replies to be compared exactly as sent
+type conn struct {
+	net.Conn
+	parser *resp.Parser
+}
+
+func dial(t *testing.T, addr string) *conn {
+	netConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { netConn.Close() })
+	c := &conn{Conn: netConn, parser: resp.NewParser(bufio.NewReader(netConn))}
+	if _, err := c.do([]string{"FLUSHALL"}); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// do sends a command and reads its reply
+func (c *conn) do(args []string) (resp.Value, error) {
+	request := fmt.Appendf(nil, "*%d\r\n", len(args))
+	for _, arg := range args {
+		request = resp.AppendBulkString(request, arg)
+	}
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Write(request); err != nil {
+		return resp.Value{}, err
+	}
+	return c.parser.Parse()
+}
+
+// runScript runs every command of a script on both servers, reporting the replies
+// that differ
+func runScript(t *testing.T, path string, redis, ours *conn) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		relaxation := ""
+		if strings.HasPrefix(line, "?") {
+			relaxation, line, _ = strings.Cut(line, " ")
+		}
+		args, err := resp.SplitArgs(line)
+		if err != nil || len(args) == 0 {
+			t.Fatalf("%s:%d: invalid command %q", path, i+1, line)
+		}
+
+		want, err := redis.do(args)
+		if err != nil {
+			t.Fatalf("%s:%d: %s: Redis: %v", path, i+1, line, err)
+		}
+		got, err := ours.do(args)
+		if err != nil {
+			t.Fatalf("%s:%d: %s: %v", path, i+1, line, err)
+		}
+		if !match(relaxation, want, got) {
+			t.Errorf("%s:%d: %s\n Redis: %s\n  ours: %s", path, i+1, line, encode(want), encode(got))
+		}
+	}
+}
+
+// match compares two replies under a relaxation
+func match(relaxation string, want, got resp.Value) bool {
+	switch relaxation {
+	case "?type":
+		return want.Type == got.Type && want.IsNull == got.IsNull
+	case "?error":
+		return want.Type == resp.Error && got.Type == resp.Error
+	case "?sorted":
+		return bytes.Equal(encodeSorted(want), encodeSorted(got))
+	case "":
+		return bytes.Equal(encodeBytes(want), encodeBytes(got))
+	}
+	panic("unknown relaxation " + relaxation)
+}
+
+// encodeBytes encodes a reply as RESP3, which represents every type
+func encodeBytes(v resp.Value) []byte {
+	encoded, err := resp.Encode(v, resp.RESP3)
+	if err != nil {
+		return []byte(err.Error())
+	}
+	return encoded
+}
+
+// encodeSorted encodes a reply with the elements of its aggregates sorted, the pairs
+// of a map kept together
+func encodeSorted(v resp.Value) []byte {
+	step := 1
+	if v.Type == resp.Map {
+		step = 2
+	}
+	var elems [][]byte
+	for i := 0; i+step <= len(v.Array); i += step {
+		var elem []byte
+		for _, part := range v.Array[i : i+step] {
+			elem = append(elem, encodeSorted(part)...)
+		}
+		elems = append(elems, elem)
+	}
+	if len(elems) == 0 {
+		return encodeBytes(v)
+	}
+	slices.SortFunc(elems, bytes.Compare)
+	return slices.Concat(append([][]byte{{byte(v.Type)}, []byte(strconv.Itoa(len(v.Array)))}, elems...)...)
+}
+
+// encode renders a reply for a failure message
+func encode(v resp.Value) string {
+	return strconv.Quote(string(encodeBytes(v)))
+}
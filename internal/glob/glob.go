@@ -0,0 +1,108 @@
+// Package glob matches names against the glob-style patterns of Redis, as used by
+// KEYS, SCAN MATCH, PSUBSCRIBE, ACL patterns and CONFIG GET.
+package glob
+
+// maxNesting bounds the recursion of patterns with many stars, as Redis does
+const maxNesting = 1000
+
+// Match reports whether name matches pattern, comparing bytes:
+//   - * matches any sequence, including an empty one
+//   - ? matches any single byte
+//   - [abc] matches one of the bytes listed, [^abc] one byte not listed, and [a-z]
+//     one in a range
+//   - \x matches x literally, inside brackets too
+//
+// Like in Redis, no pattern is malformed: an unterminated [ runs to the end of the
+// pattern, and a trailing \ matches itself.
+func Match(pattern, name string) bool {
+	skipLonger := false
+	return match(pattern, name, &skipLonger, 0)
+}
+
+// match is Match for the rest of a pattern. skipLonger is set once the pattern after
+// a star matched no rest of the name at all, which the stars before it can't change
+// by consuming more of it, so that patterns like a*a*a*b fail in linear time.
+func match(pattern, name string, skipLonger *bool, nesting int) bool {
+	if nesting > maxNesting {
+		return false
+	}
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if match(pattern[1:], name[i:], skipLonger, nesting+1) {
+					return true
+				}
+				if *skipLonger {
+					return false
+				}
+			}
+			*skipLonger = true
+			return false
+		case '?':
+			if len(name) == 0 {
+				return false
+			}
+			name = name[1:]
+		case '[':
+			if len(name) == 0 {
+				return false
+			}
+			var matched bool
+			if pattern, matched = matchClass(pattern[1:], name[0]); !matched {
+				return false
+			}
+			name = name[1:]
+			if len(pattern) == 0 {
+				// Unterminated, the class took the rest of the pattern
+				return len(name) == 0
+			}
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(name) == 0 || pattern[0] != name[0] {
+				return false
+			}
+			name = name[1:]
+		}
+		pattern = pattern[1:]
+	}
+	return len(name) == 0
+}
+
+// matchClass reports whether c matches the class starting after a [, and returns
+// the pattern from its closing ], or an empty one when there is none
+func matchClass(pattern string, c byte) (string, bool) {
+	negate := len(pattern) > 0 && pattern[0] == '^'
+	if negate {
+		pattern = pattern[1:]
+	}
+	matched := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			pattern = pattern[1:]
+			matched = matched || pattern[0] == c
+		case len(pattern) > 2 && pattern[1] == '-':
+			low, high := pattern[0], pattern[2]
+			if low > high {
+				low, high = high, low
+			}
+			matched = matched || (low <= c && c <= high)
+			pattern = pattern[2:]
+		default:
+			matched = matched || pattern[0] == c
+		}
+		pattern = pattern[1:]
+	}
+	return pattern, matched != negate
+}
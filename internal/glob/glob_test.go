@@ -0,0 +1,90 @@
+package glob
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, name string
+		want          bool
+	}{
+		// Literals and stars
+		{"", "", true},
+		{"", "a", false},
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"user:*", "user:42", true},
+		{"user:*", "session:42", false},
+		{"*:42", "user:42", true},
+		{"a*b*c", "aXXbYYc", true},
+		{"a*b*c", "aXXbYY", false},
+		{"a**b", "aXb", true},
+
+		// Single bytes
+		{"?", "a", true},
+		{"?", "", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+
+		// Classes, ranges and negation
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"[a-z]", "m", true},
+		{"[a-z]", "M", false},
+		{"[z-a]", "m", true},
+		{"key[0-9]", "key7", true},
+		{"[^x]", "y", true},
+		{"[^x]", "x", false},
+		{"[^a-c]", "b", false},
+		{"[^a-c]", "d", true},
+		{"[a\\]]", "]", true},
+		{"[a\\-z]", "-", true},
+		{"[a\\-z]", "m", false},
+
+		// Escapes
+		{"\\*", "*", true},
+		{"\\*", "a", false},
+		{"\\?", "?", true},
+		{"\\[a]", "[a]", true},
+		{"a\\\\b", "a\\b", true},
+		{"ab\\", "ab\\", true},
+
+		// Unterminated classes run to the end of the pattern
+		{"[abc", "a", true},
+		{"[abc", "d", false},
+		{"x[abc", "xb", true},
+		{"x[abc", "xbc", false},
+	} {
+		if got := Match(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestMatchPathological checks that patterns with many stars fail in linear time
+// rather than backtracking through every way of splitting the name between them
+func TestMatchPathological(t *testing.T) {
+	pattern := strings.Repeat("a*", 30) + "b"
+	name := strings.Repeat("a", 10000)
+	start := time.Now()
+	if Match(pattern, name) {
+		t.Errorf("Match(%q, a×10000) = true", pattern)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Match took %v", elapsed)
+	}
+	if !Match(pattern, name+"b") {
+		t.Errorf("Match(%q, a×10000+b) = false", pattern)
+	}
+
+	// Beyond maxNesting stars the match gives up instead of exhausting the stack
+	deep := strings.Repeat("*a", maxNesting+1)
+	if Match(deep, strings.Repeat("a", maxNesting+1)) {
+		t.Errorf("Match with %d nested stars = true", maxNesting+1)
+	}
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/glob"
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// defaultUser is the name of the only user there is
+const defaultUser = "default"
+
+// aclUser holds the key and channel patterns the default user may access. It is
+// replaced as a whole when they change, so that commands check it without locking.
+type aclUser struct {
+	keys     []string
+	channels []string
+}
+
+// errPatternAfterAll is the error of a pattern added to a list that already allows
+// everything, named by its flag
+func errPatternAfterAll(flag, reset string) error {
+	return fmt.Errorf("Adding a pattern after the * pattern (or the '%s' flag) is not valid and does not have any effect. Try '%s' to start with an empty list of patterns", flag, reset)
+}
+
+// apply applies an ACL SETUSER rule. Only the key and channel rules are supported,
+// as the user's password is requirepass and it may run every command.
+func (u *aclUser) apply(rule string) error {
+	switch lower := strings.ToLower(rule); {
+	case lower == "allkeys":
+		u.keys = []string{"*"}
+	case lower == "resetkeys":
+		u.keys = nil
+	case lower == "allchannels":
+		u.channels = []string{"*"}
+	case lower == "resetchannels":
+		u.channels = nil
+	case lower == "reset":
+		u.keys, u.channels = nil, nil
+	case strings.HasPrefix(rule, "~"):
+		if slices.Contains(u.keys, "*") {
+			return errPatternAfterAll("allkeys", "resetkeys")
+		}
+		if pattern := rule[1:]; pattern == "*" {
+			u.keys = []string{"*"}
+		} else if !slices.Contains(u.keys, pattern) {
+			u.keys = append(u.keys, pattern)
+		}
+	case strings.HasPrefix(rule, "&"):
+		if slices.Contains(u.channels, "*") {
+			return errPatternAfterAll("allchannels", "resetchannels")
+		}
+		if pattern := rule[1:]; pattern == "*" {
+			u.channels = []string{"*"}
+		} else if !slices.Contains(u.channels, pattern) {
+			u.channels = append(u.channels, pattern)
+		}
+	default:
+		return fmt.Errorf("only key and channel rules are supported")
+	}
+	return nil
+}
+
+// rules renders the patterns of the user as ACL rules
+func (u *aclUser) rules() string {
+	parts := make([]string, 0, len(u.keys)+len(u.channels)+1)
+	for _, pattern := range u.keys {
+		parts = append(parts, "~"+pattern)
+	}
+	if len(u.channels) == 0 {
+		parts = append(parts, "resetchannels")
+	}
+	for _, pattern := range u.channels {
+		parts = append(parts, "&"+pattern)
+	}
+	return strings.Join(parts, " ")
+}
+
+// mayAccess reports whether a key or channel matches one of the patterns
+func mayAccess(patterns []string, name string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		return glob.Match(pattern, name)
+	})
+}
+
+// formatUser renders the user directive
+func formatUser(c *Config) string {
+	user := aclUser{keys: c.UserKeys, channels: c.UserChannels}
+	return strings.TrimSpace(defaultUser + " " + user.rules())
+}
+
+// parseUser applies a "default <rule> ..." user directive to a user with neither
+// key nor channel patterns
+func parseUser(c *Config, value string) error {
+	fields := strings.Fields(value)
+	if len(fields) == 0 || fields[0] != defaultUser {
+		return fmt.Errorf("only the default user can be configured")
+	}
+	var user aclUser
+	for _, rule := range fields[1:] {
+		if err := user.apply(rule); err != nil {
+			return fmt.Errorf("error in rule '%s': %v", rule, err)
+		}
+	}
+	c.UserKeys, c.UserChannels = user.keys, user.channels
+	return nil
+}
+
+// syncACL publishes the patterns of the user directive to the commands.
+// Must be called with the server mutex held.
+func (s *RedisServer) syncACL() {
+	s.acl.Store(&aclUser{keys: slices.Clone(s.config.UserKeys), channels: slices.Clone(s.config.UserChannels)})
+}
+
+// permissionError returns the NOPERM error of a command accessing a key or channel
+// the user may not, empty when it may run
+func (s *RedisServer) permissionError(command string, entry *Command, cmd []string) string {
+	user := s.acl.Load()
+	if !slices.Contains(user.keys, "*") {
+		for _, key := range entry.Keys.keys(cmd) {
+			if !mayAccess(user.keys, key) {
+				return fmt.Sprintf("NOPERM No permissions to access the '%s' key", key)
+			}
+		}
+	}
+	if slices.Contains(user.channels, "*") {
+		return ""
+	}
+	switch command {
+	case "PUBLISH", "SUBSCRIBE":
+		channels := cmd[1:]
+		if command == "PUBLISH" {
+			channels = cmd[1:2]
+		}
+		for _, channel := range channels {
+			if !mayAccess(user.channels, channel) {
+				return fmt.Sprintf("NOPERM No permissions to access the '%s' channel", channel)
+			}
+		}
+	case "PSUBSCRIBE":
+		// A pattern could match channels beyond those allowed, so it must be one of
+		// the patterns of the user
+		for _, pattern := range cmd[1:] {
+			if !slices.Contains(user.channels, pattern) {
+				return fmt.Sprintf("NOPERM No permissions to access the '%s' channel", pattern)
+			}
+		}
+	}
+	return ""
+}
+
+// ACLHandler handles ACL subcommands, for the default user only
+type ACLHandler struct {
+	server *RedisServer
+}
+
+func (h *ACLHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	switch subcommand := strings.ToUpper(args[1]); {
+	case subcommand == "WHOAMI" && len(args) == 2:
+		return writer.WriteBulkString(defaultUser)
+	case subcommand == "USERS" && len(args) == 2:
+		return writer.WriteBulkStringArray([]string{defaultUser})
+	case subcommand == "LIST" && len(args) == 2:
+		_, passwords, user := h.describeUser()
+		parts := []string{"user", defaultUser, "on"}
+		if len(passwords) == 0 {
+			parts = append(parts, "nopass")
+		}
+		for _, password := range passwords {
+			parts = append(parts, "#"+password)
+		}
+		if rules := user.rules(); rules != "" {
+			parts = append(parts, rules)
+		}
+		return writer.WriteBulkStringArray([]string{strings.Join(append(parts, "+@all"), " ")})
+	case subcommand == "GETUSER" && len(args) == 3:
+		if args[2] != defaultUser {
+			return writer.WriteNull()
+		}
+		flags, passwords, user := h.describeUser()
+		keys := make([]string, len(user.keys))
+		for i, pattern := range user.keys {
+			keys[i] = "~" + pattern
+		}
+		channels := make([]string, len(user.channels))
+		for i, pattern := range user.channels {
+			channels[i] = "&" + pattern
+		}
+		return writer.WriteMap([]resp.Value{
+			{Type: resp.BulkString, Bulk: "flags"}, bulkStringArray(flags),
+			{Type: resp.BulkString, Bulk: "passwords"}, bulkStringArray(passwords),
+			{Type: resp.BulkString, Bulk: "commands"}, {Type: resp.BulkString, Bulk: "+@all"},
+			{Type: resp.BulkString, Bulk: "keys"}, {Type: resp.BulkString, Bulk: strings.Join(keys, " ")},
+			{Type: resp.BulkString, Bulk: "channels"}, {Type: resp.BulkString, Bulk: strings.Join(channels, " ")},
+			{Type: resp.BulkString, Bulk: "selectors"}, {Type: resp.Array, Array: []resp.Value{}},
+		})
+	case subcommand == "SETUSER" && len(args) >= 3:
+		return h.setUser(args[2], args[3:], writer)
+	case subcommand == "CAT" && len(args) <= 3:
+		return h.categories(args[2:], writer)
+	case subcommand == "HELP":
+		return writer.WriteBulkStringArray([]string{
+			"ACL <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"CAT [<category>]",
+			"    List all commands that belong to <category>, or all command categories",
+			"    when no category is specified.",
+			"GETUSER <username>",
+			"    Get the user's details.",
+			"LIST",
+			"    Show users details in config file format.",
+			"SETUSER <username> <attribute> [<attribute> ...]",
+			"    Apply key (~<pattern>, allkeys, resetkeys) and channel (&<pattern>,",
+			"    allchannels, resetchannels) rules to the default user.",
+			"USERS",
+			"    List all the registered usernames.",
+			"WHOAMI",
+			"    Return the current connection username.",
+			"HELP",
+			"    Print this help.",
+		})
+	}
+	return writer.WriteError(fmt.Sprintf("unknown subcommand or wrong number of arguments for '%s'. Try ACL HELP.", args[1]))
+}
+
+// describeUser returns the flags, password hashes and patterns of the user
+func (h *ACLHandler) describeUser() (flags, passwords []string, user *aclUser) {
+	flags = []string{"on"}
+	if password := h.server.requirePass(); password == "" {
+		flags = append(flags, "nopass")
+	} else {
+		hash := sha256.Sum256([]byte(password))
+		passwords = []string{hex.EncodeToString(hash[:])}
+	}
+	return flags, passwords, h.server.acl.Load()
+}
+
+// setUser applies rules to the default user, all of them or none
+func (h *ACLHandler) setUser(username string, rules []string, writer *resp.Writer) error {
+	if username != defaultUser {
+		return writer.WriteError("Only the default user can be configured, there are no other users")
+	}
+
+	h.server.mutex.Lock()
+	defer h.server.mutex.Unlock()
+	user := aclUser{keys: slices.Clone(h.server.config.UserKeys), channels: slices.Clone(h.server.config.UserChannels)}
+	for _, rule := range rules {
+		if err := user.apply(rule); err != nil {
+			return writer.WriteError(fmt.Sprintf("Error in ACL SETUSER modifier '%s': %v", rule, err))
+		}
+	}
+	h.server.config.UserKeys, h.server.config.UserChannels = user.keys, user.channels
+	h.server.syncACL()
+	return writer.WriteSimpleString("OK")
+}
+
+// categories replies with the ACL categories, or the commands of one
+func (h *ACLHandler) categories(args []string, writer *resp.Writer) error {
+	if len(args) == 0 {
+		names := make([]string, 0, len(aclCategoryNames))
+		for _, category := range aclCategoryNames {
+			if category != "@all" {
+				names = append(names, strings.TrimPrefix(category, "@"))
+			}
+		}
+		return writer.WriteBulkStringArray(names)
+	}
+	category := "@" + strings.ToLower(args[0])
+	if !slices.Contains(aclCategoryNames, category) {
+		return writer.WriteError(fmt.Sprintf("Unknown category '%s'", args[0]))
+	}
+	var names []string
+	for name, command := range h.server.commands {
+		if category == "@all" || slices.Contains(command.aclCategories(), category) {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	slices.Sort(names)
+	return writer.WriteBulkStringArray(names)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adminReadHeaderTimeout bounds how long an admin request may take to send its headers
+const adminReadHeaderTimeout = 5 * time.Second
+
+// ListenAdmin opens the listener of the HTTP admin endpoint, or returns nil when
+// admin-port is 0
+func ListenAdmin(config *Config) (net.Listener, error) {
+	if config.AdminPort == 0 {
+		return nil, nil
+	}
+	return net.Listen("tcp", net.JoinHostPort(config.AdminBind, strconv.Itoa(config.AdminPort)))
+}
+
+// ServeAdmin serves the HTTP admin endpoint on listener in the background: /metrics
+// for Prometheus, /healthz and /readyz for liveness and readiness probes and, with
+// admin-pprof, the runtime profiles under /debug/pprof/. Shutdown stops it and
+// closes the listener.
+func (s *RedisServer) ServeAdmin(listener net.Listener) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", s.MetricsHandler())
+	mux.HandleFunc("GET /healthz", s.serveHealthz)
+	mux.HandleFunc("GET /readyz", s.serveReadyz)
+	s.mutex.RLock()
+	withPprof := s.config.AdminPprof
+	s.mutex.RUnlock()
+	if withPprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+
+	s.admin = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: adminReadHeaderTimeout,
+		ErrorLog:          slog.NewLogLogger(s.logger.Handler(), levelVerbose),
+	}
+	s.logger.Info("Admin endpoint started", "addr", listener.Addr().String())
+	go s.admin.Serve(listener)
+}
+
+// healthCheck is a condition the server must meet to be ready for traffic
+type healthCheck struct {
+	name string
+	ok   bool
+}
+
+// readinessChecks evaluates the readiness conditions without taking the server
+// mutex, which loading holds throughout. There is no replication or AOF yet, so
+// neither has a link or a rewrite to check.
+func (s *RedisServer) readinessChecks() []healthCheck {
+	return []healthCheck{
+		{"loaded", !s.loading.Load()},
+		{"serving", s.serving.Load()},
+		{"not-shutting-down", !s.shuttingDown.Load()},
+	}
+}
+
+// serveHealthz answers liveness probes: the process answers, loading or not
+func (s *RedisServer) serveHealthz(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.Write([]byte("ok\n"))
+}
+
+// serveReadyz answers readiness probes with 200 once the dataset is loaded and clients
+// are served, 503 otherwise, listing every check the way Kubernetes components do
+func (s *RedisServer) serveReadyz(rw http.ResponseWriter, r *http.Request) {
+	var body strings.Builder
+	ready := true
+	for _, check := range s.readinessChecks() {
+		if check.ok {
+			fmt.Fprintf(&body, "[+]%s ok\n", check.name)
+		} else {
+			fmt.Fprintf(&body, "[-]%s failed\n", check.name)
+			ready = false
+		}
+	}
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if ready {
+		body.WriteString("readyz check passed\n")
+	} else {
+		body.WriteString("readyz check failed\n")
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}
+	rw.Write([]byte(body.String()))
+}
+
+// closeAdmin stops the admin endpoint, if it is served
+func (s *RedisServer) closeAdmin() {
+	if s.admin != nil {
+		s.admin.Close()
+	}
+}
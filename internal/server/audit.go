@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// aclCategoryNames are the ACL categories commands are sorted into, and @all
+var aclCategoryNames = []string{"@all", "@keyspace", "@read", "@write", "@admin", "@dangerous", "@pubsub", "@fast", "@slow"}
+
+// defaultAuditCategories are the categories audited unless audit-categories says otherwise
+var defaultAuditCategories = []string{"@write", "@admin"}
+
+// parseAuditCategories validates an audit-categories value
+func parseAuditCategories(value string) ([]string, error) {
+	categories := strings.Fields(strings.ToLower(value))
+	for _, category := range categories {
+		if !slices.Contains(aclCategoryNames, category) {
+			return nil, fmt.Errorf("unknown ACL category '%s'", category)
+		}
+	}
+	return categories, nil
+}
+
+// auditLog appends a JSON record per audited command to audit-log
+type auditLog struct {
+	file   *logFile
+	logger *slog.Logger
+}
+
+// OpenAudit starts auditing commands to audit-log, when it is set
+func (s *RedisServer) OpenAudit() error {
+	s.mutex.RLock()
+	path := s.config.AuditLog
+	s.mutex.RUnlock()
+	if path == "" {
+		return nil
+	}
+
+	file, err := openLogFile(path)
+	if err != nil {
+		return err
+	}
+	// Every record is kept whatever loglevel says, and the level would be noise
+	handler := slog.NewJSONHandler(file, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.LevelKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	})
+	s.audit = &auditLog{file: file, logger: slog.New(handler)}
+	return nil
+}
+
+// CloseAudit closes the audit log, if there is one, once no command is left to run
+func (s *RedisServer) CloseAudit() {
+	if s.audit != nil {
+		s.audit.file.Close()
+	}
+}
+
+// auditedCommand returns the dispatch entry of the command called name, when it is in
+// one of the audit-categories
+func (s *RedisServer) auditedCommand(name string) (*Command, bool) {
+	entry, exists := s.lookupCommand(name)
+	if !exists {
+		return nil, false
+	}
+	s.mutex.RLock()
+	categories := s.config.AuditCategories
+	s.mutex.RUnlock()
+	if slices.Contains(categories, "@all") {
+		return entry, true
+	}
+	return entry, slices.ContainsFunc(entry.aclCategories(), func(category string) bool {
+		return slices.Contains(categories, category)
+	})
+}
+
+// auditCommand records an audited command once it has run, with its outcome: ok or
+// the code of the error it replied with, errorsBefore being the error count of writer
+// before the command. Only the keys of the command are recorded, as the other
+// arguments may hold values and passwords.
+func (s *RedisServer) auditCommand(ctx context.Context, entry *Command, cmd []string, writer *resp.Writer, errorsBefore int64) {
+	result := "ok"
+	if errors, last := writer.Errors(); errors > errorsBefore {
+		result = errorCode(last)
+	}
+	attrs := []slog.Attr{
+		slog.String("user", "default"),
+		slog.String("command", strings.ToLower(entry.Name)),
+		slog.Any("keys", entry.Keys.keys(cmd)),
+		slog.String("result", result),
+	}
+	if client, ok := ClientFromContext(ctx); ok {
+		attrs = append(attrs, slog.Int64("client_id", client.ID), slog.String("client_addr", client.Addr))
+		if client.Name != "" {
+			attrs = append(attrs, slog.String("client_name", client.Name))
+		}
+	}
+	s.audit.logger.LogAttrs(ctx, slog.LevelInfo, "audit", attrs...)
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// errNoAuth is the reply to commands sent before authenticating
+const errNoAuth = "NOAUTH Authentication required."
+
+// errWrongPass is the reply to AUTH and HELLO AUTH with invalid credentials
+const errWrongPass = "WRONGPASS invalid username-password pair or user is disabled."
+
+// requirePass returns the password of the default user, empty when none is set
+func (s *RedisServer) requirePass() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.config.RequirePass
+}
+
+// authenticated reports whether the client writing to writer may run commands:
+// either no password is set or the client has authenticated
+func (s *RedisServer) authenticated(writer *resp.Writer) bool {
+	if s.requirePass() == "" {
+		return true
+	}
+	client := s.clients.Lookup(writer)
+	return client != nil && client.authenticated.Load()
+}
+
+// authenticate checks the credentials of the default user, the only one there is,
+// and marks the client writing to writer as authenticated when they are valid
+func (s *RedisServer) authenticate(writer *resp.Writer, username, password string) bool {
+	if username != "default" {
+		return false
+	}
+	// Without requirepass the default user accepts any password
+	if required := s.requirePass(); required != "" &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(required)) != 1 {
+		return false
+	}
+	if client := s.clients.Lookup(writer); client != nil {
+		client.authenticated.Store(true)
+	}
+	return true
+}
+
+// AuthHandler handles AUTH commands
+type AuthHandler struct {
+	server *RedisServer
+}
+
+func (h *AuthHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	var username, password string
+	switch len(args) {
+	case 2:
+		if h.server.requirePass() == "" {
+			return writer.WriteError("AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+		}
+		username, password = "default", args[1]
+	case 3:
+		username, password = args[1], args[2]
+	default:
+		return writer.WriteError("wrong number of arguments for 'auth' command")
+	}
+
+	if !h.server.authenticate(writer, username, password) {
+		return writer.WriteError(errWrongPass)
+	}
+	return writer.WriteSimpleString("OK")
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+// backingStoreQueue bounds the writes waiting for the writer; more are dropped
+// rather than slowing commands down
+const backingStoreQueue = 10000
+
+// Loader fetches a key missing from the keyspace from the backing store behind it.
+// found is false when the store doesn't have it either, and ttl is 0 for a key
+// without expiry.
+type Loader func(ctx context.Context, key string) (value string, ttl time.Duration, found bool, err error)
+
+// StoreWrite is a change made by a command, for the backing store: Key set to
+// Value, or deleted
+type StoreWrite struct {
+	Key     string
+	Value   string
+	Deleted bool
+}
+
+// Writer writes the changes made by commands through to the backing store
+type Writer func(ctx context.Context, write StoreWrite) error
+
+// backingStore holds the loader and the writer registered by the embedder, which
+// turn the server into a read-through and write-through cache tier
+type backingStore struct {
+	loader Loader
+	writer Writer
+
+	// loads are the loads in progress, shared by the misses of the same key
+	mutex sync.Mutex
+	loads map[string]*loadCall
+
+	writes  chan StoreWrite
+	closing chan struct{}
+	drained chan struct{}
+
+	loaded, loadErrors   atomic.Int64
+	dropped, writeErrors atomic.Int64
+}
+
+// loadCall is a load of a key, whose result is ready once done is closed
+type loadCall struct {
+	done  chan struct{}
+	value string
+	found bool
+	err   error
+}
+
+// SetLoader registers the loader GET calls on a miss. The key it finds is stored
+// with its TTL and returned. Concurrent misses of a key share a single call, made
+// without the keyspace locked. It must be registered before serving clients.
+func (s *RedisServer) SetLoader(loader Loader) {
+	s.backing.loader = loader
+	s.backing.loads = make(map[string]*loadCall)
+}
+
+// SetWriter registers the writer the changes made by SET, INCR and its variants,
+// DEL and UNLINK are passed to, in order, by a background goroutine. Keys that
+// expire, are evicted or flushed, and those loaded by the loader, aren't written
+// through. It must be registered before serving clients.
+func (s *RedisServer) SetWriter(writer Writer) {
+	s.backing.writer = writer
+	s.backing.writes = make(chan StoreWrite, backingStoreQueue)
+	s.backing.closing = make(chan struct{})
+	s.backing.drained = make(chan struct{})
+	go s.writeThroughLoop()
+}
+
+// loadKey fetches a key missing from the keyspace through the loader and stores it
+func (s *RedisServer) loadKey(ctx context.Context, key string) (string, bool, error) {
+	b := &s.backing
+	b.mutex.Lock()
+	call, loading := b.loads[key]
+	if !loading {
+		call = &loadCall{done: make(chan struct{})}
+		b.loads[key] = call
+	}
+	b.mutex.Unlock()
+
+	if loading {
+		select {
+		case <-call.done:
+			return call.value, call.found, call.err
+		case <-ctx.Done():
+			return "", false, ctx.Err()
+		}
+	}
+
+	// The other misses waiting for it mustn't fail with this client
+	value, ttl, found, err := b.loader(context.WithoutCancel(ctx), key)
+	if err != nil {
+		b.loadErrors.Add(1)
+	} else if found {
+		b.loaded.Add(1)
+		s.mutex.Lock()
+		// A key written meanwhile is newer than the one loaded
+		s.cleanupExpired(key)
+		if _, exists := s.data.Get(key); !exists {
+			var expiresAt int64
+			if ttl > 0 {
+				expiresAt = s.expiresAfter(ttl)
+			}
+			s.setKey(key, s.newEntry(store.NewString(value), expiresAt))
+		}
+		s.mutex.Unlock()
+	}
+
+	call.value, call.found, call.err = value, found, err
+	b.mutex.Lock()
+	delete(b.loads, key)
+	b.mutex.Unlock()
+	close(call.done)
+	return value, found, err
+}
+
+// errLoad is the reply to a GET whose key the loader failed to fetch
+func errLoad(err error) string {
+	return fmt.Sprintf("backing store failed to load the key: %v", err)
+}
+
+// writeThrough queues a change made by a command for the writer, if any.
+// Must be called with the server mutex held for writing, so that the changes are
+// queued in the order they are applied.
+func (s *RedisServer) writeThrough(write StoreWrite) {
+	if s.backing.writer == nil {
+		return
+	}
+	select {
+	case s.backing.writes <- write:
+	default:
+		s.backing.dropped.Add(1)
+	}
+}
+
+// writeThroughLoop passes the queued changes to the writer until Shutdown asks it
+// to finish those still queued
+func (s *RedisServer) writeThroughLoop() {
+	defer close(s.backing.drained)
+	for {
+		select {
+		case write := <-s.backing.writes:
+			s.writeToStore(write)
+		case <-s.backing.closing:
+			for {
+				select {
+				case write := <-s.backing.writes:
+					s.writeToStore(write)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeToStore passes a change to the writer, logging its failure
+func (s *RedisServer) writeToStore(write StoreWrite) {
+	if err := s.backing.writer(context.Background(), write); err != nil {
+		s.backing.writeErrors.Add(1)
+		s.logger.Warn("Backing store write failed", "key", write.Key, "err", err)
+	}
+}
+
+// drainWrites waits for the writer to finish the queued changes, until ctx is done
+func (s *RedisServer) drainWrites(ctx context.Context) {
+	if s.backing.writer == nil {
+		return
+	}
+	close(s.backing.closing)
+	select {
+	case <-s.backing.drained:
+	case <-ctx.Done():
+		s.logger.Warn("Backing store writes were still queued on shutdown", "writes", len(s.backing.writes))
+	}
+}
+
+// backingStoreInfo renders the backing store counters for INFO stats, when a
+// loader or writer is registered
+func backingStoreInfo(s *RedisServer) []string {
+	b := &s.backing
+	if b.loader == nil && b.writer == nil {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("backing_store_loads:%d", b.loaded.Load()),
+		fmt.Sprintf("backing_store_load_errors:%d", b.loadErrors.Load()),
+		fmt.Sprintf("backing_store_dropped_writes:%d", b.dropped.Load()),
+		fmt.Sprintf("backing_store_write_errors:%d", b.writeErrors.Load()),
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"iter"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+// ErrBusyKey is returned when restoring over an existing key without replacing it
+var ErrBusyKey = errors.New("BUSYKEY Target key name already exists.")
+
+// Entries streams a consistent snapshot of the keyspace, for backup tools: every key
+// as it was when the iteration started, keys already expired excepted. Writes go on
+// meanwhile, the keyspace being locked for one batch of keys at a time. It holds the
+// only snapshot slot, so it fails while BGSAVE runs and BGSAVE fails meanwhile.
+// Iteration stops at the first error, cancellation of ctx included.
+func (s *RedisServer) Entries(ctx context.Context) iter.Seq2[SnapshotEntry, error] {
+	return func(yield func(SnapshotEntry, error) bool) {
+		snap, err := s.NewSnapshot()
+		if err != nil {
+			yield(SnapshotEntry{}, err)
+			return
+		}
+		defer snap.Close()
+
+		now := s.clock.Now().UnixMilli()
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(SnapshotEntry{}, err)
+				return
+			}
+			entry, ok := snap.Next()
+			if !ok {
+				return
+			}
+			if entry.ExpiresAt != 0 && entry.ExpiresAt <= now {
+				continue
+			}
+			if !yield(entry, nil) {
+				return
+			}
+		}
+	}
+}
+
+// RestoreEntry writes a key read from a backup, like RESTORE: an existing key is
+// only overwritten with replace, and entries that expired since aren't restored. It is
+// subject to maxmemory and the namespace budgets, and sends the restore keyspace
+// notification.
+func (s *RedisServer) RestoreEntry(entry SnapshotEntry, replace bool) error {
+	if err := s.performEvictions([]string{entry.Key}); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cleanupExpired(entry.Key)
+	old, exists := s.data.Get(entry.Key)
+	if exists && !replace {
+		return ErrBusyKey
+	}
+	// Restoring an expired entry over a key deletes it, as RESTORE does
+	if entry.ExpiresAt != 0 && entry.ExpiresAt <= s.clock.Now().UnixMilli() {
+		if exists {
+			s.deleteKey(entry.Key)
+			s.entries.Release(old)
+			s.notifyKeyspaceEvent(NotifyGeneric, "del", entry.Key)
+			runKeyHooks(s.keyHooks.del, entry.Key)
+		}
+		return nil
+	}
+	s.setKey(entry.Key, s.newEntry(store.NewString(entry.Value), entry.ExpiresAt))
+	s.notifyKeyspaceEvent(NotifyGeneric, "restore", entry.Key)
+	return nil
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// ClientHandler handles CLIENT subcommands
+type ClientHandler struct {
+	server *RedisServer
+}
+
+func (h *ClientHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	client := h.server.clients.Lookup(writer)
+	switch subcommand := strings.ToUpper(args[1]); {
+	case subcommand == "ID" && len(args) == 2:
+		if client == nil {
+			return writer.WriteInteger(0)
+		}
+		return writer.WriteInteger(int(client.ID))
+	case subcommand == "GETNAME" && len(args) == 2:
+		if client == nil || h.server.clients.Name(client) == "" {
+			return writer.WriteNullBulkString()
+		}
+		return writer.WriteBulkString(h.server.clients.Name(client))
+	case subcommand == "SETNAME" && len(args) == 3:
+		if !validClientName(args[2]) {
+			return writer.WriteError("Client names cannot contain spaces, newlines or special characters.")
+		}
+		if client != nil {
+			h.server.clients.SetName(client, args[2])
+		}
+		return writer.WriteSimpleString("OK")
+	case subcommand == "INFO" && len(args) == 2:
+		if client == nil {
+			return writer.WriteVerbatimString("txt", "")
+		}
+		return writer.WriteVerbatimString("txt", h.server.describeClient(client, time.Now())+"\n")
+	case subcommand == "REPLY" && len(args) == 3:
+		modes := map[string]resp.ReplyMode{"ON": resp.RepliesOn, "OFF": resp.RepliesOff, "SKIP": resp.RepliesSkip}
+		mode, ok := modes[strings.ToUpper(args[2])]
+		if !ok {
+			return writer.WriteError("syntax error")
+		}
+		// A local client waits for every reply
+		if mode != resp.RepliesOn && client != nil && client.addr == localClientAddr {
+			return writer.WriteError("CLIENT REPLY OFF and SKIP are not supported by local clients")
+		}
+		// The OK is discarded unless replies were turned on
+		writer.SetReplyMode(mode)
+		return writer.WriteSimpleString("OK")
+	case (subcommand == "NO-EVICT" || subcommand == "NO-TOUCH") && len(args) == 3:
+		var on bool
+		switch strings.ToUpper(args[2]) {
+		case "ON":
+			on = true
+		case "OFF":
+		default:
+			return writer.WriteError("syntax error")
+		}
+		if client != nil {
+			if subcommand == "NO-EVICT" {
+				client.noEvict.Store(on)
+			} else {
+				client.noTouch.Store(on)
+			}
+		}
+		return writer.WriteSimpleString("OK")
+	case subcommand == "LIST":
+		return h.list(args[2:], writer)
+	case subcommand == "HELP":
+		return writer.WriteBulkStringArray([]string{
+			"CLIENT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"GETNAME",
+			"    Return the name of the current connection.",
+			"ID",
+			"    Return the ID of the current connection.",
+			"INFO",
+			"    Return information about the current client connection.",
+			"LIST [TYPE <normal|pubsub>] [ID <id> [<id> ...]]",
+			"    Return information about client connections.",
+			"NO-EVICT (ON|OFF)",
+			"    Protect the current client connection from eviction.",
+			"NO-TOUCH (ON|OFF)",
+			"    Will not touch LRU/LFU stats when this mode is on.",
+			"REPLY (ON|OFF|SKIP)",
+			"    Control the replies sent to the current connection.",
+			"SETNAME <name>",
+			"    Assign the name <name> to the current connection.",
+			"HELP",
+			"    Print this help.",
+		})
+	default:
+		return writer.WriteError(fmt.Sprintf("unknown subcommand or wrong number of arguments for '%s'. Try CLIENT HELP.", args[1]))
+	}
+}
+
+// list replies with a line per connected client, optionally only those of a class
+// or with the given IDs
+func (h *ClientHandler) list(args []string, writer *resp.Writer) error {
+	var class string
+	var ids []int64
+	for i := 0; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "TYPE" && i+1 < len(args):
+			class = strings.ToLower(args[i+1])
+			if class != "normal" && class != "pubsub" {
+				return writer.WriteError(fmt.Sprintf("Unknown client type '%s'", args[i+1]))
+			}
+			i++
+		case option == "ID" && i+1 < len(args):
+			for i++; i < len(args); i++ {
+				id, err := strconv.ParseInt(args[i], 10, 64)
+				if err != nil || id <= 0 {
+					return writer.WriteError(fmt.Sprintf("Invalid client ID '%s'", args[i]))
+				}
+				ids = append(ids, id)
+			}
+		default:
+			return writer.WriteError("syntax error")
+		}
+	}
+
+	clients := h.server.clients.All()
+	slices.SortFunc(clients, func(a, b *Client) int { return int(a.ID - b.ID) })
+	now := time.Now()
+	var builder strings.Builder
+	for _, client := range clients {
+		if ids != nil && !slices.Contains(ids, client.ID) {
+			continue
+		}
+		if class != "" && h.server.pubsub.IsSubscriber(client.writer) != (class == "pubsub") {
+			continue
+		}
+		builder.WriteString(h.server.describeClient(client, now) + "\n")
+	}
+	return writer.WriteVerbatimString("txt", builder.String())
+}
+
+// describeClient renders the CLIENT LIST line of a client
+func (s *RedisServer) describeClient(client *Client, now time.Time) string {
+	channels, patterns := s.pubsub.Subscriptions(client.writer)
+	var flags string
+	if channels+patterns > 0 {
+		flags += "P"
+	}
+	if client.noEvict.Load() {
+		flags += "e"
+	}
+	if client.noTouch.Load() {
+		flags += "T"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+	return fmt.Sprintf("id=%d addr=%s name=%s age=%d idle=%d flags=%s db=0 sub=%d psub=%d omem=%d tot-net-in=%d tot-net-out=%d resp=%d",
+		client.ID, client.addr, s.clients.Name(client),
+		int64(now.Sub(client.createdAt).Seconds()),
+		(now.UnixMilli()-client.lastInteraction.Load())/1000,
+		flags, channels, patterns, client.output.pending.Load(),
+		client.netInput.Load(), client.netOutput.Load(), client.writer.Protocol())
+}
+
+// ResetHandler handles RESET commands: the connection is returned to the state of a
+// new one, without subscriptions or name, with replies on and, unless it is a local
+// client, speaking RESP2 and no longer authenticated
+type ResetHandler struct {
+	server *RedisServer
+}
+
+func (h *ResetHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	h.server.pubsub.RemoveSubscriber(writer)
+	writer.SetReplyMode(resp.RepliesOn)
+	client := h.server.clients.Lookup(writer)
+	if client != nil {
+		h.server.clients.SetName(client, "")
+		client.noEvict.Store(false)
+		client.noTouch.Store(false)
+	}
+	// A local client decodes RESP3 and is always trusted
+	if client == nil || client.addr != localClientAddr {
+		writer.SetProtocol(resp.RESP2)
+		if client != nil {
+			client.authenticated.Store(false)
+		}
+	}
+	return writer.WriteSimpleString("RESET")
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// clientsCronInterval is how often idle clients are looked for
+const clientsCronInterval = time.Second
+
+// Client is the registry entry of a connected client
+type Client struct {
+	ID        int64
+	writer    *resp.Writer
+	createdAt time.Time
+
+	// addr is the client address, taken from the PROXY header when there is one.
+	// Event-loop clients only update it from the loop goroutine.
+	addr string
+
+	// name is set by HELLO SETNAME, protected by the registry mutex
+	name string
+
+	// authenticated is set once the client passes AUTH or HELLO AUTH
+	authenticated atomic.Bool
+
+	// noEvict and noTouch are set by CLIENT NO-EVICT and CLIENT NO-TOUCH; the commands
+	// of a no-touch client don't count as accesses for the eviction policy
+	noEvict atomic.Bool
+	noTouch atomic.Bool
+
+	// closeAfterReply is set by QUIT, or once an event-loop client half-closed its
+	// connection: no more commands are read, and the connection is closed as soon as
+	// the replies written so far are sent
+	closeAfterReply atomic.Bool
+
+	// lastInteraction is the unix time in milliseconds of the last command received
+	lastInteraction atomic.Int64
+
+	// netInput and netOutput count the bytes read from and written to the client
+	netInput  atomic.Int64
+	netOutput atomic.Int64
+
+	output outputBuffer
+
+	// rate is the client's share of the rate limits, protected by their mutex
+	rate rateBudget
+
+	// conn is the client's connection. Event-loop clients may only be closed from the
+	// loop goroutine, so their conn is nil and the loop reaps them itself.
+	conn net.Conn
+
+	// ctx is passed to the client's commands and cancelled once it disconnects
+	ctx      context.Context
+	cancel   context.CancelFunc
+	registry *ClientRegistry
+}
+
+// clientContextKey is the context key of the client running a command
+type clientContextKey struct{}
+
+// ClientFromContext describes the client whose command ctx belongs to
+func ClientFromContext(ctx context.Context) (ClientInfo, bool) {
+	client, ok := ctx.Value(clientContextKey{}).(*Client)
+	if !ok {
+		return ClientInfo{}, false
+	}
+	return ClientInfo{
+		ID:       client.ID,
+		Addr:     client.addr,
+		Name:     client.registry.Name(client),
+		Protocol: client.writer.Protocol(),
+	}, true
+}
+
+// noTouchContext reports whether ctx is that of a command of a no-touch client
+func noTouchContext(ctx context.Context) bool {
+	client, ok := ctx.Value(clientContextKey{}).(*Client)
+	return ok && client.noTouch.Load()
+}
+
+// Context returns the context the client's commands run with
+func (c *Client) Context() context.Context {
+	return c.ctx
+}
+
+// disconnect cancels the client's commands and closes its connection
+func (c *Client) disconnect() {
+	c.cancel()
+	c.conn.Close()
+}
+
+// validClientName reports whether name may name a client: printable ASCII without spaces
+func validClientName(name string) bool {
+	return !strings.ContainsFunc(name, func(r rune) bool { return r <= ' ' || r > '~' })
+}
+
+// Touch records that the client sent a command
+func (c *Client) Touch() {
+	c.lastInteraction.Store(time.Now().UnixMilli())
+}
+
+// ClientRegistry tracks every connected client
+type ClientRegistry struct {
+	mutex    sync.Mutex
+	clients  map[int64]*Client
+	byWriter map[*resp.Writer]*Client
+	nextID   int64
+}
+
+// NewClientRegistry creates an empty registry
+func NewClientRegistry() *ClientRegistry {
+	return &ClientRegistry{
+		clients:  make(map[int64]*Client),
+		byWriter: make(map[*resp.Writer]*Client),
+	}
+}
+
+// Register adds a client, whose context derives from ctx; conn may be nil for
+// clients the registry must not close
+func (r *ClientRegistry) Register(ctx context.Context, writer *resp.Writer, conn net.Conn, addr string) *Client {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.nextID++
+	client := &Client{ID: r.nextID, writer: writer, createdAt: time.Now(), addr: addr, conn: conn, registry: r}
+	client.ctx, client.cancel = context.WithCancel(context.WithValue(ctx, clientContextKey{}, client))
+	client.Touch()
+	r.clients[client.ID] = client
+	r.byWriter[writer] = client
+	return client
+}
+
+// Unregister removes a disconnected client and cancels its context
+func (r *ClientRegistry) Unregister(client *Client) {
+	client.cancel()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.clients, client.ID)
+	delete(r.byWriter, client.writer)
+}
+
+// Lookup returns the client replying through writer, nil if there is none
+func (r *ClientRegistry) Lookup(writer *resp.Writer) *Client {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.byWriter[writer]
+}
+
+// SetName names a client
+func (r *ClientRegistry) SetName(client *Client, name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	client.name = name
+}
+
+// Name returns the name of a client, empty until it sets one
+func (r *ClientRegistry) Name(client *Client) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return client.name
+}
+
+// All returns every connected client
+func (r *ClientRegistry) All() []*Client {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	clients := make([]*Client, 0, len(r.clients))
+	for _, client := range r.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// Idle returns the clients that haven't sent a command for longer than timeout
+func (r *ClientRegistry) Idle(timeout time.Duration) []*Client {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	deadline := time.Now().Add(-timeout).UnixMilli()
+	var idle []*Client
+	for _, client := range r.clients {
+		if client.lastInteraction.Load() < deadline {
+			idle = append(idle, client)
+		}
+	}
+	return idle
+}
+
+// idleTimeout returns the configured client timeout, 0 when disabled
+func (s *RedisServer) idleTimeout() time.Duration {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return time.Duration(s.config.Timeout) * time.Second
+}
+
+// idleClients returns the clients to disconnect under the timeout setting. Pub/sub
+// clients are exempt: they legitimately stay silent while waiting for messages.
+func (s *RedisServer) idleClients() []*Client {
+	timeout := s.idleTimeout()
+	if timeout <= 0 {
+		return nil
+	}
+
+	var expired []*Client
+	for _, client := range s.clients.Idle(timeout) {
+		if !s.pubsub.IsSubscriber(client.writer) {
+			expired = append(expired, client)
+		}
+	}
+	return expired
+}
+
+// clientsCron periodically closes the clients idle for longer than the timeout setting
+// and those over their output buffer limit, and ends their idle SCAN iterations.
+// Event-loop clients are left to the loop.
+func (s *RedisServer) clientsCron() {
+	ticker := time.NewTicker(clientsCronInterval)
+	defer ticker.Stop()
+
+	for {
+		var now time.Time
+		select {
+		case now = <-ticker.C:
+		case <-s.stopped:
+			return
+		}
+
+		for _, client := range s.idleClients() {
+			if client.conn != nil {
+				client.disconnect()
+			}
+		}
+		for _, client := range s.clients.All() {
+			if client.conn != nil && s.outputLimitExceeded(client, now) {
+				client.disconnect()
+			}
+		}
+		s.reapScanCursors(now)
+	}
+}
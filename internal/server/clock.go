@@ -0,0 +1,57 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time to the keyspace: key expiry, TTLs, TIME and the LRU and LFU
+// bookkeeping of eviction read it rather than time.Now, so that tests and
+// simulations can control how time passes for the data
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the wall clock, used unless another is set
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// MockClock is a Clock that only moves when told to. It is safe for concurrent use.
+type MockClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// NewMockClock returns a clock stopped at now
+func NewMockClock(now time.Time) *MockClock {
+	return &MockClock{now: now}
+}
+
+func (c *MockClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Set moves the clock to now, which may be in its past
+func (c *MockClock) Set(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock forward by d
+func (c *MockClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// SetClock replaces the clock of the keyspace. It must be called before serving,
+// and before loading data, so that the expiry of loaded keys is checked against it.
+func (s *RedisServer) SetClock(clock Clock) {
+	s.clock = clock
+}
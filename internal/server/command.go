@@ -0,0 +1,304 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// CommandFlags describes properties of a command that the dispatcher acts on
+type CommandFlags int
+
+const (
+	// FlagWrite marks commands that may modify the keyspace
+	FlagWrite CommandFlags = 1 << iota
+	// FlagDenyOOM marks commands that may grow memory usage and are refused over maxmemory
+	FlagDenyOOM
+	// FlagReadOnly marks commands that read the keyspace without modifying it
+	FlagReadOnly
+	// FlagAdmin marks administrative commands
+	FlagAdmin
+	// FlagPubSub marks publish/subscribe commands
+	FlagPubSub
+	// FlagNoAuth marks commands allowed before the client authenticates
+	FlagNoAuth
+	// FlagFast marks commands that run in constant or logarithmic time
+	FlagFast
+	// FlagLoading marks commands allowed while the dataset is loaded in the
+	// background; the others run only when every key they name is loaded already
+	FlagLoading
+)
+
+// commandFlagNames are the names COMMAND reports for each flag
+var commandFlagNames = []struct {
+	flag CommandFlags
+	name string
+}{
+	{FlagWrite, "write"},
+	{FlagDenyOOM, "denyoom"},
+	{FlagReadOnly, "readonly"},
+	{FlagAdmin, "admin"},
+	{FlagPubSub, "pubsub"},
+	{FlagNoAuth, "no_auth"},
+	{FlagFast, "fast"},
+	{FlagLoading, "loading"},
+}
+
+// KeySpec locates the key arguments of a command: every Step-th argument from
+// FirstKey to LastKey, which counts from the end when negative. The zero value
+// means the command takes no keys.
+type KeySpec struct {
+	FirstKey int
+	LastKey  int
+	Step     int
+}
+
+// keyCount returns the number of key arguments in a call with argc arguments,
+// command name included
+func (spec KeySpec) keyCount(argc int) int {
+	if spec.FirstKey == 0 || spec.FirstKey >= argc {
+		return 0
+	}
+	last := spec.LastKey
+	if last < 0 {
+		last += argc
+	}
+	last = min(last, argc-1)
+	if last < spec.FirstKey {
+		return 0
+	}
+	return (last-spec.FirstKey)/spec.Step + 1
+}
+
+// keys returns the key arguments of args
+func (spec KeySpec) keys(args []string) []string {
+	keys := make([]string, spec.keyCount(len(args)))
+	for i := range keys {
+		keys[i] = args[spec.FirstKey+i*spec.Step]
+	}
+	return keys
+}
+
+var (
+	noKeys   = KeySpec{}
+	firstKey = KeySpec{FirstKey: 1, LastKey: 1, Step: 1}
+	allKeys  = KeySpec{FirstKey: 1, LastKey: -1, Step: 1}
+)
+
+// Command pairs a handler with its dispatcher metadata. Arity is the exact number
+// of arguments, command name included, or the minimum number when negative.
+type Command struct {
+	Name    string
+	Arity   int
+	Flags   CommandFlags
+	Keys    KeySpec
+	Handler CommandHandler
+
+	stats commandStats
+}
+
+// aclCategories derives the ACL categories of a command from its flags
+func (c *Command) aclCategories() []string {
+	var categories []string
+	if c.Keys.FirstKey > 0 {
+		categories = append(categories, "@keyspace")
+	}
+	if c.Flags&FlagWrite != 0 {
+		categories = append(categories, "@write")
+	}
+	if c.Flags&FlagReadOnly != 0 {
+		categories = append(categories, "@read")
+	}
+	if c.Flags&FlagAdmin != 0 {
+		categories = append(categories, "@admin", "@dangerous")
+	}
+	if c.Flags&FlagPubSub != 0 {
+		categories = append(categories, "@pubsub")
+	}
+	if c.Flags&FlagFast != 0 {
+		categories = append(categories, "@fast")
+	} else {
+		categories = append(categories, "@slow")
+	}
+	return categories
+}
+
+// RegisterCommand adds a command to the dispatch table, where it is subject to the
+// same arity, authentication and maxmemory checks as the built-in ones and listed
+// by COMMAND. The table isn't locked, so it must be called before serving clients.
+func (s *RedisServer) RegisterCommand(name string, arity int, flags CommandFlags, keys KeySpec, handler CommandHandler) error {
+	name = strings.ToUpper(name)
+	switch {
+	case !validCommandName(name):
+		return fmt.Errorf("invalid command name '%s'", name)
+	case arity == 0:
+		return errors.New("arity must be non-zero")
+	case keys.FirstKey < 0 || (keys.FirstKey > 0 && keys.Step < 1):
+		return errors.New("invalid key specification")
+	case handler == nil:
+		return errors.New("missing handler")
+	}
+	if _, exists := s.commands[name]; exists {
+		return fmt.Errorf("command '%s' already exists", name)
+	}
+	if _, isAlias := s.aliases[name]; isAlias {
+		return fmt.Errorf("'%s' is already an alias", name)
+	}
+	s.registerCommand(name, arity, flags, keys, handler)
+	return nil
+}
+
+// CommandAlias makes a command answer to another name too, configured by
+// alias-command
+type CommandAlias struct {
+	Alias   string
+	Command string
+}
+
+// validCommandName reports whether name may name a command or an alias
+func validCommandName(name string) bool {
+	return name != "" && !strings.ContainsFunc(name, func(r rune) bool { return r <= ' ' || r > '~' })
+}
+
+// formatAliases renders aliases as alias-command takes them, one after the other
+func formatAliases(aliases []CommandAlias) string {
+	parts := make([]string, 0, len(aliases)*2)
+	for _, alias := range aliases {
+		parts = append(parts, strings.ToLower(alias.Alias), strings.ToLower(alias.Command))
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseAlias adds an "<alias> <command>" alias to aliases. The command is only
+// checked to exist by CheckAliases, as custom commands are registered later.
+func parseAlias(value string, aliases *[]CommandAlias) error {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return fmt.Errorf("argument must be an alias and the name of a command")
+	}
+	alias, command := strings.ToUpper(fields[0]), strings.ToUpper(fields[1])
+	switch {
+	case !validCommandName(alias):
+		return fmt.Errorf("invalid alias '%s'", fields[0])
+	case alias == command:
+		return fmt.Errorf("alias '%s' names the command itself", fields[0])
+	case slices.ContainsFunc(*aliases, func(a CommandAlias) bool { return a.Alias == alias }):
+		return fmt.Errorf("duplicate alias '%s'", fields[0])
+	}
+	*aliases = append(*aliases, CommandAlias{Alias: alias, Command: command})
+	return nil
+}
+
+// CheckAliases reports the aliases of alias-command that name a command that
+// doesn't exist, or that hide one. It must be called once the custom commands are
+// registered.
+func (s *RedisServer) CheckAliases() error {
+	var errs []error
+	for alias, command := range s.aliases {
+		if _, exists := s.commands[alias]; exists {
+			errs = append(errs, fmt.Errorf("alias '%s' hides the command of the same name", strings.ToLower(alias)))
+		}
+		if _, exists := s.commands[command]; !exists {
+			errs = append(errs, fmt.Errorf("alias '%s' names unknown command '%s'", strings.ToLower(alias), strings.ToLower(command)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// lookupCommand returns the dispatch entry of the command called name, or of the
+// command name is an alias of
+func (s *RedisServer) lookupCommand(name string) (*Command, bool) {
+	name = strings.ToUpper(name)
+	if command, isAlias := s.aliases[name]; isAlias {
+		name = command
+	}
+	entry, exists := s.commands[name]
+	return entry, exists
+}
+
+// registerCommand adds a command to the dispatch table
+func (s *RedisServer) registerCommand(name string, arity int, flags CommandFlags, keys KeySpec, handler CommandHandler) {
+	s.commands[name] = &Command{Name: name, Arity: arity, Flags: flags, Keys: keys, Handler: handler}
+}
+
+// CommandsHandler handles COMMAND, which describes the commands the server knows
+type CommandsHandler struct {
+	server *RedisServer
+}
+
+func (h *CommandsHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if len(args) == 1 {
+		return h.info(writer, h.names())
+	}
+
+	switch subcommand := strings.ToUpper(args[1]); {
+	case subcommand == "COUNT" && len(args) == 2:
+		return writer.WriteInteger(len(h.server.commands) + len(h.server.aliases))
+	case subcommand == "LIST" && len(args) == 2:
+		names := h.names()
+		for i, name := range names {
+			names[i] = strings.ToLower(name)
+		}
+		return writer.WriteBulkStringArray(names)
+	case subcommand == "INFO":
+		if len(args) == 2 {
+			return h.info(writer, h.names())
+		}
+		return h.info(writer, args[2:])
+	default:
+		return writer.WriteError(fmt.Sprintf("unknown subcommand '%s'. Try COMMAND HELP.", args[1]))
+	}
+}
+
+// names returns the names of every command and alias, sorted
+func (h *CommandsHandler) names() []string {
+	names := make([]string, 0, len(h.server.commands)+len(h.server.aliases))
+	for name := range h.server.commands {
+		names = append(names, name)
+	}
+	for alias := range h.server.aliases {
+		names = append(names, alias)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// info replies with the description of each named command, null for unknown ones.
+// An alias is described as its command, under its own name.
+func (h *CommandsHandler) info(writer *resp.Writer, names []string) error {
+	reply := make([]resp.Value, len(names))
+	for i, name := range names {
+		command, exists := h.server.lookupCommand(name)
+		if !exists {
+			reply[i] = resp.Value{Type: resp.Array, IsNull: true}
+			continue
+		}
+
+		var flags, categories []resp.Value
+		for _, f := range commandFlagNames {
+			if command.Flags&f.flag != 0 {
+				flags = append(flags, resp.Value{Type: resp.SimpleString, Str: f.name})
+			}
+		}
+		for _, category := range command.aclCategories() {
+			categories = append(categories, resp.Value{Type: resp.SimpleString, Str: category})
+		}
+		reply[i] = resp.Value{Type: resp.Array, Array: []resp.Value{
+			{Type: resp.BulkString, Bulk: strings.ToLower(name)},
+			{Type: resp.Integer, Num: command.Arity},
+			{Type: resp.Set, Array: flags},
+			{Type: resp.Integer, Num: command.Keys.FirstKey},
+			{Type: resp.Integer, Num: command.Keys.LastKey},
+			{Type: resp.Integer, Num: command.Keys.Step},
+			{Type: resp.Set, Array: categories},
+			{Type: resp.Set, Array: []resp.Value{}},
+			{Type: resp.Array, Array: []resp.Value{}},
+			{Type: resp.Array, Array: []resp.Value{}},
+		}}
+	}
+	return writer.WriteArray(reply)
+}
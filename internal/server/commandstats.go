@@ -0,0 +1,126 @@
+package server
+
+import (
+	"fmt"
+	"math/bits"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBucketCount is the number of finite latency buckets: their upper bounds
+// double from 1µs up to about one second, and slower calls land in an overflow bucket
+const latencyBucketCount = 21
+
+// latencyBucketBound returns the upper bound of finite bucket i
+func latencyBucketBound(i int) time.Duration {
+	return time.Microsecond << i
+}
+
+// commandStats counts the calls of a command and their latency. Commands may run
+// concurrently, so the counters are atomic.
+type commandStats struct {
+	calls   atomic.Int64
+	usec    atomic.Int64
+	latency [latencyBucketCount + 1]atomic.Int64
+
+	// rejected counts calls refused before running, which calls leaves out;
+	// failed counts calls that ran and replied with an error
+	rejected atomic.Int64
+	failed   atomic.Int64
+
+	// histogram is the finer histogram percentiles are read from, allocated on the
+	// first call as few commands are ever used
+	histogram atomic.Pointer[latencyHistogram]
+}
+
+// record accounts for a call that ran for d
+func (st *commandStats) record(d time.Duration) {
+	st.calls.Add(1)
+	st.usec.Add(d.Microseconds())
+	st.latency[latencyBucket(d)].Add(1)
+
+	histogram := st.histogram.Load()
+	if histogram == nil {
+		st.histogram.CompareAndSwap(nil, new(latencyHistogram))
+		histogram = st.histogram.Load()
+	}
+	histogram.record(d)
+}
+
+// used reports whether the command was called since the last reset
+func (st *commandStats) used() bool {
+	return st.calls.Load() > 0 || st.rejected.Load() > 0
+}
+
+// reset zeroes the counters, for CONFIG RESETSTAT
+func (st *commandStats) reset() {
+	st.calls.Store(0)
+	st.usec.Store(0)
+	st.rejected.Store(0)
+	st.failed.Store(0)
+	st.histogram.Store(nil)
+	for i := range st.latency {
+		st.latency[i].Store(0)
+	}
+}
+
+// usedCommands returns the names of the commands called since the last reset, sorted.
+// The dispatch table is only written before serving, so it is read without a lock.
+func (s *RedisServer) usedCommands() []string {
+	var names []string
+	for name, command := range s.commands {
+		if command.stats.used() {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// commandStatsInfo renders the commandstats INFO section
+func commandStatsInfo(s *RedisServer) []string {
+	var lines []string
+	for _, name := range s.usedCommands() {
+		stats := &s.commands[name].stats
+		calls, usec := stats.calls.Load(), stats.usec.Load()
+		perCall := 0.0
+		if calls > 0 {
+			perCall = float64(usec) / float64(calls)
+		}
+		lines = append(lines, fmt.Sprintf("cmdstat_%s:calls=%d,usec=%d,usec_per_call=%.2f,rejected_calls=%d,failed_calls=%d",
+			strings.ToLower(name), calls, usec, perCall, stats.rejected.Load(), stats.failed.Load()))
+	}
+	return lines
+}
+
+// ResetStats zeroes the statistics reported by INFO and the metrics exporter, as
+// CONFIG RESETSTAT does
+func (s *RedisServer) ResetStats() {
+	s.mutex.Lock()
+	s.stats.evictedKeys = 0
+	s.stats.expiredKeys = 0
+	s.stats.keyspaceHits = 0
+	s.stats.keyspaceMisses = 0
+	s.mutex.Unlock()
+
+	s.rejectedConnections.Store(0)
+	s.connectionsReceived.Store(0)
+	s.outputLimitDisconnections.Store(0)
+	s.rateLimits.limited.Store(0)
+	s.netInputBytes.Store(0)
+	s.netOutputBytes.Store(0)
+	s.errorStats.reset()
+	for _, command := range s.commands {
+		command.stats.reset()
+	}
+}
+
+// latencyBucket returns the index of the first bucket whose bound is at least d
+func latencyBucket(d time.Duration) int {
+	if d <= time.Microsecond {
+		return 0
+	}
+	return min(bits.Len64(uint64((d-1)/time.Microsecond)), latencyBucketCount)
+}
@@ -0,0 +1,1244 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/glob"
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// Eviction policies accepted by maxmemory-policy
+const (
+	PolicyNoEviction     = "noeviction"
+	PolicyAllKeysLRU     = "allkeys-lru"
+	PolicyAllKeysLFU     = "allkeys-lfu"
+	PolicyAllKeysRandom  = "allkeys-random"
+	PolicyVolatileLRU    = "volatile-lru"
+	PolicyVolatileLFU    = "volatile-lfu"
+	PolicyVolatileRandom = "volatile-random"
+	PolicyVolatileTTL    = "volatile-ttl"
+)
+
+// Execution models accepted by execution-model
+const (
+	// ExecutionGoroutine runs each command on its connection's goroutine
+	ExecutionGoroutine = "goroutine"
+	// ExecutionWorkerPool runs commands on a bounded pool of worker goroutines, the
+	// connections still being read by a goroutine each
+	ExecutionWorkerPool = "worker-pool"
+	// ExecutionEventLoop multiplexes every connection on a single goroutine (Linux only)
+	ExecutionEventLoop = "event-loop"
+)
+
+// Actions accepted by rate-limit-action
+const (
+	// RateLimitReject replies with an error to the commands over the limits
+	RateLimitReject = "reject"
+	// RateLimitThrottle holds the commands over the limits back until they're within
+	RateLimitThrottle = "throttle"
+)
+
+// Storage engines accepted by storage-engine
+const (
+	// StorageMemory keeps the keyspace in Go maps
+	StorageMemory = "memory"
+	// StorageDisk keeps the keyspace in a Pebble database under dir
+	StorageDisk = "disk"
+)
+
+// Client certificate modes accepted by tls-auth-clients
+const (
+	// TLSAuthClientsYes requires clients to present a certificate signed by the CA
+	TLSAuthClientsYes = "yes"
+	// TLSAuthClientsNo doesn't ask clients for a certificate
+	TLSAuthClientsNo = "no"
+	// TLSAuthClientsOptional verifies a client certificate only when one is presented
+	TLSAuthClientsOptional = "optional"
+)
+
+// defaultBind is the bind list used when none is configured
+var defaultBind = []string{"*", "-::*"}
+
+// Supervision modes accepted by supervised
+const (
+	// SupervisedNo doesn't signal any service manager
+	SupervisedNo = "no"
+	// SupervisedSystemd signals readiness to systemd through NOTIFY_SOCKET
+	SupervisedSystemd = "systemd"
+	// SupervisedAuto signals systemd when NOTIFY_SOCKET is set
+	SupervisedAuto = "auto"
+)
+
+// evictionPolicies lists the accepted maxmemory-policy values
+var evictionPolicies = []string{
+	PolicyVolatileLRU,
+	PolicyVolatileLFU,
+	PolicyVolatileRandom,
+	PolicyVolatileTTL,
+	PolicyAllKeysLRU,
+	PolicyAllKeysLFU,
+	PolicyAllKeysRandom,
+	PolicyNoEviction,
+}
+
+// Config holds the server configuration
+type Config struct {
+	Bind           []string
+	BindSourceAddr string
+	ProtectedMode  bool
+	RequirePass    string
+	// UserKeys and UserChannels are the patterns of the keys and channels the
+	// default user may access, set by the user directive and ACL SETUSER
+	UserKeys         []string
+	UserChannels     []string
+	ProxyProtocol    bool
+	Supervised       string
+	Port             int
+	TLSPort          int
+	TLSCertFile      string
+	TLSKeyFile       string
+	TLSCACertFile    string
+	TLSAuthClients   string
+	UnixSocket       string
+	UnixSocketPerm   os.FileMode
+	MaxMemory        int64
+	MaxMemoryPolicy  string
+	MaxMemorySamples int
+	LFULogFactor     int
+	LFUDecayTime     int
+
+	// MaxMemoryNamespaces gives key prefixes budgets of their own, enforced by
+	// evicting within the namespace under MaxMemoryPolicy
+	MaxMemoryNamespaces []MemoryNamespace
+
+	// ExpireJitter spreads the TTLs set with a relative time randomly by up to this
+	// percentage either way, 0 to keep them exact
+	ExpireJitter int
+
+	NotifyKeyspaceEvents int
+
+	// CommandAliases are extra names of commands, each alias-command directive
+	// adding one
+	CommandAliases []CommandAlias
+
+	TCPKeepAlive  int // seconds between keepalive probes, 0 to disable
+	TCPNoDelay    bool
+	TLSTCPNoDelay bool
+
+	Acceptors int // accept loops per listening address, sharing it through SO_REUSEPORT
+
+	MaxClients int
+	Timeout    int // seconds a client may stay idle before being closed, 0 to disable
+
+	ClientOutputBufferLimit [clientClassCount]OutputLimit
+
+	// The rate limits cap the commands and the command bytes each connection and
+	// each source IP may send per second, 0 to disable; RateLimitAction picks what
+	// happens to the commands beyond them
+	RateLimitClientCommands int64
+	RateLimitClientBytes    int64
+	RateLimitIPCommands     int64
+	RateLimitIPBytes        int64
+	RateLimitAction         string
+
+	// WatchdogThreshold is the time in milliseconds a command may hold the keyspace
+	// lock before the watchdog reports it and replies -BUSY to the commands
+	// arriving meanwhile, 0 to disable the watchdog
+	WatchdogThreshold int
+
+	ProtoMaxBulkLen        int64
+	ClientQueryBufferLimit int64
+	LargeBulkThreshold     int64
+	ProtoMaxMultibulkLen   int
+	ProtoMaxNestingDepth   int
+	StrictProtocol         bool
+	IOReadBufferSize       int64
+	IOWriteBufferSize      int64
+
+	ExecutionModel string
+	WorkerPoolSize int
+
+	// GCPercent and GCMemoryLimit tune the Go garbage collector as GOGC and
+	// GOMEMLIMIT, which they default to: the heap growth triggering a collection,
+	// -1 to disable it, and the soft memory limit in bytes, 0 for none
+	GCPercent     int
+	GCMemoryLimit int64
+
+	// The lazyfree-lazy-* settings are accepted for compatibility with Redis
+	// configuration files, and have no effect: deleted values are left to the garbage
+	// collector, which reclaims them off the store lock either way
+	LazyFreeEviction  bool
+	LazyFreeExpire    bool
+	LazyFreeUserDel   bool
+	LazyFreeUserFlush bool
+
+	Dir        string
+	DBFilename string
+	// LazyLoading loads the dump file in the background on startup, serving clients
+	// meanwhile
+	LazyLoading bool
+
+	// StorageEngine holds the keyspace; the disk engine lives in StorageDiskDir,
+	// relative to Dir, with a block cache of StorageDiskCache bytes
+	StorageEngine    string
+	StorageDiskDir   string
+	StorageDiskCache int64
+
+	// SnapshotUploadEndpoint is the S3-compatible object storage each successful
+	// BGSAVE uploads the dump file to, in SnapshotUploadBucket under
+	// SnapshotUploadPrefix, keeping the last SnapshotUploadRetention uploads (0 keeps
+	// them all). Empty disables uploads.
+	SnapshotUploadEndpoint  string
+	SnapshotUploadBucket    string
+	SnapshotUploadPrefix    string
+	SnapshotUploadRegion    string
+	SnapshotUploadAccessKey string
+	SnapshotUploadSecretKey string
+	SnapshotUploadRetention int
+
+	// SaveOnShutdown writes a final snapshot when a signal stops the server
+	SaveOnShutdown  bool
+	ShutdownTimeout int // seconds clients get to drain on shutdown
+
+	// KeyPrefixIndex maintains a radix tree of key names for KEYS/SCAN MATCH
+	KeyPrefixIndex bool
+
+	// HotKeysTracking tracks the most read keys for HOTKEYS; HotKeysReplyCache
+	// additionally caches their encoded GET replies
+	HotKeysTracking   bool
+	HotKeysReplyCache bool
+
+	// LogLevel filters the log, written to LogFile (stdout when empty) in LogFormat
+	LogLevel  string
+	LogFile   string
+	LogFormat string
+
+	// SlowlogLogSlowerThan is the run time in microseconds from which commands are
+	// recorded in the slow log of SlowlogMaxLen entries, -1 to disable it. Slow
+	// commands are also streamed to the log, a pub/sub channel and a webhook URL
+	// when the SlowlogSink settings are set.
+	SlowlogLogSlowerThan int64
+	SlowlogMaxLen        int
+	SlowlogSinkLog       bool
+	SlowlogSinkChannel   string
+	SlowlogSinkWebhook   string
+
+	// AuditLog receives a JSON record per command of AuditCategories, empty to
+	// disable auditing
+	AuditLog        string
+	AuditCategories []string
+
+	// AdminPort serves the HTTP admin endpoint (/metrics) on AdminBind, 0 to disable;
+	// AdminPprof adds the net/http/pprof profiles under /debug/pprof/
+	AdminBind  string
+	AdminPort  int
+	AdminPprof bool
+
+	// TracingEndpoint is the OTLP/HTTP collector receiving a span per command,
+	// empty to disable tracing; TracingSampleRatio is the share of traces sampled
+	TracingEndpoint    string
+	TracingSampleRatio float64
+}
+
+// DefaultConfig returns the configuration used when no options are given
+func DefaultConfig() *Config {
+	return &Config{
+		Bind:                    slices.Clone(defaultBind),
+		ProtectedMode:           true,
+		Port:                    6379,
+		TLSAuthClients:          TLSAuthClientsYes,
+		MaxMemory:               0,
+		MaxMemoryPolicy:         PolicyNoEviction,
+		UserKeys:                []string{"*"},
+		UserChannels:            []string{"*"},
+		MaxMemorySamples:        5,
+		LFULogFactor:            10,
+		LFUDecayTime:            1,
+		TCPKeepAlive:            300,
+		TCPNoDelay:              true,
+		TLSTCPNoDelay:           true,
+		Acceptors:               1,
+		MaxClients:              10000,
+		ClientOutputBufferLimit: defaultOutputLimits,
+		RateLimitAction:         RateLimitReject,
+		ProtoMaxBulkLen:         resp.DefaultMaxBulkLen,
+		ClientQueryBufferLimit:  resp.DefaultQueryBufferLimit,
+		LargeBulkThreshold:      resp.DefaultLargeBulkThreshold,
+		ProtoMaxMultibulkLen:    resp.DefaultMaxMultibulkLen,
+		ProtoMaxNestingDepth:    resp.DefaultMaxNestingDepth,
+		IOReadBufferSize:        DefaultIOBufferSize,
+		IOWriteBufferSize:       DefaultIOBufferSize,
+		ExecutionModel:          ExecutionGoroutine,
+		WorkerPoolSize:          runtime.NumCPU(),
+		GCPercent:               envGCPercent(),
+		GCMemoryLimit:           runtimeMemoryLimit(),
+		Dir:                     ".",
+		DBFilename:              "dump.rdb",
+		StorageEngine:           StorageMemory,
+		StorageDiskDir:          "keyspace",
+		StorageDiskCache:        64 * 1024 * 1024,
+		SnapshotUploadRegion:    "us-east-1",
+		ShutdownTimeout:         10,
+		LogLevel:                LogNotice,
+		LogFormat:               LogFormatText,
+		AuditCategories:         slices.Clone(defaultAuditCategories),
+		SlowlogLogSlowerThan:    10000,
+		SlowlogMaxLen:           128,
+		AdminBind:               "127.0.0.1",
+		TracingSampleRatio:      1,
+	}
+}
+
+// configParam describes a single configuration directive
+type configParam struct {
+	name    string
+	mutable bool
+	get     func(c *Config) string
+	set     func(c *Config, value string) error
+}
+
+// configParams lists every directive understood by CONFIG GET/SET and the command line
+var configParams = []configParam{
+	{
+		name: "bind",
+		get:  func(c *Config) string { return strings.Join(c.Bind, " ") },
+		set: func(c *Config, value string) error {
+			addresses := strings.Fields(value)
+			if len(addresses) == 0 {
+				return fmt.Errorf("argument must contain at least one address")
+			}
+			for _, address := range addresses {
+				if _, err := parseBindAddress(address); err != nil {
+					return err
+				}
+			}
+			c.Bind = addresses
+			return nil
+		},
+	},
+	{
+		name: "bind-source-addr",
+		get:  func(c *Config) string { return c.BindSourceAddr },
+		set: func(c *Config, value string) error {
+			if value != "" && net.ParseIP(value) == nil {
+				return fmt.Errorf("argument must be an IP address")
+			}
+			c.BindSourceAddr = value
+			return nil
+		},
+	},
+	boolParam("protected-mode", func(c *Config) *bool { return &c.ProtectedMode }),
+	{
+		name:    "requirepass",
+		mutable: true,
+		get:     func(c *Config) string { return c.RequirePass },
+		set: func(c *Config, value string) error {
+			c.RequirePass = value
+			return nil
+		},
+	},
+	{
+		name: "user",
+		get:  formatUser,
+		set:  parseUser,
+	},
+	immutable(boolParam("proxy-protocol", func(c *Config) *bool { return &c.ProxyProtocol })),
+	{
+		name: "supervised",
+		get:  func(c *Config) string { return c.Supervised },
+		set: func(c *Config, value string) error {
+			mode := strings.ToLower(value)
+			switch mode {
+			case SupervisedNo, SupervisedSystemd, SupervisedAuto:
+				c.Supervised = mode
+				return nil
+			}
+			return fmt.Errorf("argument must be one of the following: %s, %s, %s", SupervisedNo, SupervisedSystemd, SupervisedAuto)
+		},
+	},
+	portParam("port", func(c *Config) *int { return &c.Port }),
+	portParam("tls-port", func(c *Config) *int { return &c.TLSPort }),
+	stringParam("tls-cert-file", func(c *Config) *string { return &c.TLSCertFile }),
+	stringParam("tls-key-file", func(c *Config) *string { return &c.TLSKeyFile }),
+	stringParam("tls-ca-cert-file", func(c *Config) *string { return &c.TLSCACertFile }),
+	stringParam("unixsocket", func(c *Config) *string { return &c.UnixSocket }),
+	{
+		name: "unixsocketperm",
+		get:  func(c *Config) string { return strconv.FormatUint(uint64(c.UnixSocketPerm), 8) },
+		set: func(c *Config, value string) error {
+			perm, err := strconv.ParseUint(value, 8, 32)
+			if err != nil || perm > 0o777 {
+				return fmt.Errorf("argument must be an octal permission mask such as 700")
+			}
+			c.UnixSocketPerm = os.FileMode(perm)
+			return nil
+		},
+	},
+	{
+		name: "tls-auth-clients",
+		get:  func(c *Config) string { return c.TLSAuthClients },
+		set: func(c *Config, value string) error {
+			mode := strings.ToLower(value)
+			switch mode {
+			case TLSAuthClientsYes, TLSAuthClientsNo, TLSAuthClientsOptional:
+				c.TLSAuthClients = mode
+				return nil
+			}
+			return fmt.Errorf("argument must be one of the following: %s, %s, %s", TLSAuthClientsYes, TLSAuthClientsNo, TLSAuthClientsOptional)
+		},
+	},
+	{
+		name:    "dir",
+		mutable: true,
+		get:     func(c *Config) string { return c.Dir },
+		set: func(c *Config, value string) error {
+			info, err := os.Stat(value)
+			if err != nil || !info.IsDir() {
+				return fmt.Errorf("No such file or directory")
+			}
+			c.Dir = value
+			return nil
+		},
+	},
+	immutable(boolParam("lazy-loading", func(c *Config) *bool { return &c.LazyLoading })),
+	{
+		name:    "dbfilename",
+		mutable: true,
+		get:     func(c *Config) string { return c.DBFilename },
+		set: func(c *Config, value string) error {
+			if value == "" || filepath.Base(value) != value {
+				return fmt.Errorf("dbfilename can't be a path, just a filename")
+			}
+			c.DBFilename = value
+			return nil
+		},
+	},
+	{
+		name:    "maxmemory",
+		mutable: true,
+		get:     func(c *Config) string { return strconv.FormatInt(c.MaxMemory, 10) },
+		set: func(c *Config, value string) error {
+			bytes, err := parseMemory(value)
+			if err != nil {
+				return err
+			}
+			c.MaxMemory = bytes
+			return nil
+		},
+	},
+	{
+		name:    "maxmemory-policy",
+		mutable: true,
+		get:     func(c *Config) string { return c.MaxMemoryPolicy },
+		set: func(c *Config, value string) error {
+			policy := strings.ToLower(value)
+			for _, accepted := range evictionPolicies {
+				if policy == accepted {
+					c.MaxMemoryPolicy = policy
+					return nil
+				}
+			}
+			return fmt.Errorf("argument(s) must be one of the following: %s", strings.Join(evictionPolicies, ", "))
+		},
+	},
+	{
+		name:    "maxmemory-samples",
+		mutable: true,
+		get:     func(c *Config) string { return strconv.Itoa(c.MaxMemorySamples) },
+		set: func(c *Config, value string) error {
+			samples, err := strconv.Atoi(value)
+			if err != nil || samples < 1 || samples > 64 {
+				return fmt.Errorf("argument must be between 1 and 64 inclusive")
+			}
+			c.MaxMemorySamples = samples
+			return nil
+		},
+	},
+	{
+		name:    "maxmemory-namespaces",
+		mutable: true,
+		get:     func(c *Config) string { return formatNamespaces(c.MaxMemoryNamespaces) },
+		set: func(c *Config, value string) error {
+			namespaces, err := parseNamespaces(value)
+			if err != nil {
+				return err
+			}
+			c.MaxMemoryNamespaces = namespaces
+			return nil
+		},
+	},
+	{
+		name:    "expire-jitter",
+		mutable: true,
+		get:     func(c *Config) string { return strconv.Itoa(c.ExpireJitter) },
+		set: func(c *Config, value string) error {
+			percent, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+			if err != nil || percent < 0 || percent > 100 {
+				return fmt.Errorf("argument must be a percentage between 0 and 100")
+			}
+			c.ExpireJitter = percent
+			return nil
+		},
+	},
+	{
+		name: "alias-command",
+		get:  func(c *Config) string { return formatAliases(c.CommandAliases) },
+		set: func(c *Config, value string) error {
+			return parseAlias(value, &c.CommandAliases)
+		},
+	},
+	{
+		name:    "notify-keyspace-events",
+		mutable: true,
+		get:     func(c *Config) string { return formatNotifyFlags(c.NotifyKeyspaceEvents) },
+		set: func(c *Config, value string) error {
+			flags, err := parseNotifyFlags(value)
+			if err != nil {
+				return err
+			}
+			c.NotifyKeyspaceEvents = flags
+			return nil
+		},
+	},
+	{
+		name:    "tcp-keepalive",
+		mutable: true,
+		get:     func(c *Config) string { return strconv.Itoa(c.TCPKeepAlive) },
+		set: func(c *Config, value string) error {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 0 {
+				return fmt.Errorf("argument must be a non-negative integer")
+			}
+			c.TCPKeepAlive = seconds
+			return nil
+		},
+	},
+	boolParam("tcp-nodelay", func(c *Config) *bool { return &c.TCPNoDelay }),
+	boolParam("tls-tcp-nodelay", func(c *Config) *bool { return &c.TLSTCPNoDelay }),
+	{
+		name: "acceptors",
+		get:  func(c *Config) string { return strconv.Itoa(c.Acceptors) },
+		set: func(c *Config, value string) error {
+			acceptors, err := strconv.Atoi(value)
+			if err != nil || acceptors < 1 {
+				return fmt.Errorf("argument must be a positive integer")
+			}
+			c.Acceptors = acceptors
+			return nil
+		},
+	},
+	{
+		name:    "maxclients",
+		mutable: true,
+		get:     func(c *Config) string { return strconv.Itoa(c.MaxClients) },
+		set: func(c *Config, value string) error {
+			clients, err := strconv.Atoi(value)
+			if err != nil || clients < 1 {
+				return fmt.Errorf("argument must be a positive integer")
+			}
+			c.MaxClients = clients
+			return nil
+		},
+	},
+	{
+		name:    "timeout",
+		mutable: true,
+		get:     func(c *Config) string { return strconv.Itoa(c.Timeout) },
+		set: func(c *Config, value string) error {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 0 {
+				return fmt.Errorf("argument must be a non-negative integer")
+			}
+			c.Timeout = seconds
+			return nil
+		},
+	},
+	{
+		name:    "client-output-buffer-limit",
+		mutable: true,
+		get:     func(c *Config) string { return formatOutputLimits(c.ClientOutputBufferLimit) },
+		set: func(c *Config, value string) error {
+			return parseOutputLimits(value, &c.ClientOutputBufferLimit)
+		},
+	},
+	rateParam("rate-limit-client-commands", func(c *Config) *int64 { return &c.RateLimitClientCommands }),
+	memoryParam("rate-limit-client-bytes", 0, func(c *Config) *int64 { return &c.RateLimitClientBytes }),
+	rateParam("rate-limit-ip-commands", func(c *Config) *int64 { return &c.RateLimitIPCommands }),
+	memoryParam("rate-limit-ip-bytes", 0, func(c *Config) *int64 { return &c.RateLimitIPBytes }),
+	{
+		name:    "rate-limit-action",
+		mutable: true,
+		get:     func(c *Config) string { return c.RateLimitAction },
+		set: func(c *Config, value string) error {
+			action := strings.ToLower(value)
+			switch action {
+			case RateLimitReject, RateLimitThrottle:
+				c.RateLimitAction = action
+				return nil
+			}
+			return fmt.Errorf("argument must be one of the following: %s, %s", RateLimitReject, RateLimitThrottle)
+		},
+	},
+	{
+		name:    "proto-max-bulk-len",
+		mutable: true,
+		get:     func(c *Config) string { return strconv.FormatInt(c.ProtoMaxBulkLen, 10) },
+		set: func(c *Config, value string) error {
+			bytes, err := parseMemory(value)
+			if err != nil {
+				return err
+			}
+			if bytes < 1024*1024 {
+				return fmt.Errorf("argument must be at least 1mb")
+			}
+			c.ProtoMaxBulkLen = bytes
+			return nil
+		},
+	},
+	memoryParam("client-query-buffer-limit", 1024*1024, func(c *Config) *int64 { return &c.ClientQueryBufferLimit }),
+	memoryParam("large-bulk-threshold", 1024, func(c *Config) *int64 { return &c.LargeBulkThreshold }),
+	{
+		name:    "proto-max-multibulk-len",
+		mutable: true,
+		get:     func(c *Config) string { return strconv.Itoa(c.ProtoMaxMultibulkLen) },
+		set: func(c *Config, value string) error {
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1024 {
+				return fmt.Errorf("argument must be an integer of at least 1024")
+			}
+			c.ProtoMaxMultibulkLen = count
+			return nil
+		},
+	},
+	{
+		name:    "proto-max-nesting-depth",
+		mutable: true,
+		get:     func(c *Config) string { return strconv.Itoa(c.ProtoMaxNestingDepth) },
+		set: func(c *Config, value string) error {
+			depth, err := strconv.Atoi(value)
+			if err != nil || depth < 1 {
+				return fmt.Errorf("argument must be a positive integer")
+			}
+			c.ProtoMaxNestingDepth = depth
+			return nil
+		},
+	},
+	boolParam("strict-protocol", func(c *Config) *bool { return &c.StrictProtocol }),
+	memoryParam("io-read-buffer-size", 512, func(c *Config) *int64 { return &c.IOReadBufferSize }),
+	memoryParam("io-write-buffer-size", 512, func(c *Config) *int64 { return &c.IOWriteBufferSize }),
+	{
+		name: "execution-model",
+		get:  func(c *Config) string { return c.ExecutionModel },
+		set: func(c *Config, value string) error {
+			model := strings.ToLower(value)
+			switch model {
+			case ExecutionGoroutine, ExecutionWorkerPool, ExecutionEventLoop:
+				c.ExecutionModel = model
+				return nil
+			}
+			return fmt.Errorf("argument must be one of the following: %s, %s, %s", ExecutionGoroutine, ExecutionWorkerPool, ExecutionEventLoop)
+		},
+	},
+	{
+		name: "worker-pool-size",
+		get:  func(c *Config) string { return strconv.Itoa(c.WorkerPoolSize) },
+		set: func(c *Config, value string) error {
+			size, err := strconv.Atoi(value)
+			if err != nil || size < 1 {
+				return fmt.Errorf("argument must be a positive integer")
+			}
+			c.WorkerPoolSize = size
+			return nil
+		},
+	},
+	{
+		name:    "gc-percent",
+		mutable: true,
+		get:     func(c *Config) string { return formatGCPercent(c.GCPercent) },
+		set: func(c *Config, value string) error {
+			percent, err := parseGCPercent(value)
+			if err != nil {
+				return fmt.Errorf("argument must be 'off' or a non-negative integer")
+			}
+			c.GCPercent = percent
+			return nil
+		},
+	},
+	memoryParam("gc-memory-limit", 0, func(c *Config) *int64 { return &c.GCMemoryLimit }),
+	boolParam("lazyfree-lazy-eviction", func(c *Config) *bool { return &c.LazyFreeEviction }),
+	boolParam("lazyfree-lazy-expire", func(c *Config) *bool { return &c.LazyFreeExpire }),
+	boolParam("lazyfree-lazy-user-del", func(c *Config) *bool { return &c.LazyFreeUserDel }),
+	boolParam("lazyfree-lazy-user-flush", func(c *Config) *bool { return &c.LazyFreeUserFlush }),
+	boolParam("save-on-shutdown", func(c *Config) *bool { return &c.SaveOnShutdown }),
+	{
+		name: "storage-engine",
+		get:  func(c *Config) string { return c.StorageEngine },
+		set: func(c *Config, value string) error {
+			engine := strings.ToLower(value)
+			switch engine {
+			case StorageMemory, StorageDisk:
+				c.StorageEngine = engine
+				return nil
+			}
+			return fmt.Errorf("argument must be one of the following: %s, %s", StorageMemory, StorageDisk)
+		},
+	},
+	stringParam("storage-disk-dir", func(c *Config) *string { return &c.StorageDiskDir }),
+	immutable(memoryParam("storage-disk-cache", 1024*1024, func(c *Config) *int64 { return &c.StorageDiskCache })),
+	{
+		name:    "shutdown-timeout",
+		mutable: true,
+		get:     func(c *Config) string { return strconv.Itoa(c.ShutdownTimeout) },
+		set: func(c *Config, value string) error {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 0 {
+				return fmt.Errorf("argument must be a non-negative integer")
+			}
+			c.ShutdownTimeout = seconds
+			return nil
+		},
+	},
+	{
+		name:    "snapshot-upload-endpoint",
+		mutable: true,
+		get:     func(c *Config) string { return c.SnapshotUploadEndpoint },
+		set: func(c *Config, value string) error {
+			if value != "" {
+				u, err := url.Parse(value)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf("argument must be an http or https URL")
+				}
+			}
+			c.SnapshotUploadEndpoint = value
+			return nil
+		},
+	},
+	mutable(stringParam("snapshot-upload-bucket", func(c *Config) *string { return &c.SnapshotUploadBucket })),
+	mutable(stringParam("snapshot-upload-prefix", func(c *Config) *string { return &c.SnapshotUploadPrefix })),
+	mutable(stringParam("snapshot-upload-region", func(c *Config) *string { return &c.SnapshotUploadRegion })),
+	mutable(stringParam("snapshot-upload-access-key", func(c *Config) *string { return &c.SnapshotUploadAccessKey })),
+	mutable(stringParam("snapshot-upload-secret-key", func(c *Config) *string { return &c.SnapshotUploadSecretKey })),
+	{
+		name:    "snapshot-upload-retention",
+		mutable: true,
+		get:     func(c *Config) string { return strconv.Itoa(c.SnapshotUploadRetention) },
+		set: func(c *Config, value string) error {
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 0 {
+				return fmt.Errorf("argument must be a non-negative integer")
+			}
+			c.SnapshotUploadRetention = count
+			return nil
+		},
+	},
+	{
+		name:    "loglevel",
+		mutable: true,
+		get:     func(c *Config) string { return c.LogLevel },
+		set: func(c *Config, value string) error {
+			level, err := parseLogLevel(value)
+			if err != nil {
+				return err
+			}
+			c.LogLevel = level
+			return nil
+		},
+	},
+	stringParam("logfile", func(c *Config) *string { return &c.LogFile }),
+	{
+		name:    "slowlog-log-slower-than",
+		mutable: true,
+		get:     func(c *Config) string { return strconv.FormatInt(c.SlowlogLogSlowerThan, 10) },
+		set: func(c *Config, value string) error {
+			threshold, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || threshold < -1 {
+				return fmt.Errorf("argument must be -1 or a non-negative integer")
+			}
+			c.SlowlogLogSlowerThan = threshold
+			return nil
+		},
+	},
+	{
+		name:    "slowlog-max-len",
+		mutable: true,
+		get:     func(c *Config) string { return strconv.Itoa(c.SlowlogMaxLen) },
+		set: func(c *Config, value string) error {
+			length, err := strconv.Atoi(value)
+			if err != nil || length < 0 {
+				return fmt.Errorf("argument must be a non-negative integer")
+			}
+			c.SlowlogMaxLen = length
+			return nil
+		},
+	},
+	boolParam("slowlog-sink-log", func(c *Config) *bool { return &c.SlowlogSinkLog }),
+	{
+		name:    "slowlog-sink-channel",
+		mutable: true,
+		get:     func(c *Config) string { return c.SlowlogSinkChannel },
+		set: func(c *Config, value string) error {
+			c.SlowlogSinkChannel = value
+			return nil
+		},
+	},
+	{
+		name:    "slowlog-sink-webhook",
+		mutable: true,
+		get:     func(c *Config) string { return c.SlowlogSinkWebhook },
+		set: func(c *Config, value string) error {
+			if value != "" {
+				u, err := url.Parse(value)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf("argument must be an http or https URL")
+				}
+			}
+			c.SlowlogSinkWebhook = value
+			return nil
+		},
+	},
+	stringParam("audit-log", func(c *Config) *string { return &c.AuditLog }),
+	{
+		name:    "audit-categories",
+		mutable: true,
+		get:     func(c *Config) string { return strings.Join(c.AuditCategories, " ") },
+		set: func(c *Config, value string) error {
+			categories, err := parseAuditCategories(value)
+			if err != nil {
+				return err
+			}
+			c.AuditCategories = categories
+			return nil
+		},
+	},
+	{
+		name: "log-format",
+		get:  func(c *Config) string { return c.LogFormat },
+		set: func(c *Config, value string) error {
+			format := strings.ToLower(value)
+			switch format {
+			case LogFormatText, LogFormatJSON:
+				c.LogFormat = format
+				return nil
+			}
+			return fmt.Errorf("argument must be one of the following: %s, %s", LogFormatText, LogFormatJSON)
+		},
+	},
+	{
+		name: "admin-bind",
+		get:  func(c *Config) string { return c.AdminBind },
+		set: func(c *Config, value string) error {
+			if value != "" && value != "localhost" && net.ParseIP(value) == nil {
+				return fmt.Errorf("argument must be an IP address")
+			}
+			c.AdminBind = value
+			return nil
+		},
+	},
+	portParam("admin-port", func(c *Config) *int { return &c.AdminPort }),
+	immutable(boolParam("admin-pprof", func(c *Config) *bool { return &c.AdminPprof })),
+	{
+		name: "tracing-endpoint",
+		get:  func(c *Config) string { return c.TracingEndpoint },
+		set: func(c *Config, value string) error {
+			if value != "" {
+				u, err := url.Parse(value)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf("argument must be an http or https URL")
+				}
+			}
+			c.TracingEndpoint = value
+			return nil
+		},
+	},
+	{
+		name: "tracing-sample-ratio",
+		get:  func(c *Config) string { return strconv.FormatFloat(c.TracingSampleRatio, 'g', -1, 64) },
+		set: func(c *Config, value string) error {
+			ratio, err := strconv.ParseFloat(value, 64)
+			if err != nil || ratio < 0 || ratio > 1 {
+				return fmt.Errorf("argument must be a number between 0 and 1")
+			}
+			c.TracingSampleRatio = ratio
+			return nil
+		},
+	},
+	boolParam("key-prefix-index", func(c *Config) *bool { return &c.KeyPrefixIndex }),
+	boolParam("hotkeys-tracking", func(c *Config) *bool { return &c.HotKeysTracking }),
+	boolParam("hotkeys-reply-cache", func(c *Config) *bool { return &c.HotKeysReplyCache }),
+	{
+		name:    "lfu-log-factor",
+		mutable: true,
+		get:     func(c *Config) string { return strconv.Itoa(c.LFULogFactor) },
+		set: func(c *Config, value string) error {
+			factor, err := strconv.Atoi(value)
+			if err != nil || factor < 0 {
+				return fmt.Errorf("argument must be a non-negative integer")
+			}
+			c.LFULogFactor = factor
+			return nil
+		},
+	},
+	{
+		name:    "lfu-decay-time",
+		mutable: true,
+		get:     func(c *Config) string { return strconv.Itoa(c.LFUDecayTime) },
+		set: func(c *Config, value string) error {
+			minutes, err := strconv.Atoi(value)
+			if err != nil || minutes < 0 {
+				return fmt.Errorf("argument must be a non-negative integer")
+			}
+			c.LFUDecayTime = minutes
+			return nil
+		},
+	},
+	{
+		name:    "watchdog-threshold",
+		mutable: true,
+		get:     func(c *Config) string { return strconv.Itoa(c.WatchdogThreshold) },
+		set: func(c *Config, value string) error {
+			milliseconds, err := strconv.Atoi(value)
+			if err != nil || milliseconds < 0 {
+				return fmt.Errorf("argument must be a non-negative integer")
+			}
+			c.WatchdogThreshold = milliseconds
+			return nil
+		},
+	},
+}
+
+// boolParam builds a mutable yes/no directive backed by the field returned by field
+func boolParam(name string, field func(c *Config) *bool) configParam {
+	return configParam{
+		name:    name,
+		mutable: true,
+		get: func(c *Config) string {
+			if *field(c) {
+				return "yes"
+			}
+			return "no"
+		},
+		set: func(c *Config, value string) error {
+			switch strings.ToLower(value) {
+			case "yes":
+				*field(c) = true
+			case "no":
+				*field(c) = false
+			default:
+				return fmt.Errorf("argument must be 'yes' or 'no'")
+			}
+			return nil
+		},
+	}
+}
+
+// immutable restricts a directive to the command line
+func immutable(param configParam) configParam {
+	param.mutable = false
+	return param
+}
+
+// mutable lets CONFIG SET change a directive
+func mutable(param configParam) configParam {
+	param.mutable = true
+	return param
+}
+
+// portParam builds an immutable TCP port directive; 0 disables the listener
+func portParam(name string, field func(c *Config) *int) configParam {
+	return configParam{
+		name: name,
+		get:  func(c *Config) string { return strconv.Itoa(*field(c)) },
+		set: func(c *Config, value string) error {
+			port, err := strconv.Atoi(value)
+			if err != nil || port < 0 || port > 65535 {
+				return fmt.Errorf("argument must be a valid port number")
+			}
+			*field(c) = port
+			return nil
+		},
+	}
+}
+
+// stringParam builds an immutable free-form directive
+func stringParam(name string, field func(c *Config) *string) configParam {
+	return configParam{
+		name: name,
+		get:  func(c *Config) string { return *field(c) },
+		set: func(c *Config, value string) error {
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+// memoryParam builds a mutable byte-size directive with a lower bound, backed by the
+// field returned by field
+func memoryParam(name string, minimum int64, field func(c *Config) *int64) configParam {
+	return configParam{
+		name:    name,
+		mutable: true,
+		get:     func(c *Config) string { return strconv.FormatInt(*field(c), 10) },
+		set: func(c *Config, value string) error {
+			bytes, err := parseMemory(value)
+			if err != nil {
+				return err
+			}
+			if bytes < minimum {
+				return fmt.Errorf("argument must be at least %d bytes", minimum)
+			}
+			*field(c) = bytes
+			return nil
+		},
+	}
+}
+
+// rateParam builds a mutable per-second rate directive, 0 to disable
+func rateParam(name string, field func(c *Config) *int64) configParam {
+	return configParam{
+		name:    name,
+		mutable: true,
+		get:     func(c *Config) string { return strconv.FormatInt(*field(c), 10) },
+		set: func(c *Config, value string) error {
+			rate, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || rate < 0 {
+				return fmt.Errorf("argument must be a non-negative integer")
+			}
+			*field(c) = rate
+			return nil
+		},
+	}
+}
+
+// findConfigParam looks up a directive by name (case-insensitive)
+func findConfigParam(name string) *configParam {
+	name = strings.ToLower(name)
+	for i := range configParams {
+		if configParams[i].name == name {
+			return &configParams[i]
+		}
+	}
+	return nil
+}
+
+// Set applies a single directive
+func (c *Config) Set(name, value string) error {
+	param := findConfigParam(name)
+	if param == nil {
+		return fmt.Errorf("unknown option '%s'", name)
+	}
+	return param.set(c, value)
+}
+
+// ParseArgs builds a configuration from redis-server style arguments: an optional
+// configuration file, then "--name value" directives overriding it. Every invalid
+// directive is reported rather than just the first, joined in the error returned.
+func ParseArgs(args []string) (*Config, error) {
+	config := DefaultConfig()
+	var errs []error
+
+	if len(args) > 0 && !strings.HasPrefix(args[0], "--") {
+		errs = append(errs, config.loadFile(args[0])...)
+		args = args[1:]
+	}
+	for i := 0; i < len(args); i++ {
+		name := args[i]
+		if !strings.HasPrefix(name, "--") {
+			errs = append(errs, fmt.Errorf("unexpected argument '%s'", name))
+			continue
+		}
+		if i+1 >= len(args) {
+			errs = append(errs, fmt.Errorf("missing value for '%s'", name))
+			break
+		}
+		if err := config.apply(strings.TrimPrefix(name, "--"), args[i+1]); err != nil {
+			errs = append(errs, fmt.Errorf("'%s': %w", name, err))
+		}
+		i++
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return config, nil
+}
+
+// loadFile applies the directives of a redis.conf style file: a directive per line
+// followed by its arguments, quoted as in inline commands, with '#' comments.
+// Arguments are joined by spaces, as in "save 3600 1". The errors are prefixed by
+// the position of their directive.
+func (c *Config) loadFile(path string) []error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []error{err}
+	}
+	var errs []error
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		args, err := resp.SplitArgs(line)
+		switch {
+		case err != nil:
+			err = fmt.Errorf("unbalanced quotes")
+		case len(args) < 2:
+			err = fmt.Errorf("missing value for '%s'", args[0])
+		default:
+			if err = c.apply(args[0], strings.Join(args[1:], " ")); err != nil {
+				err = fmt.Errorf("'%s': %w", args[0], err)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %w", path, i+1, err))
+		}
+	}
+	return errs
+}
+
+// apply sets a directive given on startup, telling unknown directives apart from
+// invalid values
+func (c *Config) apply(name, value string) error {
+	param := findConfigParam(name)
+	if param == nil {
+		return fmt.Errorf("unknown directive")
+	}
+	if err := param.set(c, value); err != nil {
+		return fmt.Errorf("invalid value '%s': %w", value, err)
+	}
+	return nil
+}
+
+// parseMemory parses a memory amount such as "100mb" or "1gb" into bytes
+func parseMemory(value string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"kb", 1024},
+		{"mb", 1024 * 1024},
+		{"gb", 1024 * 1024 * 1024},
+		{"k", 1000},
+		{"m", 1000 * 1000},
+		{"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+
+	lower := strings.ToLower(value)
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower = strings.TrimSuffix(lower, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	amount, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || amount < 0 {
+		return 0, fmt.Errorf("argument must be a memory value")
+	}
+	return amount * multiplier, nil
+}
+
+// ConfigHandler handles CONFIG GET/SET/RESETSTAT commands
+type ConfigHandler struct {
+	server *RedisServer
+}
+
+func (h *ConfigHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if len(args) < 2 {
+		return writer.WriteError("wrong number of arguments for 'config' command")
+	}
+
+	switch strings.ToUpper(args[1]) {
+	case "GET":
+		return h.get(args, writer)
+	case "SET":
+		return h.set(args, writer)
+	case "RESETSTAT":
+		if len(args) != 2 {
+			return writer.WriteError("wrong number of arguments for 'config|resetstat' command")
+		}
+		h.server.ResetStats()
+		return writer.WriteSimpleString("OK")
+	default:
+		return writer.WriteError(fmt.Sprintf("unknown subcommand '%s'", args[1]))
+	}
+}
+
+// get replies with name/value pairs for every directive matching the given patterns
+func (h *ConfigHandler) get(args []string, writer *resp.Writer) error {
+	if len(args) < 3 {
+		return writer.WriteError("wrong number of arguments for 'config|get' command")
+	}
+
+	h.server.mutex.RLock()
+	var reply []resp.Value
+	for _, param := range configParams {
+		for _, pattern := range args[2:] {
+			if glob.Match(strings.ToLower(pattern), param.name) {
+				reply = append(reply,
+					resp.Value{Type: resp.BulkString, Bulk: param.name},
+					resp.Value{Type: resp.BulkString, Bulk: param.get(h.server.config)})
+				break
+			}
+		}
+	}
+	h.server.mutex.RUnlock()
+
+	return writer.WriteMap(reply)
+}
+
+// set applies name/value pairs atomically: either every directive is applied or none is
+func (h *ConfigHandler) set(args []string, writer *resp.Writer) error {
+	if len(args) < 4 || len(args)%2 != 0 {
+		return writer.WriteError("wrong number of arguments for 'config|set' command")
+	}
+
+	h.server.mutex.Lock()
+	err := h.server.applyConfig(args[2:])
+	h.server.mutex.Unlock()
+
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	return writer.WriteSimpleString("OK")
+}
+
+// applyConfig validates and applies name/value pairs to the running configuration.
+// Must be called with the server mutex held.
+func (s *RedisServer) applyConfig(pairs []string) error {
+	updated := *s.config
+	for i := 0; i+1 < len(pairs); i += 2 {
+		param := findConfigParam(pairs[i])
+		if param == nil {
+			return fmt.Errorf("Unknown option or number of arguments for CONFIG SET - '%s'", pairs[i])
+		}
+		if !param.mutable {
+			return fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - can't set immutable config", param.name)
+		}
+		if err := param.set(&updated, pairs[i+1]); err != nil {
+			return fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - %v", param.name, err)
+		}
+	}
+	*s.config = updated
+	s.syncPrefixIndex()
+	s.syncHotKeys()
+	s.syncLogLevel()
+	s.syncSlowLog()
+	s.syncRateLimits()
+	s.syncWatchdog()
+	s.syncNamespaces()
+	s.syncGC()
+	return nil
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// DefaultIOBufferSize is the default size of the per-connection read and write buffers
+const DefaultIOBufferSize = 4096
+
+// Buffer pools recycle per-connection bufio buffers of the default size so connection
+// churn doesn't allocate a fresh pair of buffers for every client
+var (
+	readerPool = sync.Pool{New: func() interface{} { return bufio.NewReaderSize(nil, DefaultIOBufferSize) }}
+	writerPool = sync.Pool{New: func() interface{} { return bufio.NewWriterSize(nil, DefaultIOBufferSize) }}
+)
+
+// ConnectionOptions holds the per-connection settings, sampled when a client connects
+type ConnectionOptions struct {
+	ReadBufferSize  int
+	WriteBufferSize int
+	Limits          resp.ParserLimits
+}
+
+// connectionOptions returns the settings new connections should use
+func (s *RedisServer) connectionOptions() ConnectionOptions {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return ConnectionOptions{
+		ReadBufferSize:  int(s.config.IOReadBufferSize),
+		WriteBufferSize: int(s.config.IOWriteBufferSize),
+		Limits: resp.ParserLimits{
+			MaxBulkLen:         int(s.config.ProtoMaxBulkLen),
+			QueryBufferLimit:   int(s.config.ClientQueryBufferLimit),
+			LargeBulkThreshold: int(s.config.LargeBulkThreshold),
+			MaxMultibulkLen:    s.config.ProtoMaxMultibulkLen,
+			MaxNestingDepth:    s.config.ProtoMaxNestingDepth,
+			Strict:             s.config.StrictProtocol,
+		},
+	}
+}
+
+// Connection handles a single client connection
+type Connection struct {
+	conn   net.Conn
+	source *inputSource
+	sink   *outputSink
+	parser *resp.Parser
+	writer *resp.Writer
+}
+
+// NewConnection creates a new connection handler
+func NewConnection(conn net.Conn, options ConnectionOptions) *Connection {
+	source := &inputSource{conn: conn}
+	var reader *bufio.Reader
+	if options.ReadBufferSize == DefaultIOBufferSize {
+		reader = readerPool.Get().(*bufio.Reader)
+		reader.Reset(source)
+	} else {
+		reader = bufio.NewReaderSize(source, options.ReadBufferSize)
+	}
+
+	sink := &outputSink{conn: conn}
+	var bufWriter *bufio.Writer
+	if options.WriteBufferSize == DefaultIOBufferSize {
+		bufWriter = writerPool.Get().(*bufio.Writer)
+		bufWriter.Reset(sink)
+	} else {
+		bufWriter = bufio.NewWriterSize(sink, options.WriteBufferSize)
+	}
+
+	parser := resp.NewParser(reader)
+	parser.SetLimits(options.Limits)
+	return &Connection{
+		conn:   conn,
+		source: source,
+		sink:   sink,
+		parser: parser,
+		writer: resp.NewWriter(bufWriter),
+	}
+}
+
+// Handle processes incoming commands from the client
+func (c *Connection) Handle(server *RedisServer) {
+	defer c.release()
+	defer c.conn.Close()
+	defer server.pubsub.RemoveSubscriber(c.writer)
+
+	client := server.clients.Register(server.ctx, c.writer, c.conn, c.conn.RemoteAddr().String())
+	defer server.clients.Unregister(client)
+	c.sink.output = &client.output
+	c.source.read, c.source.total = &client.netInput, &server.netInputBytes
+	c.sink.written, c.sink.total = &client.netOutput, &server.netOutputBytes
+
+	for !server.shuttingDown.Load() {
+		// Flush replies only once the pipelined input is drained, i.e. right before
+		// the next read would block, so a batch of commands costs a single write
+		if c.parser.Buffered() == 0 {
+			if err := c.writer.Flush(); err != nil {
+				return
+			}
+		}
+
+		// Parse incoming RESP message
+		value, err := c.parser.Parse()
+		if err != nil && server.shuttingDown.Load() {
+			break // woken up by Shutdown
+		}
+		if err != nil {
+			server.logReadError(client.addr, err)
+			protoErr := resp.AsProtocolError(err)
+			if protoErr != nil {
+				c.writer.WriteError("ERR " + err.Error())
+				server.errorStats.record("ERR", 1)
+			}
+			c.writer.Flush() // skipping to the next command may block on a read
+			if protoErr != nil && !protoErr.Fatal {
+				continue
+			}
+			return
+		}
+		client.Touch()
+
+		// Convert RESP array to command arguments
+		args := extractArgs(value, c.writer)
+		if args == nil {
+			continue // Error already sent
+		}
+
+		if !server.admit(client, args, c.writer) {
+			continue
+		}
+
+		// Handle the command
+		err = server.dispatch(client.Context(), args, c.writer)
+		if err != nil {
+			server.logVerbose("Error handling command", "client_addr", client.addr, "command", args[0], "err", err)
+		}
+		if client.closeAfterReply.Load() {
+			c.writer.Flush()
+			return
+		}
+	}
+
+	// Shutting down: deliver the replies of the commands that already ran
+	c.writer.Flush()
+}
+
+// extractArgs extracts string arguments from a RESP array, replying with an
+// error and returning nil when the value is not a valid command
+func extractArgs(value resp.Value, writer *resp.Writer) []string {
+	if value.Type != resp.Array {
+		writer.WriteError("expected array")
+		return nil
+	}
+
+	// Empty and null arrays are ignored without a reply, as in Redis
+	if len(value.Array) == 0 {
+		return nil
+	}
+
+	args := make([]string, len(value.Array))
+
+	for i, arg := range value.Array {
+		switch {
+		case arg.IsNull:
+			// A command can't carry a nil argument, only an empty one
+			writer.WriteError("invalid argument type")
+			return nil
+		case arg.Type == resp.BulkString:
+			args[i] = arg.Bulk
+		case arg.Type == resp.SimpleString:
+			args[i] = arg.Str
+		default:
+			writer.WriteError("invalid argument type")
+			return nil
+		}
+	}
+
+	return args
+}
+
+// release returns the connection's default-sized buffers to the pools. The writer is
+// closed first so a late pub/sub delivery can't write into a buffer another client now owns.
+func (c *Connection) release() {
+	if bufWriter := c.writer.Close(); bufWriter != nil && bufWriter.Size() == DefaultIOBufferSize {
+		bufWriter.Reset(nil)
+		writerPool.Put(bufWriter)
+	}
+	if reader := c.parser.Close(); reader.Size() == DefaultIOBufferSize {
+		reader.Reset(nil)
+		readerPool.Put(reader)
+	}
+}
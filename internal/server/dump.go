@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// errBadPayload is the reply to a RESTORE payload that fails its checksum
+const errBadPayload = "DUMP payload version or checksum are wrong"
+
+// dumpPayload serializes a string value as DUMP does: its RDB encoding, followed by
+// the RDB version and the CRC-64 of both, little-endian
+func dumpPayload(value string) string {
+	var buf strings.Builder
+	out := &checksumWriter{w: &buf}
+	rw := &RDBWriter{out: out}
+	out.Write([]byte{rdbTypeString})
+	rw.writeString(value)
+	out.Write([]byte{byte(rdbVersion), byte(rdbVersion >> 8)})
+	var sum [8]byte
+	binary.LittleEndian.PutUint64(sum[:], out.crc)
+	buf.Write(sum[:])
+	return buf.String()
+}
+
+// parseDumpPayload decodes a payload produced by DUMP, here or by Redis, which must
+// hold a string value. Payloads of any RDB version are accepted, the encoding of
+// strings being the same in all of them.
+func parseDumpPayload(payload string) (string, error) {
+	if len(payload) < 10 {
+		return "", errors.New(errBadPayload)
+	}
+	body, footer := payload[:len(payload)-8], payload[len(payload)-8:]
+	if crc64Update(0, []byte(body)) != binary.LittleEndian.Uint64([]byte(footer)) {
+		return "", errors.New(errBadPayload)
+	}
+
+	value := body[:len(body)-2]
+	rr := &RDBReader{in: bufio.NewReader(strings.NewReader(value)), maxString: uint64(len(value))}
+	valueType, err := rr.readByte()
+	if err != nil || valueType != rdbTypeString {
+		return "", errors.New("Bad data format")
+	}
+	str, err := rr.readString()
+	if err != nil || rr.offset != int64(len(value)) {
+		return "", errors.New("Bad data format")
+	}
+	return str, nil
+}
+
+// DumpHandler handles DUMP commands
+type DumpHandler struct {
+	server *RedisServer
+}
+
+func (h *DumpHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if len(args) != 2 {
+		return writer.WriteError("wrong number of arguments for 'dump' command")
+	}
+
+	h.server.mutex.Lock()
+	kv, exists := h.server.lookupKeyRead(ctx, args[1])
+	var value string
+	if exists {
+		value = stringValue(kv)
+	}
+	h.server.mutex.Unlock()
+
+	if !exists {
+		return writer.WriteNullBulkString()
+	}
+	return writer.WriteBulkString(dumpPayload(value))
+}
+
+// RestoreHandler handles RESTORE commands. IDLETIME and FREQ are accepted for the
+// commands Redis tooling sends, but the key starts with fresh access statistics.
+type RestoreHandler struct {
+	server *RedisServer
+}
+
+func (h *RestoreHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if len(args) < 4 {
+		return writer.WriteError("wrong number of arguments for 'restore' command")
+	}
+
+	ttl, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return writer.WriteError("value is not an integer or out of range")
+	}
+	if ttl < 0 {
+		return writer.WriteError("Invalid TTL value, must be >= 0")
+	}
+	replace, absolute := false, false
+	for i := 4; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absolute = true
+		case "IDLETIME":
+			if i+1 >= len(args) {
+				return writer.WriteError("syntax error")
+			}
+			i++
+			if idle, err := strconv.ParseInt(args[i], 10, 64); err != nil || idle < 0 {
+				return writer.WriteError("Invalid IDLETIME value, must be >= 0")
+			}
+		case "FREQ":
+			if i+1 >= len(args) {
+				return writer.WriteError("syntax error")
+			}
+			i++
+			if freq, err := strconv.Atoi(args[i]); err != nil || freq < 0 || freq > 255 {
+				return writer.WriteError("Invalid FREQ value, must be >= 0 and <= 255")
+			}
+		default:
+			return writer.WriteError("syntax error")
+		}
+	}
+
+	value, err := parseDumpPayload(args[3])
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	entry := SnapshotEntry{Key: args[1], Value: value, ExpiresAt: ttl}
+	if ttl > 0 && !absolute {
+		now := h.server.clock.Now().UnixMilli()
+		if ttl > math.MaxInt64-now {
+			return writer.WriteError("invalid expire time in 'restore' command")
+		}
+		entry.ExpiresAt += now
+	}
+	if err := h.server.RestoreEntry(entry, replace); err != nil {
+		return writer.WriteError(err.Error())
+	}
+	return writer.WriteSimpleString("OK")
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// maxErrorCodes bounds the error codes tracked by errorstats, so that a module or
+// script making up codes can't grow the table forever. Codes beyond it still count
+// towards total_error_replies.
+const maxErrorCodes = 128
+
+// errorStats counts error replies by their code, the first word of the message
+type errorStats struct {
+	mutex sync.Mutex
+	total int64
+	codes map[string]int64
+}
+
+// record accounts for n error replies, the last of which was msg
+func (st *errorStats) record(msg string, n int64) {
+	code := errorCode(msg)
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.total += n
+	if _, tracked := st.codes[code]; !tracked && len(st.codes) >= maxErrorCodes {
+		return
+	}
+	if st.codes == nil {
+		st.codes = make(map[string]int64)
+	}
+	st.codes[code] += n
+}
+
+// snapshot returns the reply total and the count of every code, sorted by code
+func (st *errorStats) snapshot() (total int64, codes []string, counts []int64) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	for code := range st.codes {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	for _, code := range codes {
+		counts = append(counts, st.codes[code])
+	}
+	return st.total, codes, counts
+}
+
+// reset zeroes the counters, for CONFIG RESETSTAT
+func (st *errorStats) reset() {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.total = 0
+	st.codes = nil
+}
+
+// errorStatsInfo renders the errorstats INFO section
+func errorStatsInfo(s *RedisServer) []string {
+	_, codes, counts := s.errorStats.snapshot()
+	lines := make([]string, len(codes))
+	for i, code := range codes {
+		lines[i] = fmt.Sprintf("errorstat_%s:count=%d", code, counts[i])
+	}
+	return lines
+}
@@ -0,0 +1,650 @@
+//go:build linux
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// eventLoop multiplexes the clients of the TCP listeners on one goroutine using
+// epoll, like the Redis event loop. Their commands never run concurrently, but the
+// TLS and Unix socket clients, in-process clients and background jobs run on
+// goroutines of their own, so the store lock is still contended.
+type eventLoop struct {
+	server    *RedisServer
+	epfd      int
+	listeners map[int]*os.File // duplicated listening descriptors, kept alive by their files
+	clients   map[int]*loopClient
+	readBuf   []byte
+
+	// outMutex guards the output of every client, and dirty: a pub/sub delivery is
+	// written by whichever goroutine publishes, which needn't be the loop's
+	outMutex sync.Mutex
+	dirty    map[*loopClient]struct{} // clients with replies waiting to be written
+	flushing []*loopClient            // dirty clients being written, reused by every iteration
+
+	// polling is set while the loop waits for events, which output queued by another
+	// goroutine interrupts by signalling wakeFd, an eventfd
+	polling atomic.Bool
+	wakeFd  int
+
+	// throttled holds the clients over the rate limits, which aren't read from until
+	// the time their next command is within them
+	throttled map[*loopClient]time.Time
+
+	// proxyProtocol is set when every connection starts with a PROXY header
+	proxyProtocol bool
+
+	// draining is set once the server shuts down: nothing is accepted or read anymore
+	// and clients are closed as soon as their pending replies are written
+	draining      bool
+	drainDeadline time.Time
+}
+
+// loopClient holds the per-connection buffers of an event-loop client
+type loopClient struct {
+	loop      *eventLoop
+	fd        int
+	in        []byte // bytes received but not yet parsed into a full command
+	out       []byte // encoded replies not yet written to the socket
+	source    *bytes.Reader
+	parser    *resp.Parser
+	writer    *resp.Writer
+	client    *Client
+	wantWrite bool // registered for EPOLLOUT because the socket buffer was full
+	closed    bool // guarded by the loop's outMutex, set once fd is closed
+
+	peer          *net.TCPAddr // the socket peer, which is the proxy with proxy-protocol
+	awaitingProxy bool         // the PROXY header hasn't been received yet
+}
+
+// eagerWriteThreshold is the queued output beyond which a client's replies are sent
+// while the command is still producing them
+const eagerWriteThreshold = 64 * 1024
+
+// Write buffers encoded replies; it is the sink of the client's resp.Writer. It may
+// be called by other goroutines than the loop's, publishing to the client.
+func (c *loopClient) Write(p []byte) (int, error) {
+	l := c.loop
+	l.outMutex.Lock()
+	if c.closed {
+		l.outMutex.Unlock()
+		return 0, net.ErrClosed
+	}
+	c.out = append(c.out, p...)
+	if len(c.out) >= eagerWriteThreshold {
+		c.writeOut()
+	}
+	c.client.output.pending.Store(int64(len(c.out)))
+	l.dirty[c] = struct{}{}
+	l.outMutex.Unlock()
+
+	// The loop flushes dirty clients before it polls again, so it only needs waking
+	// up while it polls
+	if l.polling.Load() {
+		l.wake()
+	}
+	return len(p), nil
+}
+
+// pendingOutput returns the amount of output queued for the client
+func (c *loopClient) pendingOutput() int {
+	c.loop.outMutex.Lock()
+	defer c.loop.outMutex.Unlock()
+	return len(c.out)
+}
+
+// writeOut sends as much queued output as the socket takes without blocking, so a
+// large or streamed reply to a client that keeps up isn't queued whole. Errors are
+// left for the next flush to handle.
+// Must be called with the loop's outMutex held.
+func (c *loopClient) writeOut() {
+	sent := 0
+	for sent < len(c.out) {
+		n, err := syscall.Write(c.fd, c.out[sent:])
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || n <= 0 {
+			break
+		}
+		c.loop.server.netOutputBytes.Add(int64(n))
+		c.client.netOutput.Add(int64(n))
+		sent += n
+	}
+	c.out = c.out[:copy(c.out, c.out[sent:])]
+}
+
+// RunEventLoop serves every connection accepted on listeners from the calling goroutine
+func RunEventLoop(listeners []net.Listener, server *RedisServer) error {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("epoll_create: %w", err)
+	}
+	defer syscall.Close(epfd)
+
+	wakeFd, _, errno := syscall.RawSyscall(syscall.SYS_EVENTFD2, 0, syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if errno != 0 {
+		return fmt.Errorf("eventfd: %w", errno)
+	}
+	defer syscall.Close(int(wakeFd))
+
+	server.mutex.RLock()
+	proxyProtocol := server.config.ProxyProtocol
+	server.mutex.RUnlock()
+
+	loop := &eventLoop{
+		server:        server,
+		epfd:          epfd,
+		listeners:     make(map[int]*os.File),
+		clients:       make(map[int]*loopClient),
+		dirty:         make(map[*loopClient]struct{}),
+		throttled:     make(map[*loopClient]time.Time),
+		readBuf:       make([]byte, 16*1024),
+		wakeFd:        int(wakeFd),
+		proxyProtocol: proxyProtocol,
+	}
+	if err := loop.register(loop.wakeFd, syscall.EPOLLIN, syscall.EPOLL_CTL_ADD); err != nil {
+		return err
+	}
+	for _, listener := range listeners {
+		tcpListener, ok := listener.(*net.TCPListener)
+		if !ok {
+			return errors.New("event loop requires TCP listeners")
+		}
+		file, err := tcpListener.File()
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		fd := int(file.Fd())
+		if err := syscall.SetNonblock(fd, true); err != nil {
+			return err
+		}
+		if err := loop.register(fd, syscall.EPOLLIN, syscall.EPOLL_CTL_ADD); err != nil {
+			return err
+		}
+		loop.listeners[fd] = file
+	}
+
+	return loop.run()
+}
+
+// wake interrupts the loop's wait for events
+func (l *eventLoop) wake() {
+	one := uint64(1)
+	syscall.Write(l.wakeFd, (*[8]byte)(unsafe.Pointer(&one))[:])
+}
+
+// register adds or modifies the epoll interest set of a descriptor
+func (l *eventLoop) register(fd int, events uint32, op int) error {
+	event := syscall.EpollEvent{Events: events, Fd: int32(fd)}
+	if err := syscall.EpollCtl(l.epfd, op, fd, &event); err != nil {
+		return fmt.Errorf("epoll_ctl: %w", err)
+	}
+	return nil
+}
+
+// run waits for readiness events and dispatches them until the server shuts down or
+// a fatal error occurs
+func (l *eventLoop) run() error {
+	events := make([]syscall.EpollEvent, 256)
+	lastCron := time.Now()
+	for {
+		// Wake up periodically even when idle so idle clients get reaped, and in
+		// time to resume the first throttled client
+		timeout := clientsCronInterval
+		for _, until := range l.throttled {
+			timeout = max(min(timeout, time.Until(until)), time.Millisecond)
+		}
+		// Output queued by other goroutines since the last flush is written right away
+		l.polling.Store(true)
+		l.outMutex.Lock()
+		if len(l.dirty) > 0 {
+			timeout = 0
+		}
+		l.outMutex.Unlock()
+		n, err := syscall.EpollWait(l.epfd, events, int(timeout/time.Millisecond))
+		l.polling.Store(false)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("epoll_wait: %w", err)
+		}
+
+		for i := 0; i < n; i++ {
+			fd := int(events[i].Fd)
+			if fd == l.wakeFd {
+				var count [8]byte
+				syscall.Read(l.wakeFd, count[:])
+				continue
+			}
+			if _, listening := l.listeners[fd]; listening {
+				l.accept(fd)
+				continue
+			}
+			client, exists := l.clients[fd]
+			if !exists {
+				continue
+			}
+			if events[i].Events&(syscall.EPOLLIN|syscall.EPOLLHUP|syscall.EPOLLERR) != 0 {
+				l.read(client)
+			}
+			if events[i].Events&syscall.EPOLLOUT != 0 {
+				l.flush(client)
+			}
+		}
+
+		now := time.Now()
+		for client, until := range l.throttled {
+			if !now.Before(until) {
+				l.resume(client)
+			}
+		}
+
+		// Replies (including pub/sub deliveries to other clients) are written once per iteration
+		l.outMutex.Lock()
+		for client := range l.dirty {
+			l.flushing = append(l.flushing, client)
+		}
+		clear(l.dirty)
+		l.outMutex.Unlock()
+		for _, client := range l.flushing {
+			l.flush(client)
+		}
+		clear(l.flushing)
+		l.flushing = l.flushing[:0]
+
+		if time.Since(lastCron) >= clientsCronInterval {
+			l.clientsCron()
+			lastCron = time.Now()
+		}
+
+		if l.server.shuttingDown.Load() {
+			if !l.draining {
+				l.startDrain()
+			}
+			if len(l.clients) == 0 || time.Now().After(l.drainDeadline) {
+				for _, client := range l.clients {
+					l.close(client)
+				}
+				return nil
+			}
+		}
+	}
+}
+
+// startDrain stops accepting connections and reading commands. Clients without pending
+// output are closed right away, the others once their replies are written.
+func (l *eventLoop) startDrain() {
+	l.draining = true
+	l.drainDeadline = time.Now().Add(l.server.ShutdownTimeout())
+	for fd := range l.listeners {
+		syscall.EpollCtl(l.epfd, syscall.EPOLL_CTL_DEL, fd, nil)
+	}
+	for _, client := range l.clients {
+		if client.pendingOutput() == 0 {
+			l.close(client)
+			continue
+		}
+		client.wantWrite = true
+		l.register(client.fd, syscall.EPOLLOUT, syscall.EPOLL_CTL_MOD)
+	}
+}
+
+// clientsCron closes the loop's clients that exceeded the idle timeout, or the soft
+// output buffer limit for too long while the socket stayed full
+func (l *eventLoop) clientsCron() {
+	expired := make(map[*Client]bool)
+	for _, client := range l.server.idleClients() {
+		expired[client] = true
+	}
+	now := time.Now()
+	for _, client := range l.clients {
+		headerLate := client.awaitingProxy && now.Sub(client.client.createdAt) > proxyHeaderTimeout
+		if headerLate || expired[client.client] || l.server.outputLimitExceeded(client.client, now) {
+			l.close(client)
+		}
+	}
+}
+
+// accept takes every pending connection off the listen queue of listenFd
+func (l *eventLoop) accept(listenFd int) {
+	for {
+		fd, sa, err := syscall.Accept4(listenFd, syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC)
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			return
+		}
+		if err != nil {
+			l.server.logger.Warn("Error accepting connection", "err", err)
+			return
+		}
+
+		// With the PROXY protocol, protected mode applies once the header names the client
+		peer := sockaddrTCP(sa)
+		var reason []byte
+		switch {
+		case !l.proxyProtocol && l.server.refusesRemote(peer.IP):
+			reason = errProtectedMode
+		case !l.server.admitClient():
+			reason = errMaxClients
+		}
+		if reason != nil {
+			syscall.Write(fd, reason)
+			syscall.Close(fd)
+			continue
+		}
+
+		tuneFd(fd, l.server.socketOptions(false))
+		options := l.server.connectionOptions()
+		client := &loopClient{loop: l, fd: fd, source: bytes.NewReader(nil), peer: peer, awaitingProxy: l.proxyProtocol}
+		client.parser = resp.NewParser(bufio.NewReaderSize(client.source, options.ReadBufferSize))
+		client.parser.SetLimits(options.Limits)
+		client.writer = resp.NewWriter(bufio.NewWriterSize(client, options.WriteBufferSize))
+		client.client = l.server.clients.Register(l.server.ctx, client.writer, nil, peer.String())
+
+		if err := l.register(fd, syscall.EPOLLIN, syscall.EPOLL_CTL_ADD); err != nil {
+			l.server.logger.Warn("Error registering connection", "client_addr", peer.String(), "err", err)
+			syscall.Close(fd)
+			l.server.clients.Unregister(client.client)
+			l.server.releaseClient()
+			continue
+		}
+		l.clients[fd] = client
+	}
+}
+
+// sockaddrTCP returns the address of an accepted peer
+func sockaddrTCP(sa syscall.Sockaddr) *net.TCPAddr {
+	switch addr := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return &net.TCPAddr{IP: net.IP(addr.Addr[:]), Port: addr.Port}
+	case *syscall.SockaddrInet6:
+		return &net.TCPAddr{IP: net.IP(addr.Addr[:]), Port: addr.Port}
+	}
+	return &net.TCPAddr{}
+}
+
+// tuneFd applies TCP options to an accepted descriptor, mirroring tuneConn
+func tuneFd(fd int, options socketOptions) {
+	syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_NODELAY, boolToInt(options.noDelay))
+	if options.keepAlive <= 0 {
+		syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, 0)
+		return
+	}
+	idle := int(options.keepAlive / time.Second)
+	syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, 1)
+	syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, idle)
+	syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, max(idle/3, 1))
+	syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, 3)
+}
+
+// read drains the socket and executes every complete command received
+func (l *eventLoop) read(client *loopClient) {
+	if l.draining {
+		l.close(client) // only hang-ups and errors are reported while draining
+		return
+	}
+
+	halfClosed := false
+	for {
+		n, err := syscall.Read(client.fd, l.readBuf)
+		if err == syscall.EAGAIN {
+			break
+		}
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			l.close(client)
+			return
+		}
+		if n == 0 {
+			// The client is done sending: the commands it sent still run
+			halfClosed = true
+			break
+		}
+		l.server.netInputBytes.Add(int64(n))
+		client.client.netInput.Add(int64(n))
+		client.in = append(client.in, l.readBuf[:n]...)
+	}
+
+	if client.awaitingProxy && !l.readProxyHeader(client) {
+		return
+	}
+
+	for len(client.in) > 0 && !client.client.closeAfterReply.Load() {
+		// Parsing a partial command would start over from its first byte on every read
+		if !client.parser.Ready(client.in) {
+			break
+		}
+		client.source.Reset(client.in)
+		client.parser.Reset(client.source)
+
+		value, err := client.parser.Parse()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// Incomplete command, wait for more data. Input skipped while
+			// resynchronizing is dropped for good.
+			client.in = client.in[client.parser.Discarded():]
+			break
+		}
+		consumed := len(client.in) - client.source.Len() - client.parser.Buffered()
+		if err != nil {
+			l.server.logReadError(client.client.addr, err)
+			protoErr := resp.AsProtocolError(err)
+			if protoErr != nil {
+				client.writer.WriteError("ERR " + err.Error())
+			}
+			if protoErr != nil && !protoErr.Fatal {
+				client.in = client.in[consumed:] // the parser skips to the next command
+				continue
+			}
+			client.writer.Flush()
+			l.flush(client)
+			l.close(client)
+			return
+		}
+
+		args := extractArgs(value, client.writer)
+		if args != nil {
+			if wait := l.server.rateLimit(client.client, args); wait > 0 {
+				if l.server.rateLimits.throttle.Load() {
+					// The command stays in the input buffer, to be parsed again
+					l.throttle(client, wait)
+					break
+				}
+				l.server.rejectRateLimited(client.writer)
+				args = nil
+			}
+		}
+		client.in = client.in[consumed:]
+		client.client.Touch()
+
+		if args != nil {
+			if err := l.server.HandleCommand(client.client.Context(), args, client.writer); err != nil {
+				l.server.logVerbose("Error handling command", "client_addr", client.client.addr, "command", args[0], "err", err)
+			}
+		}
+	}
+
+	// Keep the backing array for the next read once the input is fully consumed
+	if len(client.in) == 0 {
+		client.in = client.in[:0]
+	}
+	client.writer.Flush()
+	if halfClosed || client.client.closeAfterReply.Load() {
+		delete(l.throttled, client)
+		l.closeAfterReply(client)
+	}
+}
+
+// interest returns the events a client is polled for: input unless it is
+// throttled, and output while the socket buffer is full
+func (l *eventLoop) interest(client *loopClient) uint32 {
+	var events uint32
+	if _, throttled := l.throttled[client]; !throttled {
+		events |= syscall.EPOLLIN
+	}
+	if client.wantWrite {
+		events |= syscall.EPOLLOUT
+	}
+	return events
+}
+
+// throttle stops reading from a client over the rate limits for wait, so that
+// the other clients are served meanwhile
+func (l *eventLoop) throttle(client *loopClient, wait time.Duration) {
+	if _, throttled := l.throttled[client]; !throttled {
+		l.server.rateLimits.limited.Add(1)
+	}
+	l.throttled[client] = time.Now().Add(wait)
+	l.register(client.fd, l.interest(client), syscall.EPOLL_CTL_MOD)
+}
+
+// resume reads from a throttled client again, starting with the commands it sent
+// meanwhile
+func (l *eventLoop) resume(client *loopClient) {
+	delete(l.throttled, client)
+	if _, open := l.clients[client.fd]; !open || l.draining {
+		return
+	}
+	l.register(client.fd, l.interest(client), syscall.EPOLL_CTL_MOD)
+	l.read(client)
+}
+
+// closeAfterReply stops reading from a client, which is closed once its pending
+// replies are written. A half-closed socket stays readable, so it mustn't be
+// polled for input meanwhile.
+func (l *eventLoop) closeAfterReply(client *loopClient) {
+	client.client.closeAfterReply.Store(true)
+	if client.pendingOutput() == 0 {
+		l.close(client)
+		return
+	}
+	client.wantWrite = true
+	l.register(client.fd, syscall.EPOLLOUT, syscall.EPOLL_CTL_MOD)
+}
+
+// readProxyHeader consumes the PROXY header at the start of the client's input and
+// reports whether commands may follow. Clients with an invalid header, or refused by
+// protected mode once their address is known, are closed.
+func (l *eventLoop) readProxyHeader(client *loopClient) bool {
+	addr, n, err := parseProxyHeader(client.in)
+	if err == errProxyHeaderIncomplete {
+		return false
+	}
+	if err != nil {
+		l.server.logVerbose("Invalid PROXY header", "client_addr", client.peer.String(), "err", err)
+		l.close(client)
+		return false
+	}
+	client.in = client.in[n:]
+	client.awaitingProxy = false
+
+	if addr == nil {
+		addr = client.peer
+	}
+	client.client.addr = addr.String()
+	if l.server.refusesRemote(addr.IP) {
+		syscall.Write(client.fd, errProtectedMode)
+		l.close(client)
+		return false
+	}
+	return true
+}
+
+// flush writes as much buffered output as the socket accepts, subscribing to
+// EPOLLOUT when the kernel buffer is full
+func (l *eventLoop) flush(client *loopClient) {
+	if _, open := l.clients[client.fd]; !open {
+		return
+	}
+	if l.server.outputLimitExceeded(client.client, time.Now()) {
+		l.close(client)
+		return
+	}
+
+	l.outMutex.Lock()
+	pending, err := client.send()
+	l.outMutex.Unlock()
+	if err != nil {
+		l.close(client)
+		return
+	}
+	if pending > 0 {
+		if !client.wantWrite {
+			client.wantWrite = true
+			l.register(client.fd, l.interest(client), syscall.EPOLL_CTL_MOD)
+		}
+		return
+	}
+
+	if l.draining || client.client.closeAfterReply.Load() {
+		l.close(client)
+		return
+	}
+	if client.wantWrite {
+		client.wantWrite = false
+		l.register(client.fd, l.interest(client), syscall.EPOLL_CTL_MOD)
+	}
+}
+
+// send writes as much queued output as the socket accepts, and returns the amount
+// left and the error that broke the connection, if any.
+// Must be called with the loop's outMutex held.
+func (c *loopClient) send() (int, error) {
+	defer func() { c.client.output.pending.Store(int64(len(c.out))) }()
+	for len(c.out) > 0 {
+		n, err := syscall.Write(c.fd, c.out)
+		if err == syscall.EAGAIN {
+			return len(c.out), nil
+		}
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return len(c.out), err
+		}
+		c.loop.server.netOutputBytes.Add(int64(n))
+		c.client.netOutput.Add(int64(n))
+		c.out = c.out[n:]
+	}
+	c.out = c.out[:0]
+	return 0, nil
+}
+
+// close tears down a client and releases its subscriptions
+func (l *eventLoop) close(client *loopClient) {
+	if _, open := l.clients[client.fd]; !open {
+		return
+	}
+	delete(l.clients, client.fd)
+	delete(l.throttled, client)
+	// The descriptor may be reused as soon as it is closed, so no delivery may be
+	// written to it from then on
+	l.outMutex.Lock()
+	delete(l.dirty, client)
+	client.closed = true
+	l.outMutex.Unlock()
+	syscall.EpollCtl(l.epfd, syscall.EPOLL_CTL_DEL, client.fd, nil)
+	syscall.Close(client.fd)
+	l.server.clients.Unregister(client.client)
+	l.server.releaseClient()
+	l.server.pubsub.RemoveSubscriber(client.writer)
+	client.writer.Close()
+}
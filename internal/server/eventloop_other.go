@@ -0,0 +1,13 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"net"
+)
+
+// RunEventLoop is only implemented on Linux, where it is backed by epoll
+func RunEventLoop(listeners []net.Listener, server *RedisServer) error {
+	return errors.New("the event-loop execution model requires Linux")
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"errors"
+	"math/rand"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+// entryOverhead approximates the per-key bookkeeping cost (map slot, KeyValue struct, headers)
+const entryOverhead = 64
+
+// lfuInitVal is the counter given to new keys so they are not evicted before they get a chance to be accessed
+const lfuInitVal = 5
+
+// errOOM is returned for write commands that cannot be served within maxmemory
+var errOOM = errors.New("OOM command not allowed when used memory > 'maxmemory'.")
+
+// entrySize estimates the memory held by a single key
+func entrySize(key string, kv *store.KeyValue) int64 {
+	size := int64(len(key)) + entryOverhead + kv.Value.Size()
+	if kv.ExpiresAt != 0 {
+		size += 24 // entry in the expires index
+	}
+	return size
+}
+
+// performEvictions frees memory according to maxmemory-policy until usage is back
+// under maxmemory, and under the budgets of the namespaces of the command's keys.
+// It returns an OOM error when the command should be refused instead.
+func (s *RedisServer) performEvictions(keys []string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.config.MaxMemory > 0 {
+		for s.usedMemory > s.config.MaxMemory {
+			if s.config.MaxMemoryPolicy == PolicyNoEviction {
+				return errOOM
+			}
+
+			key, found := s.evictionCandidate()
+			if !found {
+				return errOOM
+			}
+			s.evictKey(key)
+		}
+	}
+
+	return s.evictNamespaces(keys)
+}
+
+// evictKey removes a key chosen for eviction.
+// Must be called with the server mutex held for writing.
+func (s *RedisServer) evictKey(key string) {
+	kv, _ := s.data.Get(key)
+	s.deleteKey(key)
+	s.entries.Release(kv)
+	s.stats.evictedKeys++
+	s.notifyKeyspaceEvent(NotifyEvicted, "evicted", key)
+	runKeyHooks(s.keyHooks.evict, key)
+}
+
+// isLFUPolicy reports whether the policy ranks keys by access frequency
+func isLFUPolicy(policy string) bool {
+	return policy == PolicyAllKeysLFU || policy == PolicyVolatileLFU
+}
+
+// isVolatilePolicy reports whether the policy only evicts keys with an expiry set
+func isVolatilePolicy(policy string) bool {
+	switch policy {
+	case PolicyVolatileLRU, PolicyVolatileLFU, PolicyVolatileRandom, PolicyVolatileTTL:
+		return true
+	}
+	return false
+}
+
+// touchKey records an access to a key for the active eviction policy, and reports
+// whether it changed the access time to the second or the LFU counter, which is
+// when an engine returning copies is worth storing it for.
+// Must be called with the server mutex held for writing.
+func (s *RedisServer) touchKey(kv *store.KeyValue) bool {
+	now := s.clock.Now()
+	changed := kv.AccessedAt/1000 != now.Unix()
+	kv.AccessedAt = now.UnixMilli()
+	if isLFUPolicy(s.config.MaxMemoryPolicy) || s.hotKeys != nil {
+		freq, decayedAt := kv.Freq, kv.FreqDecayedAt
+		kv.Freq = s.lfuDecayedFreq(kv)
+		kv.FreqDecayedAt = now.Unix() / 60
+		kv.Freq = lfuLogIncr(kv.Freq, s.config.LFULogFactor)
+		changed = changed || kv.Freq != freq || kv.FreqDecayedAt != decayedAt
+	}
+	return changed
+}
+
+// lfuLogIncr increments an 8-bit counter logarithmically: the higher the counter,
+// the less likely it is to grow, so 255 is reached only after ~1M hits with factor 10
+func lfuLogIncr(counter uint8, logFactor int) uint8 {
+	if counter == 255 {
+		return counter
+	}
+	base := float64(counter) - lfuInitVal
+	if base < 0 {
+		base = 0
+	}
+	if rand.Float64() < 1.0/(base*float64(logFactor)+1) {
+		counter++
+	}
+	return counter
+}
+
+// lfuDecayedFreq returns the key's counter after subtracting one for every
+// lfu-decay-time minutes elapsed since it was last decayed
+func (s *RedisServer) lfuDecayedFreq(kv *store.KeyValue) uint8 {
+	if s.config.LFUDecayTime <= 0 {
+		return kv.Freq
+	}
+	elapsed := s.clock.Now().Unix()/60 - kv.FreqDecayedAt
+	periods := elapsed / int64(s.config.LFUDecayTime)
+	if periods >= int64(kv.Freq) {
+		return 0
+	}
+	return kv.Freq - uint8(periods)
+}
+
+// evictionCandidate samples maxmemory-samples keys and returns the best one to evict
+// for the current policy
+func (s *RedisServer) evictionCandidate() (string, bool) {
+	return s.bestCandidate(func(fn func(key string, kv *store.KeyValue) bool) {
+		s.data.Sample(isVolatilePolicy(s.config.MaxMemoryPolicy), fn)
+	})
+}
+
+// bestCandidate returns the best key to evict for the current policy among the
+// first maxmemory-samples keys sample offers
+func (s *RedisServer) bestCandidate(sample func(fn func(key string, kv *store.KeyValue) bool)) (string, bool) {
+	policy := s.config.MaxMemoryPolicy
+
+	var best string
+	var bestScore int64
+	found := false
+	sampled := 0
+
+	sample(func(key string, kv *store.KeyValue) bool {
+		if policy == PolicyAllKeysRandom || policy == PolicyVolatileRandom {
+			best, found = key, true
+			return false
+		}
+
+		// Lower scores are evicted first
+		var score int64
+		switch {
+		case isLFUPolicy(policy):
+			score = int64(s.lfuDecayedFreq(kv))
+		case policy == PolicyVolatileTTL:
+			score = kv.ExpiresAt
+		default:
+			score = kv.AccessedAt
+		}
+		if !found || score < bestScore {
+			best = key
+			bestScore = score
+			found = true
+		}
+		sampled++
+		return sampled < s.config.MaxMemorySamples
+	})
+
+	return best, found
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// expiresAfter returns the expiry, in unix milliseconds, of a key given a TTL,
+// spread by up to expire-jitter percent either way so that keys written together
+// don't all expire at once.
+// Must be called with the server mutex held.
+func (s *RedisServer) expiresAfter(ttl time.Duration) int64 {
+	if jitter := s.config.ExpireJitter; jitter > 0 {
+		spread := float64(ttl) * float64(jitter) / 100
+		ttl += time.Duration((rand.Float64()*2 - 1) * spread)
+	}
+	return s.clock.Now().Add(max(ttl, time.Millisecond)).UnixMilli()
+}
+
+// setExpiry changes the expiry of a live key, in unix milliseconds, 0 to remove it,
+// and keeps memory accounting current.
+// Must be called with the server mutex held for writing.
+func (s *RedisServer) setExpiry(key string, kv *store.KeyValue, expiresAt int64) {
+	s.preserveForSnapshot(key)
+	s.rdb.dirty++
+	before := entrySize(key, kv)
+	s.data.Expire(key, expiresAt)
+	// The disk engine returns copies, so the entry is read back
+	kv, _ = s.data.Get(key)
+	after := entrySize(key, kv)
+	s.usedMemory += after - before
+	s.accountNamespace(key, -before)
+	s.accountNamespace(key, after)
+	s.keySetHooks(key, stringValue(kv), expiresAt)
+}
+
+// ExpireHandler handles EXPIRE, PEXPIRE, EXPIREAT and PEXPIREAT commands: unit is
+// the unit of their time, which is a unix time when absolute is set
+type ExpireHandler struct {
+	server   *RedisServer
+	unit     time.Duration
+	absolute bool
+}
+
+func (h *ExpireHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	key := args[1]
+	when, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return writer.WriteError("value is not an integer or out of range")
+	}
+
+	var nx, xx, gt, lt bool
+	for _, option := range args[3:] {
+		switch strings.ToUpper(option) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		default:
+			return writer.WriteError(fmt.Sprintf("Unsupported option %s", option))
+		}
+	}
+	if nx && (xx || gt || lt) {
+		return writer.WriteError("NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if gt && lt {
+		return writer.WriteError("GT and LT options at the same time are not compatible")
+	}
+
+	// The time in milliseconds, relative to now unless absolute
+	perMilli := int64(h.unit / time.Millisecond)
+	if when > math.MaxInt64/perMilli || when < math.MinInt64/perMilli {
+		return writer.WriteError(fmt.Sprintf("invalid expire time in '%s' command", strings.ToLower(args[0])))
+	}
+	millis := when * perMilli
+
+	h.server.mutex.Lock()
+	defer h.server.mutex.Unlock()
+
+	now := h.server.clock.Now().UnixMilli()
+	expiresAt := millis
+	if !h.absolute {
+		if (millis > 0 && now > math.MaxInt64-millis) || (millis < 0 && now < math.MinInt64-millis) {
+			return writer.WriteError(fmt.Sprintf("invalid expire time in '%s' command", strings.ToLower(args[0])))
+		}
+		expiresAt = now + millis
+	}
+
+	kv, exists := h.server.lookupKey(ctx, key)
+	if !exists {
+		return writer.WriteInteger(0)
+	}
+	// A key without an expiry has an infinite TTL for GT and LT
+	current := kv.ExpiresAt
+	switch {
+	case nx && current != 0,
+		xx && current == 0,
+		gt && (current == 0 || expiresAt <= current),
+		lt && current != 0 && expiresAt >= current:
+		return writer.WriteInteger(0)
+	}
+
+	// An expiry in the past deletes the key right away, as DEL does
+	if expiresAt <= now {
+		h.server.writeThrough(StoreWrite{Key: key, Deleted: true})
+		h.server.deleteKey(key)
+		h.server.entries.Release(kv)
+		h.server.notifyKeyspaceEvent(NotifyGeneric, "del", key)
+		runKeyHooks(h.server.keyHooks.del, key)
+		return writer.WriteInteger(1)
+	}
+
+	// Relative TTLs are spread by expire-jitter, when they fit a time.Duration
+	if !h.absolute && millis <= int64(math.MaxInt64/time.Millisecond) {
+		expiresAt = h.server.expiresAfter(time.Duration(millis) * time.Millisecond)
+	}
+	h.server.setExpiry(key, kv, expiresAt)
+	h.server.notifyKeyspaceEvent(NotifyGeneric, "expire", key)
+	return writer.WriteInteger(1)
+}
+
+// PersistHandler handles PERSIST commands
+type PersistHandler struct {
+	server *RedisServer
+}
+
+func (h *PersistHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	key := args[1]
+
+	h.server.mutex.Lock()
+	defer h.server.mutex.Unlock()
+
+	kv, exists := h.server.lookupKey(ctx, key)
+	if !exists || kv.ExpiresAt == 0 {
+		return writer.WriteInteger(0)
+	}
+	h.server.setExpiry(key, kv, 0)
+	h.server.notifyKeyspaceEvent(NotifyGeneric, "persist", key)
+	return writer.WriteInteger(1)
+}
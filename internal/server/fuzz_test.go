@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log/slog"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// fuzzAllocBudget is what a command may allocate beyond a multiple of its size
+const fuzzAllocBudget = 64 << 20
+
+// FuzzHandleCommand runs arbitrary commands on a fresh server: the input holds
+// commands separated by newlines, and arguments separated by NUL bytes. Every command
+// must reply with well-formed RESP, without panicking or allocating beyond a bound.
+func FuzzHandleCommand(f *testing.F) {
+	for _, seed := range []string{
+		"SET\x00k\x00v\x00EX\x0010\nGET\x00k\nTTL\x00k",
+		"SET\x00k\x00v\nEXPIRE\x00k\x00-9223372036854775808\x00GT\nPEXPIREAT\x00k\x009223372036854775807\x00LT\nPERSIST\x00k",
+		"INCR\x00n\nINCRBY\x00n\x00-9223372036854775808\nDECR\x00n",
+		"SET\x00k\x00v\x00PX\x000\x00NX\x00GET",
+		"CONFIG\x00SET\x00maxmemory\x001\nSET\x00a\x00b\nCONFIG\x00GET\x00*",
+		"KEYS\x00[a-\nSCAN\x000\x00MATCH\x00*\x00COUNT\x00-1",
+		"SET\x00a\x001\nSET\x00b\x002\nSCAN\x000\x00COUNT\x001\x00TYPE\x00string\nSCAN\x001\x00MATCH\x00b\nFLUSHDB\nSCAN\x002",
+		"SET\x00a*b\x001\nKEYS\x00a\\*b\nKEYS\x00[^\\]-a]*\nKEYS\x00a*a*a*a*a*a*a*b\nPSUBSCRIBE\x00[\nPUBLISH\x00x\x00m",
+		"SUBSCRIBE\x00c\nPUBLISH\x00c\x00m\nPSUBSCRIBE\x00*\nUNSUBSCRIBE",
+		"SUBSCRIBE\x00c\nGET\x00k\nPING\x00m\nRESET\nGET\x00k",
+		"TYPE\x00k\nSET\x00k\x00v\nTYPE\x00k\nOBJECT\x00ENCODING\x00k\nMEMORY\x00USAGE\x00k\nINFO\x00all",
+		"CLIENT\x00SETNAME\x00a b\nCLIENT\x00LIST\x00ID\x00x",
+		"CLIENT\x00NO-TOUCH\x00ON\nCLIENT\x00NO-EVICT\x00on\nGET\x00k\nCLIENT\x00INFO",
+		"SLOWLOG\x00GET\x00-1\nLATENCY\x00HISTOGRAM\nHOTKEYS",
+		"LATENCY\x00LATEST\nLATENCY\x00HISTORY\x00watchdog\nLATENCY\x00RESET",
+		"ACL\x00SETUSER\x00default\x00resetkeys\x00~k*\x00&c\nSET\x00x\x001\nPUBLISH\x00d\x00m\nACL\x00LIST\nACL\x00GETUSER\x00default",
+		"HELLO\x003\x00AUTH\x00default\x00x\nAUTH\x00x",
+		"SET\x00k\x001\nDUMP\x00k\nRESTORE\x00r\x000\x00payload\x00REPLACE\x00FREQ\x001",
+		"CLIENT\x00REPLY\x00SKIP\nGET\x00k\nCLIENT\x00REPLY\x00OFF\nPING\nCLIENT\x00REPLY\x00ON",
+		"DEL\x00a\x00b\nUNLINK\nFLUSHALL\x00ASYNC\nBGSAVE\nCOMMAND\x00INFO\x00get",
+	} {
+		f.Add(seed)
+	}
+
+	dir := f.TempDir()
+	f.Fuzz(func(t *testing.T, input string) {
+		config := DefaultConfig()
+		config.Dir = dir
+		config.MaxMemory = 32 << 20
+		s := NewRedisServer(config)
+		s.SetLogger(slog.New(slog.DiscardHandler))
+		defer s.Shutdown(context.Background(), false)
+
+		var out bytes.Buffer
+		writer := resp.NewWriter(bufio.NewWriter(&out))
+		client := s.clients.Register(s.ctx, writer, nil, "fuzz")
+		defer s.clients.Unregister(client)
+
+		// Once CLIENT REPLY may have turned replies off, commands needn't reply
+		silenced := false
+		for _, line := range strings.Split(input, "\n") {
+			cmd := strings.Split(line, "\x00")
+			// Webhooks would reach out of the process
+			if strings.Contains(strings.ToLower(line), "webhook") {
+				continue
+			}
+			silenced = silenced || strings.Contains(strings.ToLower(line), "reply")
+
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			s.HandleCommand(client.Context(), cmd, writer)
+			writer.Flush()
+			runtime.ReadMemStats(&after)
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > fuzzAllocBudget+64*uint64(len(line)) {
+				t.Fatalf("%q allocated %d bytes", cmd, allocated)
+			}
+
+			reply := out.Bytes()
+			if len(reply) == 0 && !silenced && !strings.EqualFold(cmd[0], "SHUTDOWN") {
+				t.Fatalf("%q didn't reply", cmd)
+			}
+			for len(reply) > 0 {
+				_, n, err := resp.Decode(reply)
+				if err != nil {
+					t.Fatalf("%q replied %q: %v", cmd, out.Bytes(), err)
+				}
+				reply = reply[n:]
+			}
+			out.Reset()
+		}
+	})
+}
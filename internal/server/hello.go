@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// ServerVersion is the Redis version the server reports to clients
+const ServerVersion = "7.2.0"
+
+// HelloHandler handles HELLO commands, which negotiate the protocol version of the
+// connection and return the server metadata
+type HelloHandler struct {
+	server *RedisServer
+}
+
+func (h *HelloHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	protocol := writer.Protocol()
+	i := 1
+	if len(args) > 1 {
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return writer.WriteError("Protocol version is not an integer or out of range")
+		}
+		if version != resp.RESP2 && version != resp.RESP3 {
+			return writer.WriteError("NOPROTO unsupported protocol version")
+		}
+		protocol = version
+		i++
+	}
+
+	var name, username, password string
+	setName, auth := false, false
+	for ; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "AUTH" && i+2 < len(args):
+			username, password, auth = args[i+1], args[i+2], true
+			i += 2
+		case option == "SETNAME" && i+1 < len(args):
+			name, setName = args[i+1], true
+			if !validClientName(name) {
+				return writer.WriteError("Client names cannot contain spaces, newlines or special characters.")
+			}
+			i++
+		default:
+			return writer.WriteError(fmt.Sprintf("Syntax error in HELLO option '%s'", args[i]))
+		}
+	}
+
+	// Credentials are checked before anything else changes, like in Redis
+	if auth {
+		if !h.server.authenticate(writer, username, password) {
+			return writer.WriteError(errWrongPass)
+		}
+	} else if !h.server.authenticated(writer) {
+		return writer.WriteError("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+	}
+
+	var id int
+	if client := h.server.clients.Lookup(writer); client != nil {
+		id = int(client.ID)
+		if setName {
+			h.server.clients.SetName(client, name)
+		}
+	}
+
+	writer.SetProtocol(protocol)
+	return writer.WriteMap([]resp.Value{
+		{Type: resp.BulkString, Bulk: "server"}, {Type: resp.BulkString, Bulk: "redis"},
+		{Type: resp.BulkString, Bulk: "version"}, {Type: resp.BulkString, Bulk: ServerVersion},
+		{Type: resp.BulkString, Bulk: "proto"}, {Type: resp.Integer, Num: protocol},
+		{Type: resp.BulkString, Bulk: "id"}, {Type: resp.Integer, Num: id},
+		{Type: resp.BulkString, Bulk: "mode"}, {Type: resp.BulkString, Bulk: "standalone"},
+		{Type: resp.BulkString, Bulk: "role"}, {Type: resp.BulkString, Bulk: "master"},
+		{Type: resp.BulkString, Bulk: "modules"}, {Type: resp.Array, Array: []resp.Value{}},
+	})
+}
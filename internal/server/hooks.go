@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// ClientInfo describes the client running a command, for command hooks
+type ClientInfo struct {
+	ID       int64
+	Addr     string
+	Name     string
+	Protocol int
+}
+
+// PreCommandHook runs before each command. It may modify the elements of args in
+// place; an error rejects the command and is sent to the client as an error reply.
+type PreCommandHook func(ctx context.Context, client ClientInfo, args []string) error
+
+// PostCommandHook runs after each command, rejected ones included, with the RESP
+// encoding of the reply and the time spent executing the command
+type PostCommandHook func(ctx context.Context, client ClientInfo, args []string, reply []byte, duration time.Duration)
+
+// commandHooks are the hooks run around every command. They are only registered
+// before serving, so they are read without a lock.
+type commandHooks struct {
+	pre  []PreCommandHook
+	post []PostCommandHook
+}
+
+// AddPreCommandHook registers a hook run before every command, in registration
+// order. It must be called before serving clients.
+func (s *RedisServer) AddPreCommandHook(hook PreCommandHook) {
+	s.hooks.pre = append(s.hooks.pre, hook)
+}
+
+// AddPostCommandHook registers a hook run after every command, in registration
+// order. It must be called before serving clients.
+func (s *RedisServer) AddPostCommandHook(hook PostCommandHook) {
+	s.hooks.post = append(s.hooks.post, hook)
+}
+
+// runHooked executes a command between the registered hooks
+func (s *RedisServer) runHooked(ctx context.Context, cmd []string, writer *resp.Writer) error {
+	client, ok := ClientFromContext(ctx)
+	if !ok {
+		client.Protocol = writer.Protocol()
+	}
+	if len(s.hooks.post) > 0 {
+		writer.StartCapture()
+	}
+
+	var err error
+	var duration time.Duration
+	rejected := false
+	for _, hook := range s.hooks.pre {
+		if hookErr := hook(ctx, client, cmd); hookErr != nil {
+			err = writer.WriteError(hookErr.Error())
+			rejected = true
+			if len(cmd) > 0 {
+				if entry, exists := s.lookupCommand(cmd[0]); exists {
+					entry.stats.rejected.Add(1)
+				}
+			}
+			break
+		}
+	}
+	if !rejected {
+		start := time.Now()
+		err = s.execute(ctx, cmd, writer)
+		duration = time.Since(start)
+	}
+
+	if len(s.hooks.post) > 0 {
+		reply := writer.StopCapture()
+		for _, hook := range s.hooks.post {
+			hook(ctx, client, cmd, reply, duration)
+		}
+	}
+	return err
+}
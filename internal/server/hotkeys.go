@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// hotKeysCapacity is the number of hottest keys tracked
+const hotKeysCapacity = 32
+
+// hotReplyMinFreq is the LFU counter a tracked key needs before its GET reply is
+// cached; with the default lfu-log-factor that takes a few hundred reads
+const hotReplyMinFreq = 16
+
+// HotKeys tracks the most frequently read keys and, optionally, the encoded GET
+// replies of the hottest ones. Frequencies are the LFU counters of the entries, which
+// are maintained for every policy while tracking is enabled. Must be used with the
+// server mutex held for writing.
+type HotKeys struct {
+	counts map[string]uint8 // tracked keys and their counter at the last read
+
+	replies   map[string][]byte // encoded GET replies, nil when the cache is disabled
+	cacheHits int64
+}
+
+// NewHotKeys creates a tracker, with a reply cache if cacheReplies is set
+func NewHotKeys(cacheReplies bool) *HotKeys {
+	hk := &HotKeys{counts: make(map[string]uint8)}
+	if cacheReplies {
+		hk.replies = make(map[string][]byte)
+	}
+	return hk
+}
+
+// Track records a read of key, whose counter is now freq. When the tracker is full,
+// the key replaces the coldest tracked key if it is hotter.
+func (hk *HotKeys) Track(key string, freq uint8) {
+	if _, tracked := hk.counts[key]; tracked || len(hk.counts) < hotKeysCapacity {
+		hk.counts[key] = freq
+		return
+	}
+
+	var coldest string
+	coldestFreq := freq
+	for candidate, count := range hk.counts {
+		if count < coldestFreq {
+			coldest, coldestFreq = candidate, count
+		}
+	}
+	if coldestFreq < freq {
+		hk.Forget(coldest)
+		hk.counts[key] = freq
+	}
+}
+
+// Invalidate drops the cached reply of a key whose value changed
+func (hk *HotKeys) Invalidate(key string) {
+	if hk.replies != nil {
+		delete(hk.replies, key)
+	}
+}
+
+// Forget stops tracking a key
+func (hk *HotKeys) Forget(key string) {
+	delete(hk.counts, key)
+	hk.Invalidate(key)
+}
+
+// Reply returns the encoded GET reply of a hot key, encoding and caching it on first
+// use. It returns nil when the key isn't hot enough or the cache is disabled.
+func (hk *HotKeys) Reply(key string, kv *store.KeyValue) []byte {
+	if hk.replies == nil {
+		return nil
+	}
+	if reply, cached := hk.replies[key]; cached {
+		hk.cacheHits++
+		return reply
+	}
+	if freq, tracked := hk.counts[key]; !tracked || freq < hotReplyMinFreq {
+		return nil
+	}
+
+	value := stringValue(kv)
+	reply := resp.AppendBulkString(make([]byte, 0, len(value)+16), value)
+	hk.replies[key] = reply
+	return reply
+}
+
+// CachedReplies returns the number of keys with a cached reply
+func (hk *HotKeys) CachedReplies() int {
+	return len(hk.replies)
+}
+
+// syncHotKeys starts or stops tracking to follow the hotkeys-tracking and
+// hotkeys-reply-cache settings. Must be called with the server mutex held for writing.
+func (s *RedisServer) syncHotKeys() {
+	switch {
+	case !s.config.HotKeysTracking:
+		s.hotKeys = nil
+	case s.hotKeys == nil:
+		s.hotKeys = NewHotKeys(s.config.HotKeysReplyCache)
+	case s.config.HotKeysReplyCache && s.hotKeys.replies == nil:
+		s.hotKeys.replies = make(map[string][]byte)
+	case !s.config.HotKeysReplyCache && s.hotKeys.replies != nil:
+		s.hotKeys.replies = nil
+	}
+}
+
+// HotKeysHandler handles HOTKEYS commands
+type HotKeysHandler struct {
+	server *RedisServer
+}
+
+func (h *HotKeysHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	count := hotKeysCapacity
+	switch {
+	case len(args) == 3 && strings.EqualFold(args[1], "COUNT"):
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < 1 {
+			return writer.WriteError("value is not an integer or out of range")
+		}
+		count = n
+	case len(args) != 1:
+		return writer.WriteError("syntax error")
+	}
+
+	type hotKey struct {
+		key  string
+		freq uint8
+	}
+	var hot []hotKey
+
+	h.server.mutex.Lock()
+	if h.server.hotKeys == nil {
+		h.server.mutex.Unlock()
+		return writer.WriteError("hotkeys tracking is disabled, enable it with CONFIG SET hotkeys-tracking yes")
+	}
+	for key := range h.server.hotKeys.counts {
+		kv, exists := h.server.data.Get(key)
+		if !exists || h.server.isExpired(key) {
+			continue
+		}
+		hot = append(hot, hotKey{key, h.server.lfuDecayedFreq(kv)})
+	}
+	h.server.mutex.Unlock()
+
+	slices.SortFunc(hot, func(a, b hotKey) int {
+		if a.freq != b.freq {
+			return int(b.freq) - int(a.freq)
+		}
+		return strings.Compare(a.key, b.key)
+	})
+	if len(hot) > count {
+		hot = hot[:count]
+	}
+
+	reply := make([]resp.Value, len(hot))
+	for i, entry := range hot {
+		reply[i] = resp.Value{Type: resp.Array, Array: []resp.Value{
+			{Type: resp.BulkString, Bulk: entry.key},
+			{Type: resp.Integer, Num: int(entry.freq)},
+		}}
+	}
+	return writer.WriteArray(reply)
+}
+
+// hotKeysInfo renders the hot-key lines of INFO stats
+func hotKeysInfo(hk *HotKeys) []string {
+	if hk == nil {
+		return []string{"hotkeys_tracked:0", "hotkeys_cached_replies:0", "hotkeys_cache_hits:0"}
+	}
+	return []string{
+		fmt.Sprintf("hotkeys_tracked:%d", len(hk.counts)),
+		fmt.Sprintf("hotkeys_cached_replies:%d", hk.CachedReplies()),
+		fmt.Sprintf("hotkeys_cache_hits:%d", hk.cacheHits),
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// ServerStats holds counters reported by INFO
+type ServerStats struct {
+	startTime   time.Time
+	evictedKeys int64
+	expiredKeys int64
+
+	keyspaceHits   int64
+	keyspaceMisses int64
+
+	// sharedIntegerKeys counts keys whose value references a shared integer
+	sharedIntegerKeys int64
+}
+
+// infoSection renders a single INFO section. Called with the server mutex held for reading.
+type infoSection struct {
+	name   string
+	render func(s *RedisServer) []string
+}
+
+// extraInfoSections are left out of the default INFO reply, and only reported when
+// asked for by name, or by all or everything
+var extraInfoSections = map[string]bool{
+	"commandstats": true,
+	"latencystats": true,
+}
+
+// infoSections lists the sections reported by INFO, in output order
+var infoSections = []infoSection{
+	{"server", func(s *RedisServer) []string {
+		uptime := time.Since(s.stats.startTime)
+		return []string{
+			fmt.Sprintf("tcp_port:%d", s.config.Port),
+			fmt.Sprintf("tls_port:%d", s.config.TLSPort),
+			fmt.Sprintf("uptime_in_seconds:%d", int64(uptime.Seconds())),
+		}
+	}},
+	{"clients", func(s *RedisServer) []string {
+		return []string{
+			fmt.Sprintf("connected_clients:%d", s.connectedClients.Load()),
+			fmt.Sprintf("maxclients:%d", s.config.MaxClients),
+			// There are no blocking commands nor client-side caching yet
+			"blocked_clients:0",
+			"tracking_clients:0",
+			fmt.Sprintf("pubsub_clients:%d", s.pubsub.SubscriberCount()),
+		}
+	}},
+	{"memory", func(s *RedisServer) []string {
+		return append([]string{
+			fmt.Sprintf("used_memory:%d", s.usedMemory),
+			fmt.Sprintf("maxmemory:%d", s.config.MaxMemory),
+			fmt.Sprintf("maxmemory_policy:%s", s.config.MaxMemoryPolicy),
+			fmt.Sprintf("prefix_index_enabled:%d", boolToInt(s.prefixIndex != nil)),
+			fmt.Sprintf("prefix_index_nodes:%d", s.prefixIndex.Nodes()),
+		}, namespacesInfo(s)...)
+	}},
+	{"persistence", func(s *RedisServer) []string {
+		bgsaveStatus := "ok"
+		if !s.rdb.lastBgsaveOK {
+			bgsaveStatus = "err"
+		}
+		lines := append([]string{fmt.Sprintf("loading:%d", boolToInt(s.loading.Load()))}, loadingInfo(s)...)
+		return append(append(lines,
+			fmt.Sprintf("rdb_changes_since_last_save:%d", s.rdb.dirty),
+			fmt.Sprintf("rdb_bgsave_in_progress:%d", boolToInt(s.rdb.bgsaveInProgress)),
+			fmt.Sprintf("rdb_last_save_time:%d", s.rdb.lastSave.Unix()),
+			fmt.Sprintf("rdb_last_bgsave_status:%s", bgsaveStatus),
+		), uploadInfo(s)...)
+	}},
+	{"stats", func(s *RedisServer) []string {
+		totalErrors, _, _ := s.errorStats.snapshot()
+		return append([]string{
+			fmt.Sprintf("total_connections_received:%d", s.connectionsReceived.Load()),
+			fmt.Sprintf("rejected_connections:%d", s.rejectedConnections.Load()),
+			fmt.Sprintf("total_net_input_bytes:%d", s.netInputBytes.Load()),
+			fmt.Sprintf("total_net_output_bytes:%d", s.netOutputBytes.Load()),
+			fmt.Sprintf("expired_keys:%d", s.stats.expiredKeys),
+			fmt.Sprintf("evicted_keys:%d", s.stats.evictedKeys),
+			fmt.Sprintf("keyspace_hits:%d", s.stats.keyspaceHits),
+			fmt.Sprintf("keyspace_misses:%d", s.stats.keyspaceMisses),
+			fmt.Sprintf("client_output_buffer_limit_disconnections:%d", s.outputLimitDisconnections.Load()),
+			fmt.Sprintf("rate_limited_commands:%d", s.rateLimits.limited.Load()),
+			fmt.Sprintf("total_error_replies:%d", totalErrors),
+		}, append(hotKeysInfo(s.hotKeys), backingStoreInfo(s)...)...)
+	}},
+	{"replication", func(s *RedisServer) []string {
+		// As for ROLE, a master without replicas until there is replication
+		return []string{
+			"role:master",
+			"connected_slaves:0",
+			"master_repl_offset:0",
+		}
+	}},
+	{"commandstats", commandStatsInfo},
+	{"errorstats", errorStatsInfo},
+	{"latencystats", latencyStatsInfo},
+	{"keyspace", func(s *RedisServer) []string {
+		keys := s.data.Len()
+		if keys == 0 {
+			return nil // empty databases aren't listed
+		}
+		return []string{fmt.Sprintf("db0:keys=%d,expires=%d,avg_ttl=%d", keys, s.data.VolatileLen(), s.averageTTL().Milliseconds())}
+	}},
+}
+
+// averageTTL returns the mean time to live of the keys with an expiry, 0 when there
+// are none. It is derived from counters the storage engine keeps current, so it costs
+// no scan. Called with the server mutex held.
+func (s *RedisServer) averageTTL() time.Duration {
+	volatile := s.data.VolatileLen()
+	if volatile == 0 {
+		return 0
+	}
+	meanExpiry := time.Unix(s.data.ExpirySum()/int64(volatile), 0)
+	return max(meanExpiry.Sub(s.clock.Now()), 0)
+}
+
+// InfoHandler handles INFO commands
+type InfoHandler struct {
+	server *RedisServer
+}
+
+func (h *InfoHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	wanted := make(map[string]bool)
+	for _, arg := range args[1:] {
+		wanted[strings.ToLower(arg)] = true
+	}
+	all := wanted["all"] || wanted["everything"]
+	defaults := len(wanted) == 0 || wanted["default"]
+
+	var builder strings.Builder
+	h.server.mutex.RLock()
+	for _, section := range infoSections {
+		if !all && !(defaults && !extraInfoSections[section.name]) && !wanted[section.name] {
+			continue
+		}
+		if builder.Len() > 0 {
+			builder.WriteString("\r\n")
+		}
+		builder.WriteString("# " + strings.ToUpper(section.name[:1]) + section.name[1:] + "\r\n")
+		for _, line := range section.render(h.server) {
+			builder.WriteString(line + "\r\n")
+		}
+	}
+	h.server.mutex.RUnlock()
+
+	return writer.WriteVerbatimString("txt", builder.String())
+}
+
+// boolToInt renders a flag as the 0/1 INFO convention
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
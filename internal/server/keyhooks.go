@@ -0,0 +1,72 @@
+package server
+
+import "time"
+
+// SetHook is called whenever a key is written, with its new value and its expiry,
+// the zero time when it has none
+type SetHook func(key, value string, expiresAt time.Time)
+
+// KeyHook is called when a key goes away
+type KeyHook func(key string)
+
+// keyspaceHooks are the Go callbacks run on every keyspace change. They are only
+// registered before serving, so they are read without a lock.
+type keyspaceHooks struct {
+	set    []SetHook
+	del    []KeyHook
+	expire []KeyHook
+	evict  []KeyHook
+	flush  []func()
+}
+
+// OnSet registers a hook run whenever a key is written: by SET and INCR alike, for
+// every key loaded from the RDB file, and when EXPIRE and its variants or PERSIST
+// change its expiry. Keyspace hooks run synchronously with the
+// keyspace locked, in the order the changes are applied, so they must be quick and
+// must not call back into the server. They must be registered before serving clients.
+func (s *RedisServer) OnSet(hook SetHook) {
+	s.keyHooks.set = append(s.keyHooks.set, hook)
+}
+
+// OnDelete registers a hook run when DEL or UNLINK removes a key
+func (s *RedisServer) OnDelete(hook KeyHook) {
+	s.keyHooks.del = append(s.keyHooks.del, hook)
+}
+
+// OnExpire registers a hook run when an expired key is removed. Keys expire lazily,
+// when they are next accessed, so the hook may run well after the expiry time.
+func (s *RedisServer) OnExpire(hook KeyHook) {
+	s.keyHooks.expire = append(s.keyHooks.expire, hook)
+}
+
+// OnEvict registers a hook run when a key is evicted to stay under maxmemory
+func (s *RedisServer) OnEvict(hook KeyHook) {
+	s.keyHooks.evict = append(s.keyHooks.evict, hook)
+}
+
+// OnFlush registers a hook run when FLUSHDB or FLUSHALL empties the keyspace, which
+// removes every key without calling the per-key hooks
+func (s *RedisServer) OnFlush(hook func()) {
+	s.keyHooks.flush = append(s.keyHooks.flush, hook)
+}
+
+// keySetHooks runs the set hooks. Must be called with the server mutex held for writing.
+func (s *RedisServer) keySetHooks(key, value string, expiresAt int64) {
+	if len(s.keyHooks.set) == 0 {
+		return
+	}
+	var expiry time.Time
+	if expiresAt != 0 {
+		expiry = time.UnixMilli(expiresAt)
+	}
+	for _, hook := range s.keyHooks.set {
+		hook(key, value, expiry)
+	}
+}
+
+// runKeyHooks runs hooks for key. Must be called with the server mutex held for writing.
+func runKeyHooks(hooks []KeyHook, key string) {
+	for _, hook := range hooks {
+		hook(key)
+	}
+}
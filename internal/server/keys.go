@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// DelHandler handles DEL and UNLINK commands, which are the same here: the values
+// deleted are left to the garbage collector
+type DelHandler struct {
+	server *RedisServer
+}
+
+func (h *DelHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if len(args) < 2 {
+		return writer.WriteError(fmt.Sprintf("wrong number of arguments for '%s' command", strings.ToLower(args[0])))
+	}
+
+	h.server.mutex.Lock()
+	deleted := 0
+	for _, key := range args[1:] {
+		// The backing store may hold keys that aren't cached
+		h.server.writeThrough(StoreWrite{Key: key, Deleted: true})
+		h.server.cleanupExpired(key)
+		kv, exists := h.server.data.Get(key)
+		if !exists {
+			continue
+		}
+		h.server.deleteKey(key)
+		h.server.entries.Release(kv)
+		h.server.notifyKeyspaceEvent(NotifyGeneric, "del", key)
+		runKeyHooks(h.server.keyHooks.del, key)
+		deleted++
+	}
+	h.server.mutex.Unlock()
+
+	return writer.WriteInteger(deleted)
+}
+
+// FlushHandler handles FLUSHDB and FLUSHALL commands. ASYNC and SYNC are accepted
+// and make no difference, the old content being left to the garbage collector.
+type FlushHandler struct {
+	server *RedisServer
+}
+
+func (h *FlushHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if len(args) > 2 {
+		return writer.WriteError("syntax error")
+	}
+
+	h.server.mutex.Lock()
+	defer h.server.mutex.Unlock()
+
+	if len(args) == 2 {
+		switch strings.ToUpper(args[1]) {
+		case "ASYNC", "SYNC":
+		default:
+			return writer.WriteError("syntax error")
+		}
+	}
+
+	h.server.flushData()
+	return writer.WriteSimpleString("OK")
+}
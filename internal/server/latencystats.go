@@ -0,0 +1,288 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/bits"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// latencyPercentiles are the percentiles reported by INFO latencystats
+var latencyPercentiles = []float64{50, 99, 99.9}
+
+// The percentile histogram is HDR-style: durations in nanoseconds are counted
+// exactly below 2^(hdrSubBucketBits+1), then every power of two is split into
+// 2^hdrSubBucketBits linear sub-buckets, which bounds the error to about 3%.
+// Slower calls than hdrMaxValue, about 18 minutes, are counted as hdrMaxValue.
+const (
+	hdrSubBucketBits = 5
+	hdrMaxValueBits  = 40
+	hdrMaxValue      = 1<<hdrMaxValueBits - 1
+	hdrBucketCount   = (hdrMaxValueBits-hdrSubBucketBits)<<hdrSubBucketBits + 1<<hdrSubBucketBits
+)
+
+// latencyHistogram counts call durations for percentile queries
+type latencyHistogram struct {
+	counts [hdrBucketCount]atomic.Int64
+}
+
+// hdrBucket returns the index of the bucket counting d
+func hdrBucket(d time.Duration) int {
+	v := min(uint64(max(d, 0)), hdrMaxValue)
+	shift := max(bits.Len64(v)-hdrSubBucketBits-1, 0)
+	return shift<<hdrSubBucketBits + int(v>>shift)
+}
+
+// hdrBucketHigh returns the longest duration counted by bucket i
+func hdrBucketHigh(i int) time.Duration {
+	if i < 2<<hdrSubBucketBits {
+		return time.Duration(i)
+	}
+	shift := i>>hdrSubBucketBits - 1
+	mantissa := i - shift<<hdrSubBucketBits
+	return time.Duration(mantissa+1)<<shift - 1
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	h.counts[hdrBucket(d)].Add(1)
+}
+
+// percentiles returns the duration under which each of the given percentiles of the
+// calls completed, reading the buckets once
+func (h *latencyHistogram) percentiles(ps []float64) []time.Duration {
+	var counts [hdrBucketCount]int64
+	var total int64
+	for i := range h.counts {
+		counts[i] = h.counts[i].Load()
+		total += counts[i]
+	}
+
+	values := make([]time.Duration, len(ps))
+	if total == 0 {
+		return values
+	}
+	for j, p := range ps {
+		rank := max(int64(p/100*float64(total)+0.5), 1)
+		var cumulative int64
+		for i, count := range counts {
+			if cumulative += count; cumulative >= rank {
+				values[j] = hdrBucketHigh(i)
+				break
+			}
+		}
+	}
+	return values
+}
+
+// latencyStatsInfo renders the latencystats INFO section
+func latencyStatsInfo(s *RedisServer) []string {
+	var lines []string
+	for _, name := range s.usedCommands() {
+		histogram := s.commands[name].stats.histogram.Load()
+		if histogram == nil {
+			continue // only ever rejected
+		}
+		values := histogram.percentiles(latencyPercentiles)
+		fields := make([]string, len(values))
+		for i, value := range values {
+			fields[i] = fmt.Sprintf("p%s=%.3f", strconv.FormatFloat(latencyPercentiles[i], 'f', -1, 64), float64(value)/float64(time.Microsecond))
+		}
+		lines = append(lines, fmt.Sprintf("latency_percentiles_usec_%s:%s", strings.ToLower(name), strings.Join(fields, ",")))
+	}
+	return lines
+}
+
+// latencyEventHistory bounds the samples kept per latency event, as in Redis
+const latencyEventHistory = 160
+
+// latencyMonitor keeps the latency spikes of events for LATENCY LATEST and HISTORY
+type latencyMonitor struct {
+	mutex  sync.Mutex
+	events map[string]*latencyEvent
+}
+
+// latencyEvent is the history of an event: a sample per second it occurred in, the
+// latest last, and its worst latency ever
+type latencyEvent struct {
+	samples []latencySample
+	max     time.Duration
+}
+
+// latencySample is the worst latency of an event within a second
+type latencySample struct {
+	time     int64 // unix seconds
+	duration time.Duration
+}
+
+// record adds a latency spike of an event, merged with the sample of the same second
+func (m *latencyMonitor) record(event string, d time.Duration, now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.events == nil {
+		m.events = make(map[string]*latencyEvent)
+	}
+	e, exists := m.events[event]
+	if !exists {
+		e = &latencyEvent{}
+		m.events[event] = e
+	}
+	e.max = max(e.max, d)
+	second := now.Unix()
+	if n := len(e.samples); n > 0 && e.samples[n-1].time == second {
+		e.samples[n-1].duration = max(e.samples[n-1].duration, d)
+		return
+	}
+	if len(e.samples) == latencyEventHistory {
+		e.samples = e.samples[1:]
+	}
+	e.samples = append(e.samples, latencySample{time: second, duration: d})
+}
+
+// LatencyHandler handles LATENCY subcommands
+type LatencyHandler struct {
+	server *RedisServer
+}
+
+func (h *LatencyHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	switch strings.ToUpper(args[1]) {
+	case "HISTOGRAM":
+		return h.histogram(args[2:], writer)
+	case "LATEST":
+		if len(args) != 2 {
+			break
+		}
+		return h.latest(writer)
+	case "HISTORY":
+		if len(args) != 3 {
+			break
+		}
+		return h.history(args[2], writer)
+	case "RESET":
+		return h.reset(args[2:], writer)
+	case "HELP":
+		return writer.WriteBulkStringArray([]string{
+			"LATENCY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"HISTOGRAM [COMMAND ...]",
+			"    Return a cumulative distribution of latencies in the format of a histogram for the specified command names.",
+			"    If no commands are specified then all histograms are replied.",
+			"LATEST",
+			"    Return the latest latency samples for all events.",
+			"HISTORY <event>",
+			"    Return time-latency samples for the <event> class.",
+			"RESET [<event> ...]",
+			"    Reset latency data of one or more <event> classes.",
+			"    (default: reset all data for all event classes)",
+			"HELP",
+			"    Print this help.",
+		})
+	}
+	return writer.WriteError(fmt.Sprintf("unknown subcommand or wrong number of arguments for '%s'. Try LATENCY HELP.", args[1]))
+}
+
+// latest replies with the time and latency of the latest sample of every event, and
+// its worst latency, in milliseconds
+func (h *LatencyHandler) latest(writer *resp.Writer) error {
+	m := &h.server.latency
+	m.mutex.Lock()
+	var reply []resp.Value
+	for _, name := range slices.Sorted(maps.Keys(m.events)) {
+		e := m.events[name]
+		last := e.samples[len(e.samples)-1]
+		reply = append(reply, resp.Value{Type: resp.Array, Array: []resp.Value{
+			{Type: resp.BulkString, Bulk: name},
+			{Type: resp.Integer, Num: int(last.time)},
+			{Type: resp.Integer, Num: int(last.duration.Milliseconds())},
+			{Type: resp.Integer, Num: int(e.max.Milliseconds())},
+		}})
+	}
+	m.mutex.Unlock()
+	return writer.WriteArray(reply)
+}
+
+// history replies with the samples of an event, oldest first
+func (h *LatencyHandler) history(event string, writer *resp.Writer) error {
+	m := &h.server.latency
+	m.mutex.Lock()
+	var reply []resp.Value
+	if e, exists := m.events[event]; exists {
+		for _, sample := range e.samples {
+			reply = append(reply, resp.Value{Type: resp.Array, Array: []resp.Value{
+				{Type: resp.Integer, Num: int(sample.time)},
+				{Type: resp.Integer, Num: int(sample.duration.Milliseconds())},
+			}})
+		}
+	}
+	m.mutex.Unlock()
+	return writer.WriteArray(reply)
+}
+
+// reset forgets the given events, every event when none is given, and replies with
+// the number of events forgotten
+func (h *LatencyHandler) reset(events []string, writer *resp.Writer) error {
+	m := &h.server.latency
+	m.mutex.Lock()
+	count := 0
+	if len(events) == 0 {
+		count = len(m.events)
+		clear(m.events)
+	}
+	for _, event := range events {
+		if _, exists := m.events[event]; exists {
+			delete(m.events, event)
+			count++
+		}
+	}
+	m.mutex.Unlock()
+	return writer.WriteInteger(count)
+}
+
+// histogram replies with the calls and cumulative latency distribution of the given
+// commands, every command called so far when none is given. Buckets are bounded by
+// powers of two microseconds, and only those holding calls are listed.
+func (h *LatencyHandler) histogram(names []string, writer *resp.Writer) error {
+	if len(names) == 0 {
+		names = h.server.usedCommands()
+	}
+
+	var reply []resp.Value
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.ToUpper(name)
+		command, exists := h.server.commands[name]
+		if !exists || seen[name] || command.stats.calls.Load() == 0 {
+			continue
+		}
+		seen[name] = true
+
+		var buckets []resp.Value
+		var cumulative int64
+		for i := range command.stats.latency {
+			count := command.stats.latency[i].Load()
+			if count == 0 {
+				continue
+			}
+			cumulative += count
+			// Calls slower than the last bound are counted under the next power of two
+			bound := latencyBucketBound(i) / time.Microsecond
+			buckets = append(buckets,
+				resp.Value{Type: resp.Integer, Num: int(bound)},
+				resp.Value{Type: resp.Integer, Num: int(cumulative)})
+		}
+		reply = append(reply,
+			resp.Value{Type: resp.BulkString, Bulk: strings.ToLower(name)},
+			resp.Value{Type: resp.Map, Array: []resp.Value{
+				{Type: resp.BulkString, Bulk: "calls"}, {Type: resp.Integer, Num: int(cumulative)},
+				{Type: resp.BulkString, Bulk: "histogram_usec"}, {Type: resp.Map, Array: buckets},
+			}})
+	}
+	return writer.WriteMap(reply)
+}
@@ -0,0 +1,332 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loadTLSConfig builds the TLS server configuration from the tls-* directives
+func loadTLSConfig(config *Config) (*tls.Config, error) {
+	if config.TLSCertFile == "" || config.TLSKeyFile == "" {
+		return nil, errors.New("tls-cert-file and tls-key-file are required when tls-port is set")
+	}
+	cert, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		ClientAuth:   tls.NoClientCert,
+	}
+	if config.TLSAuthClients == TLSAuthClientsNo {
+		return tlsConfig, nil
+	}
+
+	if config.TLSCACertFile == "" {
+		return nil, errors.New("tls-ca-cert-file is required unless tls-auth-clients is no")
+	}
+	pem, err := os.ReadFile(config.TLSCACertFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading CA certificates: %w", err)
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", config.TLSCACertFile)
+	}
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	if config.TLSAuthClients == TLSAuthClientsOptional {
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// bindAddress is a parsed entry of the bind directive
+type bindAddress struct {
+	network  string // tcp4 or tcp6
+	host     string
+	optional bool // prefixed with "-": skipped when the address is unavailable
+}
+
+// parseBindAddress parses a bind entry: an IPv4 or IPv6 literal, "*" for every IPv4
+// address or "::*" for every IPv6 address, optionally prefixed with "-"
+func parseBindAddress(value string) (bindAddress, error) {
+	addr := bindAddress{network: "tcp4"}
+	if strings.HasPrefix(value, "-") {
+		addr.optional = true
+		value = value[1:]
+	}
+
+	switch value {
+	case "*":
+		addr.host = "0.0.0.0"
+	case "::*":
+		addr.network, addr.host = "tcp6", "::"
+	default:
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return addr, fmt.Errorf("invalid bind address '%s'", value)
+		}
+		if ip.To4() == nil {
+			addr.network = "tcp6"
+		}
+		addr.host = value
+	}
+	return addr, nil
+}
+
+// socketOptions are the TCP options applied to accepted connections
+type socketOptions struct {
+	keepAlive time.Duration // 0 disables keepalive probes
+	noDelay   bool
+}
+
+// socketOptions returns the current TCP options for plaintext or TLS listeners, so
+// CONFIG SET takes effect for new connections
+func (s *RedisServer) socketOptions(secure bool) socketOptions {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	noDelay := s.config.TCPNoDelay
+	if secure {
+		noDelay = s.config.TLSTCPNoDelay
+	}
+	return socketOptions{keepAlive: time.Duration(s.config.TCPKeepAlive) * time.Second, noDelay: noDelay}
+}
+
+// tuneConn applies the TCP options of the listener kind to an accepted connection.
+// Keepalive probes start after the configured period and repeat every third of it,
+// as in Redis, so a dead peer is detected within about twice the period.
+func (s *RedisServer) tuneConn(conn net.Conn) {
+	secure := false
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		secure = true
+		conn = tlsConn.NetConn()
+	}
+	if proxied, ok := conn.(*proxyConn); ok {
+		conn = proxied.Conn
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+
+	options := s.socketOptions(secure)
+	tcpConn.SetNoDelay(options.noDelay)
+	tcpConn.SetKeepAliveConfig(net.KeepAliveConfig{
+		Enable:   options.keepAlive > 0,
+		Idle:     options.keepAlive,
+		Interval: options.keepAlive / 3,
+		Count:    3,
+	})
+}
+
+// listenTCP opens a listener on port for every bind address, or acceptors listeners
+// sharing each address through SO_REUSEPORT. Optional addresses that can't be bound
+// are skipped, but at least one listener must open.
+func listenTCP(config *Config, port int, logger *slog.Logger) ([]net.Listener, error) {
+	listenConfig := &net.ListenConfig{}
+	if config.Acceptors > 1 {
+		var err error
+		if listenConfig, err = reusePortListenConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	var listeners []net.Listener
+	for _, entry := range config.Bind {
+		addr, err := parseBindAddress(entry)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+
+		address := net.JoinHostPort(addr.host, strconv.Itoa(port))
+		for i := 0; i < config.Acceptors; i++ {
+			listener, err := listenConfig.Listen(context.Background(), addr.network, address)
+			if err != nil && addr.optional && i == 0 {
+				logger.Warn("Skipping optional bind address", "addr", entry, "err", err)
+				break
+			}
+			if err != nil {
+				closeListeners(listeners)
+				return nil, err
+			}
+			listeners = append(listeners, listener)
+		}
+	}
+
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("no bind address could be used for port %d", port)
+	}
+	return listeners, nil
+}
+
+// closeListeners closes every listener in the list
+func closeListeners(listeners []net.Listener) {
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
+
+// outboundDialer returns the dialer for connections the server opens itself, bound
+// to bind-source-addr when it is set
+func outboundDialer(config *Config) *net.Dialer {
+	dialer := &net.Dialer{}
+	if config.BindSourceAddr != "" {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(config.BindSourceAddr)}
+	}
+	return dialer
+}
+
+// listenTLS opens the TLS listeners on tls-port. The handshake runs on the
+// connection's goroutine when it first reads, so a slow client doesn't hold up accepts.
+func listenTLS(config *Config, logger *slog.Logger) ([]net.Listener, error) {
+	tlsConfig, err := loadTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	listeners, err := listenTCP(config, config.TLSPort, logger)
+	if err != nil {
+		return nil, err
+	}
+	return wrapTLS(config, tlsConfig, listeners), nil
+}
+
+// wrapTLS turns TCP listeners into TLS listeners, reading the PROXY header first
+// when proxy-protocol is enabled
+func wrapTLS(config *Config, tlsConfig *tls.Config, listeners []net.Listener) []net.Listener {
+	wrapped := make([]net.Listener, len(listeners))
+	for i, listener := range proxyListeners(config, listeners) {
+		wrapped[i] = tls.NewListener(listener, tlsConfig)
+	}
+	return wrapped
+}
+
+// listenUnix opens the Unix domain socket listener at unixsocket, replacing a stale
+// socket file left by a previous run, and applies unixsocketperm when set
+func listenUnix(config *Config) (net.Listener, error) {
+	if info, err := os.Lstat(config.UnixSocket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(config.UnixSocket)
+	}
+	listener, err := net.Listen("unix", config.UnixSocket)
+	if err != nil {
+		return nil, err
+	}
+	if config.UnixSocketPerm != 0 {
+		if err := os.Chmod(config.UnixSocket, config.UnixSocketPerm); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
+// errMaxClients is sent to connections refused because maxclients is reached
+var errMaxClients = []byte("-ERR max number of clients reached\r\n")
+
+// admitClient counts a new connection, refusing it when maxclients is reached
+func (s *RedisServer) admitClient() bool {
+	s.mutex.RLock()
+	limit := int64(s.config.MaxClients)
+	s.mutex.RUnlock()
+
+	if s.connectedClients.Add(1) > limit {
+		s.connectedClients.Add(-1)
+		s.rejectedConnections.Add(1)
+		return false
+	}
+	s.connectionsReceived.Add(1)
+	return true
+}
+
+// releaseClient uncounts a closed connection
+func (s *RedisServer) releaseClient() {
+	s.connectedClients.Add(-1)
+}
+
+// errProtectedMode is sent to remote connections refused by protected mode
+var errProtectedMode = []byte("-DENIED Redis is running in protected mode because protected mode is enabled and no password is set for the default user. " +
+	"In this mode connections are only accepted from the loopback interface. " +
+	"If you want to connect from external computers to Redis you may adopt one of the following solutions: " +
+	"1) Just disable protected mode sending the command 'CONFIG SET protected-mode no' from the loopback interface by connecting to Redis from the same host the server is running, however MAKE SURE Redis is not publicly accessible from internet if you do so. " +
+	"2) Alternatively you can just disable the protected mode by editing the Redis configuration file, and setting the protected mode option to 'no', and then restarting the server. " +
+	"3) If you started the server manually just for testing, restart it with the '--protected-mode no' option. " +
+	"4) Set up an authentication password for the default user. " +
+	"NOTE: You only need to do one of the above things in order for the server to start accepting connections from the outside.\r\n")
+
+// refusesRemote reports whether protected mode turns away a client connecting from
+// ip: protected-mode is on, bind was left at its default, requirepass is empty and
+// the client isn't on the loopback interface.
+func (s *RedisServer) refusesRemote(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() {
+		return false
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.config.ProtectedMode && s.config.RequirePass == "" && slices.Equal(s.config.Bind, defaultBind)
+}
+
+// remoteIP returns the IP address of a TCP peer, nil for Unix socket clients
+func remoteIP(conn net.Conn) net.IP {
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP
+	}
+	return nil
+}
+
+// rejectClient sends the refusal reason to a client and closes its connection
+func rejectClient(conn net.Conn, reason []byte) {
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	conn.Write(reason)
+	conn.Close()
+}
+
+// serve accepts connections and handles each in a separate goroutine
+func serve(listener net.Listener, server *RedisServer) {
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			server.logger.Warn("Error accepting connection", "err", err)
+			continue
+		}
+
+		server.tuneConn(conn)
+
+		if !server.admitClient() {
+			// Writing to a TLS connection would run the handshake on the accept loop
+			if _, secure := conn.(*tls.Conn); secure {
+				go rejectClient(conn, errMaxClients)
+			} else {
+				rejectClient(conn, errMaxClients)
+			}
+			continue
+		}
+
+		go func() {
+			defer server.releaseClient()
+
+			// The peer address may come from a PROXY header, so it is only resolved here
+			if server.refusesRemote(remoteIP(conn)) {
+				rejectClient(conn, errProtectedMode)
+				return
+			}
+			connection := NewConnection(conn, server.connectionOptions())
+			connection.Handle(server)
+		}()
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// loadBatch is the number of keys loaded from the dump file per lock of the keyspace
+const loadBatch = 1024
+
+// errLoading is the reply to commands that can't run until the dataset is loaded
+const errLoading = "LOADING Redis is loading the dataset in memory"
+
+// loadProgress tracks the loading of the dump file for INFO persistence
+type loadProgress struct {
+	startedAt   atomic.Int64 // unix nanoseconds
+	totalBytes  atomic.Int64
+	loadedBytes atomic.Int64
+}
+
+// start resets the progress for a file of size bytes
+func (p *loadProgress) start(size int64) {
+	p.startedAt.Store(time.Now().UnixNano())
+	p.totalBytes.Store(size)
+	p.loadedBytes.Store(0)
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// LoadRDBInBackground loads the dump file like LoadRDB, but returns at once so that
+// clients are served meanwhile, calling done once it ends. Until then, commands
+// without the loading flag are replied -LOADING unless every key they name is
+// loaded already, and the keys they write are kept over those of the file. A
+// failure to load, which leaves only part of the dataset, requests a shutdown
+// without saving, as does SHUTDOWN NOSAVE.
+func (s *RedisServer) LoadRDBInBackground(done func(loaded int, err error)) {
+	s.loading.Store(true)
+	go func() {
+		loaded, err := s.loadRDBTraced(s.ctx)
+		if err != nil && s.ctx.Err() == nil {
+			s.logger.Warn("Failed to load the RDB file, shutting down", "err", err)
+			select {
+			case s.shutdownRequests <- false:
+			default:
+			}
+		}
+		done(loaded, err)
+	}()
+}
+
+// loaded reports whether there are keys and all of them are in the keyspace, so that
+// a command naming them may run while loading
+func (s *RedisServer) loaded(keys []string) bool {
+	if len(keys) == 0 {
+		return false
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, key := range keys {
+		if _, exists := s.data.Get(key); !exists {
+			return false
+		}
+	}
+	return true
+}
+
+// loadingInfo renders the progress of the loading for INFO persistence, while it
+// lasts
+func loadingInfo(s *RedisServer) []string {
+	if !s.loading.Load() {
+		return nil
+	}
+	p := &s.loadProgress
+	startedAt := time.Unix(0, p.startedAt.Load())
+	total, loadedBytes := p.totalBytes.Load(), p.loadedBytes.Load()
+	var percent float64
+	eta := int64(1)
+	if total > 0 {
+		percent = float64(loadedBytes) * 100 / float64(total)
+	}
+	if loadedBytes > 0 {
+		elapsed := time.Since(startedAt)
+		eta = int64(elapsed.Seconds() * float64(total-loadedBytes) / float64(loadedBytes))
+	}
+	return []string{
+		fmt.Sprintf("loading_start_time:%d", startedAt.Unix()),
+		fmt.Sprintf("loading_total_bytes:%d", total),
+		fmt.Sprintf("loading_loaded_bytes:%d", loadedBytes),
+		fmt.Sprintf("loading_loaded_perc:%.2f", percent),
+		fmt.Sprintf("loading_eta_seconds:%d", eta),
+	}
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// localClientAddr is the address local clients report, as they have no peer
+const localClientAddr = "local"
+
+var (
+	// ErrClientClosed is returned by LocalClient methods once Close was called
+	ErrClientClosed = errors.New("client closed")
+	// ErrShuttingDown is returned by LocalClient methods once the server stops
+	ErrShuttingDown = errors.New("server is shutting down")
+)
+
+// LocalClient is a client living in the server's process: its commands are dispatched
+// directly, without a connection, and the RESP3 replies are decoded as they're flushed.
+// It is registered like any client, so it has its own pub/sub subscriptions and shows
+// up to hooks, but it is trusted and never needs to authenticate. It is safe for
+// concurrent use; commands run one at a time.
+type LocalClient struct {
+	server *RedisServer
+	client *Client
+	writer *resp.Writer
+
+	// commandMutex serializes commands, so the frames decoded meanwhile are the reply
+	commandMutex sync.Mutex
+
+	// inbox holds the decoded frames, split between command replies and the pub/sub
+	// messages waiting for Receive. It is filled from Flush, under the writer's lock.
+	inboxMutex sync.Mutex
+	pending    []byte
+	replies    []resp.Value
+	messages   []resp.Value
+	arrived    chan struct{}
+	closed     bool
+}
+
+// NewLocalClient connects a client from inside the process
+func (s *RedisServer) NewLocalClient() *LocalClient {
+	c := &LocalClient{server: s, arrived: make(chan struct{})}
+	c.writer = resp.NewWriter(bufio.NewWriterSize(localSink{c}, DefaultIOBufferSize))
+	c.writer.SetProtocol(resp.RESP3)
+	c.client = s.clients.Register(s.ctx, c.writer, nil, localClientAddr)
+	c.client.authenticated.Store(true)
+	return c
+}
+
+// localSink receives the replies flushed by a local client's writer
+type localSink struct {
+	c *LocalClient
+}
+
+// Write decodes every complete frame, keeping a partial one for the next write.
+// Messages are pushes in RESP3, so they can't be mistaken for replies.
+func (s localSink) Write(p []byte) (int, error) {
+	c := s.c
+	c.inboxMutex.Lock()
+	defer c.inboxMutex.Unlock()
+
+	c.pending = append(c.pending, p...)
+	received := false
+	for len(c.pending) > 0 {
+		value, n, err := resp.Decode(c.pending)
+		if err != nil {
+			break // incomplete: the rest is still in the writer's buffer
+		}
+		c.pending = c.pending[n:]
+		if isPubSubMessage(value) {
+			c.messages = append(c.messages, value)
+			received = true
+		} else {
+			c.replies = append(c.replies, value)
+		}
+	}
+	if len(c.pending) == 0 {
+		c.pending = nil
+	}
+	if received {
+		close(c.arrived)
+		c.arrived = make(chan struct{})
+	}
+	return len(p), nil
+}
+
+// isPubSubMessage reports whether a frame is a published message rather than a reply;
+// subscription confirmations are pushes too, but they answer the client's commands
+func isPubSubMessage(v resp.Value) bool {
+	if v.Type != resp.Push || len(v.Array) == 0 {
+		return false
+	}
+	switch v.Array[0].Bulk {
+	case "message", "pmessage":
+		return true
+	}
+	return false
+}
+
+// Do runs a command and returns its reply frames: a single one, except for the
+// subscription commands, which confirm each channel separately. Error replies are
+// returned as frames too.
+func (c *LocalClient) Do(args []string) ([]resp.Value, error) {
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	// Messages are told apart from replies by their RESP3 push type
+	if strings.EqualFold(args[0], "HELLO") && len(args) > 1 && args[1] != "3" {
+		return []resp.Value{{Type: resp.Error, Str: "NOPROTO local clients only speak RESP3"}}, nil
+	}
+
+	c.commandMutex.Lock()
+	defer c.commandMutex.Unlock()
+	if err := c.usable(); err != nil {
+		return nil, err
+	}
+
+	c.client.Touch()
+	if err := c.server.dispatch(c.client.Context(), args, c.writer); err != nil {
+		return nil, err
+	}
+	if err := c.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	c.inboxMutex.Lock()
+	defer c.inboxMutex.Unlock()
+	replies := c.replies
+	c.replies = nil
+	return replies, nil
+}
+
+// Receive waits for the next message published to the channels and patterns the
+// client subscribed to
+func (c *LocalClient) Receive(ctx context.Context) (resp.Value, error) {
+	for {
+		c.inboxMutex.Lock()
+		if len(c.messages) > 0 {
+			message := c.messages[0]
+			c.messages = c.messages[1:]
+			c.inboxMutex.Unlock()
+			return message, nil
+		}
+		arrived := c.arrived
+		c.inboxMutex.Unlock()
+
+		if err := c.usable(); err != nil {
+			return resp.Value{}, err
+		}
+		select {
+		case <-arrived:
+		case <-ctx.Done():
+			return resp.Value{}, ctx.Err()
+		case <-c.client.Context().Done():
+			// Closed or shutting down: drain what was already delivered first
+		}
+	}
+}
+
+// usable reports why the client can't be used any more, nil while it can
+func (c *LocalClient) usable() error {
+	c.inboxMutex.Lock()
+	closed := c.closed
+	c.inboxMutex.Unlock()
+	switch {
+	case closed:
+		return ErrClientClosed
+	case c.server.shuttingDown.Load():
+		return ErrShuttingDown
+	}
+	return nil
+}
+
+// Close drops the client's subscriptions and unregisters it
+func (c *LocalClient) Close() error {
+	c.commandMutex.Lock()
+	defer c.commandMutex.Unlock()
+
+	c.inboxMutex.Lock()
+	if c.closed {
+		c.inboxMutex.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.inboxMutex.Unlock()
+
+	c.server.pubsub.RemoveSubscriber(c.writer)
+	c.server.clients.Unregister(c.client)
+	c.writer.Close()
+	return nil
+}
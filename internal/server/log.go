@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// Log levels accepted by loglevel, from the most to the least verbose
+const (
+	LogDebug   = "debug"
+	LogVerbose = "verbose"
+	LogNotice  = "notice"
+	LogWarning = "warning"
+)
+
+// Log formats accepted by log-format
+const (
+	// LogFormatText writes key=value lines
+	LogFormatText = "text"
+	// LogFormatJSON writes a JSON object per line
+	LogFormatJSON = "json"
+)
+
+// levelVerbose sits between debug and notice, which map to slog's debug and info
+const levelVerbose = slog.LevelDebug + 2
+
+// slogLevel maps a loglevel value to the slog level it enables
+func slogLevel(level string) slog.Level {
+	switch level {
+	case LogDebug:
+		return slog.LevelDebug
+	case LogVerbose:
+		return levelVerbose
+	case LogWarning:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// renameLevel reports levels under their loglevel names
+func renameLevel(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Key != slog.LevelKey || len(groups) > 0 {
+		return attr
+	}
+	switch level := attr.Value.Any().(slog.Level); {
+	case level < levelVerbose:
+		attr.Value = slog.StringValue(LogDebug)
+	case level < slog.LevelInfo:
+		attr.Value = slog.StringValue(LogVerbose)
+	case level < slog.LevelWarn:
+		attr.Value = slog.StringValue(LogNotice)
+	default:
+		attr.Value = slog.StringValue(LogWarning)
+	}
+	return attr
+}
+
+// newLogHandler writes records at or above level to w in the given log-format
+func newLogHandler(w io.Writer, format string, level slog.Leveler) slog.Handler {
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: renameLevel}
+	if format == LogFormatJSON {
+		return slog.NewJSONHandler(w, options)
+	}
+	return slog.NewTextHandler(w, options)
+}
+
+// OpenLog starts logging to logfile, in log-format; the server logs to stdout until
+// then, or when logfile is empty
+func (s *RedisServer) OpenLog() error {
+	s.mutex.RLock()
+	path, format := s.config.LogFile, s.config.LogFormat
+	s.mutex.RUnlock()
+
+	w := io.Writer(os.Stdout)
+	if path != "" {
+		file, err := openLogFile(path)
+		if err != nil {
+			return err
+		}
+		s.logFile = file
+		w = file
+	}
+	s.logger = slog.New(newLogHandler(w, format, &s.logLevel))
+	return nil
+}
+
+// CloseLog closes the log file, if the server writes to one, once it is done logging
+func (s *RedisServer) CloseLog() {
+	if s.logFile != nil {
+		s.logFile.Close()
+	}
+}
+
+// ReopenLog closes and reopens the log file and the audit log, so that logging moves
+// to a new file once logrotate has renamed the old one. The server keeps writing to
+// the old file if the new one can't be opened.
+func (s *RedisServer) ReopenLog() {
+	files := []*logFile{s.logFile}
+	if s.audit != nil {
+		files = append(files, s.audit.file)
+	}
+	for _, file := range files {
+		if file == nil {
+			continue
+		}
+		if err := file.Reopen(); err != nil {
+			s.logger.Warn("Failed to reopen the log file", "path", file.path, "err", err)
+			continue
+		}
+		s.logger.Info("Log file reopened", "path", file.path)
+	}
+}
+
+// logFile is the log file, which may be swapped for a new one under the same path
+type logFile struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+}
+
+// openLogFile opens path for appending, creating it if needed
+func openLogFile(path string) (*logFile, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &logFile{path: path, file: file}, nil
+}
+
+func (f *logFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.file.Write(p)
+}
+
+// Reopen opens path again and closes the previous file
+func (f *logFile) Reopen() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	previous := f.file
+	f.file = file
+	f.mutex.Unlock()
+	return previous.Close()
+}
+
+func (f *logFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.file.Close()
+}
+
+// SetLogger replaces the server's logger, for embedders routing the logs into their
+// own. Records are still filtered by loglevel. It must be called before serving.
+func (s *RedisServer) SetLogger(logger *slog.Logger) {
+	s.logger = slog.New(&levelFilter{Handler: logger.Handler(), level: &s.logLevel})
+}
+
+// Logger returns the server's logger
+func (s *RedisServer) Logger() *slog.Logger {
+	return s.logger
+}
+
+// syncLogLevel applies loglevel. Must be called with the server mutex held.
+func (s *RedisServer) syncLogLevel() {
+	s.logLevel.Set(slogLevel(s.config.LogLevel))
+}
+
+// levelFilter drops the records of an injected handler below loglevel
+type levelFilter struct {
+	slog.Handler
+	level slog.Leveler
+}
+
+func (f *levelFilter) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= f.level.Level() && f.Handler.Enabled(ctx, level)
+}
+
+func (f *levelFilter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelFilter{Handler: f.Handler.WithAttrs(attrs), level: f.level}
+}
+
+func (f *levelFilter) WithGroup(name string) slog.Handler {
+	return &levelFilter{Handler: f.Handler.WithGroup(name), level: f.level}
+}
+
+// logVerbose logs at the verbose level, which slog has no shorthand for
+func (s *RedisServer) logVerbose(msg string, args ...any) {
+	s.logger.Log(context.Background(), levelVerbose, msg, args...)
+}
+
+// logReadError logs why reading a client's next command failed: protocol errors are
+// worth a look, disconnections are routine
+func (s *RedisServer) logReadError(addr string, err error) {
+	if resp.AsProtocolError(err) != nil {
+		s.logVerbose("Protocol error from client", "client_addr", addr, "err", err)
+		return
+	}
+	s.logger.Debug("Client disconnected", "client_addr", addr, "err", err)
+}
+
+// logCommand logs a command at debug level once it has run, with its duration. Only
+// the command name is logged, as arguments may hold values and passwords.
+func (s *RedisServer) logCommand(ctx context.Context, name string, start time.Time) {
+	attrs := []slog.Attr{slog.String("command", strings.ToLower(name)), slog.Duration("duration", time.Since(start))}
+	if client, ok := ClientFromContext(ctx); ok {
+		attrs = append(attrs, slog.Int64("client_id", client.ID), slog.String("client_addr", client.Addr))
+	}
+	s.logger.LogAttrs(ctx, slog.LevelDebug, "command executed", attrs...)
+}
+
+// parseLogLevel validates a loglevel value
+func parseLogLevel(value string) (string, error) {
+	level := strings.ToLower(value)
+	switch level {
+	case LogDebug, LogVerbose, LogNotice, LogWarning:
+		return level, nil
+	}
+	return "", fmt.Errorf("argument must be one of the following: %s, %s, %s, %s", LogDebug, LogVerbose, LogNotice, LogWarning)
+}
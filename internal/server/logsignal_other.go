@@ -0,0 +1,11 @@
+//go:build !unix
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenLogSignals make the server reopen its log file; SIGUSR1 only exists on Unix
+var reopenLogSignals = []os.Signal{syscall.SIGHUP}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenLogSignals make the server reopen its log file, for log rotation
+var reopenLogSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR1}
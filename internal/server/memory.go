@@ -0,0 +1,275 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// Defaults of MEMORY BIGKEYS: the keys reported per type and the keys examined
+const (
+	bigKeysDefaultCount   = 5
+	bigKeysDefaultSamples = 10000
+)
+
+// MemoryHandler handles MEMORY subcommands
+type MemoryHandler struct {
+	server *RedisServer
+}
+
+func (h *MemoryHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if len(args) < 2 {
+		return writer.WriteError("wrong number of arguments for 'memory' command")
+	}
+
+	switch strings.ToUpper(args[1]) {
+	case "USAGE":
+		return h.usage(args, writer)
+	case "STATS":
+		return h.stats(writer)
+	case "BIGKEYS":
+		return h.bigKeys(args, writer)
+	case "PURGE":
+		if len(args) != 2 {
+			return writer.WriteError("wrong number of arguments for 'memory|purge' command")
+		}
+		// A forced collection returning as much memory as possible to the OS, which
+		// the scavenger otherwise does gradually
+		debug.FreeOSMemory()
+		return writer.WriteSimpleString("OK")
+	case "HELP":
+		return writer.WriteBulkStringArray([]string{
+			"MEMORY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"STATS",
+			"    Return information about the memory usage of the server.",
+			"USAGE <key> [SAMPLES <count>]",
+			"    Return memory in bytes used by <key> and its value.",
+			"BIGKEYS [COUNT <count>] [SAMPLES <count>]",
+			"    Return the <count> largest keys of every type, with their estimated size in",
+			"    bytes, among <count> keys sampled at random (all of them when 0).",
+			"PURGE",
+			"    Collect garbage and return the freed memory to the operating system.",
+			"HELP",
+			"    Print this help.",
+		})
+	default:
+		return writer.WriteError(fmt.Sprintf("unknown subcommand '%s'. Try MEMORY HELP.", args[1]))
+	}
+}
+
+// usage replies with the estimated size of a key
+func (h *MemoryHandler) usage(args []string, writer *resp.Writer) error {
+	if len(args) != 3 && len(args) != 5 {
+		return writer.WriteError("wrong number of arguments for 'memory|usage' command")
+	}
+	key := args[2]
+
+	h.server.mutex.Lock()
+	h.server.cleanupExpired(key)
+	kv, exists := h.server.data.Get(key)
+	var size int64
+	if exists {
+		size = entrySize(key, kv)
+	}
+	h.server.mutex.Unlock()
+
+	if !exists {
+		return writer.WriteNullBulkString()
+	}
+	return writer.WriteInteger(int(size))
+}
+
+// stats replies with allocator and dataset statistics as a map
+func (h *MemoryHandler) stats(writer *resp.Writer) error {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	h.server.mutex.RLock()
+	keys := h.server.data.Len()
+	dataset := h.server.usedMemory
+	sharedKeys := h.server.stats.sharedIntegerKeys
+	gc := h.server.gc
+	h.server.mutex.RUnlock()
+
+	// A shared integer is at most 4 bytes plus a string header per key
+	const sharedSavingPerKey = 4 + 16
+
+	return writer.WriteMap([]resp.Value{
+		{Type: resp.BulkString, Bulk: "total.allocated"}, {Type: resp.Integer, Num: int(mem.HeapAlloc)},
+		{Type: resp.BulkString, Bulk: "heap.system"}, {Type: resp.Integer, Num: int(mem.HeapSys)},
+		{Type: resp.BulkString, Bulk: "keys.count"}, {Type: resp.Integer, Num: keys},
+		{Type: resp.BulkString, Bulk: "dataset.bytes"}, {Type: resp.Integer, Num: int(dataset)},
+		{Type: resp.BulkString, Bulk: "shared.integers.keys"}, {Type: resp.Integer, Num: int(sharedKeys)},
+		{Type: resp.BulkString, Bulk: "shared.integers.bytes.saved"}, {Type: resp.Integer, Num: int(sharedKeys * sharedSavingPerKey)},
+		{Type: resp.BulkString, Bulk: "gc.cycles"}, {Type: resp.Integer, Num: int(mem.NumGC)},
+		{Type: resp.BulkString, Bulk: "gc.pause.total.us"}, {Type: resp.Integer, Num: int(mem.PauseTotalNs / 1000)},
+		{Type: resp.BulkString, Bulk: "gc.next"}, {Type: resp.Integer, Num: int(mem.NextGC)},
+		{Type: resp.BulkString, Bulk: "gc.percent"}, {Type: resp.Integer, Num: gc.percent},
+		{Type: resp.BulkString, Bulk: "gc.memory.limit"}, {Type: resp.Integer, Num: int(gc.memoryLimit)},
+		{Type: resp.BulkString, Bulk: "allocator.active"}, {Type: resp.Integer, Num: int(mem.HeapInuse)},
+		{Type: resp.BulkString, Bulk: "allocator.resident"}, {Type: resp.Integer, Num: int(mem.HeapSys - mem.HeapReleased)},
+		{Type: resp.BulkString, Bulk: "allocator.released"}, {Type: resp.Integer, Num: int(mem.HeapReleased)},
+		{Type: resp.BulkString, Bulk: "allocator.objects"}, {Type: resp.Integer, Num: int(mem.HeapObjects)},
+		{Type: resp.BulkString, Bulk: "stacks.system"}, {Type: resp.Integer, Num: int(mem.StackSys)},
+		{Type: resp.BulkString, Bulk: "runtime.system"}, {Type: resp.Integer, Num: int(mem.Sys)},
+	})
+}
+
+// gcTuning is the garbage collector tuning applied to the runtime
+type gcTuning struct {
+	percent     int
+	memoryLimit int64
+}
+
+// envGCPercent returns the GC percent GOGC sets, 100 by default and -1 when off
+func envGCPercent() int {
+	if percent, err := parseGCPercent(os.Getenv("GOGC")); err == nil {
+		return percent
+	}
+	return 100
+}
+
+// runtimeMemoryLimit returns the soft memory limit of the runtime, GOMEMLIMIT unless
+// changed, 0 when there is none
+func runtimeMemoryLimit() int64 {
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+		return limit
+	}
+	return 0
+}
+
+// parseGCPercent parses a GOGC value: "off" or a non-negative percentage
+func parseGCPercent(value string) (int, error) {
+	if strings.EqualFold(value, "off") {
+		return -1, nil
+	}
+	percent, err := strconv.Atoi(value)
+	if err != nil || percent < 0 {
+		return 0, fmt.Errorf("invalid GC percent '%s'", value)
+	}
+	return percent, nil
+}
+
+// formatGCPercent renders a GC percent as GOGC takes it
+func formatGCPercent(percent int) string {
+	if percent < 0 {
+		return "off"
+	}
+	return strconv.Itoa(percent)
+}
+
+// syncGC applies gc-percent and gc-memory-limit to the runtime. They are process-wide,
+// so only those changed since are applied, leaving alone the tuning of an application
+// embedding the server otherwise.
+// Must be called with the server mutex held for writing.
+func (s *RedisServer) syncGC() {
+	if s.config.GCPercent != s.gc.percent {
+		debug.SetGCPercent(s.config.GCPercent)
+		s.gc.percent = s.config.GCPercent
+	}
+	if s.config.GCMemoryLimit != s.gc.memoryLimit {
+		limit := s.config.GCMemoryLimit
+		if limit == 0 {
+			limit = math.MaxInt64
+		}
+		debug.SetMemoryLimit(limit)
+		s.gc.memoryLimit = s.config.GCMemoryLimit
+	}
+}
+
+// bigKeys replies with the largest keys of every type among a random sample of the
+// keyspace, along with the number and size of the keys of each type sampled, so that
+// what takes up memory can be found without scanning from a client. The keyspace is
+// locked meanwhile, which SAMPLES bounds.
+func (h *MemoryHandler) bigKeys(args []string, writer *resp.Writer) error {
+	count, samples := bigKeysDefaultCount, bigKeysDefaultSamples
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return writer.WriteError("syntax error")
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil || n < 0 {
+			return writer.WriteError("value is not an integer or out of range")
+		}
+		switch strings.ToUpper(args[i]) {
+		case "COUNT":
+			if n == 0 {
+				return writer.WriteError("COUNT must be positive")
+			}
+			count = n
+		case "SAMPLES":
+			samples = n
+		default:
+			return writer.WriteError("syntax error")
+		}
+	}
+
+	type bigKey struct {
+		key  string
+		size int64
+	}
+	type typeStats struct {
+		keys    int
+		bytes   int64
+		biggest []bigKey // largest first, at most count
+	}
+	byType := make(map[store.ObjectType]*typeStats)
+	sampled, sampledBytes := 0, int64(0)
+
+	h.server.mutex.RLock()
+	now := h.server.clock.Now().UnixMilli()
+	h.server.data.Sample(false, func(key string, kv *store.KeyValue) bool {
+		if kv.ExpiresAt != 0 && kv.ExpiresAt <= now {
+			return true
+		}
+		size := entrySize(key, kv)
+		stats := byType[kv.Value.Type()]
+		if stats == nil {
+			stats = &typeStats{}
+			byType[kv.Value.Type()] = stats
+		}
+		stats.keys++
+		stats.bytes += size
+		if len(stats.biggest) < count || size > stats.biggest[len(stats.biggest)-1].size {
+			at, _ := slices.BinarySearchFunc(stats.biggest, size, func(k bigKey, size int64) int {
+				return int(size - k.size)
+			})
+			stats.biggest = slices.Insert(stats.biggest, at, bigKey{key, size})
+			stats.biggest = stats.biggest[:min(len(stats.biggest), count)]
+		}
+		sampled++
+		sampledBytes += size
+		return samples == 0 || sampled < samples
+	})
+	h.server.mutex.RUnlock()
+
+	reply := []resp.Value{
+		{Type: resp.BulkString, Bulk: "keys.sampled"}, {Type: resp.Integer, Num: sampled},
+		{Type: resp.BulkString, Bulk: "bytes.sampled"}, {Type: resp.Integer, Num: int(sampledBytes)},
+	}
+	for _, t := range slices.Sorted(maps.Keys(byType)) {
+		stats := byType[t]
+		biggest := make([]resp.Value, len(stats.biggest))
+		for i, k := range stats.biggest {
+			biggest[i] = resp.Value{Type: resp.Array, Array: []resp.Value{
+				{Type: resp.BulkString, Bulk: k.key}, {Type: resp.Integer, Num: int(k.size)},
+			}}
+		}
+		reply = append(reply, resp.Value{Type: resp.BulkString, Bulk: t.String()}, resp.Value{Type: resp.Map, Array: []resp.Value{
+			{Type: resp.BulkString, Bulk: "keys"}, {Type: resp.Integer, Num: stats.keys},
+			{Type: resp.BulkString, Bulk: "bytes"}, {Type: resp.Integer, Num: int(stats.bytes)},
+			{Type: resp.BulkString, Bulk: "biggest"}, {Type: resp.Array, Array: biggest},
+		}})
+	}
+	return writer.WriteMap(reply)
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metricsWriter renders metrics in the Prometheus text exposition format
+type metricsWriter struct {
+	strings.Builder
+}
+
+// family starts a metric family with its help text and type
+func (w *metricsWriter) family(name, kind, help string) {
+	w.WriteString("# HELP " + name + " " + help + "\n")
+	w.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+// sample writes a sample; labels are name="value" pairs already joined by commas
+func (w *metricsWriter) sample(name, labels string, value float64) {
+	w.WriteString(name)
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+}
+
+// metric writes a family made of a single unlabelled sample
+func (w *metricsWriter) metric(name, kind, help string, value float64) {
+	w.family(name, kind, help)
+	w.sample(name, "", value)
+}
+
+// MetricsHandler serves the server's metrics to Prometheus. Commands are reported
+// once they have run at least once, under their lowercase name.
+func (s *RedisServer) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		rw.Write([]byte(s.renderMetrics()))
+	})
+}
+
+// renderMetrics renders every metric
+func (s *RedisServer) renderMetrics() string {
+	var w metricsWriter
+
+	s.mutex.RLock()
+	uptime := time.Since(s.stats.startTime)
+	usedMemory, maxMemory := s.usedMemory, s.config.MaxMemory
+	keys, volatile, avgTTL := s.data.Len(), s.data.VolatileLen(), s.averageTTL()
+	stats := s.stats
+	s.mutex.RUnlock()
+
+	w.metric("redis_uptime_in_seconds", "gauge", "Time since the server started.", uptime.Seconds())
+	w.metric("redis_connected_clients", "gauge", "Number of client connections.", float64(s.connectedClients.Load()))
+	w.metric("redis_blocked_clients", "gauge", "Clients blocked on a command; there are no blocking commands yet.", 0)
+	w.metric("redis_tracking_clients", "gauge", "Clients with client-side caching; there is no tracking yet.", 0)
+	w.metric("redis_pubsub_clients", "gauge", "Clients with a channel or pattern subscription.", float64(s.pubsub.SubscriberCount()))
+	w.metric("redis_connections_received_total", "counter", "Connections accepted.", float64(s.connectionsReceived.Load()))
+	w.metric("redis_rejected_connections_total", "counter", "Connections rejected because of maxclients.", float64(s.rejectedConnections.Load()))
+	w.metric("redis_memory_used_bytes", "gauge", "Memory used by the dataset, as estimated for maxmemory.", float64(usedMemory))
+	w.metric("redis_memory_max_bytes", "gauge", "The maxmemory setting, 0 when unlimited.", float64(maxMemory))
+	w.family("redis_db_keys", "gauge", "Number of keys in the database.")
+	w.sample("redis_db_keys", `db="db0"`, float64(keys))
+	w.family("redis_db_keys_expiring", "gauge", "Number of keys with an expiry in the database.")
+	w.sample("redis_db_keys_expiring", `db="db0"`, float64(volatile))
+	w.family("redis_db_avg_ttl_seconds", "gauge", "Average time to live of the keys with an expiry.")
+	w.sample("redis_db_avg_ttl_seconds", `db="db0"`, avgTTL.Seconds())
+	w.metric("redis_net_input_bytes_total", "counter", "Bytes read from network clients.", float64(s.netInputBytes.Load()))
+	w.metric("redis_net_output_bytes_total", "counter", "Bytes written to network clients.", float64(s.netOutputBytes.Load()))
+	w.metric("redis_keyspace_hits_total", "counter", "Successful key lookups by read commands.", float64(stats.keyspaceHits))
+	w.metric("redis_keyspace_misses_total", "counter", "Failed key lookups by read commands.", float64(stats.keyspaceMisses))
+	w.metric("redis_expired_keys_total", "counter", "Keys removed because they expired.", float64(stats.expiredKeys))
+	w.metric("redis_evicted_keys_total", "counter", "Keys evicted to stay under maxmemory.", float64(stats.evictedKeys))
+
+	totalErrors, codes, counts := s.errorStats.snapshot()
+	w.metric("redis_error_replies_total", "counter", "Error replies sent to clients.", float64(totalErrors))
+	w.family("redis_errors_total", "counter", "Error replies by error code.")
+	for i, code := range codes {
+		w.sample("redis_errors_total", "err="+strconv.Quote(code), float64(counts[i]))
+	}
+
+	names := s.usedCommands()
+	w.family("redis_commands_total", "counter", "Calls of the command.")
+	for _, name := range names {
+		w.sample("redis_commands_total", commandLabel(name), float64(s.commands[name].stats.calls.Load()))
+	}
+	w.family("redis_commands_duration_seconds_total", "counter", "Time spent running the command.")
+	for _, name := range names {
+		usec := s.commands[name].stats.usec.Load()
+		w.sample("redis_commands_duration_seconds_total", commandLabel(name), float64(usec)/1e6)
+	}
+	w.family("redis_commands_rejected_calls_total", "counter", "Calls of the command refused before running.")
+	for _, name := range names {
+		w.sample("redis_commands_rejected_calls_total", commandLabel(name), float64(s.commands[name].stats.rejected.Load()))
+	}
+	w.family("redis_commands_failed_calls_total", "counter", "Calls of the command that replied with an error.")
+	for _, name := range names {
+		w.sample("redis_commands_failed_calls_total", commandLabel(name), float64(s.commands[name].stats.failed.Load()))
+	}
+	w.family("redis_command_duration_seconds", "histogram", "Latency of the command.")
+	for _, name := range names {
+		stats := &s.commands[name].stats
+		label := commandLabel(name)
+		// Buckets are read one at a time, so the count is their sum rather than calls
+		var cumulative int64
+		for i := range latencyBucketCount {
+			cumulative += stats.latency[i].Load()
+			bound := strconv.FormatFloat(latencyBucketBound(i).Seconds(), 'g', -1, 64)
+			w.sample("redis_command_duration_seconds_bucket", label+`,le="`+bound+`"`, float64(cumulative))
+		}
+		cumulative += stats.latency[latencyBucketCount].Load()
+		w.sample("redis_command_duration_seconds_bucket", label+`,le="+Inf"`, float64(cumulative))
+		w.sample("redis_command_duration_seconds_sum", label, float64(stats.usec.Load())/1e6)
+		w.sample("redis_command_duration_seconds_count", label, float64(cumulative))
+	}
+	return w.String()
+}
+
+// commandLabel is the label identifying a command. Command names are printable
+// ASCII, for which Go quoting matches the escaping of label values.
+func commandLabel(name string) string {
+	return "cmd=" + strconv.Quote(strings.ToLower(name))
+}
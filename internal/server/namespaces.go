@@ -0,0 +1,217 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+// namespaceSkipLimit bounds the keys without an expiry a volatile policy looks past
+// per eviction in a namespace
+const namespaceSkipLimit = 1024
+
+// MemoryNamespace is a key prefix with a memory budget of its own, configured by
+// maxmemory-namespaces
+type MemoryNamespace struct {
+	Prefix    string
+	MaxMemory int64
+}
+
+// formatNamespaces renders namespaces as maxmemory-namespaces takes them
+func formatNamespaces(namespaces []MemoryNamespace) string {
+	parts := make([]string, 0, len(namespaces)*2)
+	for _, ns := range namespaces {
+		parts = append(parts, ns.Prefix, strconv.FormatInt(ns.MaxMemory, 10))
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseNamespaces parses "<prefix> <maxmemory>" pairs; an empty value configures
+// no namespace
+func parseNamespaces(value string) ([]MemoryNamespace, error) {
+	fields := strings.Fields(value)
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("wrong number of arguments")
+	}
+
+	var namespaces []MemoryNamespace
+	for i := 0; i < len(fields); i += 2 {
+		prefix := fields[i]
+		if slices.ContainsFunc(namespaces, func(ns MemoryNamespace) bool { return ns.Prefix == prefix }) {
+			return nil, fmt.Errorf("duplicate namespace '%s'", prefix)
+		}
+		bytes, err := parseMemory(fields[i+1])
+		if err != nil {
+			return nil, err
+		}
+		if bytes < 1 {
+			return nil, fmt.Errorf("maxmemory of namespace '%s' must be at least 1 byte", prefix)
+		}
+		namespaces = append(namespaces, MemoryNamespace{Prefix: prefix, MaxMemory: bytes})
+	}
+	return namespaces, nil
+}
+
+// memoryNamespace accounts for the keys under a configured prefix, and keeps their
+// names to sample eviction candidates from
+type memoryNamespace struct {
+	MemoryNamespace
+	usedMemory  int64
+	evictedKeys int64
+	keys        map[string]struct{}
+}
+
+// namespaceOf returns the namespace of the longest prefix of key, nil when key is
+// in none.
+// Must be called with the server mutex held.
+func (s *RedisServer) namespaceOf(key string) *memoryNamespace {
+	var longest *memoryNamespace
+	for _, ns := range s.namespaces {
+		if strings.HasPrefix(key, ns.Prefix) && (longest == nil || len(ns.Prefix) > len(longest.Prefix)) {
+			longest = ns
+		}
+	}
+	return longest
+}
+
+// accountNamespace adds a key of size bytes to its namespace, or removes it for a
+// negative size.
+// Must be called with the server mutex held for writing.
+func (s *RedisServer) accountNamespace(key string, size int64) {
+	if len(s.namespaces) == 0 {
+		return
+	}
+	ns := s.namespaceOf(key)
+	if ns == nil {
+		return
+	}
+	ns.usedMemory += size
+	if size > 0 {
+		ns.keys[key] = struct{}{}
+	} else {
+		delete(ns.keys, key)
+	}
+}
+
+// syncNamespaces applies maxmemory-namespaces. Changing only the budgets keeps the
+// accounting, changing the prefixes recomputes it over the whole keyspace.
+// Must be called with the server mutex held for writing.
+func (s *RedisServer) syncNamespaces() {
+	configured := s.config.MaxMemoryNamespaces
+	if len(configured) == len(s.namespaces) {
+		same := true
+		byPrefix := make(map[string]int64, len(configured))
+		for _, ns := range configured {
+			byPrefix[ns.Prefix] = ns.MaxMemory
+		}
+		for _, ns := range s.namespaces {
+			if _, exists := byPrefix[ns.Prefix]; !exists {
+				same = false
+				break
+			}
+		}
+		if same {
+			for _, ns := range s.namespaces {
+				ns.MaxMemory = byPrefix[ns.Prefix]
+			}
+			return
+		}
+	}
+	s.rebuildNamespaces()
+}
+
+// rebuildNamespaces recomputes the namespaces from the configuration and the keys
+// stored.
+// Must be called with the server mutex held for writing.
+func (s *RedisServer) rebuildNamespaces() {
+	s.namespaces = nil
+	for _, ns := range s.config.MaxMemoryNamespaces {
+		s.namespaces = append(s.namespaces, &memoryNamespace{MemoryNamespace: ns, keys: make(map[string]struct{})})
+	}
+	if len(s.namespaces) == 0 {
+		return
+	}
+	s.data.Iterate(func(key string, kv *store.KeyValue) bool {
+		s.accountNamespace(key, entrySize(key, kv))
+		return true
+	})
+}
+
+// resetNamespaces empties the namespaces along with the keyspace.
+// Must be called with the server mutex held for writing.
+func (s *RedisServer) resetNamespaces() {
+	for _, ns := range s.namespaces {
+		ns.usedMemory = 0
+		ns.keys = make(map[string]struct{})
+	}
+}
+
+// evictNamespaces frees memory in the namespaces of the given keys that are over
+// their budget, according to maxmemory-policy. It returns an OOM error when the
+// command should be refused instead.
+// Must be called with the server mutex held for writing.
+func (s *RedisServer) evictNamespaces(keys []string) error {
+	if len(s.namespaces) == 0 {
+		return nil
+	}
+	for _, key := range keys {
+		ns := s.namespaceOf(key)
+		if ns == nil {
+			continue
+		}
+		for ns.usedMemory > ns.MaxMemory {
+			if s.config.MaxMemoryPolicy == PolicyNoEviction {
+				return errNamespaceOOM(ns.Prefix)
+			}
+			victim, found := s.namespaceCandidate(ns)
+			if !found {
+				return errNamespaceOOM(ns.Prefix)
+			}
+			s.evictKey(victim)
+			ns.evictedKeys++
+		}
+	}
+	return nil
+}
+
+// errNamespaceOOM is returned for write commands that cannot be served within the
+// budget of a namespace
+func errNamespaceOOM(prefix string) error {
+	return fmt.Errorf("OOM command not allowed when used memory of namespace '%s' > its maxmemory.", prefix)
+}
+
+// namespaceCandidate samples the keys of a namespace as evictionCandidate does the
+// keyspace
+func (s *RedisServer) namespaceCandidate(ns *memoryNamespace) (string, bool) {
+	volatile := isVolatilePolicy(s.config.MaxMemoryPolicy)
+	return s.bestCandidate(func(fn func(key string, kv *store.KeyValue) bool) {
+		// Map iteration starts at a random key, and keys without an expiry are
+		// skipped for volatile policies, a bounded number of them
+		skipped := 0
+		for key := range ns.keys {
+			kv, exists := s.data.Get(key)
+			if !exists || (volatile && kv.ExpiresAt == 0) {
+				if skipped++; skipped > namespaceSkipLimit {
+					return
+				}
+				continue
+			}
+			if !fn(key, kv) {
+				return
+			}
+		}
+	})
+}
+
+// namespacesInfo renders the namespaces for INFO memory
+func namespacesInfo(s *RedisServer) []string {
+	lines := make([]string, 0, len(s.namespaces))
+	for i, ns := range s.namespaces {
+		lines = append(lines, fmt.Sprintf("namespace%d:prefix=%s,used_memory=%d,maxmemory=%d,evicted_keys=%d",
+			i, ns.Prefix, ns.usedMemory, ns.MaxMemory, ns.evictedKeys))
+	}
+	return lines
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Keyspace notification classes selected by notify-keyspace-events
+const (
+	NotifyKeyspace = 1 << iota // K: publish to __keyspace@<db>__:<key>
+	NotifyKeyevent             // E: publish to __keyevent@<db>__:<event>
+	NotifyGeneric              // g: generic commands (DEL, EXPIRE, ...)
+	NotifyString               // $: string commands
+	NotifyExpired              // x: key expired
+	NotifyEvicted              // e: key evicted for maxmemory
+
+	// NotifyAll is the class set selected by the 'A' alias
+	NotifyAll = NotifyGeneric | NotifyString | NotifyExpired | NotifyEvicted
+)
+
+// notifyFlagChars maps notify-keyspace-events characters to classes, in canonical output order
+var notifyFlagChars = []struct {
+	char  byte
+	class int
+}{
+	{'g', NotifyGeneric},
+	{'$', NotifyString},
+	{'x', NotifyExpired},
+	{'e', NotifyEvicted},
+	{'K', NotifyKeyspace},
+	{'E', NotifyKeyevent},
+}
+
+// parseNotifyFlags converts a notify-keyspace-events string such as "Ex" into class flags
+func parseNotifyFlags(value string) (int, error) {
+	flags := 0
+	for i := 0; i < len(value); i++ {
+		if value[i] == 'A' {
+			flags |= NotifyAll
+			continue
+		}
+		known := false
+		for _, flag := range notifyFlagChars {
+			if flag.char == value[i] {
+				flags |= flag.class
+				known = true
+				break
+			}
+		}
+		if !known {
+			return 0, fmt.Errorf("Invalid event class character. Use 'Ag$lshzxeKEtmdn'.")
+		}
+	}
+	return flags, nil
+}
+
+// formatNotifyFlags converts class flags back into their notify-keyspace-events string
+func formatNotifyFlags(flags int) string {
+	var builder strings.Builder
+	if flags&NotifyAll == NotifyAll {
+		builder.WriteByte('A')
+	}
+	for _, flag := range notifyFlagChars {
+		if flag.class&NotifyAll != 0 && flags&NotifyAll == NotifyAll {
+			continue
+		}
+		if flags&flag.class != 0 {
+			builder.WriteByte(flag.char)
+		}
+	}
+	return builder.String()
+}
+
+// notifyKeyspaceEvent publishes a keyspace notification if its class is enabled
+func (s *RedisServer) notifyKeyspaceEvent(class int, event, key string) {
+	flags := s.config.NotifyKeyspaceEvents
+	if flags&class == 0 {
+		return
+	}
+
+	if flags&NotifyKeyspace != 0 {
+		s.pubsub.Publish("__keyspace@0__:"+key, event)
+	}
+	if flags&NotifyKeyevent != 0 {
+		s.pubsub.Publish("__keyevent@0__:"+event, key)
+	}
+}
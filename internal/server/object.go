@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// ObjectHandler handles OBJECT subcommands
+type ObjectHandler struct {
+	server *RedisServer
+}
+
+func (h *ObjectHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if len(args) < 2 {
+		return writer.WriteError("wrong number of arguments for 'object' command")
+	}
+
+	subcommand := strings.ToUpper(args[1])
+	if subcommand == "HELP" {
+		return writer.WriteBulkStringArray([]string{
+			"OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"ENCODING <key>",
+			"    Return the kind of internal representation used in order to store the value",
+			"    associated with a <key>.",
+			"FREQ <key>",
+			"    Return the access frequency index of the key <key>.",
+			"IDLETIME <key>",
+			"    Return the idle time of the key <key>.",
+			"HELP",
+			"    Print this help.",
+		})
+	}
+
+	if len(args) != 3 {
+		return writer.WriteError(fmt.Sprintf("wrong number of arguments for 'object|%s' command", strings.ToLower(args[1])))
+	}
+	key := args[2]
+
+	h.server.mutex.Lock()
+	defer h.server.mutex.Unlock()
+
+	h.server.cleanupExpired(key)
+	kv, exists := h.server.data.Get(key)
+	h.server.countLookup(exists)
+	if !exists {
+		return writer.WriteNullBulkString()
+	}
+	lfu := isLFUPolicy(h.server.config.MaxMemoryPolicy)
+
+	switch subcommand {
+	case "ENCODING":
+		return writer.WriteBulkString(objectEncoding(kv.Value))
+	case "FREQ":
+		if !lfu {
+			return writer.WriteError("An LFU maxmemory policy is not selected, access frequency not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+		}
+		return writer.WriteInteger(int(h.server.lfuDecayedFreq(kv)))
+	case "IDLETIME":
+		if lfu {
+			return writer.WriteError("An LFU maxmemory policy is selected, idle time not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+		}
+		idle := h.server.clock.Now().UnixMilli() - kv.AccessedAt
+		return writer.WriteInteger(int(idle / 1000))
+	default:
+		return writer.WriteError(fmt.Sprintf("unknown subcommand '%s'. Try OBJECT HELP.", args[1]))
+	}
+}
+
+// objectEncoding names the representation Redis would use for a value
+func objectEncoding(value store.Object) string {
+	switch value := value.(type) {
+	case *store.StringObject:
+		return stringEncoding(value.Value)
+	default:
+		return "unknown"
+	}
+}
+
+// stringEncoding names the representation Redis would use for a string value
+func stringEncoding(value string) string {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil && len(value) <= 20 {
+		return "int"
+	}
+	if len(value) <= 44 {
+		return "embstr"
+	}
+	return "raw"
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Client classes of client-output-buffer-limit
+const (
+	ClientClassNormal = iota
+	ClientClassReplica
+	ClientClassPubSub
+	clientClassCount
+)
+
+// clientClassNames are the names of the client classes, indexed by class
+var clientClassNames = [clientClassCount]string{"normal", "replica", "pubsub"}
+
+// OutputLimit bounds the reply bytes a client may have queued but not yet read. A client
+// is disconnected beyond Hard bytes, or beyond Soft bytes for SoftSeconds in a row; a
+// zero limit is disabled.
+type OutputLimit struct {
+	Hard        int64
+	Soft        int64
+	SoftSeconds int
+}
+
+// defaultOutputLimits are the client-output-buffer-limit defaults of Redis
+var defaultOutputLimits = [clientClassCount]OutputLimit{
+	ClientClassNormal:  {},
+	ClientClassReplica: {Hard: 256 * 1024 * 1024, Soft: 64 * 1024 * 1024, SoftSeconds: 60},
+	ClientClassPubSub:  {Hard: 32 * 1024 * 1024, Soft: 8 * 1024 * 1024, SoftSeconds: 60},
+}
+
+// formatOutputLimits renders the limits as the client-output-buffer-limit value
+func formatOutputLimits(limits [clientClassCount]OutputLimit) string {
+	parts := make([]string, 0, clientClassCount*4)
+	for class, limit := range limits {
+		parts = append(parts, clientClassNames[class],
+			strconv.FormatInt(limit.Hard, 10),
+			strconv.FormatInt(limit.Soft, 10),
+			strconv.Itoa(limit.SoftSeconds))
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseOutputLimits applies "<class> <hard> <soft> <soft-seconds>" groups to limits;
+// classes that aren't mentioned keep their current limits
+func parseOutputLimits(value string, limits *[clientClassCount]OutputLimit) error {
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields)%4 != 0 {
+		return fmt.Errorf("wrong number of arguments")
+	}
+
+	updated := *limits
+	for i := 0; i < len(fields); i += 4 {
+		var class int
+		switch strings.ToLower(fields[i]) {
+		case "normal":
+			class = ClientClassNormal
+		case "replica", "slave":
+			class = ClientClassReplica
+		case "pubsub":
+			class = ClientClassPubSub
+		default:
+			return fmt.Errorf("invalid client class '%s'", fields[i])
+		}
+
+		hard, err := parseMemory(fields[i+1])
+		if err != nil {
+			return err
+		}
+		soft, err := parseMemory(fields[i+2])
+		if err != nil {
+			return err
+		}
+		seconds, err := strconv.Atoi(fields[i+3])
+		if err != nil || seconds < 0 {
+			return fmt.Errorf("soft-seconds must be a non-negative integer")
+		}
+		updated[class] = OutputLimit{Hard: hard, Soft: soft, SoftSeconds: seconds}
+	}
+	*limits = updated
+	return nil
+}
+
+// outputBuffer tracks the reply bytes of a client that the socket hasn't accepted yet
+type outputBuffer struct {
+	pending atomic.Int64
+
+	// softLimitSince is the unix time in milliseconds when pending went over the soft
+	// limit, 0 while it is under it
+	softLimitSince atomic.Int64
+}
+
+// exceeds reports whether the pending bytes break limit, starting or resetting the
+// soft-limit timer as a side effect
+func (o *outputBuffer) exceeds(limit OutputLimit, now time.Time) bool {
+	pending := o.pending.Load()
+	if limit.Hard > 0 && pending > limit.Hard {
+		return true
+	}
+	if limit.Soft == 0 || pending <= limit.Soft {
+		o.softLimitSince.Store(0)
+		return false
+	}
+
+	since := o.softLimitSince.Load()
+	if since == 0 {
+		o.softLimitSince.Store(now.UnixMilli())
+		return false
+	}
+	return now.UnixMilli()-since > int64(limit.SoftSeconds)*1000
+}
+
+// outputSink is the destination of a goroutine client's write buffer. It counts the
+// bytes of a write blocked on a client that doesn't read as pending output, and the
+// bytes written in written and total.
+type outputSink struct {
+	conn           net.Conn
+	output         *outputBuffer
+	written, total *atomic.Int64
+}
+
+func (s *outputSink) Write(p []byte) (int, error) {
+	s.output.pending.Add(int64(len(p)))
+	defer s.output.pending.Add(-int64(len(p)))
+	n, err := s.conn.Write(p)
+	s.written.Add(int64(n))
+	s.total.Add(int64(n))
+	return n, err
+}
+
+// inputSource is the source of a goroutine client's read buffer, counting the bytes
+// read in read and total
+type inputSource struct {
+	conn        net.Conn
+	read, total *atomic.Int64
+}
+
+func (s *inputSource) Read(p []byte) (int, error) {
+	n, err := s.conn.Read(p)
+	s.read.Add(int64(n))
+	s.total.Add(int64(n))
+	return n, err
+}
+
+// outputLimitExceeded reports whether a client broke the output buffer limit of its
+// class. There is no replication, so clients are either pub/sub or normal.
+func (s *RedisServer) outputLimitExceeded(client *Client, now time.Time) bool {
+	class := ClientClassNormal
+	if s.pubsub.IsSubscriber(client.writer) {
+		class = ClientClassPubSub
+	}
+
+	s.mutex.RLock()
+	limit := s.config.ClientOutputBufferLimit[class]
+	s.mutex.RUnlock()
+
+	if !client.output.exceeds(limit, now) {
+		return false
+	}
+	s.outputLimitDisconnections.Add(1)
+	s.logger.Warn("Client closed for overcoming of output buffer limits",
+		"client_id", client.ID, "client_addr", client.addr, "pending", client.output.pending.Load())
+	return true
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+	"github.com/codecrafters-io/redis-starter-go/resp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// rdbState tracks snapshot persistence, protected by the server mutex
+type rdbState struct {
+	dirty            int64 // changes since the last successful save
+	lastSave         time.Time
+	bgsaveInProgress bool
+	lastBgsaveOK     bool
+	upload           uploadState
+}
+
+// rdbPath returns the configured dump file path. Must be called with the server mutex held.
+func (s *RedisServer) rdbPath() string {
+	return filepath.Join(s.config.Dir, s.config.DBFilename)
+}
+
+// rdbSave writes a point-in-time snapshot of the keyspace to the dump file
+func (s *RedisServer) rdbSave(ctx context.Context) error {
+	s.mutex.RLock()
+	dirtyAtStart := s.rdb.dirty
+	s.mutex.RUnlock()
+
+	snap, err := s.NewSnapshot()
+	if err != nil {
+		return err
+	}
+	return s.rdbSaveSnapshot(ctx, snap, dirtyAtStart)
+}
+
+// rdbSaveSnapshot writes an open snapshot to the dump file and closes it. Writes keep
+// flowing while it runs; only the batches of the snapshot iterator take the lock.
+func (s *RedisServer) rdbSaveSnapshot(ctx context.Context, snap *Snapshot, dirtyAtStart int64) (err error) {
+	defer snap.Close()
+	_, span := s.startSpan(ctx, "rdb.save")
+	defer func() { endSpan(span, err) }()
+
+	s.mutex.RLock()
+	path := s.rdbPath()
+	s.mutex.RUnlock()
+
+	tmpPath := filepath.Join(filepath.Dir(path), fmt.Sprintf("temp-%d.rdb", os.Getpid()))
+	if err := writeRDBFile(tmpPath, snap); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	s.mutex.Lock()
+	s.rdb.dirty -= dirtyAtStart
+	s.rdb.lastSave = time.Now()
+	s.mutex.Unlock()
+	return nil
+}
+
+// writeRDBFile streams every snapshot entry into a new RDB file and syncs it to disk
+func writeRDBFile(path string, snap *Snapshot) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer, err := NewRDBWriter(file)
+	if err != nil {
+		return err
+	}
+	for entry, ok := snap.Next(); ok; entry, ok = snap.Next() {
+		if err := writer.WriteEntry(entry); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// LoadRDB populates the keyspace from the dump file, if there is one
+func (s *RedisServer) LoadRDB() (int, error) {
+	s.loading.Store(true)
+	return s.loadRDBTraced(context.Background())
+}
+
+// loadRDBTraced is loadRDB in a span, ending the loading once it succeeds
+func (s *RedisServer) loadRDBTraced(ctx context.Context) (int, error) {
+	_, span := s.startSpan(ctx, "rdb.load")
+	loaded, err := s.loadRDB(ctx)
+	// Only part of the dataset is there otherwise, which mustn't be saved
+	if err == nil {
+		s.loading.Store(false)
+	}
+	span.SetAttributes(attribute.Int("redis.keys.count", loaded))
+	endSpan(span, err)
+	return loaded, err
+}
+
+// loadRDB reads the dump file in batches of keys, locking the keyspace for each
+// one only, until it is done or ctx is
+func (s *RedisServer) loadRDB(ctx context.Context) (int, error) {
+	s.mutex.RLock()
+	path := s.rdbPath()
+	// An engine that persists the keyspace itself already holds a newer dataset
+	stored := s.data.Len()
+	s.mutex.RUnlock()
+	if stored > 0 {
+		return 0, nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	s.loadProgress.start(info.Size())
+
+	reader, err := NewRDBReader(&countingReader{r: file, n: &s.loadProgress.loadedBytes})
+	if err != nil {
+		return 0, err
+	}
+
+	loaded := 0
+	now, keyspaceNow := time.Now(), s.clock.Now().UnixMilli()
+	for done := false; !done; {
+		s.mutex.Lock()
+		// Checked with the keyspace locked, so that Shutdown closing it is noticed
+		if err := ctx.Err(); err != nil {
+			s.mutex.Unlock()
+			return loaded, err
+		}
+		for i := 0; i < loadBatch; i++ {
+			entry, err := reader.Next()
+			if err == io.EOF {
+				done = true
+				break
+			}
+			if err != nil {
+				s.mutex.Unlock()
+				return loaded, err
+			}
+			if entry.ExpiresAt != 0 && entry.ExpiresAt < keyspaceNow {
+				continue
+			}
+			// A key written while loading in the background is newer
+			if _, exists := s.data.Get(entry.Key); exists {
+				continue
+			}
+			s.setKey(entry.Key, s.newEntry(store.NewString(entry.Value), entry.ExpiresAt))
+			// Loaded keys aren't changes since the save
+			s.rdb.dirty--
+			loaded++
+		}
+		if done {
+			s.rdb.lastSave = now
+		}
+		s.mutex.Unlock()
+	}
+	return loaded, nil
+}
+
+// SaveHandler handles SAVE commands
+type SaveHandler struct {
+	server *RedisServer
+}
+
+func (h *SaveHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if err := h.server.rdbSave(ctx); err != nil {
+		h.server.logger.Warn("Error saving DB", "err", err)
+		return writer.WriteError("ERR " + err.Error())
+	}
+	return writer.WriteSimpleString("OK")
+}
+
+// BgsaveHandler handles BGSAVE commands
+type BgsaveHandler struct {
+	server *RedisServer
+}
+
+func (h *BgsaveHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	s := h.server
+	s.mutex.Lock()
+	if s.rdb.bgsaveInProgress {
+		s.mutex.Unlock()
+		return writer.WriteError("ERR Background save already in progress")
+	}
+	s.rdb.bgsaveInProgress = true
+	dirtyAtStart := s.rdb.dirty
+	s.mutex.Unlock()
+
+	// The snapshot is opened before replying, so every write acknowledged
+	// after this point is excluded from the dump, just like after a fork
+	snap, err := s.NewSnapshot()
+	if err != nil {
+		s.mutex.Lock()
+		s.rdb.bgsaveInProgress = false
+		s.mutex.Unlock()
+		return writer.WriteError("ERR " + err.Error())
+	}
+
+	// The save outlives the command, but its span remains a child of the command's
+	background := trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+	go func() {
+		err := s.rdbSaveSnapshot(background, snap, dirtyAtStart)
+		if err != nil {
+			s.logger.Warn("Background saving error", "err", err)
+		}
+		s.mutex.Lock()
+		s.rdb.bgsaveInProgress = false
+		s.rdb.lastBgsaveOK = err == nil
+		s.mutex.Unlock()
+		if err == nil {
+			s.queueUpload()
+		}
+	}()
+
+	return writer.WriteSimpleString("Background saving started")
+}
+
+// LastSaveHandler handles LASTSAVE commands
+type LastSaveHandler struct {
+	server *RedisServer
+}
+
+func (h *LastSaveHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	h.server.mutex.RLock()
+	lastSave := h.server.rdb.lastSave.Unix()
+	h.server.mutex.RUnlock()
+	return writer.WriteInteger(int(lastSave))
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyHeaderTimeout bounds how long a connection may take to send its PROXY header
+const proxyHeaderTimeout = 5 * time.Second
+
+// proxyV1MaxLen is the longest valid PROXY protocol v1 header, CRLF included
+const proxyV1MaxLen = 107
+
+// proxyV2Signature opens every PROXY protocol v2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var (
+	errProxyHeaderIncomplete = errors.New("incomplete PROXY header")
+	errInvalidProxyHeader    = errors.New("invalid PROXY header")
+)
+
+// parseProxyHeader parses a PROXY protocol v1 or v2 header at the start of buf and
+// returns the client address it carries and the header length. The address is nil for
+// headers that don't carry one, such as health checks from the proxy itself.
+// errProxyHeaderIncomplete means more bytes are needed.
+func parseProxyHeader(buf []byte) (*net.TCPAddr, int, error) {
+	switch {
+	case hasPartialPrefix(buf, []byte("PROXY ")):
+		return parseProxyV1(buf)
+	case hasPartialPrefix(buf, proxyV2Signature):
+		return parseProxyV2(buf)
+	}
+	return nil, 0, errInvalidProxyHeader
+}
+
+// hasPartialPrefix reports whether buf starts with prefix, or with the start of prefix
+// when buf is shorter
+func hasPartialPrefix(buf, prefix []byte) bool {
+	n := min(len(buf), len(prefix))
+	return bytes.Equal(buf[:n], prefix[:n])
+}
+
+// parseProxyV1 parses a text header: "PROXY TCP4|TCP6|UNKNOWN src dst sport dport\r\n"
+func parseProxyV1(buf []byte) (*net.TCPAddr, int, error) {
+	end := bytes.Index(buf[:min(len(buf), proxyV1MaxLen)], []byte("\r\n"))
+	if end < 0 {
+		if len(buf) >= proxyV1MaxLen {
+			return nil, 0, errInvalidProxyHeader
+		}
+		return nil, 0, errProxyHeaderIncomplete
+	}
+
+	fields := strings.Split(string(buf[:end]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, end + 2, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, 0, errInvalidProxyHeader
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, 0, errInvalidProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, end + 2, nil
+}
+
+// parseProxyV2 parses a binary header: the signature, version and command, address
+// family, address block length and the address block itself
+func parseProxyV2(buf []byte) (*net.TCPAddr, int, error) {
+	const fixedLen = 16
+	if len(buf) < fixedLen {
+		return nil, 0, errProxyHeaderIncomplete
+	}
+	versionCommand, family := buf[12], buf[13]
+	n := fixedLen + int(binary.BigEndian.Uint16(buf[14:16]))
+	if versionCommand>>4 != 2 {
+		return nil, 0, errInvalidProxyHeader
+	}
+	if len(buf) < n {
+		return nil, 0, errProxyHeaderIncomplete
+	}
+
+	// LOCAL connections are the proxy's own, and only TCP over IPv4 or IPv6 carries a
+	// client address we can use
+	if versionCommand&0xf == 0 {
+		return nil, n, nil
+	}
+	block := buf[fixedLen:n]
+	switch {
+	case family == 0x11 && len(block) >= 12:
+		ip := net.IP(bytes.Clone(block[0:4]))
+		return &net.TCPAddr{IP: ip, Port: int(binary.BigEndian.Uint16(block[8:10]))}, n, nil
+	case family == 0x21 && len(block) >= 36:
+		ip := net.IP(bytes.Clone(block[0:16]))
+		return &net.TCPAddr{IP: ip, Port: int(binary.BigEndian.Uint16(block[32:34]))}, n, nil
+	}
+	return nil, n, nil
+}
+
+// proxyListener wraps accepted connections so they read a PROXY header first
+type proxyListener struct {
+	net.Listener
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: conn}, nil
+}
+
+// proxyConn is a connection that starts with a PROXY header. The header is read on
+// first use rather than on accept, so a slow proxy doesn't hold up the accept loop.
+type proxyConn struct {
+	net.Conn
+	once   sync.Once
+	remote net.Addr
+	rest   []byte // bytes read past the header
+	err    error
+}
+
+// readHeader reads and parses the PROXY header
+func (c *proxyConn) readHeader() {
+	c.remote = c.Conn.RemoteAddr()
+	c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	buf := make([]byte, 0, 256)
+	for {
+		n, err := c.Conn.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+
+		addr, length, parseErr := parseProxyHeader(buf)
+		if parseErr == nil {
+			if addr != nil {
+				c.remote = addr
+			}
+			c.rest = buf[length:]
+			return
+		}
+		if parseErr != errProxyHeaderIncomplete {
+			c.err = parseErr
+			return
+		}
+		if err != nil {
+			c.err = err
+			return
+		}
+		if len(buf) == cap(buf) {
+			buf = append(buf, 0)[:len(buf)]
+		}
+	}
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	if len(c.rest) > 0 {
+		n := copy(p, c.rest)
+		c.rest = c.rest[n:]
+		return n, nil
+	}
+	return c.Conn.Read(p)
+}
+
+// RemoteAddr returns the client address from the PROXY header, or the peer address
+// when the header doesn't carry one
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	return c.remote
+}
+
+// proxyListeners wraps listeners for the PROXY protocol when it is enabled
+func proxyListeners(config *Config, listeners []net.Listener) []net.Listener {
+	if !config.ProxyProtocol {
+		return listeners
+	}
+	wrapped := make([]net.Listener, len(listeners))
+	for i, listener := range listeners {
+		wrapped[i] = &proxyListener{Listener: listener}
+	}
+	return wrapped
+}
@@ -0,0 +1,390 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/glob"
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// PubSub tracks channel and pattern subscriptions and delivers published messages
+type PubSub struct {
+	mutex       sync.RWMutex
+	channels    map[string]map[*resp.Writer]struct{}
+	patterns    map[string]map[*resp.Writer]struct{}
+	subscribers map[*resp.Writer]*subscriber
+
+	// subscriberCount mirrors len(subscribers), so that commands can skip the
+	// subscribed-mode check without taking the mutex while nobody is subscribed
+	subscriberCount atomic.Int64
+}
+
+// subscriber holds the subscriptions of a single client
+type subscriber struct {
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+// count returns the total number of channels and patterns the client is subscribed to
+func (sub *subscriber) count() int {
+	return len(sub.channels) + len(sub.patterns)
+}
+
+// NewPubSub creates an empty pub/sub registry
+func NewPubSub() *PubSub {
+	return &PubSub{
+		channels:    make(map[string]map[*resp.Writer]struct{}),
+		patterns:    make(map[string]map[*resp.Writer]struct{}),
+		subscribers: make(map[*resp.Writer]*subscriber),
+	}
+}
+
+// subscriberFor returns the subscription state of a client, creating it if needed.
+// Must be called with the pubsub mutex held for writing.
+func (ps *PubSub) subscriberFor(w *resp.Writer) *subscriber {
+	sub, exists := ps.subscribers[w]
+	if !exists {
+		sub = &subscriber{
+			channels: make(map[string]struct{}),
+			patterns: make(map[string]struct{}),
+		}
+		ps.subscribers[w] = sub
+		ps.subscriberCount.Add(1)
+	}
+	return sub
+}
+
+// Subscribe adds a channel subscription and returns the client's subscription count
+func (ps *PubSub) Subscribe(w *resp.Writer, channel string) int {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	sub := ps.subscriberFor(w)
+	sub.channels[channel] = struct{}{}
+	if ps.channels[channel] == nil {
+		ps.channels[channel] = make(map[*resp.Writer]struct{})
+	}
+	ps.channels[channel][w] = struct{}{}
+	return sub.count()
+}
+
+// PSubscribe adds a pattern subscription and returns the client's subscription count
+func (ps *PubSub) PSubscribe(w *resp.Writer, pattern string) int {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	sub := ps.subscriberFor(w)
+	sub.patterns[pattern] = struct{}{}
+	if ps.patterns[pattern] == nil {
+		ps.patterns[pattern] = make(map[*resp.Writer]struct{})
+	}
+	ps.patterns[pattern][w] = struct{}{}
+	return sub.count()
+}
+
+// Unsubscribe removes a channel subscription and returns the client's subscription count
+func (ps *PubSub) Unsubscribe(w *resp.Writer, channel string) int {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	sub := ps.subscriberFor(w)
+	delete(sub.channels, channel)
+	if clients, exists := ps.channels[channel]; exists {
+		delete(clients, w)
+		if len(clients) == 0 {
+			delete(ps.channels, channel)
+		}
+	}
+	return ps.releaseIfIdle(w, sub)
+}
+
+// PUnsubscribe removes a pattern subscription and returns the client's subscription count
+func (ps *PubSub) PUnsubscribe(w *resp.Writer, pattern string) int {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	sub := ps.subscriberFor(w)
+	delete(sub.patterns, pattern)
+	if clients, exists := ps.patterns[pattern]; exists {
+		delete(clients, w)
+		if len(clients) == 0 {
+			delete(ps.patterns, pattern)
+		}
+	}
+	return ps.releaseIfIdle(w, sub)
+}
+
+// releaseIfIdle forgets a client without subscriptions and returns its subscription count.
+// Must be called with the pubsub mutex held for writing.
+func (ps *PubSub) releaseIfIdle(w *resp.Writer, sub *subscriber) int {
+	count := sub.count()
+	if count == 0 {
+		delete(ps.subscribers, w)
+		ps.subscriberCount.Add(-1)
+	}
+	return count
+}
+
+// Channels returns the channels a client is subscribed to
+func (ps *PubSub) Channels(w *resp.Writer) []string {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	var channels []string
+	if sub, exists := ps.subscribers[w]; exists {
+		for channel := range sub.channels {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// Patterns returns the patterns a client is subscribed to
+func (ps *PubSub) Patterns(w *resp.Writer) []string {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	var patterns []string
+	if sub, exists := ps.subscribers[w]; exists {
+		for pattern := range sub.patterns {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// IsSubscriber reports whether a client has any channel or pattern subscription
+func (ps *PubSub) IsSubscriber(w *resp.Writer) bool {
+	if ps.subscriberCount.Load() == 0 {
+		return false
+	}
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	_, exists := ps.subscribers[w]
+	return exists
+}
+
+// Subscriptions returns the number of channels and patterns a client is subscribed to
+func (ps *PubSub) Subscriptions(w *resp.Writer) (channels, patterns int) {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	if sub, exists := ps.subscribers[w]; exists {
+		return len(sub.channels), len(sub.patterns)
+	}
+	return 0, 0
+}
+
+// SubscriberCount returns the number of clients with a subscription
+func (ps *PubSub) SubscriberCount() int {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return len(ps.subscribers)
+}
+
+// RemoveSubscriber drops every subscription of a disconnecting client
+func (ps *PubSub) RemoveSubscriber(w *resp.Writer) {
+	for _, channel := range ps.Channels(w) {
+		ps.Unsubscribe(w, channel)
+	}
+	for _, pattern := range ps.Patterns(w) {
+		ps.PUnsubscribe(w, pattern)
+	}
+}
+
+// Publish delivers a message to every matching subscriber and returns the number of receivers
+func (ps *PubSub) Publish(channel, message string) int {
+	type delivery struct {
+		writer *resp.Writer
+		frame  []byte
+	}
+	var deliveries []delivery
+
+	ps.mutex.RLock()
+	if clients, exists := ps.channels[channel]; exists {
+		frames := newPubSubFrames("message", channel, message)
+		for w := range clients {
+			deliveries = append(deliveries, delivery{w, frames.For(w)})
+		}
+	}
+	for pattern, clients := range ps.patterns {
+		if !glob.Match(pattern, channel) {
+			continue
+		}
+		frames := newPubSubFrames("pmessage", pattern, channel, message)
+		for w := range clients {
+			deliveries = append(deliveries, delivery{w, frames.For(w)})
+		}
+	}
+	ps.mutex.RUnlock()
+
+	// Subscribers may be idle in a blocking read, so deliveries are flushed right away
+	for _, d := range deliveries {
+		if d.writer.WritePush(d.frame) == nil {
+			d.writer.Flush()
+		}
+	}
+	return len(deliveries)
+}
+
+// pubSubFrames encodes a pub/sub message once per protocol, on first use, so RESP2
+// and RESP3 subscribers can share the encoding with their peers
+type pubSubFrames struct {
+	parts       []interface{}
+	array, push []byte
+}
+
+// newPubSubFrames prepares the frames of a message made of parts
+func newPubSubFrames(parts ...interface{}) *pubSubFrames {
+	return &pubSubFrames{parts: parts}
+}
+
+// For returns the frame to send to the client writing to w
+func (f *pubSubFrames) For(w *resp.Writer) []byte {
+	if w.Protocol() == resp.RESP3 {
+		if f.push == nil {
+			f.push = encodePubSubFrame(resp.Push, f.parts...)
+		}
+		return f.push
+	}
+	if f.array == nil {
+		f.array = encodePubSubFrame(resp.Array, f.parts...)
+	}
+	return f.array
+}
+
+// pubSubFrameType returns how pub/sub frames are sent to the client writing to w:
+// as pushes on RESP3, so they can interleave with command replies, as arrays on RESP2
+func pubSubFrameType(w *resp.Writer) resp.Type {
+	if w.Protocol() == resp.RESP3 {
+		return resp.Push
+	}
+	return resp.Array
+}
+
+// encodePubSubFrame encodes a pub/sub frame of the given aggregate type. Strings
+// become bulk strings, ints become integers and nil becomes a null.
+func encodePubSubFrame(frameType resp.Type, parts ...interface{}) []byte {
+	var builder strings.Builder
+	builder.WriteString(string(frameType) + strconv.Itoa(len(parts)) + "\r\n")
+	for _, part := range parts {
+		switch v := part.(type) {
+		case string:
+			builder.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+		case int:
+			builder.WriteString(":" + strconv.Itoa(v) + "\r\n")
+		case nil:
+			if frameType == resp.Push {
+				builder.WriteString("_\r\n")
+			} else {
+				builder.WriteString("$-1\r\n")
+			}
+		}
+	}
+	return []byte(builder.String())
+}
+
+// subscribedModeCommands are the only commands a RESP2 client may send while it has
+// subscriptions, as its connection then carries messages rather than replies
+var subscribedModeCommands = map[string]bool{
+	"SUBSCRIBE":    true,
+	"PSUBSCRIBE":   true,
+	"UNSUBSCRIBE":  true,
+	"PUNSUBSCRIBE": true,
+	"PING":         true,
+	"QUIT":         true,
+	"RESET":        true,
+}
+
+// inSubscribedMode reports whether the client writing to writer is a RESP2 client
+// with subscriptions. RESP3 clients receive messages as pushes, so they may run any
+// command.
+func (s *RedisServer) inSubscribedMode(writer *resp.Writer) bool {
+	return writer.Protocol() == resp.RESP2 && s.pubsub.IsSubscriber(writer)
+}
+
+// SubscribeHandler handles SUBSCRIBE and PSUBSCRIBE commands
+type SubscribeHandler struct {
+	server  *RedisServer
+	pattern bool
+}
+
+func (h *SubscribeHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	kind := "subscribe"
+	if h.pattern {
+		kind = "psubscribe"
+	}
+	if len(args) < 2 {
+		return writer.WriteError(fmt.Sprintf("wrong number of arguments for '%s' command", kind))
+	}
+
+	for _, target := range args[1:] {
+		var count int
+		if h.pattern {
+			count = h.server.pubsub.PSubscribe(writer, target)
+		} else {
+			count = h.server.pubsub.Subscribe(writer, target)
+		}
+		if err := writer.WriteRaw(encodePubSubFrame(pubSubFrameType(writer), kind, target, count)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnsubscribeHandler handles UNSUBSCRIBE and PUNSUBSCRIBE commands
+type UnsubscribeHandler struct {
+	server  *RedisServer
+	pattern bool
+}
+
+func (h *UnsubscribeHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	kind := "unsubscribe"
+	targets := args[1:]
+	if h.pattern {
+		kind = "punsubscribe"
+	}
+
+	// Without arguments, drop every subscription of this kind
+	if len(targets) == 0 {
+		if h.pattern {
+			targets = h.server.pubsub.Patterns(writer)
+		} else {
+			targets = h.server.pubsub.Channels(writer)
+		}
+		if len(targets) == 0 {
+			count := len(h.server.pubsub.Channels(writer)) + len(h.server.pubsub.Patterns(writer))
+			return writer.WriteRaw(encodePubSubFrame(pubSubFrameType(writer), kind, nil, count))
+		}
+	}
+
+	for _, target := range targets {
+		var count int
+		if h.pattern {
+			count = h.server.pubsub.PUnsubscribe(writer, target)
+		} else {
+			count = h.server.pubsub.Unsubscribe(writer, target)
+		}
+		if err := writer.WriteRaw(encodePubSubFrame(pubSubFrameType(writer), kind, target, count)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PublishHandler handles PUBLISH commands
+type PublishHandler struct {
+	server *RedisServer
+}
+
+func (h *PublishHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if len(args) != 3 {
+		return writer.WriteError("wrong number of arguments for 'publish' command")
+	}
+	receivers := h.server.pubsub.Publish(args[1], args[2])
+	return writer.WriteInteger(receivers)
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// errRateLimited is the reply to a command rejected over the rate limits
+const errRateLimited = "ERR rate limit exceeded"
+
+// rateSweepInterval is how often the budgets of the source IPs that went quiet are
+// dropped
+const rateSweepInterval = 10 * time.Second
+
+// rateLimiter enforces the rate-limit-* directives on the commands of network
+// clients. Every client and source IP has a budget of commands and of command bytes
+// per second, which bursts up to a second's worth.
+type rateLimiter struct {
+	// The limits mirror the configuration, so that the fast path needn't take the
+	// server mutex
+	clientCommands, clientBytes atomic.Int64
+	ipCommands, ipBytes         atomic.Int64
+	throttle                    atomic.Bool
+
+	// limited counts the commands rejected or held back
+	limited atomic.Int64
+
+	mutex     sync.Mutex
+	ips       map[string]*rateBudget
+	lastSweep time.Time
+}
+
+// rateBudget holds the token buckets of a client or source IP
+type rateBudget struct {
+	commands, bytes rateBucket
+}
+
+// rateBucket is a token bucket refilled at a rate per second, holding at most a
+// second's worth of tokens
+type rateBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// refill adds the tokens earned since the last refill; a new bucket starts full
+func (b *rateBucket) refill(rate int64, now time.Time) {
+	if b.updated.IsZero() {
+		b.tokens = float64(rate)
+	} else {
+		b.tokens = min(float64(rate), b.tokens+now.Sub(b.updated).Seconds()*float64(rate))
+	}
+	b.updated = now
+}
+
+// wait returns how long until the bucket holds cost tokens, or a second's worth for
+// a larger cost, 0 if it already does. Large costs overdraw the bucket, which holds
+// the following ones back instead.
+func (b *rateBucket) wait(cost float64, rate int64) time.Duration {
+	need := min(cost, float64(rate))
+	if b.tokens >= need {
+		return 0
+	}
+	return max(time.Duration((need-b.tokens)/float64(rate)*float64(time.Second)), time.Millisecond)
+}
+
+// full reports whether the bucket would be full by now, as a new one would
+func (b *rateBucket) full(rate int64, now time.Time) bool {
+	return rate == 0 || b.tokens+now.Sub(b.updated).Seconds()*float64(rate) >= float64(rate)
+}
+
+// check returns how long a command of cost bytes must wait for the budget, 0 if it
+// is within it. A zero rate is unlimited.
+func (b *rateBudget) check(cost float64, commandRate, byteRate int64, now time.Time) time.Duration {
+	var wait time.Duration
+	if commandRate > 0 {
+		b.commands.refill(commandRate, now)
+		wait = b.commands.wait(1, commandRate)
+	}
+	if byteRate > 0 {
+		b.bytes.refill(byteRate, now)
+		wait = max(wait, b.bytes.wait(cost, byteRate))
+	}
+	return wait
+}
+
+// charge takes a command of cost bytes off the budget
+func (b *rateBudget) charge(cost float64, commandRate, byteRate int64) {
+	if commandRate > 0 {
+		b.commands.tokens--
+	}
+	if byteRate > 0 {
+		b.bytes.tokens -= cost
+	}
+}
+
+// syncRateLimits applies the rate-limit-* directives.
+// Must be called with the server mutex held.
+func (s *RedisServer) syncRateLimits() {
+	s.rateLimits.clientCommands.Store(s.config.RateLimitClientCommands)
+	s.rateLimits.clientBytes.Store(s.config.RateLimitClientBytes)
+	s.rateLimits.ipCommands.Store(s.config.RateLimitIPCommands)
+	s.rateLimits.ipBytes.Store(s.config.RateLimitIPBytes)
+	s.rateLimits.throttle.Store(s.config.RateLimitAction == RateLimitThrottle)
+}
+
+// rateLimit charges a command to the budgets of its client and of the client's
+// source IP. When either is exhausted the command isn't charged, and rateLimit
+// returns how long it must wait to be within the limits.
+func (s *RedisServer) rateLimit(client *Client, args []string) time.Duration {
+	rl := &s.rateLimits
+	clientCommands, clientBytes := rl.clientCommands.Load(), rl.clientBytes.Load()
+	ipCommands, ipBytes := rl.ipCommands.Load(), rl.ipBytes.Load()
+	if clientCommands == 0 && clientBytes == 0 && ipCommands == 0 && ipBytes == 0 {
+		return 0
+	}
+	var cost float64
+	for _, arg := range args {
+		cost += float64(len(arg))
+	}
+	now := time.Now()
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	wait := client.rate.check(cost, clientCommands, clientBytes, now)
+	var ip *rateBudget
+	if ipCommands > 0 || ipBytes > 0 {
+		ip = rl.ipBudget(clientIP(client.addr), ipCommands, ipBytes, now)
+		wait = max(wait, ip.check(cost, ipCommands, ipBytes, now))
+	}
+	if wait > 0 {
+		return wait
+	}
+	client.rate.charge(cost, clientCommands, clientBytes)
+	if ip != nil {
+		ip.charge(cost, ipCommands, ipBytes)
+	}
+	return 0
+}
+
+// ipBudget returns the budget of a source IP, dropping meanwhile those that would
+// be full by now, as they'd start afresh anyway.
+// Must be called with the rate limiter mutex held.
+func (rl *rateLimiter) ipBudget(ip string, commandRate, byteRate int64, now time.Time) *rateBudget {
+	if now.Sub(rl.lastSweep) >= rateSweepInterval {
+		for addr, budget := range rl.ips {
+			if budget.commands.full(commandRate, now) && budget.bytes.full(byteRate, now) {
+				delete(rl.ips, addr)
+			}
+		}
+		rl.lastSweep = now
+	}
+	budget, exists := rl.ips[ip]
+	if !exists {
+		if rl.ips == nil {
+			rl.ips = make(map[string]*rateBudget)
+		}
+		budget = &rateBudget{}
+		rl.ips[ip] = budget
+	}
+	return budget
+}
+
+// clientIP returns the host part of a client address, the whole address when it
+// has no port
+func clientIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// rejectRateLimited replies to a command rejected over the rate limits
+func (s *RedisServer) rejectRateLimited(writer *resp.Writer) {
+	s.rateLimits.limited.Add(1)
+	s.errorStats.record(errRateLimited, 1)
+	writer.WriteError(errRateLimited)
+}
+
+// admit applies the rate limits to a command of a client served by its own
+// goroutine. Over the limits, the command is either rejected or, when throttling,
+// held back until the budgets allow it. It reports whether the command may run.
+func (s *RedisServer) admit(client *Client, args []string, writer *resp.Writer) bool {
+	wait := s.rateLimit(client, args)
+	if wait == 0 {
+		return true
+	}
+	if !s.rateLimits.throttle.Load() {
+		s.rejectRateLimited(writer)
+		return false
+	}
+
+	s.rateLimits.limited.Add(1)
+	// The replies to the commands within the limits aren't held back with it
+	if writer.Flush() != nil {
+		return false
+	}
+	for wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-client.Context().Done():
+			timer.Stop()
+			return false
+		}
+		wait = s.rateLimit(client, args)
+	}
+	return true
+}
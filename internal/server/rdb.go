@@ -0,0 +1,437 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// RDB format constants (https://rdb.fnordig.de/file_format.html). Only string
+// values are supported; the file is readable by real Redis and its tooling.
+const (
+	rdbVersion = 11
+
+	rdbTypeString = 0
+
+	rdbOpcodeIdle         = 0xF8
+	rdbOpcodeFreq         = 0xF9
+	rdbOpcodeAux          = 0xFA
+	rdbOpcodeResizeDB     = 0xFB
+	rdbOpcodeExpireTimeMs = 0xFC
+	rdbOpcodeExpireTime   = 0xFD
+	rdbOpcodeSelectDB     = 0xFE
+	rdbOpcodeEOF          = 0xFF
+
+	rdbEncInt8  = 0
+	rdbEncInt16 = 1
+	rdbEncInt32 = 2
+	rdbEncLZF   = 3
+
+	// lzfMaxRatio bounds how much LZF expands its input: a 3-byte back reference
+	// copies at most 264 bytes
+	lzfMaxRatio = 88
+)
+
+// crc64Table implements CRC-64/Jones as used by Redis for the RDB checksum
+var crc64Table = func() [256]uint64 {
+	const poly = 0x95ac9329ac4bc9b5
+	var table [256]uint64
+	for i := range table {
+		crc := uint64(i)
+		for j := 0; j < 8; j++ {
+			if crc&1 == 1 {
+				crc = crc>>1 ^ poly
+			} else {
+				crc >>= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// crc64Update extends a Redis CRC-64 checksum with p
+func crc64Update(crc uint64, p []byte) uint64 {
+	for _, b := range p {
+		crc = crc64Table[byte(crc)^b] ^ crc>>8
+	}
+	return crc
+}
+
+// checksumWriter forwards writes while maintaining the RDB checksum
+type checksumWriter struct {
+	w   io.Writer
+	crc uint64
+}
+
+func (c *checksumWriter) Write(p []byte) (int, error) {
+	c.crc = crc64Update(c.crc, p)
+	return c.w.Write(p)
+}
+
+// RDBWriter encodes keys into the RDB file format
+type RDBWriter struct {
+	out *checksumWriter
+	buf *bufio.Writer
+}
+
+// NewRDBWriter starts an RDB stream on w and writes the header
+func NewRDBWriter(w io.Writer) (*RDBWriter, error) {
+	buf := bufio.NewWriter(w)
+	out := &checksumWriter{w: buf}
+	rw := &RDBWriter{out: out, buf: buf}
+
+	if _, err := fmt.Fprintf(out, "REDIS%04d", rdbVersion); err != nil {
+		return nil, err
+	}
+	rw.writeAux("redis-ver", "7.2.0")
+	rw.writeAux("redis-bits", strconv.Itoa(strconv.IntSize))
+	rw.writeAux("ctime", strconv.FormatInt(time.Now().Unix(), 10))
+	rw.out.Write([]byte{rdbOpcodeSelectDB})
+	rw.writeLength(0)
+	return rw, nil
+}
+
+// writeAux writes an auxiliary metadata field
+func (rw *RDBWriter) writeAux(key, value string) {
+	rw.out.Write([]byte{rdbOpcodeAux})
+	rw.writeString(key)
+	rw.writeString(value)
+}
+
+// writeLength writes an RDB length-encoded integer
+func (rw *RDBWriter) writeLength(n uint64) {
+	switch {
+	case n < 1<<6:
+		rw.out.Write([]byte{byte(n)})
+	case n < 1<<14:
+		rw.out.Write([]byte{0x40 | byte(n>>8), byte(n)})
+	case n <= 0xFFFFFFFF:
+		var b [5]byte
+		b[0] = 0x80
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		rw.out.Write(b[:])
+	default:
+		var b [9]byte
+		b[0] = 0x81
+		binary.BigEndian.PutUint64(b[1:], n)
+		rw.out.Write(b[:])
+	}
+}
+
+// writeString writes a length-prefixed string
+func (rw *RDBWriter) writeString(s string) {
+	rw.writeLength(uint64(len(s)))
+	io.WriteString(rw.out, s)
+}
+
+// WriteEntry appends a key to the stream
+func (rw *RDBWriter) WriteEntry(entry SnapshotEntry) error {
+	if entry.ExpiresAt != 0 {
+		var b [9]byte
+		b[0] = rdbOpcodeExpireTimeMs
+		binary.LittleEndian.PutUint64(b[1:], uint64(entry.ExpiresAt))
+		rw.out.Write(b[:])
+	}
+	rw.out.Write([]byte{rdbTypeString})
+	rw.writeString(entry.Key)
+	rw.writeString(entry.Value)
+	return nil
+}
+
+// Close writes the EOF marker and checksum and flushes the stream
+func (rw *RDBWriter) Close() error {
+	rw.out.Write([]byte{rdbOpcodeEOF})
+	var sum [8]byte
+	binary.LittleEndian.PutUint64(sum[:], rw.out.crc)
+	if _, err := rw.buf.Write(sum[:]); err != nil {
+		return err
+	}
+	return rw.buf.Flush()
+}
+
+// RDBReader decodes an RDB stream
+type RDBReader struct {
+	in       *bufio.Reader
+	crc      uint64
+	offset   int64 // bytes read so far
+	encoding string
+	// maxString bounds the strings read, 0 for no bound, so that a corrupted length
+	// fails rather than allocating it
+	maxString uint64
+	Version   int
+	// Aux holds the auxiliary fields seen so far
+	Aux map[string]string
+
+	// DB, ValueEncoding and EntrySize describe the key last returned by Next: its
+	// database, how its value was stored ("raw", "int" or "lzf") and the size of its
+	// record in the file, expiry included
+	DB            int
+	ValueEncoding string
+	EntrySize     int64
+}
+
+// NewRDBReader reads and validates the RDB header
+func NewRDBReader(r io.Reader) (*RDBReader, error) {
+	rr := &RDBReader{in: bufio.NewReader(r), Aux: make(map[string]string)}
+
+	header := make([]byte, 9)
+	if err := rr.readFull(header); err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	if string(header[:5]) != "REDIS" {
+		return nil, errors.New("wrong signature, not an RDB file")
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid RDB version %q", header[5:])
+	}
+	rr.Version = version
+	return rr, nil
+}
+
+// Offset returns the number of bytes decoded so far, the checksum included once Next
+// has returned io.EOF, for files where the RDB data is followed by more
+func (rr *RDBReader) Offset() int64 {
+	return rr.offset
+}
+
+// readFull reads exactly len(p) bytes and adds them to the checksum
+func (rr *RDBReader) readFull(p []byte) error {
+	if _, err := io.ReadFull(rr.in, p); err != nil {
+		return err
+	}
+	rr.crc = crc64Update(rr.crc, p)
+	rr.offset += int64(len(p))
+	return nil
+}
+
+// readByte reads a single byte and adds it to the checksum
+func (rr *RDBReader) readByte() (byte, error) {
+	var b [1]byte
+	err := rr.readFull(b[:])
+	return b[0], err
+}
+
+// readLength reads a length-encoded integer. encoded reports a special string encoding.
+func (rr *RDBReader) readLength() (n uint64, encoded bool, err error) {
+	first, err := rr.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch first >> 6 {
+	case 0:
+		return uint64(first & 0x3F), false, nil
+	case 1:
+		next, err := rr.readByte()
+		return uint64(first&0x3F)<<8 | uint64(next), false, err
+	case 2:
+		switch first {
+		case 0x80:
+			var b [4]byte
+			err := rr.readFull(b[:])
+			return uint64(binary.BigEndian.Uint32(b[:])), false, err
+		case 0x81:
+			var b [8]byte
+			err := rr.readFull(b[:])
+			return binary.BigEndian.Uint64(b[:]), false, err
+		}
+		return 0, false, fmt.Errorf("unknown length encoding 0x%02x", first)
+	default:
+		return uint64(first & 0x3F), true, nil
+	}
+}
+
+// readString reads a string in any of the RDB string encodings, recording which
+func (rr *RDBReader) readString() (string, error) {
+	n, encoded, err := rr.readLength()
+	if err != nil {
+		return "", err
+	}
+
+	rr.encoding = "int"
+	if !encoded {
+		rr.encoding = "raw"
+		if rr.maxString > 0 && n > rr.maxString {
+			return "", fmt.Errorf("string length %d exceeds the data", n)
+		}
+		b := make([]byte, n)
+		if err := rr.readFull(b); err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+
+	switch n {
+	case rdbEncInt8:
+		b, err := rr.readByte()
+		return strconv.Itoa(int(int8(b))), err
+	case rdbEncInt16:
+		var b [2]byte
+		err := rr.readFull(b[:])
+		return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(b[:])))), err
+	case rdbEncInt32:
+		var b [4]byte
+		err := rr.readFull(b[:])
+		return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(b[:])))), err
+	case rdbEncLZF:
+		rr.encoding = "lzf"
+		compressedLen, _, err := rr.readLength()
+		if err != nil {
+			return "", err
+		}
+		length, _, err := rr.readLength()
+		if err != nil {
+			return "", err
+		}
+		if rr.maxString > 0 && compressedLen > rr.maxString || length/lzfMaxRatio > compressedLen {
+			return "", errors.New("invalid LZF lengths")
+		}
+		compressed := make([]byte, compressedLen)
+		if err := rr.readFull(compressed); err != nil {
+			return "", err
+		}
+		return lzfDecompress(compressed, int(length))
+	}
+	return "", fmt.Errorf("unknown string encoding %d", n)
+}
+
+// Next returns the next key in the stream, or io.EOF after the EOF marker
+func (rr *RDBReader) Next() (SnapshotEntry, error) {
+	var entry SnapshotEntry
+	start := rr.offset // of the key's record, moved past the metadata before it
+	for {
+		opcode, err := rr.readByte()
+		if err != nil {
+			return entry, err
+		}
+
+		switch opcode {
+		case rdbOpcodeEOF:
+			return entry, rr.verifyChecksum()
+		case rdbOpcodeAux:
+			key, err := rr.readString()
+			if err != nil {
+				return entry, err
+			}
+			value, err := rr.readString()
+			if err != nil {
+				return entry, err
+			}
+			rr.Aux[key] = value
+			start = rr.offset
+		case rdbOpcodeSelectDB:
+			db, _, err := rr.readLength()
+			if err != nil {
+				return entry, err
+			}
+			rr.DB = int(db)
+			start = rr.offset
+		case rdbOpcodeResizeDB:
+			if _, _, err := rr.readLength(); err != nil {
+				return entry, err
+			}
+			if _, _, err := rr.readLength(); err != nil {
+				return entry, err
+			}
+			start = rr.offset
+		case rdbOpcodeExpireTimeMs:
+			var b [8]byte
+			if err := rr.readFull(b[:]); err != nil {
+				return entry, err
+			}
+			entry.ExpiresAt = int64(binary.LittleEndian.Uint64(b[:]))
+		case rdbOpcodeExpireTime:
+			var b [4]byte
+			if err := rr.readFull(b[:]); err != nil {
+				return entry, err
+			}
+			entry.ExpiresAt = int64(binary.LittleEndian.Uint32(b[:])) * 1000
+		case rdbOpcodeIdle:
+			if _, _, err := rr.readLength(); err != nil {
+				return entry, err
+			}
+		case rdbOpcodeFreq:
+			if _, err := rr.readByte(); err != nil {
+				return entry, err
+			}
+		case rdbTypeString:
+			if entry.Key, err = rr.readString(); err != nil {
+				return entry, err
+			}
+			if entry.Value, err = rr.readString(); err != nil {
+				return entry, err
+			}
+			rr.ValueEncoding = rr.encoding
+			rr.EntrySize = rr.offset - start
+			return entry, nil
+		default:
+			return entry, fmt.Errorf("unsupported RDB opcode or value type %d", opcode)
+		}
+	}
+}
+
+// verifyChecksum checks the trailing CRC-64; a zero checksum means it was disabled
+func (rr *RDBReader) verifyChecksum() error {
+	if rr.Version < 5 {
+		return io.EOF
+	}
+	expected := rr.crc
+	var b [8]byte
+	if err := rr.readFull(b[:]); err != nil {
+		return fmt.Errorf("reading checksum: %w", err)
+	}
+	if sum := binary.LittleEndian.Uint64(b[:]); sum != 0 && sum != expected {
+		return fmt.Errorf("checksum mismatch: file has %016x, computed %016x", sum, expected)
+	}
+	return io.EOF
+}
+
+// lzfDecompress expands an LZF-compressed string of the given decompressed length
+func lzfDecompress(in []byte, length int) (string, error) {
+	out := make([]byte, 0, length)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			// Literal run of ctrl+1 bytes
+			end := i + ctrl + 1
+			if end > len(in) {
+				return "", errors.New("invalid LZF data")
+			}
+			out = append(out, in[i:end]...)
+			i = end
+			continue
+		}
+
+		// Back reference
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return "", errors.New("invalid LZF data")
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return "", errors.New("invalid LZF data")
+		}
+		ref := len(out) - ((ctrl&0x1F)<<8 | int(in[i])) - 1
+		i++
+		if ref < 0 {
+			return "", errors.New("invalid LZF back reference")
+		}
+		for j := 0; j < n+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != length {
+		return "", errors.New("LZF length mismatch")
+	}
+	return string(out), nil
+}
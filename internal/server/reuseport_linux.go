@@ -0,0 +1,28 @@
+//go:build linux
+
+package server
+
+import (
+	"net"
+	"syscall"
+)
+
+// soReusePort is SO_REUSEPORT on Linux, which the syscall package doesn't define
+const soReusePort = 0xf
+
+// reusePortListenConfig returns a ListenConfig that sets SO_REUSEPORT, letting several
+// sockets bind the same address while the kernel spreads connections across them
+func reusePortListenConfig() (*net.ListenConfig, error) {
+	return &net.ListenConfig{
+		Control: func(network, address string, conn syscall.RawConn) error {
+			var sockErr error
+			err := conn.Control(func(fd uintptr) {
+				sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}, nil
+}
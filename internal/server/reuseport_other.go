@@ -0,0 +1,13 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"net"
+)
+
+// reusePortListenConfig is only implemented on Linux
+func reusePortListenConfig() (*net.ListenConfig, error) {
+	return nil, errors.New("multiple acceptors require SO_REUSEPORT, which is only supported on Linux")
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"context"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// RoleHandler handles ROLE commands. There is no replication yet, so the server is
+// always a master without replicas, its replication offset staying at 0.
+type RoleHandler struct{}
+
+func (h *RoleHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	return writer.WriteValue(resp.Value{Type: resp.Array, Array: []resp.Value{
+		{Type: resp.BulkString, Bulk: "master"},
+		{Type: resp.Integer, Num: 0},
+		{Type: resp.Array, Array: []resp.Value{}},
+	}})
+}
+
+// errClusterDisabled is the reply to the cluster commands, as there is no cluster
+// mode
+const errClusterDisabled = "This instance has cluster support disabled"
+
+// ReadOnlyHandler handles READONLY and READWRITE commands. Without cluster mode
+// there are neither replica reads to allow nor -MOVED redirections to avoid, so
+// both are refused as by a Redis with cluster-enabled no.
+type ReadOnlyHandler struct{}
+
+func (h *ReadOnlyHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	return writer.WriteError(errClusterDisabled)
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+)
+
+// Run serves clients with config until the server is asked to shut down, then saves
+// the dataset if required. It returns once the server has stopped.
+func Run(config *Config) error {
+	// The server comes first so that everything below logs through it
+	server := NewRedisServer(config)
+	if err := server.CheckAliases(); err != nil {
+		return err
+	}
+	if err := server.OpenLog(); err != nil {
+		return fmt.Errorf("failed to open the log file: %w", err)
+	}
+	defer server.CloseLog()
+	logger := server.Logger()
+	if err := server.OpenAudit(); err != nil {
+		return fmt.Errorf("failed to open the audit log: %w", err)
+	}
+	defer server.CloseAudit()
+	if err := server.OpenTracing(context.Background()); err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	defer server.CloseTracing(context.Background())
+
+	// Sockets passed by systemd socket activation replace the configured ones
+	activated, err := inheritListeners()
+	if err != nil {
+		return fmt.Errorf("socket activation failed: %w", err)
+	}
+	var listeners, extraListeners []net.Listener
+	if activated != nil {
+		defer activated.close()
+		listeners = activated.tcp
+		if len(activated.tls) > 0 {
+			tlsConfig, err := loadTLSConfig(config)
+			if err != nil {
+				return fmt.Errorf("failed to set up TLS: %w", err)
+			}
+			extraListeners = append(extraListeners, wrapTLS(config, tlsConfig, activated.tls)...)
+		}
+		extraListeners = append(extraListeners, activated.unix...)
+	} else {
+		listeners, extraListeners, err = openListeners(config, logger)
+		if err != nil {
+			return err
+		}
+		defer closeListeners(listeners)
+		defer closeListeners(extraListeners)
+	}
+
+	adminListener, err := ListenAdmin(config)
+	if err != nil {
+		return fmt.Errorf("failed to listen on admin port %d: %w", config.AdminPort, err)
+	}
+	if adminListener != nil {
+		defer adminListener.Close()
+		// Served from the start, so that probes see the server alive while it loads
+		server.ServeAdmin(adminListener)
+	}
+
+	if err := server.OpenStorage(); err != nil {
+		return fmt.Errorf("failed to open the storage engine: %w", err)
+	}
+	// A background load fails once clients are served, which stops the server
+	loadErrors := make(chan error, 1)
+	if config.LazyLoading {
+		server.LoadRDBInBackground(func(loaded int, err error) {
+			if err != nil {
+				loadErrors <- err
+				return
+			}
+			logger.Info("DB loaded from disk", "keys", loaded)
+		})
+	} else {
+		loaded, err := server.LoadRDB()
+		if err != nil {
+			return fmt.Errorf("failed to load the RDB file: %w", err)
+		}
+		if loaded > 0 {
+			logger.Info("DB loaded from disk", "keys", loaded)
+		}
+	}
+	server.Serve(listeners, extraListeners)
+
+	// Persistence is loaded, or loading in the background, and every listener is
+	// served: traffic may be routed here
+	notifySupervisor(config, "STATUS=Ready to accept connections\nREADY=1\n", logger)
+
+	// Stop accepting first, then let connected clients drain
+	save := server.WaitForShutdown()
+	notifySupervisor(config, "STATUS=Shutting down\nSTOPPING=1\n", logger)
+	closeListeners(listeners)
+	closeListeners(extraListeners)
+	ctx, cancel := context.WithTimeout(context.Background(), server.ShutdownTimeout())
+	defer cancel()
+	if err := server.Shutdown(ctx, save); err != nil {
+		return fmt.Errorf("final save failed: %w", err)
+	}
+	select {
+	case err := <-loadErrors:
+		if !errors.Is(err, context.Canceled) {
+			return fmt.Errorf("failed to load the RDB file: %w", err)
+		}
+	default:
+	}
+	logger.Info("Redis is now ready to exit, bye bye...")
+	return nil
+}
+
+// Serve accepts clients on listeners and extraListeners in the background. The caller
+// keeps ownership of the listeners and closes them before calling Shutdown.
+func (s *RedisServer) Serve(listeners, extraListeners []net.Listener) {
+	for _, listener := range extraListeners {
+		s.logger.Info("Accepting connections", "addr", listener.Addr().String())
+		go serve(listener, s)
+	}
+	for _, listener := range listeners {
+		s.logger.Info("Redis server started", "addr", listener.Addr().String())
+	}
+
+	s.serving.Store(true)
+
+	// One accept loop per listener, or a single event loop polling all of them
+	if s.config.ExecutionModel == ExecutionEventLoop && len(listeners) > 0 {
+		go func() {
+			if err := RunEventLoop(listeners, s); err != nil {
+				s.logger.Warn("Event loop failed", "err", err)
+				os.Exit(1)
+			}
+		}()
+	} else {
+		for _, listener := range proxyListeners(s.config, listeners) {
+			go serve(listener, s)
+		}
+	}
+}
+
+// openListeners opens the plaintext TCP listeners on every bind address, and the TLS
+// and Unix socket listeners, which are always served by per-connection goroutines.
+func openListeners(config *Config, logger *slog.Logger) (listeners, extraListeners []net.Listener, err error) {
+	if config.Port == 0 && config.TLSPort == 0 && config.UnixSocket == "" {
+		return nil, nil, fmt.Errorf("invalid configuration: no port, tls-port or unixsocket to listen on")
+	}
+
+	// Port 0 disables the plaintext listeners
+	if config.Port != 0 {
+		listeners, err = listenTCP(config, config.Port, logger)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to bind to port %d: %w", config.Port, err)
+		}
+	}
+	if config.TLSPort != 0 {
+		tlsListeners, err := listenTLS(config, logger)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, nil, fmt.Errorf("failed to listen on TLS port %d: %w", config.TLSPort, err)
+		}
+		extraListeners = append(extraListeners, tlsListeners...)
+	}
+	if config.UnixSocket != "" {
+		unixListener, err := listenUnix(config)
+		if err != nil {
+			closeListeners(listeners)
+			closeListeners(extraListeners)
+			return nil, nil, fmt.Errorf("failed to listen on Unix socket %s: %w", config.UnixSocket, err)
+		}
+		extraListeners = append(extraListeners, unixListener)
+	}
+	return listeners, extraListeners, nil
+}
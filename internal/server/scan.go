@@ -0,0 +1,345 @@
+package server
+
+import (
+	"context"
+	"iter"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/glob"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// maxScanCursors bounds the unfinished SCAN iterations of a client: beyond it, the
+// one it used the longest ago is ended
+const maxScanCursors = 64
+
+// scanCursorIdleTimeout is how long an unfinished SCAN iteration is kept unused
+// before it is ended, releasing what it holds
+const scanCursorIdleTimeout = 5 * time.Minute
+
+// maxScanCursor bounds the random cursors, which clients reading them as a double,
+// like JavaScript ones, then still get right
+const maxScanCursor = 1<<53 - 1
+
+// defaultScanCount is the number of keys SCAN returns when COUNT is not given
+const defaultScanCount = 10
+
+// scanCursor is where an unfinished SCAN iteration resumes. With the prefix index
+// it walks keys in lexicographic order, so it only needs the next key to return;
+// otherwise it pulls them from an iteration of the storage engine, which returns the
+// keys present throughout exactly once, even across writes.
+type scanCursor struct {
+	// from is the next key of a walk of the prefix index, and the keys sorting before
+	// it were returned already
+	from string
+	// next pulls the next key of an iteration of the engine, which stop ends
+	next func() (string, *store.KeyValue, bool)
+	stop func()
+
+	// done is closed once the client of the iteration disconnects, nil without one
+	done     <-chan struct{}
+	lastUsed time.Time
+}
+
+// close ends the iteration of the engine, if any
+func (c *scanCursor) close() {
+	if c.stop != nil {
+		c.stop()
+	}
+}
+
+// endedScan is the iteration of a cursor whose keyspace was flushed
+func endedScan() (string, *store.KeyValue, bool) {
+	return "", nil, false
+}
+
+// scanCursors remembers the unfinished SCAN iterations by client. Cursors are
+// random and only valid for the client they were returned to, so that no client can
+// resume, and so take over, the iteration of another one.
+type scanCursors struct {
+	clients map[int64]map[uint64]*scanCursor // by client id, 0 without a client
+}
+
+// save stores an unfinished iteration of a client and returns its cursor, ending the
+// client's least recently used one beyond maxScanCursors
+func (c *scanCursors) save(client int64, cursor *scanCursor) uint64 {
+	if c.clients == nil {
+		c.clients = make(map[int64]map[uint64]*scanCursor)
+	}
+	cursors := c.clients[client]
+	if cursors == nil {
+		cursors = make(map[uint64]*scanCursor)
+		c.clients[client] = cursors
+	}
+	if len(cursors) >= maxScanCursors {
+		var oldest uint64
+		for id, other := range cursors {
+			if oldest == 0 || other.lastUsed.Before(cursors[oldest].lastUsed) {
+				oldest = id
+			}
+		}
+		cursors[oldest].close()
+		delete(cursors, oldest)
+	}
+	for {
+		id := rand.Uint64N(maxScanCursor) + 1
+		if _, taken := cursors[id]; !taken {
+			cursors[id] = cursor
+			return id
+		}
+	}
+}
+
+// resume returns the iteration of a client's cursor and forgets it
+func (c *scanCursors) resume(client int64, id uint64) (*scanCursor, bool) {
+	cursor, exists := c.clients[client][id]
+	if exists {
+		delete(c.clients[client], id)
+		if len(c.clients[client]) == 0 {
+			delete(c.clients, client)
+		}
+	}
+	return cursor, exists
+}
+
+// reap ends the iterations unused since scanCursorIdleTimeout before now, and
+// those of clients that disconnected
+func (c *scanCursors) reap(now time.Time) {
+	for client, cursors := range c.clients {
+		for id, cursor := range cursors {
+			select {
+			case <-cursor.done:
+			default:
+				if now.Sub(cursor.lastUsed) < scanCursorIdleTimeout {
+					continue
+				}
+			}
+			cursor.close()
+			delete(cursors, id)
+		}
+		if len(cursors) == 0 {
+			delete(c.clients, client)
+		}
+	}
+}
+
+// endIterations ends the iterations of the engine, before it is flushed or closed.
+// Their cursors remain valid and finish without returning anything more.
+func (c *scanCursors) endIterations() {
+	for _, cursors := range c.clients {
+		for _, cursor := range cursors {
+			if cursor.next != nil {
+				cursor.close()
+				cursor.next, cursor.stop = endedScan, nil
+			}
+		}
+	}
+}
+
+// reapScanCursors ends the SCAN iterations left unused for too long or whose client
+// disconnected, which may hold a snapshot of the storage engine
+func (s *RedisServer) reapScanCursors(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.scanCursors.reap(now)
+}
+
+// scanStep visits up to count keys of an iteration and returns the live ones
+// matching pattern, and of type typeName unless it is empty. It returns nil as the
+// cursor once the iteration is done.
+// Must be called with the server mutex held for writing.
+func (s *RedisServer) scanStep(cursor *scanCursor, pattern, typeName string, count int) ([]string, *scanCursor) {
+	var keys []string
+	if cursor.next == nil && s.prefixIndex != nil {
+		visited, more := 0, false
+		s.prefixIndex.Walk(store.LiteralPrefix(pattern), cursor.from, func(key string) bool {
+			if visited == count {
+				cursor.from, more = key, true
+				return false
+			}
+			visited++
+			if s.scanMatches(key, pattern, typeName) {
+				keys = append(keys, key)
+			}
+			return true
+		})
+		if !more {
+			return keys, nil
+		}
+		return keys, cursor
+	}
+
+	// An iteration started on the prefix index, disabled since, goes on over the
+	// engine from the keys it didn't return yet
+	if cursor.next == nil {
+		entries, _ := s.data.Snapshot()
+		cursor.next, cursor.stop = iter.Pull2(entries)
+	}
+	for visited := 0; visited < count; visited++ {
+		key, _, ok := cursor.next()
+		if !ok {
+			cursor.close()
+			return keys, nil
+		}
+		if key >= cursor.from && s.scanMatches(key, pattern, typeName) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, cursor
+}
+
+// scanMatches reports whether a key SCAN visits is live and matches its filters.
+// Engines iterating a point-in-time view return keys deleted since, so the key is
+// looked up again. Must be called with the server mutex held.
+func (s *RedisServer) scanMatches(key, pattern, typeName string) bool {
+	if !glob.Match(pattern, key) {
+		return false
+	}
+	kv, exists := s.data.Get(key)
+	if !exists || (kv.ExpiresAt != 0 && s.clock.Now().UnixMilli() > kv.ExpiresAt) {
+		return false
+	}
+	return typeName == "" || strings.EqualFold(kv.Value.Type().String(), typeName)
+}
+
+// matchingKeys returns the live keys matching pattern in lexicographic order. The
+// prefix index is used when enabled. Must be called with the server mutex held.
+func (s *RedisServer) matchingKeys(pattern string) []string {
+	var keys []string
+	if s.prefixIndex != nil {
+		s.prefixIndex.Walk(store.LiteralPrefix(pattern), "", func(key string) bool {
+			if glob.Match(pattern, key) && !s.isExpired(key) {
+				keys = append(keys, key)
+			}
+			return true
+		})
+		return keys
+	}
+
+	s.data.Iterate(func(key string, _ *store.KeyValue) bool {
+		if glob.Match(pattern, key) && !s.isExpired(key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	slices.Sort(keys)
+	return keys
+}
+
+// syncPrefixIndex builds or drops the prefix index to follow the key-prefix-index
+// setting. Must be called with the server mutex held for writing.
+func (s *RedisServer) syncPrefixIndex() {
+	switch {
+	case s.config.KeyPrefixIndex && s.prefixIndex == nil:
+		s.prefixIndex = store.NewPrefixIndex()
+		s.data.Iterate(func(key string, _ *store.KeyValue) bool {
+			s.prefixIndex.Insert(key)
+			return true
+		})
+	case !s.config.KeyPrefixIndex && s.prefixIndex != nil:
+		s.prefixIndex = nil
+	}
+}
+
+// KeysHandler handles KEYS commands
+type KeysHandler struct {
+	server *RedisServer
+}
+
+func (h *KeysHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if len(args) != 2 {
+		return writer.WriteError("wrong number of arguments for 'keys' command")
+	}
+
+	h.server.mutex.RLock()
+	keys := h.server.matchingKeys(args[1])
+	h.server.mutex.RUnlock()
+
+	return writer.WriteBulkStringArray(keys)
+}
+
+// ScanHandler handles SCAN commands
+type ScanHandler struct {
+	server *RedisServer
+}
+
+func (h *ScanHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if len(args) < 2 {
+		return writer.WriteError("wrong number of arguments for 'scan' command")
+	}
+
+	cursor, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return writer.WriteError("invalid cursor")
+	}
+
+	pattern, typeName := "*", ""
+	count := defaultScanCount
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return writer.WriteError("syntax error")
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			count, err = strconv.Atoi(args[i+1])
+			if err != nil {
+				return writer.WriteError("value is not an integer or out of range")
+			}
+			if count < 1 {
+				return writer.WriteError("syntax error")
+			}
+		case "TYPE":
+			// An unknown type matches no key, as in Redis
+			typeName = args[i+1]
+		default:
+			return writer.WriteError("syntax error")
+		}
+	}
+
+	var owner int64
+	var done <-chan struct{}
+	if client, ok := ctx.Value(clientContextKey{}).(*Client); ok {
+		owner, done = client.ID, client.ctx.Done()
+	}
+
+	h.server.mutex.Lock()
+	iteration := &scanCursor{}
+	if cursor != 0 {
+		// Like Redis, any cursor is accepted: one the client doesn't have, be it
+		// ended or made up, starts over, which still returns every key at least once
+		if resumed, exists := h.server.scanCursors.resume(owner, cursor); exists {
+			iteration = resumed
+		}
+	}
+
+	// COUNT bounds the keys visited rather than the ones returned, so that a call
+	// holds the keyspace for a bounded time even when few keys match
+	keys, iteration := h.server.scanStep(iteration, pattern, typeName, count)
+	next := uint64(0)
+	if iteration != nil {
+		iteration.done, iteration.lastUsed = done, time.Now()
+		next = h.server.scanCursors.save(owner, iteration)
+	}
+	h.server.mutex.Unlock()
+
+	return writer.WriteArray([]resp.Value{
+		{Type: resp.BulkString, Bulk: strconv.FormatUint(next, 10)},
+		bulkStringArray(keys),
+	})
+}
+
+// bulkStringArray wraps strings as a RESP array of bulk strings
+func bulkStringArray(values []string) resp.Value {
+	array := make([]resp.Value, len(values))
+	for i, v := range values {
+		array[i] = resp.Value{Type: resp.BulkString, Bulk: v}
+	}
+	return resp.Value{Type: resp.Array, Array: array}
+}
@@ -0,0 +1,734 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+	"github.com/codecrafters-io/redis-starter-go/resp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CommandHandler interface for handling Redis commands. ctx carries the client
+// running the command and is cancelled once the client is disconnected or the
+// server shuts down.
+type CommandHandler interface {
+	Handle(ctx context.Context, args []string, writer *resp.Writer) error
+}
+
+// PingHandler handles PING commands. A RESP2 subscriber gets its reply in the shape
+// of a message, as Redis sends it.
+type PingHandler struct {
+	server *RedisServer
+}
+
+func (h *PingHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if h.server.inSubscribedMode(writer) {
+		message := ""
+		if len(args) > 1 {
+			message = args[1]
+		}
+		return writer.WriteBulkStringArray([]string{"pong", message})
+	}
+	return writer.WriteSimpleString("PONG")
+}
+
+// EchoHandler handles ECHO commands
+type EchoHandler struct{}
+
+func (h *EchoHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if len(args) < 2 {
+		return writer.WriteError("wrong number of arguments for 'echo' command")
+	}
+	return writer.WriteBulkString(args[1])
+}
+
+// QuitHandler handles QUIT commands: the connection is closed once the reply is sent
+type QuitHandler struct {
+	server *RedisServer
+}
+
+func (h *QuitHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if client := h.server.clients.Lookup(writer); client != nil {
+		client.closeAfterReply.Store(true)
+	}
+	return writer.WriteSimpleString("OK")
+}
+
+// TimeHandler handles TIME commands. The time is the keyspace's, so that clients
+// computing expiry times from it agree with the server.
+type TimeHandler struct {
+	server *RedisServer
+}
+
+func (h *TimeHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	now := h.server.clock.Now().UnixMicro()
+	return writer.WriteBulkStringArray([]string{
+		strconv.FormatInt(now/1e6, 10),
+		strconv.FormatInt(now%1e6, 10),
+	})
+}
+
+// SetHandler handles SET commands
+type SetHandler struct {
+	server *RedisServer
+}
+
+func (h *SetHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if len(args) < 3 {
+		return writer.WriteError("wrong number of arguments for 'set' command")
+	}
+
+	key := args[1]
+	value := args[2]
+	var ttl time.Duration
+
+	// Parse EX/PX options
+	for i := 3; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return writer.WriteError("syntax error")
+		}
+
+		option := strings.ToUpper(args[i])
+		switch option {
+		case "EX":
+			seconds, err := strconv.Atoi(args[i+1])
+			if err != nil || seconds <= 0 {
+				return writer.WriteError("value is not an integer or out of range")
+			}
+			ttl = time.Duration(seconds) * time.Second
+		case "PX":
+			milliseconds, err := strconv.Atoi(args[i+1])
+			if err != nil || milliseconds <= 0 {
+				return writer.WriteError("value is not an integer or out of range")
+			}
+			ttl = time.Duration(milliseconds) * time.Millisecond
+		default:
+			return writer.WriteError("syntax error")
+		}
+	}
+
+	// Thread-safe write to data store
+	h.server.mutex.Lock()
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = h.server.expiresAfter(ttl)
+	}
+	h.server.setKey(key, h.server.newEntry(store.NewString(value), expiresAt))
+	h.server.notifyKeyspaceEvent(NotifyString, "set", key)
+	h.server.writeThrough(StoreWrite{Key: key, Value: value})
+	h.server.mutex.Unlock()
+
+	return writer.WriteSimpleString("OK")
+}
+
+// GetHandler handles GET commands
+type GetHandler struct {
+	server *RedisServer
+}
+
+func (h *GetHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if len(args) != 2 {
+		return writer.WriteError("wrong number of arguments for 'get' command")
+	}
+
+	key := args[1]
+
+	// Thread-safe read from data store
+	h.server.mutex.Lock()
+	kv, exists, wrongType := h.server.lookupKeyReadOfType(ctx, key, store.ObjString)
+	var value string
+	var reply []byte
+	if exists {
+		value = stringValue(kv)
+		if h.server.hotKeys != nil {
+			reply = h.server.hotKeys.Reply(key, kv)
+		}
+	}
+	h.server.mutex.Unlock()
+
+	if wrongType {
+		return writer.WriteError(errWrongType)
+	}
+	if !exists && h.server.backing.loader != nil {
+		loaded, found, err := h.server.loadKey(ctx, key)
+		if err != nil {
+			return writer.WriteError(errLoad(err))
+		}
+		value, exists = loaded, found
+	}
+	if !exists {
+		// Return null bulk string for non-existent key
+		return writer.WriteNullBulkString()
+	}
+
+	// Hot keys reuse their encoded reply until the value changes
+	if reply != nil {
+		return writer.WriteRaw(reply)
+	}
+	return writer.WriteBulkString(value)
+}
+
+// TTLHandler handles TTL, PTTL, EXPIRETIME and PEXPIRETIME commands: unit is the
+// unit of their reply, the unix time of the expiry when absolute is set
+type TTLHandler struct {
+	server   *RedisServer
+	unit     time.Duration
+	absolute bool
+}
+
+func (h *TTLHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if len(args) != 2 {
+		return writer.WriteError(fmt.Sprintf("wrong number of arguments for '%s' command", strings.ToLower(args[0])))
+	}
+
+	key := args[1]
+
+	h.server.mutex.Lock()
+	h.server.cleanupExpired(key) // Clean expired key first
+	kv, exists := h.server.data.Get(key)
+	h.server.countLookup(exists)
+	var expiresAt int64
+	if exists {
+		expiresAt = kv.ExpiresAt
+	}
+	h.server.mutex.Unlock()
+
+	if !exists {
+		return writer.WriteInteger(-2) // key doesn't exist
+	}
+
+	if expiresAt == 0 {
+		return writer.WriteInteger(-1) // no expiry
+	}
+
+	remaining := expiresAt - h.server.clock.Now().UnixMilli()
+	if remaining <= 0 {
+		// Key expired, clean it up
+		h.server.mutex.Lock()
+		h.server.cleanupExpired(key)
+		h.server.mutex.Unlock()
+		return writer.WriteInteger(-2)
+	}
+
+	// Rounded to the nearest unit as in Redis, so that EXPIRE 100 reads back as 100
+	perMilli := int64(h.unit / time.Millisecond)
+	if h.absolute {
+		return writer.WriteInteger(int((expiresAt + perMilli/2) / perMilli))
+	}
+	return writer.WriteInteger(int((remaining + perMilli/2) / perMilli))
+}
+
+// IncrHandler handles INCR, DECR, INCRBY and DECRBY commands
+type IncrHandler struct {
+	server *RedisServer
+	delta  int64 // +1 or -1; multiplied by the argument for the *BY variants
+	byArg  bool
+}
+
+func (h *IncrHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	if (h.byArg && len(args) != 3) || (!h.byArg && len(args) != 2) {
+		return writer.WriteError(fmt.Sprintf("wrong number of arguments for '%s' command", strings.ToLower(args[0])))
+	}
+
+	key := args[1]
+	delta := h.delta
+	if h.byArg {
+		amount, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil || (h.delta < 0 && amount == math.MinInt64) {
+			return writer.WriteError("value is not an integer or out of range")
+		}
+		delta *= amount
+	}
+
+	h.server.mutex.Lock()
+	kv, exists, wrongType := h.server.lookupKeyOfType(ctx, key, store.ObjString)
+	if wrongType {
+		h.server.mutex.Unlock()
+		return writer.WriteError(errWrongType)
+	}
+	current := int64(0)
+	var expiresAt int64
+	if exists {
+		parsed, err := strconv.ParseInt(stringValue(kv), 10, 64)
+		if err != nil {
+			h.server.mutex.Unlock()
+			return writer.WriteError("value is not an integer or out of range")
+		}
+		current = parsed
+		expiresAt = kv.ExpiresAt
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		h.server.mutex.Unlock()
+		return writer.WriteError("increment or decrement would overflow")
+	}
+	current += delta
+
+	// INCR keeps the key's TTL
+	h.server.setKey(key, h.server.newEntry(store.NewString(formatInteger(current)), expiresAt))
+	h.server.notifyKeyspaceEvent(NotifyString, "incrby", key)
+	h.server.writeThrough(StoreWrite{Key: key, Value: formatInteger(current)})
+	h.server.mutex.Unlock()
+
+	return writer.WriteInteger(int(current))
+}
+
+// RedisServer represents the Redis server
+type RedisServer struct {
+	commands map[string]*Command
+	aliases  map[string]string // alias-command, upper-cased alias to command
+	data     store.Engine
+	config   *Config
+	pubsub   *PubSub
+	clients  *ClientRegistry
+	workers  *WorkerPool
+	stats    ServerStats
+	rdb      rdbState
+
+	entries     store.Allocator
+	snapshot    *Snapshot
+	snapshotSeq uint64
+
+	prefixIndex *store.PrefixIndex // nil unless key-prefix-index is enabled
+	hotKeys     *HotKeys           // nil unless hotkeys-tracking is enabled
+	namespaces  []*memoryNamespace // from maxmemory-namespaces, in configuration order
+	scanCursors scanCursors
+	hooks       commandHooks
+	keyHooks    keyspaceHooks
+	backing     backingStore
+	gc          gcTuning // applied to the runtime
+	clock       Clock
+	admin       *http.Server // nil unless the admin endpoint is served
+
+	// tracer is nil unless tracing is enabled; tracerProvider is set when the
+	// server exports the spans itself
+	tracer         trace.Tracer
+	tracerProvider *sdktrace.TracerProvider
+
+	// logger writes to stdout until OpenLog, filtered by logLevel
+	logger   *slog.Logger
+	logLevel slog.LevelVar
+	logFile  *logFile
+	audit    *auditLog // nil unless audit-log is set
+
+	usedMemory int64
+	mutex      storeLock
+	latency    latencyMonitor
+	acl        atomic.Pointer[aclUser]
+
+	// connectedClients and rejectedConnections are updated by accept loops without the mutex
+	connectedClients    atomic.Int64
+	rejectedConnections atomic.Int64
+	connectionsReceived atomic.Int64
+
+	// outputLimitDisconnections counts clients closed over their output buffer limit
+	outputLimitDisconnections atomic.Int64
+
+	// netInputBytes and netOutputBytes count the bytes read from and written to
+	// network clients
+	netInputBytes  atomic.Int64
+	netOutputBytes atomic.Int64
+
+	errorStats errorStats
+	slowlog    slowLog
+	rateLimits rateLimiter
+
+	// loading is set while the RDB file is loaded, serving once clients are accepted
+	loading      atomic.Bool
+	loadProgress loadProgress
+	serving      atomic.Bool
+
+	// shutdownRequests carries SHUTDOWN commands to main, with whether to save;
+	// shuttingDown is set once Shutdown starts draining clients and stopped is
+	// closed once it is done, stopping the background tasks
+	shutdownRequests chan bool
+	shuttingDown     atomic.Bool
+	stopped          chan struct{}
+
+	// ctx is the parent of every client context, cancelled when shutdown starts
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewRedisServer creates a new Redis server
+func NewRedisServer(config *Config) *RedisServer {
+	server := &RedisServer{
+		commands: make(map[string]*Command),
+		data:     store.NewMemoryEngine(),
+		config:   config,
+		pubsub:   NewPubSub(),
+		clients:  NewClientRegistry(),
+		clock:    systemClock{},
+
+		shutdownRequests: make(chan bool, 1),
+		stopped:          make(chan struct{}),
+	}
+	server.ctx, server.cancel = context.WithCancel(context.Background())
+	server.stats.startTime = time.Now()
+	server.rdb.lastSave = server.stats.startTime
+	server.rdb.lastBgsaveOK = true
+	server.aliases = make(map[string]string, len(config.CommandAliases))
+	for _, alias := range config.CommandAliases {
+		server.aliases[alias.Alias] = alias.Command
+	}
+	if config.ExecutionModel == ExecutionWorkerPool {
+		server.workers = NewWorkerPool(config.WorkerPoolSize)
+	}
+	server.syncPrefixIndex()
+	server.syncHotKeys()
+	server.syncLogLevel()
+	server.syncSlowLog()
+	server.syncRateLimits()
+	server.mutex.latency = &server.latency
+	server.syncWatchdog()
+	server.syncNamespaces()
+	server.syncACL()
+	server.gc = gcTuning{percent: envGCPercent(), memoryLimit: runtimeMemoryLimit()}
+	server.syncGC()
+	server.logger = slog.New(newLogHandler(os.Stdout, config.LogFormat, &server.logLevel))
+	server.slowlog.webhook = make(chan slowlogEntry, slowlogWebhookQueue)
+	go server.clientsCron()
+	go server.watchdog()
+	go server.slowlogWebhookLoop()
+
+	// Register command handlers
+	server.registerCommand("PING", -1, FlagFast|FlagLoading, noKeys, &PingHandler{server: server})
+	server.registerCommand("ECHO", 2, FlagFast|FlagLoading, noKeys, &EchoHandler{})
+	server.registerCommand("QUIT", -1, FlagNoAuth|FlagFast|FlagLoading, noKeys, &QuitHandler{server: server})
+	server.registerCommand("RESET", 1, FlagNoAuth|FlagFast|FlagLoading, noKeys, &ResetHandler{server: server})
+	server.registerCommand("TIME", 1, FlagFast|FlagLoading, noKeys, &TimeHandler{server: server})
+	server.registerCommand("ROLE", 1, FlagFast|FlagLoading, noKeys, &RoleHandler{})
+	server.registerCommand("READONLY", 1, FlagFast|FlagLoading, noKeys, &ReadOnlyHandler{})
+	server.registerCommand("READWRITE", 1, FlagFast|FlagLoading, noKeys, &ReadOnlyHandler{})
+	server.registerCommand("CLIENT", -2, FlagLoading, noKeys, &ClientHandler{server: server})
+	server.registerCommand("HELLO", -1, FlagNoAuth|FlagFast|FlagLoading, noKeys, &HelloHandler{server: server})
+	server.registerCommand("AUTH", -2, FlagNoAuth|FlagFast|FlagLoading, noKeys, &AuthHandler{server: server})
+	server.registerCommand("ACL", -2, FlagAdmin|FlagLoading, noKeys, &ACLHandler{server: server})
+	server.registerCommand("SET", -3, FlagWrite|FlagDenyOOM, firstKey, &SetHandler{server: server})
+	server.registerCommand("GET", 2, FlagReadOnly|FlagFast, firstKey, &GetHandler{server: server})
+	server.registerCommand("DUMP", 2, FlagReadOnly, firstKey, &DumpHandler{server: server})
+	server.registerCommand("RESTORE", -4, FlagWrite|FlagDenyOOM, firstKey, &RestoreHandler{server: server})
+	server.registerCommand("TTL", 2, FlagReadOnly|FlagFast, firstKey, &TTLHandler{server: server, unit: time.Second})
+	server.registerCommand("PTTL", 2, FlagReadOnly|FlagFast, firstKey, &TTLHandler{server: server, unit: time.Millisecond})
+	server.registerCommand("EXPIRETIME", 2, FlagReadOnly|FlagFast, firstKey, &TTLHandler{server: server, unit: time.Second, absolute: true})
+	server.registerCommand("PEXPIRETIME", 2, FlagReadOnly|FlagFast, firstKey, &TTLHandler{server: server, unit: time.Millisecond, absolute: true})
+	server.registerCommand("TYPE", 2, FlagReadOnly|FlagFast, firstKey, &TypeHandler{server: server})
+	server.registerCommand("EXPIRE", -3, FlagWrite|FlagFast, firstKey, &ExpireHandler{server: server, unit: time.Second})
+	server.registerCommand("PEXPIRE", -3, FlagWrite|FlagFast, firstKey, &ExpireHandler{server: server, unit: time.Millisecond})
+	server.registerCommand("EXPIREAT", -3, FlagWrite|FlagFast, firstKey, &ExpireHandler{server: server, unit: time.Second, absolute: true})
+	server.registerCommand("PEXPIREAT", -3, FlagWrite|FlagFast, firstKey, &ExpireHandler{server: server, unit: time.Millisecond, absolute: true})
+	server.registerCommand("PERSIST", 2, FlagWrite|FlagFast, firstKey, &PersistHandler{server: server})
+	server.registerCommand("CONFIG", -2, FlagAdmin|FlagLoading, noKeys, &ConfigHandler{server: server})
+	server.registerCommand("INFO", -1, FlagLoading, noKeys, &InfoHandler{server: server})
+	server.registerCommand("OBJECT", -2, FlagReadOnly, noKeys, &ObjectHandler{server: server})
+	server.registerCommand("SUBSCRIBE", -2, FlagPubSub|FlagLoading, noKeys, &SubscribeHandler{server: server})
+	server.registerCommand("PSUBSCRIBE", -2, FlagPubSub|FlagLoading, noKeys, &SubscribeHandler{server: server, pattern: true})
+	server.registerCommand("UNSUBSCRIBE", -1, FlagPubSub|FlagLoading, noKeys, &UnsubscribeHandler{server: server})
+	server.registerCommand("PUNSUBSCRIBE", -1, FlagPubSub|FlagLoading, noKeys, &UnsubscribeHandler{server: server, pattern: true})
+	server.registerCommand("PUBLISH", 3, FlagPubSub|FlagFast|FlagLoading, noKeys, &PublishHandler{server: server})
+	server.registerCommand("KEYS", 2, FlagReadOnly, noKeys, &KeysHandler{server: server})
+	server.registerCommand("SCAN", -2, FlagReadOnly, noKeys, &ScanHandler{server: server})
+	server.registerCommand("DEL", -2, FlagWrite, allKeys, &DelHandler{server: server})
+	server.registerCommand("UNLINK", -2, FlagWrite|FlagFast, allKeys, &DelHandler{server: server})
+	server.registerCommand("FLUSHDB", -1, FlagWrite, noKeys, &FlushHandler{server: server})
+	server.registerCommand("FLUSHALL", -1, FlagWrite, noKeys, &FlushHandler{server: server})
+	server.registerCommand("INCR", 2, FlagWrite|FlagDenyOOM|FlagFast, firstKey, &IncrHandler{server: server, delta: 1})
+	server.registerCommand("DECR", 2, FlagWrite|FlagDenyOOM|FlagFast, firstKey, &IncrHandler{server: server, delta: -1})
+	server.registerCommand("INCRBY", 3, FlagWrite|FlagDenyOOM|FlagFast, firstKey, &IncrHandler{server: server, delta: 1, byArg: true})
+	server.registerCommand("DECRBY", 3, FlagWrite|FlagDenyOOM|FlagFast, firstKey, &IncrHandler{server: server, delta: -1, byArg: true})
+	server.registerCommand("HOTKEYS", -1, FlagReadOnly, noKeys, &HotKeysHandler{server: server})
+	server.registerCommand("MEMORY", -2, FlagReadOnly|FlagLoading, noKeys, &MemoryHandler{server: server})
+	server.registerCommand("LATENCY", -2, FlagAdmin|FlagLoading, noKeys, &LatencyHandler{server: server})
+	server.registerCommand("SLOWLOG", -2, FlagAdmin|FlagLoading, noKeys, &SlowlogHandler{server: server})
+	server.registerCommand("SAVE", 1, FlagAdmin, noKeys, &SaveHandler{server: server})
+	server.registerCommand("BGSAVE", -1, FlagAdmin, noKeys, &BgsaveHandler{server: server})
+	server.registerCommand("LASTSAVE", 1, FlagFast|FlagLoading, noKeys, &LastSaveHandler{server: server})
+	server.registerCommand("SHUTDOWN", -1, FlagAdmin|FlagLoading, noKeys, &ShutdownHandler{server: server})
+	server.registerCommand("COMMAND", -1, FlagLoading, noKeys, &CommandsHandler{server: server})
+
+	return server
+}
+
+// newEntry allocates an entry for a value with an optional expiry in unix
+// milliseconds (0 for none). Must be called with the server mutex held for writing.
+func (s *RedisServer) newEntry(value store.Object, expiresAt int64) *store.KeyValue {
+	kv := s.entries.New()
+	kv.Value = value
+	kv.ExpiresAt = expiresAt
+	return kv
+}
+
+// isExpired checks if a key has expired
+func (s *RedisServer) isExpired(key string) bool {
+	kv, exists := s.data.Get(key)
+	if !exists {
+		return false
+	}
+	if kv.ExpiresAt == 0 {
+		return false // no expiry
+	}
+	return s.clock.Now().UnixMilli() > kv.ExpiresAt
+}
+
+// cleanupExpired removes an expired key
+func (s *RedisServer) cleanupExpired(key string) {
+	if s.isExpired(key) {
+		kv, _ := s.data.Get(key)
+		s.deleteKey(key)
+		s.entries.Release(kv)
+		s.stats.expiredKeys++
+		s.notifyKeyspaceEvent(NotifyExpired, "expired", key)
+		runKeyHooks(s.keyHooks.expire, key)
+	}
+}
+
+// lookupKey returns a live key and records the access for eviction bookkeeping,
+// unless the command of ctx comes from a no-touch client.
+// Must be called with the server mutex held for writing.
+func (s *RedisServer) lookupKey(ctx context.Context, key string) (*store.KeyValue, bool) {
+	s.cleanupExpired(key)
+	kv, exists := s.data.Get(key)
+	if !exists {
+		return nil, false
+	}
+	if !noTouchContext(ctx) && s.touchKey(kv) {
+		s.data.Touch(key, kv)
+	}
+	if s.hotKeys != nil {
+		s.hotKeys.Track(key, kv.Freq)
+	}
+	return kv, true
+}
+
+// lookupKeyRead is lookupKey for commands reading the key, counted in keyspace_hits
+// and keyspace_misses.
+// Must be called with the server mutex held for writing.
+func (s *RedisServer) lookupKeyRead(ctx context.Context, key string) (*store.KeyValue, bool) {
+	kv, exists := s.lookupKey(ctx, key)
+	s.countLookup(exists)
+	return kv, exists
+}
+
+// countLookup counts a read lookup of a key in keyspace_hits or keyspace_misses.
+// Must be called with the server mutex held for writing.
+func (s *RedisServer) countLookup(hit bool) {
+	if hit {
+		s.stats.keyspaceHits++
+	} else {
+		s.stats.keyspaceMisses++
+	}
+}
+
+// setKey stores a key, replacing any previous value, and keeps memory accounting current.
+// Must be called with the server mutex held for writing.
+func (s *RedisServer) setKey(key string, kv *store.KeyValue) {
+	s.preserveForSnapshot(key)
+	s.rdb.dirty++
+	if s.hotKeys != nil {
+		s.hotKeys.Invalidate(key)
+	}
+	if str, ok := kv.Value.(*store.StringObject); ok {
+		str.Value, str.Shared = internValue(str.Value)
+	}
+	if isSharedInteger(kv) {
+		s.stats.sharedIntegerKeys++
+	}
+	old, exists := s.data.Get(key)
+	if exists {
+		if isSharedInteger(old) {
+			s.stats.sharedIntegerKeys--
+		}
+		s.usedMemory -= entrySize(key, old)
+		s.accountNamespace(key, -entrySize(key, old))
+		kv.Freq = old.Freq
+		kv.FreqDecayedAt = old.FreqDecayedAt
+	} else {
+		kv.Freq = lfuInitVal
+		kv.FreqDecayedAt = s.clock.Now().Unix() / 60
+		if s.prefixIndex != nil {
+			s.prefixIndex.Insert(key)
+		}
+	}
+	s.touchKey(kv)
+	s.data.Set(key, kv)
+	// The engine may still read the entry it replaces, so it is only released now
+	if exists {
+		s.entries.Release(old)
+	}
+	s.usedMemory += entrySize(key, kv)
+	s.accountNamespace(key, entrySize(key, kv))
+	s.keySetHooks(key, stringValue(kv), kv.ExpiresAt)
+}
+
+// deleteKey removes a key and keeps memory accounting current.
+// Must be called with the server mutex held for writing.
+func (s *RedisServer) deleteKey(key string) bool {
+	kv, exists := s.data.Get(key)
+	if !exists {
+		return false
+	}
+	s.preserveForSnapshot(key)
+	s.rdb.dirty++
+	if isSharedInteger(kv) {
+		s.stats.sharedIntegerKeys--
+	}
+	s.usedMemory -= entrySize(key, kv)
+	s.accountNamespace(key, -entrySize(key, kv))
+	s.data.Delete(key)
+	if s.prefixIndex != nil {
+		s.prefixIndex.Delete(key)
+	}
+	if s.hotKeys != nil {
+		s.hotKeys.Forget(key)
+	}
+	return true
+}
+
+// flushData empties the keyspace, leaving its old content to the garbage collector.
+// Must be called with the server mutex held for writing.
+func (s *RedisServer) flushData() {
+	keys := s.data.Len()
+	s.scanCursors.endIterations()
+	s.data.Flush()
+	s.usedMemory = 0
+	s.resetNamespaces()
+	if s.prefixIndex != nil {
+		s.prefixIndex = store.NewPrefixIndex()
+	}
+	if s.hotKeys != nil {
+		s.hotKeys = NewHotKeys(s.config.HotKeysReplyCache)
+	}
+	s.rdb.dirty += int64(keys)
+	for _, hook := range s.keyHooks.flush {
+		hook()
+	}
+	s.detachSnapshot()
+}
+
+// dispatch runs a command inline or on the worker pool, depending on the execution
+// model. Either way it returns only once the command is done, so replies stay ordered.
+func (s *RedisServer) dispatch(ctx context.Context, cmd []string, writer *resp.Writer) error {
+	if s.workers == nil {
+		return s.HandleCommand(ctx, cmd, writer)
+	}
+
+	var err error
+	s.workers.Run(func() {
+		err = s.HandleCommand(ctx, cmd, writer)
+	})
+	return err
+}
+
+// HandleCommand processes a Redis command, between the command hooks if any are registered
+func (s *RedisServer) HandleCommand(ctx context.Context, cmd []string, writer *resp.Writer) error {
+	defer writer.EndCommand()
+	if len(cmd) > 0 && s.logger.Enabled(ctx, slog.LevelDebug) {
+		defer s.logCommand(ctx, cmd[0], time.Now())
+	}
+	if len(cmd) > 0 && s.tracer != nil {
+		var end func()
+		ctx, end = s.traceCommand(ctx, cmd, writer)
+		defer end()
+	}
+	errorsBefore, _ := writer.Errors()
+	defer s.countErrors(writer, errorsBefore)
+	if len(cmd) > 0 && s.audit != nil {
+		// Decided beforehand, so that a CONFIG SET of audit-categories is audited
+		if entry, audited := s.auditedCommand(cmd[0]); audited {
+			defer s.auditCommand(ctx, entry, cmd, writer, errorsBefore)
+		}
+	}
+	if len(s.hooks.pre) == 0 && len(s.hooks.post) == 0 {
+		return s.execute(ctx, cmd, writer)
+	}
+	return s.runHooked(ctx, cmd, writer)
+}
+
+// countErrors adds the error replies written since the writer had written errorsBefore
+// to errorstats
+func (s *RedisServer) countErrors(writer *resp.Writer, errorsBefore int64) {
+	if errors, last := writer.Errors(); errors > errorsBefore {
+		s.errorStats.record(last, errors-errorsBefore)
+	}
+}
+
+// execute runs a command through the dispatch table
+func (s *RedisServer) execute(ctx context.Context, cmd []string, writer *resp.Writer) error {
+	if len(cmd) == 0 {
+		return writer.WriteError("empty command")
+	}
+
+	command := strings.ToUpper(cmd[0])
+	entry, exists := s.lookupCommand(command)
+	if !exists {
+		return writer.WriteError(fmt.Sprintf("unknown command '%s'", command))
+	}
+	if entry.Name != command {
+		// An alias runs as the command it stands for
+		command = entry.Name
+		cmd = append([]string{command}, cmd[1:]...)
+	}
+
+	// Keyspace commands would only queue up behind the command holding the lock, as
+	// would checking authentication, which reads the configuration
+	if entry.Flags&(FlagWrite|FlagReadOnly) != 0 {
+		if blocked, overdue := s.mutex.overdue(); overdue {
+			entry.stats.rejected.Add(1)
+			return writer.WriteError(errBusy(blocked))
+		}
+	}
+
+	if entry.Flags&FlagNoAuth == 0 && !s.authenticated(writer) {
+		entry.stats.rejected.Add(1)
+		return writer.WriteError(errNoAuth)
+	}
+
+	if (entry.Arity > 0 && len(cmd) != entry.Arity) || len(cmd) < -entry.Arity {
+		entry.stats.rejected.Add(1)
+		return writer.WriteError(fmt.Sprintf("wrong number of arguments for '%s' command", strings.ToLower(command)))
+	}
+
+	if !subscribedModeCommands[command] && s.inSubscribedMode(writer) {
+		entry.stats.rejected.Add(1)
+		return writer.WriteError(fmt.Sprintf("Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", strings.ToLower(command)))
+	}
+
+	if msg := s.permissionError(command, entry, cmd); msg != "" {
+		entry.stats.rejected.Add(1)
+		return writer.WriteError(msg)
+	}
+
+	if entry.Flags&FlagLoading == 0 && s.loading.Load() && !s.loaded(entry.Keys.keys(cmd)) {
+		entry.stats.rejected.Add(1)
+		return writer.WriteError(errLoading)
+	}
+
+	if entry.Flags&FlagDenyOOM != 0 {
+		if err := s.performEvictions(entry.Keys.keys(cmd)); err != nil {
+			entry.stats.rejected.Add(1)
+			return writer.WriteError(err.Error())
+		}
+	}
+
+	errorsBefore, _ := writer.Errors()
+	start := time.Now()
+	err := entry.Handler.Handle(ctx, cmd, writer)
+	duration := time.Since(start)
+	entry.stats.record(duration)
+	if s.slowlog.isSlow(duration) {
+		s.logSlowCommand(ctx, cmd, duration)
+	}
+	if errorsAfter, _ := writer.Errors(); errorsAfter > errorsBefore {
+		entry.stats.failed.Add(1)
+	}
+	return err
+}
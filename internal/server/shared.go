@@ -0,0 +1,44 @@
+package server
+
+import (
+	"strconv"
+)
+
+// sharedIntegerCount is the number of integer values kept as shared strings
+// (0 to 9999, the same range as Redis' OBJ_SHARED_INTEGERS)
+const sharedIntegerCount = 10000
+
+// sharedIntegers holds the canonical string of every shared integer value. Keys
+// whose value is one of these reference the shared copy instead of owning one.
+var sharedIntegers = func() [sharedIntegerCount]string {
+	var table [sharedIntegerCount]string
+	for i := range table {
+		table[i] = strconv.Itoa(i)
+	}
+	return table
+}()
+
+// internValue returns the shared copy of a canonical small integer string such as
+// "42" ("042" and "+42" are left alone since they must round-trip unchanged)
+func internValue(value string) (string, bool) {
+	if len(value) == 0 || len(value) > 4 || (len(value) > 1 && value[0] == '0') {
+		return value, false
+	}
+	n := 0
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < '0' || c > '9' {
+			return value, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return sharedIntegers[n], true
+}
+
+// formatInteger renders an integer value, using the shared copy when there is one
+func formatInteger(n int64) string {
+	if n >= 0 && n < sharedIntegerCount {
+		return sharedIntegers[n]
+	}
+	return strconv.FormatInt(n, 10)
+}
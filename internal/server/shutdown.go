@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// shutdownPollInterval is how often Shutdown checks whether every client has gone
+const shutdownPollInterval = 10 * time.Millisecond
+
+// WaitForShutdown blocks until SIGTERM, SIGINT or the SHUTDOWN command asks the server
+// to stop, and reports whether a final save should be performed. Meanwhile SIGHUP and
+// SIGUSR1 reopen the log file.
+func (s *RedisServer) WaitForShutdown() bool {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+	reopen := make(chan os.Signal, 1)
+	signal.Notify(reopen, reopenLogSignals...)
+	defer signal.Stop(reopen)
+
+	for {
+		select {
+		case <-reopen:
+			s.ReopenLog()
+		case sig := <-signals:
+			s.logger.Warn("Received signal, scheduling shutdown", "signal", sig.String())
+			return s.SaveOnShutdown()
+		case save := <-s.shutdownRequests:
+			s.logger.Warn("User requested shutdown")
+			return save
+		}
+	}
+}
+
+// ShutdownRequests delivers SHUTDOWN commands, with whether to save, to servers
+// that don't stop through WaitForShutdown
+func (s *RedisServer) ShutdownRequests() <-chan bool {
+	return s.shutdownRequests
+}
+
+// SaveOnShutdown reports whether a shutdown not requested by SHUTDOWN should save
+func (s *RedisServer) SaveOnShutdown() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.config.SaveOnShutdown
+}
+
+// Shutdown stops serving clients and optionally saves the dataset. The listeners must
+// already be closed. Commands being executed complete and their replies are flushed;
+// clients still connected once ctx is done are closed forcibly.
+func (s *RedisServer) Shutdown(ctx context.Context, save bool) error {
+	defer close(s.stopped)
+	defer s.closeStorage()
+	s.closeAdmin()
+
+	// Goroutine clients blocked reading their next command wake up and leave; busy
+	// ones notice the flag once their current command is done, which the cancelled
+	// context asks to finish early
+	s.shuttingDown.Store(true)
+	s.cancel()
+	for _, client := range s.clients.All() {
+		if client.conn != nil {
+			client.conn.SetReadDeadline(time.Now())
+		}
+	}
+
+	for s.connectedClients.Load() > 0 && ctx.Err() == nil {
+		time.Sleep(shutdownPollInterval)
+	}
+	if remaining := s.connectedClients.Load(); remaining > 0 {
+		s.logger.Warn("Closing clients that didn't drain in time", "clients", remaining)
+		for _, client := range s.clients.All() {
+			if client.conn != nil {
+				client.disconnect()
+			}
+		}
+	}
+	s.drainWrites(ctx)
+
+	if !save {
+		return nil
+	}
+	if s.loading.Load() {
+		s.logger.Warn("Not saving the dataset, which is only partly loaded")
+		return nil
+	}
+
+	// A background save holds the only snapshot slot; wait for it rather than failing
+	for {
+		s.mutex.RLock()
+		inProgress := s.rdb.bgsaveInProgress
+		s.mutex.RUnlock()
+		if !inProgress {
+			break
+		}
+		time.Sleep(shutdownPollInterval)
+	}
+	s.logger.Info("Saving the final RDB snapshot before exiting")
+	return s.rdbSave(ctx)
+}
+
+// ShutdownTimeout returns how long clients get to drain on shutdown
+func (s *RedisServer) ShutdownTimeout() time.Duration {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return time.Duration(s.config.ShutdownTimeout) * time.Second
+}
+
+// ShutdownHandler handles SHUTDOWN commands
+type ShutdownHandler struct {
+	server *RedisServer
+}
+
+func (h *ShutdownHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	h.server.mutex.RLock()
+	save := h.server.config.SaveOnShutdown
+	h.server.mutex.RUnlock()
+
+	switch {
+	case len(args) == 1:
+	case len(args) == 2 && strings.EqualFold(args[1], "SAVE"):
+		save = true
+	case len(args) == 2 && strings.EqualFold(args[1], "NOSAVE"):
+		save = false
+	default:
+		return writer.WriteError("syntax error")
+	}
+
+	// Like Redis, a successful SHUTDOWN doesn't reply: the connection just closes
+	select {
+	case h.server.shutdownRequests <- save:
+	default:
+		return writer.WriteError("shutdown already in progress")
+	}
+	return nil
+}
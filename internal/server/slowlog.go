@@ -0,0 +1,241 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// Slow log limits, as in Redis: longer commands are abridged before being recorded
+const (
+	slowlogMaxArgc   = 32
+	slowlogMaxArgLen = 128
+)
+
+// slowlogWebhookQueue bounds the records waiting for the webhook; more are dropped
+// rather than slowing commands down
+const slowlogWebhookQueue = 256
+
+// slowlogWebhookTimeout bounds a single webhook delivery
+const slowlogWebhookTimeout = 5 * time.Second
+
+// slowlogEntry is a command that ran for longer than slowlog-log-slower-than
+type slowlogEntry struct {
+	ID         int64     `json:"id"`
+	Time       time.Time `json:"time"`
+	DurationUS int64     `json:"duration_us"`
+	Args       []string  `json:"args"`
+	ClientAddr string    `json:"client_addr"`
+	ClientName string    `json:"client_name"`
+}
+
+// slowLog keeps the latest slow commands for SLOWLOG and streams them to the sinks
+type slowLog struct {
+	// threshold mirrors slowlog-log-slower-than in microseconds, so that the fast
+	// path needn't take the server mutex
+	threshold atomic.Int64
+
+	mutex   sync.Mutex
+	entries []slowlogEntry // newest first
+	nextID  int64
+
+	webhook chan slowlogEntry
+}
+
+// syncSlowLog applies slowlog-log-slower-than and trims the log to slowlog-max-len.
+// Must be called with the server mutex held.
+func (s *RedisServer) syncSlowLog() {
+	s.slowlog.threshold.Store(s.config.SlowlogLogSlowerThan)
+	s.slowlog.mutex.Lock()
+	defer s.slowlog.mutex.Unlock()
+	if len(s.slowlog.entries) > s.config.SlowlogMaxLen {
+		s.slowlog.entries = s.slowlog.entries[:s.config.SlowlogMaxLen]
+	}
+}
+
+// isSlow reports whether a command that ran for d goes to the slow log
+func (sl *slowLog) isSlow(d time.Duration) bool {
+	threshold := sl.threshold.Load()
+	return threshold >= 0 && d.Microseconds() >= threshold
+}
+
+// slowlogArgs abridges and redacts the arguments of a command for the slow log
+func slowlogArgs(cmd []string) []string {
+	args := make([]string, 0, min(len(cmd), slowlogMaxArgc))
+	for i, arg := range cmd {
+		if i == slowlogMaxArgc-1 && len(cmd) > slowlogMaxArgc {
+			args = append(args, fmt.Sprintf("... (%d more arguments)", len(cmd)-i))
+			break
+		}
+		if len(arg) > slowlogMaxArgLen {
+			arg = fmt.Sprintf("%s... (%d more bytes)", arg[:slowlogMaxArgLen], len(arg)-slowlogMaxArgLen)
+		}
+		args = append(args, arg)
+	}
+
+	// Credentials never reach the slow log
+	switch strings.ToUpper(cmd[0]) {
+	case "AUTH", "HELLO":
+		for i := 1; i < len(args); i++ {
+			args[i] = "(redacted)"
+		}
+	case "CONFIG":
+		for i := 2; i+1 < len(args); i++ {
+			if strings.EqualFold(args[i], "requirepass") {
+				args[i+1] = "(redacted)"
+			}
+		}
+	}
+	return args
+}
+
+// logSlowCommand records a slow command and streams it to the configured sinks
+func (s *RedisServer) logSlowCommand(ctx context.Context, cmd []string, d time.Duration) {
+	entry := slowlogEntry{Time: time.Now(), DurationUS: d.Microseconds(), Args: slowlogArgs(cmd)}
+	if client, ok := ClientFromContext(ctx); ok {
+		entry.ClientAddr, entry.ClientName = client.Addr, client.Name
+	}
+
+	s.mutex.RLock()
+	maxLen := s.config.SlowlogMaxLen
+	toLog, channel, webhook := s.config.SlowlogSinkLog, s.config.SlowlogSinkChannel, s.config.SlowlogSinkWebhook
+	s.mutex.RUnlock()
+
+	s.slowlog.mutex.Lock()
+	entry.ID = s.slowlog.nextID
+	s.slowlog.nextID++
+	if maxLen > 0 {
+		s.slowlog.entries = append(s.slowlog.entries, slowlogEntry{})
+		copy(s.slowlog.entries[1:], s.slowlog.entries)
+		s.slowlog.entries[0] = entry
+		s.slowlog.entries = s.slowlog.entries[:min(len(s.slowlog.entries), maxLen)]
+	}
+	s.slowlog.mutex.Unlock()
+
+	if toLog {
+		s.logger.LogAttrs(ctx, slog.LevelWarn, "Slow command",
+			slog.Int64("id", entry.ID), slog.Any("args", entry.Args), slog.Duration("duration", d),
+			slog.String("client_addr", entry.ClientAddr), slog.String("client_name", entry.ClientName))
+	}
+	if channel != "" {
+		payload, _ := json.Marshal(entry)
+		s.pubsub.Publish(channel, string(payload))
+	}
+	if webhook != "" {
+		select {
+		case s.slowlog.webhook <- entry:
+		default:
+			s.logVerbose("Slow log webhook queue full, dropping a record", "id", entry.ID)
+		}
+	}
+}
+
+// slowlogWebhookLoop POSTs the slow commands queued for slowlog-sink-webhook as JSON,
+// one request each, until the server stops
+func (s *RedisServer) slowlogWebhookLoop() {
+	client := &http.Client{Timeout: slowlogWebhookTimeout}
+	for {
+		var entry slowlogEntry
+		select {
+		case entry = <-s.slowlog.webhook:
+		case <-s.stopped:
+			return
+		}
+
+		s.mutex.RLock()
+		url := s.config.SlowlogSinkWebhook
+		s.mutex.RUnlock()
+		if url == "" {
+			continue // disabled since it was queued
+		}
+		payload, _ := json.Marshal(entry)
+		response, err := client.Post(url, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			s.logger.Warn("Slow log webhook failed", "url", url, "err", err)
+			continue
+		}
+		response.Body.Close()
+		if response.StatusCode >= 300 {
+			s.logger.Warn("Slow log webhook failed", "url", url, "status", response.Status)
+		}
+	}
+}
+
+// SlowlogHandler handles SLOWLOG subcommands
+type SlowlogHandler struct {
+	server *RedisServer
+}
+
+func (h *SlowlogHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	sl := &h.server.slowlog
+	switch subcommand := strings.ToUpper(args[1]); {
+	case subcommand == "GET" && len(args) <= 3:
+		count := 10
+		if len(args) == 3 {
+			n, err := strconv.Atoi(args[2])
+			if err != nil || n < -1 {
+				return writer.WriteError("count should be greater than or equal to -1")
+			}
+			count = n
+		}
+		sl.mutex.Lock()
+		entries := sl.entries
+		if count >= 0 && count < len(entries) {
+			entries = entries[:count]
+		}
+		reply := make([]resp.Value, len(entries))
+		for i, entry := range entries {
+			args := make([]resp.Value, len(entry.Args))
+			for j, arg := range entry.Args {
+				args[j] = resp.Value{Type: resp.BulkString, Bulk: arg}
+			}
+			reply[i] = resp.Value{Type: resp.Array, Array: []resp.Value{
+				{Type: resp.Integer, Num: int(entry.ID)},
+				{Type: resp.Integer, Num: int(entry.Time.Unix())},
+				{Type: resp.Integer, Num: int(entry.DurationUS)},
+				{Type: resp.Array, Array: args},
+				{Type: resp.BulkString, Bulk: entry.ClientAddr},
+				{Type: resp.BulkString, Bulk: entry.ClientName},
+			}}
+		}
+		sl.mutex.Unlock()
+		return writer.WriteArray(reply)
+	case subcommand == "LEN" && len(args) == 2:
+		sl.mutex.Lock()
+		length := len(sl.entries)
+		sl.mutex.Unlock()
+		return writer.WriteInteger(length)
+	case subcommand == "RESET" && len(args) == 2:
+		sl.mutex.Lock()
+		sl.entries = nil
+		sl.mutex.Unlock()
+		return writer.WriteSimpleString("OK")
+	case subcommand == "HELP":
+		return writer.WriteBulkStringArray([]string{
+			"SLOWLOG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"GET [<count>]",
+			"    Return top <count> entries from the slowlog (default: 10, -1 mean all).",
+			"    Entries are made of:",
+			"    id, timestamp, time in microseconds, arguments array, client IP and port,",
+			"    client name",
+			"LEN",
+			"    Return the length of the slowlog.",
+			"RESET",
+			"    Reset the slowlog.",
+			"HELP",
+			"    Print this help.",
+		})
+	default:
+		return writer.WriteError(fmt.Sprintf("unknown subcommand or wrong number of arguments for '%s'. Try SLOWLOG HELP.", args[1]))
+	}
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"errors"
+	"iter"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+// snapshotBatchSize is the number of keys a snapshot visits per store lock acquisition
+const snapshotBatchSize = 256
+
+// errSnapshotInProgress is returned when a second snapshot is requested while one is open
+var errSnapshotInProgress = errors.New("a snapshot is already in progress")
+
+// SnapshotEntry is a key as it was when the snapshot was taken
+type SnapshotEntry struct {
+	Key       string
+	Value     string
+	ExpiresAt int64 // unix milliseconds, 0 if the key never expires
+}
+
+// Snapshot is a point-in-time view of the keyspace that can be iterated while
+// writes continue. It walks the live engine a batch at a time and relies on
+// copy-on-write: the first time a key is modified while the snapshot is open, its
+// pre-image is preserved so the iterator still returns the value as of creation.
+type Snapshot struct {
+	server *RedisServer
+	id     uint64
+
+	next func() (string, *store.KeyValue, bool)
+	stop func()
+
+	// pointInTime is set when the engine iterates a frozen view of the keyspace
+	// itself, so nothing needs preserving
+	pointInTime bool
+
+	// preserved holds pre-images of keys modified since the snapshot was taken
+	preserved map[string]*preservedEntry
+
+	buffer   []SnapshotEntry
+	liveDone bool
+	done     bool
+}
+
+// preservedEntry is the copy-on-write record of a key modified during a snapshot
+type preservedEntry struct {
+	kv      *store.KeyValue // value at snapshot time, nil if the key didn't exist
+	emitted bool            // already returned by the iterator (or known not to be needed)
+}
+
+// NewSnapshot opens a consistent snapshot of the keyspace. Only one snapshot may be
+// open at a time; callers must Close it when done.
+func (s *RedisServer) NewSnapshot() (*Snapshot, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.snapshot != nil {
+		return nil, errSnapshotInProgress
+	}
+
+	s.snapshotSeq++
+	snap := &Snapshot{
+		server:    s,
+		id:        s.snapshotSeq,
+		preserved: make(map[string]*preservedEntry),
+	}
+	entries, pointInTime := s.data.Snapshot()
+	snap.next, snap.stop = iter.Pull2(entries)
+	snap.pointInTime = pointInTime
+	s.snapshot = snap
+	return snap, nil
+}
+
+// preserveForSnapshot records the pre-image of a key that is about to be modified.
+// Must be called with the server mutex held for writing, before the change.
+func (s *RedisServer) preserveForSnapshot(key string) {
+	snap := s.snapshot
+	if snap == nil || snap.pointInTime {
+		return
+	}
+	if _, recorded := snap.preserved[key]; recorded {
+		return
+	}
+
+	old, exists := s.data.Get(key)
+	switch {
+	case !exists:
+		// Any key changed since the snapshot began is already recorded, so a
+		// missing key did not exist at snapshot time either
+		snap.preserved[key] = &preservedEntry{emitted: true}
+	case old.SnapshotID == snap.id:
+		// Already returned by the iterator, no need to keep the old value
+		snap.preserved[key] = &preservedEntry{emitted: true}
+	default:
+		copied := *old
+		snap.preserved[key] = &preservedEntry{kv: &copied}
+	}
+}
+
+// detachSnapshot hands the flushed content over to an open snapshot: the snapshot
+// keeps iterating it, which no writer touches
+// any more, so there is nothing left to preserve. Must be called with the server
+// mutex held for writing.
+func (s *RedisServer) detachSnapshot() {
+	s.snapshot = nil
+}
+
+// Next returns the next entry of the snapshot, or false once every key has been returned
+func (snap *Snapshot) Next() (SnapshotEntry, bool) {
+	if len(snap.buffer) == 0 && !snap.done {
+		snap.fill()
+	}
+	if len(snap.buffer) == 0 {
+		return SnapshotEntry{}, false
+	}
+	entry := snap.buffer[0]
+	snap.buffer = snap.buffer[1:]
+	return entry, true
+}
+
+// fill loads the next batch of entries under the store lock
+func (snap *Snapshot) fill() {
+	s := snap.server
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	snap.buffer = snap.buffer[:0]
+	for !snap.liveDone && len(snap.buffer) < snapshotBatchSize {
+		key, kv, ok := snap.next()
+		if !ok {
+			snap.liveDone = true
+			break
+		}
+
+		if preserved, modified := snap.preserved[key]; modified {
+			if !preserved.emitted && preserved.kv != nil {
+				snap.buffer = append(snap.buffer, newSnapshotEntry(key, preserved.kv))
+			}
+			preserved.emitted = true
+			continue
+		}
+
+		kv.SnapshotID = snap.id
+		snap.buffer = append(snap.buffer, newSnapshotEntry(key, kv))
+	}
+
+	if snap.liveDone {
+		// Keys deleted from the live engine after the snapshot began
+		for key, preserved := range snap.preserved {
+			if !preserved.emitted && preserved.kv != nil {
+				snap.buffer = append(snap.buffer, newSnapshotEntry(key, preserved.kv))
+			}
+			preserved.emitted = true
+		}
+		snap.done = true
+	}
+}
+
+// newSnapshotEntry copies the fields of a stored key into a snapshot entry
+func newSnapshotEntry(key string, kv *store.KeyValue) SnapshotEntry {
+	return SnapshotEntry{Key: key, Value: stringValue(kv), ExpiresAt: kv.ExpiresAt}
+}
+
+// Close releases the snapshot so writers stop preserving pre-images
+func (snap *Snapshot) Close() {
+	s := snap.server
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.snapshot == snap {
+		s.snapshot = nil
+	}
+	snap.stop()
+	snap.done = true
+	snap.preserved = nil
+}
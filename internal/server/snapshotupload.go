@@ -0,0 +1,347 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// uploadTimeFormat names the uploaded snapshots, so that they sort by age
+const uploadTimeFormat = "20060102T150405.000Z"
+
+// An upload, pruning included, is abandoned after uploadTimeout plus a second per
+// uploadMinRate bytes of the dump file, so that a stalled endpoint can't hold up
+// the uploads of later saves forever
+const (
+	uploadTimeout = time.Minute
+	uploadMinRate = 1 << 20
+)
+
+// emptyPayloadHash is the SHA-256 of the empty body of the requests but uploads
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// uploadState tracks the uploads of the dump file to snapshot-upload-endpoint,
+// protected by the server mutex
+type uploadState struct {
+	inProgress bool
+	// pending is set when a BGSAVE completes during an upload, which then uploads
+	// the dump file again
+	pending    bool
+	lastOK     bool
+	lastTime   time.Time
+	lastObject string
+}
+
+// uploadTarget is the S3-compatible bucket snapshots are uploaded to, signing its
+// requests with AWS Signature Version 4 when there are credentials
+type uploadTarget struct {
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	region    string
+	accessKey string
+	secretKey string
+	retention int
+	client    *http.Client
+}
+
+// newUploadTarget reads the snapshot-upload settings, nil when uploads are disabled.
+// Must be called with the server mutex held.
+func (s *RedisServer) newUploadTarget() *uploadTarget {
+	if s.config.SnapshotUploadEndpoint == "" {
+		return nil
+	}
+	endpoint, _ := url.Parse(s.config.SnapshotUploadEndpoint)
+	return &uploadTarget{
+		endpoint: endpoint,
+		bucket:   s.config.SnapshotUploadBucket,
+		// Each snapshot is named after the dump file and the time of its upload
+		prefix:    s.config.SnapshotUploadPrefix + strings.TrimSuffix(s.config.DBFilename, ".rdb") + "-",
+		region:    s.config.SnapshotUploadRegion,
+		accessKey: s.config.SnapshotUploadAccessKey,
+		secretKey: s.config.SnapshotUploadSecretKey,
+		retention: s.config.SnapshotUploadRetention,
+		client:    http.DefaultClient,
+	}
+}
+
+// queueUpload uploads the dump file a BGSAVE just wrote, or has the upload in
+// progress upload it again once done
+func (s *RedisServer) queueUpload() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.config.SnapshotUploadEndpoint == "" {
+		return
+	}
+	if s.rdb.upload.inProgress {
+		s.rdb.upload.pending = true
+		return
+	}
+	s.rdb.upload.inProgress = true
+	go s.uploadLoop()
+}
+
+// uploadLoop uploads the dump file until no BGSAVE completed meanwhile
+func (s *RedisServer) uploadLoop() {
+	for {
+		s.mutex.RLock()
+		target, path := s.newUploadTarget(), s.rdbPath()
+		s.mutex.RUnlock()
+
+		var object string
+		var err error
+		if target != nil {
+			ctx, span := s.startSpan(s.ctx, "rdb.upload")
+			object, err = target.upload(ctx, path, time.Now())
+			endSpan(span, err)
+			if err != nil {
+				s.logger.Warn("Snapshot upload failed", "err", err)
+			} else {
+				s.logger.Info("Snapshot uploaded", "object", object)
+			}
+		}
+
+		s.mutex.Lock()
+		if target != nil {
+			s.rdb.upload.lastOK, s.rdb.upload.lastTime = err == nil, time.Now()
+			if object != "" {
+				s.rdb.upload.lastObject = object
+			}
+		}
+		again := s.rdb.upload.pending && s.ctx.Err() == nil
+		s.rdb.upload.pending = false
+		s.rdb.upload.inProgress = again
+		s.mutex.Unlock()
+		if !again {
+			return
+		}
+	}
+}
+
+// upload streams the dump file at path to a new object named after now, then
+// deletes the oldest snapshots beyond the retention. It returns the object's key.
+func (t *uploadTarget) upload(ctx context.Context, path string, now time.Time) (string, error) {
+	// A save replacing the dump file meanwhile renames another file over it, which
+	// leaves the one opened here intact
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, uploadTimeout+time.Duration(info.Size()/uploadMinRate)*time.Second)
+	defer cancel()
+
+	key := t.prefix + now.UTC().Format(uploadTimeFormat) + ".rdb"
+	response, err := t.do(ctx, http.MethodPut, key, nil, file, info.Size())
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+
+	if t.retention > 0 {
+		if err := t.prune(ctx); err != nil {
+			return key, fmt.Errorf("uploaded %s, but failed to delete old snapshots: %w", key, err)
+		}
+	}
+	return key, nil
+}
+
+// listBucketResult is the reply to ListObjectsV2
+type listBucketResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// prune deletes the oldest snapshots beyond the retention
+func (t *uploadTarget) prune(ctx context.Context) error {
+	var keys []string
+	query := url.Values{"list-type": {"2"}, "prefix": {t.prefix}}
+	for {
+		response, err := t.do(ctx, http.MethodGet, "", query, nil, 0)
+		if err != nil {
+			return err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+		if err != nil {
+			return fmt.Errorf("listing the snapshots: %w", err)
+		}
+		for _, object := range result.Contents {
+			if strings.HasSuffix(object.Key, ".rdb") {
+				keys = append(keys, object.Key)
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+
+	slices.Sort(keys)
+	for _, key := range keys[:max(len(keys)-t.retention, 0)] {
+		response, err := t.do(ctx, http.MethodDelete, key, nil, nil, 0)
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+	}
+	return nil
+}
+
+// s3Error is the body of a failed request
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+// do sends a request for an object of the bucket, or for the bucket itself when key
+// is empty, and fails unless it succeeds
+func (t *uploadTarget) do(ctx context.Context, method, key string, query url.Values, body *os.File, size int64) (*http.Response, error) {
+	u := *t.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + t.bucket + "/" + key
+	u.RawPath = strings.TrimSuffix(t.endpoint.EscapedPath(), "/") + "/" + uriEncode(t.bucket, false) + "/" + uriEncode(key, false)
+	u.RawQuery = canonicalQuery(query)
+
+	request, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	payloadHash := emptyPayloadHash
+	if body != nil {
+		// The snapshot is streamed rather than read twice to be hashed
+		request.Body, request.ContentLength = io.NopCloser(body), size
+		payloadHash = "UNSIGNED-PAYLOAD"
+	}
+	t.sign(request, payloadHash, time.Now())
+
+	response, err := t.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 300 {
+		return response, nil
+	}
+	defer response.Body.Close()
+	var failure s3Error
+	if xml.NewDecoder(io.LimitReader(response.Body, 64*1024)).Decode(&failure) == nil && failure.Code != "" {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, u.Path, failure.Code, failure.Message)
+	}
+	return nil, fmt.Errorf("%s %s: %s", method, u.Path, response.Status)
+}
+
+// sign adds the AWS Signature Version 4 headers of the request, unless there are no
+// credentials
+func (t *uploadTarget) sign(request *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if t.accessKey == "" {
+		return
+	}
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		"host:" + request.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	scope := amzDate[:8] + "/" + t.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + t.secretKey)
+	for _, part := range []string{amzDate[:8], t.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		t.accessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes a query string as Signature Version 4 signs it: sorted by
+// name, with every character but the unreserved ones escaped
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode escapes every byte but the unreserved characters, and slashes unless
+// encodeSlash is set
+func uriEncode(value string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// uploadInfo renders the state of the uploads for INFO persistence, when they are
+// enabled
+func uploadInfo(s *RedisServer) []string {
+	if s.config.SnapshotUploadEndpoint == "" {
+		return nil
+	}
+	status := "ok"
+	if s.rdb.upload.lastTime.IsZero() {
+		status = "none"
+	} else if !s.rdb.upload.lastOK {
+		status = "err"
+	}
+	var lastTime int64
+	if !s.rdb.upload.lastTime.IsZero() {
+		lastTime = s.rdb.upload.lastTime.Unix()
+	}
+	return []string{
+		fmt.Sprintf("snapshot_upload_in_progress:%d", boolToInt(s.rdb.upload.inProgress)),
+		fmt.Sprintf("snapshot_upload_last_status:%s", status),
+		fmt.Sprintf("snapshot_upload_last_time:%d", lastTime),
+		fmt.Sprintf("snapshot_upload_last_object:%s", s.rdb.upload.lastObject),
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"path/filepath"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+// OpenStorage switches the keyspace to the engine picked by storage-engine. The
+// server starts on an empty in-memory engine, so this must happen before serving.
+func (s *RedisServer) OpenStorage() error {
+	if s.config.StorageEngine != StorageDisk {
+		return nil
+	}
+	engine, err := store.OpenDiskEngine(filepath.Join(s.config.Dir, s.config.StorageDiskDir), s.config.StorageDiskCache)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data = engine
+
+	// Memory accounting, the namespaces and the prefix index cover the keys already
+	// stored
+	engine.Iterate(func(key string, kv *store.KeyValue) bool {
+		s.usedMemory += entrySize(key, kv)
+		if isSharedInteger(kv) {
+			s.stats.sharedIntegerKeys++
+		}
+		return true
+	})
+	s.prefixIndex = nil
+	s.syncPrefixIndex()
+	s.rebuildNamespaces()
+	return nil
+}
+
+// closeStorage closes the storage engine once no client is left to use it
+func (s *RedisServer) closeStorage() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.scanCursors.endIterations()
+	if err := s.data.Close(); err != nil {
+		s.logger.Warn("Error closing the storage engine", "err", err)
+	}
+}
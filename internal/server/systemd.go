@@ -0,0 +1,93 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// sdListenFdsStart is the first descriptor passed by systemd socket activation
+const sdListenFdsStart = 3
+
+// activatedListeners are the listening sockets inherited from systemd
+type activatedListeners struct {
+	tcp  []net.Listener
+	tls  []net.Listener // sockets named "tls" with FileDescriptorName=
+	unix []net.Listener
+}
+
+// inheritListeners returns the sockets passed by systemd socket activation (LISTEN_PID,
+// LISTEN_FDS and LISTEN_FDNAMES), or nil when the server wasn't socket activated. The
+// variables are cleared so processes started by the server don't inherit them.
+func inheritListeners() (*activatedListeners, error) {
+	pid, count := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	if pid == "" || count == "" || pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS '%s'", count)
+	}
+
+	activated := &activatedListeners{}
+	for i := 0; i < n; i++ {
+		file := os.NewFile(uintptr(sdListenFdsStart+i), "listen-fd-"+strconv.Itoa(i))
+		listener, err := net.FileListener(file)
+		file.Close() // FileListener works on a duplicate
+		if err != nil {
+			activated.close()
+			return nil, fmt.Errorf("inherited descriptor %d: %w", sdListenFdsStart+i, err)
+		}
+
+		switch {
+		case listener.Addr().Network() == "unix":
+			activated.unix = append(activated.unix, listener)
+		case i < len(names) && names[i] == "tls":
+			activated.tls = append(activated.tls, listener)
+		default:
+			activated.tcp = append(activated.tcp, listener)
+		}
+	}
+	return activated, nil
+}
+
+// close closes every inherited listener
+func (a *activatedListeners) close() {
+	closeListeners(a.tcp)
+	closeListeners(a.tls)
+	closeListeners(a.unix)
+}
+
+// notifySupervisor sends a state change such as "READY=1" to systemd when the server
+// is supervised by it, through the datagram socket named by NOTIFY_SOCKET
+func notifySupervisor(config *Config, state string, logger *slog.Logger) {
+	if config.Supervised == SupervisedNo {
+		return
+	}
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		if config.Supervised == SupervisedSystemd {
+			logger.Warn("Supervised by systemd, but NOTIFY_SOCKET is not set")
+		}
+		return
+	}
+
+	// A leading "@" names an abstract socket, which net handles natively
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		logger.Warn("Failed to notify systemd", "err", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		logger.Warn("Failed to notify systemd", "err", err)
+	}
+}
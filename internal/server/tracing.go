@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName identifies the server's instrumentation in the spans it produces
+const tracerName = "github.com/codecrafters-io/redis-starter-go/internal/server"
+
+// OpenTracing starts exporting spans to tracing-endpoint over OTLP/HTTP, sampling
+// tracing-sample-ratio of the traces started here; traces propagated from elsewhere
+// keep their own sampling decision. Tracing stays off when the endpoint is empty.
+// The standard OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES variables apply.
+func (s *RedisServer) OpenTracing(ctx context.Context) error {
+	s.mutex.RLock()
+	endpoint, ratio := s.config.TracingEndpoint, s.config.TracingSampleRatio
+	s.mutex.RUnlock()
+	if endpoint == "" {
+		return nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return err
+	}
+	res, err := resource.Merge(
+		resource.NewSchemaless(attribute.String("service.name", "redis-server")),
+		resource.Environment(),
+	)
+	if err != nil {
+		return err
+	}
+	s.tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	s.tracer = s.tracerProvider.Tracer(tracerName)
+	return nil
+}
+
+// CloseTracing exports the spans still buffered, if OpenTracing started tracing
+func (s *RedisServer) CloseTracing(ctx context.Context) {
+	if s.tracerProvider != nil {
+		s.tracerProvider.Shutdown(ctx)
+	}
+}
+
+// SetTracerProvider has the server trace through provider, for embedders with their
+// own OpenTelemetry setup. It must be called before serving.
+func (s *RedisServer) SetTracerProvider(provider trace.TracerProvider) {
+	s.tracer = provider.Tracer(tracerName)
+}
+
+// startSpan starts a span when tracing is enabled, otherwise returns a no-op span
+func (s *RedisServer) startSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if s.tracer == nil {
+		return ctx, noop.Span{}
+	}
+	return s.tracer.Start(ctx, name, opts...)
+}
+
+// endSpan records err, if any, and ends span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceCommand starts the span of a command, child of any span in ctx, and returns
+// the function ending it once the reply is written. Must only be called with
+// tracing enabled.
+func (s *RedisServer) traceCommand(ctx context.Context, cmd []string, writer *resp.Writer) (context.Context, func()) {
+	name := strings.ToUpper(cmd[0])
+	keys := 0
+	if command, exists := s.lookupCommand(name); exists {
+		keys = command.Keys.keyCount(len(cmd))
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system.name", "redis"),
+		attribute.String("db.operation.name", name),
+		attribute.String("db.namespace", "0"),
+		attribute.Int("redis.keys.count", keys),
+	}
+	if client, ok := ClientFromContext(ctx); ok {
+		attrs = append(attrs, attribute.Int64("redis.client.id", client.ID), attribute.String("client.address", client.Addr))
+	}
+	ctx, span := s.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+
+	written := writer.Written()
+	errors, _ := writer.Errors()
+	return ctx, func() {
+		span.SetAttributes(attribute.Int64("redis.reply.size", writer.Written()-written))
+		if count, last := writer.Errors(); count > errors {
+			span.SetAttributes(attribute.String("error.type", errorCode(last)))
+			span.SetStatus(codes.Error, last)
+		}
+		span.End()
+	}
+}
+
+// errorCodes are the codes error replies may start with, as in "WRONGTYPE ...". Other
+// replies, such as "COUNT must be positive", are generic errors even when their
+// first word is uppercase.
+var errorCodes = map[string]bool{
+	"ERR": true, "WRONGTYPE": true, "NOAUTH": true, "WRONGPASS": true, "NOPERM": true,
+	"NOPROTO": true, "OOM": true, "LOADING": true, "BUSY": true, "BUSYKEY": true,
+	"READONLY": true, "EXECABORT": true, "NOSCRIPT": true, "MISCONF": true,
+}
+
+// errorCode returns the code of an error reply: its first word when one of
+// errorCodes, otherwise ERR
+func errorCode(msg string) string {
+	code, _, _ := strings.Cut(msg, " ")
+	if !errorCodes[code] {
+		return "ERR"
+	}
+	return code
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// errWrongType is the reply to commands run against a key holding another type of value
+const errWrongType = "WRONGTYPE Operation against a key holding the wrong kind of value"
+
+// lookupKeyOfType is lookupKey for commands operating on values of type t: a key
+// holding another type is reported through wrongType, as Redis does after recording
+// the access. Must be called with the server mutex held for writing.
+func (s *RedisServer) lookupKeyOfType(ctx context.Context, key string, t store.ObjectType) (kv *store.KeyValue, exists, wrongType bool) {
+	kv, exists = s.lookupKey(ctx, key)
+	if exists && kv.Value.Type() != t {
+		return nil, false, true
+	}
+	return kv, exists, false
+}
+
+// lookupKeyReadOfType is lookupKeyOfType for commands reading the key. A key of the
+// wrong type counts as a hit, as it was found.
+// Must be called with the server mutex held for writing.
+func (s *RedisServer) lookupKeyReadOfType(ctx context.Context, key string, t store.ObjectType) (kv *store.KeyValue, exists, wrongType bool) {
+	kv, exists, wrongType = s.lookupKeyOfType(ctx, key, t)
+	s.countLookup(exists || wrongType)
+	return kv, exists, wrongType
+}
+
+// stringValue returns the value of a key holding a string
+func stringValue(kv *store.KeyValue) string {
+	return kv.Value.(*store.StringObject).Value
+}
+
+// isSharedInteger reports whether a key's value references a shared integer string
+func isSharedInteger(kv *store.KeyValue) bool {
+	str, ok := kv.Value.(*store.StringObject)
+	return ok && str.Shared
+}
+
+// TypeHandler handles TYPE commands
+type TypeHandler struct {
+	server *RedisServer
+}
+
+func (h *TypeHandler) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	key := args[1]
+
+	h.server.mutex.Lock()
+	// Like OBJECT, TYPE inspects the key without counting as an access
+	h.server.cleanupExpired(key)
+	kv, exists := h.server.data.Get(key)
+	h.server.countLookup(exists)
+	typeName := "none"
+	if exists {
+		typeName = kv.Value.Type().String()
+	}
+	h.server.mutex.Unlock()
+
+	return writer.WriteSimpleString(typeName)
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// watchdogInterval is how often the watchdog checks how long the store lock has
+// been held
+const watchdogInterval = 100 * time.Millisecond
+
+// watchdogEvent is the LATENCY event recording the store lock held beyond
+// watchdog-threshold
+const watchdogEvent = "watchdog"
+
+// watchdogStackBuffer bounds the goroutine dump logged by the watchdog
+const watchdogStackBuffer = 1 << 20
+
+// storeLock is the server mutex. While the watchdog is enabled it records since
+// when it has been held for writing and since when writers have been waiting for
+// it, so that a command freezing every other one is noticed, be it a writer or a
+// reader such as KEYS on a large keyspace. Readers aren't timed themselves: many
+// short ones may overlap for long without blocking anybody.
+type storeLock struct {
+	sync.RWMutex
+
+	// threshold mirrors watchdog-threshold in nanoseconds, 0 when disabled
+	threshold atomic.Int64
+	// lockedAt is when the write lock was taken and waitingSince when the writers
+	// waiting for it started to, in unix nanoseconds, 0 when untracked
+	lockedAt     atomic.Int64
+	waitingSince atomic.Int64
+	waiters      atomic.Int64
+	// reported is set once the watchdog logged the current block
+	reported atomic.Bool
+
+	// latency records the blocks beyond the threshold as they end
+	latency *latencyMonitor
+}
+
+func (l *storeLock) Lock() {
+	if l.threshold.Load() == 0 {
+		l.RWMutex.Lock()
+		return
+	}
+	if l.waiters.Add(1) == 1 {
+		l.waitingSince.Store(time.Now().UnixNano())
+	}
+	l.RWMutex.Lock()
+	now := time.Now()
+	waitingSince := l.waitingSince.Load()
+	// The writers still waiting now wait for this one
+	if l.waiters.Add(-1) == 0 {
+		l.waitingSince.Store(0)
+	} else {
+		l.waitingSince.Store(now.UnixNano())
+	}
+	l.lockedAt.Store(now.UnixNano())
+	if waitingSince != 0 {
+		l.recordBlock(time.Duration(now.UnixNano()-waitingSince), now)
+	}
+}
+
+func (l *storeLock) Unlock() {
+	if lockedAt := l.lockedAt.Swap(0); lockedAt != 0 {
+		now := time.Now()
+		l.recordBlock(time.Duration(now.UnixNano()-lockedAt), now)
+		l.reported.Store(false)
+	}
+	l.RWMutex.Unlock()
+}
+
+// recordBlock records in LATENCY a block of the lock beyond the threshold
+func (l *storeLock) recordBlock(blocked time.Duration, now time.Time) {
+	if threshold := time.Duration(l.threshold.Load()); threshold > 0 && blocked >= threshold && l.latency != nil {
+		l.latency.record(watchdogEvent, blocked, now)
+	}
+}
+
+// overdue returns how long the lock has been unavailable to writers, and whether
+// that is beyond the threshold
+func (l *storeLock) overdue() (time.Duration, bool) {
+	threshold := time.Duration(l.threshold.Load())
+	if threshold == 0 {
+		return 0, false
+	}
+	now := time.Now().UnixNano()
+	var blocked time.Duration
+	for _, since := range []int64{l.lockedAt.Load(), l.waitingSince.Load()} {
+		if since != 0 {
+			blocked = max(blocked, time.Duration(now-since))
+		}
+	}
+	return blocked, blocked >= threshold
+}
+
+// syncWatchdog applies watchdog-threshold.
+// Must be called with the server mutex held.
+func (s *RedisServer) syncWatchdog() {
+	s.mutex.threshold.Store(int64(time.Duration(s.config.WatchdogThreshold) * time.Millisecond))
+}
+
+// watchdog logs the blocks of the store lock beyond watchdog-threshold while they
+// last, once each, with the stacks of the commands that may be holding it
+func (s *RedisServer) watchdog() {
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stopped:
+			return
+		}
+
+		blocked, overdue := s.mutex.overdue()
+		if !overdue || s.mutex.reported.Swap(true) {
+			continue
+		}
+		s.logger.Warn("The keyspace has been locked beyond watchdog-threshold, commands are replied -BUSY",
+			"blocked", blocked.Round(time.Millisecond), "stacks", commandStacks())
+	}
+}
+
+// errBusy is the reply to commands arriving while the store lock is blocked beyond
+// watchdog-threshold
+func errBusy(blocked time.Duration) string {
+	return fmt.Sprintf("BUSY The keyspace has been locked by a command for %d ms. Try again later.", blocked.Milliseconds())
+}
+
+// commandStacks returns the stacks of the goroutines running a command without
+// waiting for a lock, among which is usually the one holding the store lock, or
+// every stack when there is none
+func commandStacks() string {
+	buf := make([]byte, watchdogStackBuffer)
+	dump := string(buf[:runtime.Stack(buf, true)])
+	var stacks []string
+	for _, stack := range strings.Split(dump, "\n\n") {
+		if strings.Contains(stack, ".(*RedisServer).execute(") && !strings.Contains(stack, "runtime_Semacquire") {
+			stacks = append(stacks, stack)
+		}
+	}
+	if len(stacks) == 0 {
+		return dump
+	}
+	return strings.Join(stacks, "\n\n")
+}
@@ -0,0 +1,41 @@
+package server
+
+// WorkerPool executes commands on a fixed number of goroutines, bounding how many run
+// at once, and thus the lock contention and the stack they grow, however many clients
+// send commands together. It does nothing for idle connections: each keeps its own
+// goroutine, parked reading its socket, which the event-loop model avoids.
+type WorkerPool struct {
+	jobs chan func()
+}
+
+// NewWorkerPool starts a pool with the given number of workers
+func NewWorkerPool(size int) *WorkerPool {
+	pool := &WorkerPool{jobs: make(chan func(), size)}
+	for i := 0; i < size; i++ {
+		go pool.work()
+	}
+	return pool
+}
+
+// work runs jobs until the pool is closed
+func (p *WorkerPool) work() {
+	for job := range p.jobs {
+		job()
+	}
+}
+
+// Run executes fn on a worker and waits for it to complete. Because the caller
+// blocks, commands from one connection run strictly in order and replies never reorder.
+func (p *WorkerPool) Run(fn func()) {
+	done := make(chan struct{})
+	p.jobs <- func() {
+		defer close(done)
+		fn()
+	}
+	<-done
+}
+
+// Close stops the workers once queued jobs have run
+func (p *WorkerPool) Close() {
+	close(p.jobs)
+}
@@ -0,0 +1,172 @@
+package store
+
+import (
+	"iter"
+	"maps"
+)
+
+// Engine holds the keyspace. The server serializes every call with its own lock, so
+// implementations needn't be safe for concurrent use. Entries are handed out by
+// pointer and the server updates their access metadata in place, then hands them
+// to Touch for engines that return copies.
+type Engine interface {
+	// Get returns the entry stored under key
+	Get(key string) (*KeyValue, bool)
+	// Set stores kv under key, replacing any previous entry
+	Set(key string, kv *KeyValue)
+	// Delete removes key and returns the entry it held
+	Delete(key string) (*KeyValue, bool)
+	// Touch stores the access metadata of kv, an entry Get returned for key and
+	// which is still stored, without changing its value or expiry
+	Touch(key string, kv *KeyValue)
+	// Expire sets the expiry of key in unix milliseconds, 0 to remove it, and
+	// reports whether the key exists
+	Expire(key string, expiresAt int64) bool
+
+	// Len returns the number of keys, VolatileLen the number of keys with an expiry
+	Len() int
+	VolatileLen() int
+	// ExpirySum returns the sum of the expiry times of the keys with one, in unix
+	// seconds, from which the server derives their average TTL
+	ExpirySum() int64
+
+	// Iterate calls fn for every key until it returns false
+	Iterate(fn func(key string, kv *KeyValue) bool)
+	// Sample is Iterate starting at a random key, over the keys with an expiry only
+	// when volatile is set. Eviction stops after a handful of keys.
+	Sample(volatile bool, fn func(key string, kv *KeyValue) bool)
+	// Snapshot returns a sequence over every key that may be pulled a step at a
+	// time while the engine is modified in between: keys present throughout are
+	// returned exactly once, keys added or removed meanwhile at most once.
+	// pointInTime reports whether it returns them as they were when Snapshot was
+	// called, otherwise the server preserves the pre-image of the keys it changes.
+	Snapshot() (entries iter.Seq2[string, *KeyValue], pointInTime bool)
+
+	// Flush empties the engine. Open snapshots keep iterating the former content.
+	Flush()
+
+	// Close releases the engine once the server is done with it
+	Close() error
+}
+
+// MemoryEngine is the default Engine: a pair of Go maps, one with every key and one
+// with the keys that have an expiry
+type MemoryEngine struct {
+	data      map[string]*KeyValue
+	expires   map[string]*KeyValue
+	expirySum int64
+}
+
+// expirySeconds is the contribution of an expiry to ExpirySum
+func expirySeconds(expiresAt int64) int64 {
+	return expiresAt / 1000
+}
+
+// NewMemoryEngine returns an empty in-memory engine
+func NewMemoryEngine() *MemoryEngine {
+	return &MemoryEngine{
+		data:    make(map[string]*KeyValue),
+		expires: make(map[string]*KeyValue),
+	}
+}
+
+func (e *MemoryEngine) Get(key string) (*KeyValue, bool) {
+	kv, exists := e.data[key]
+	return kv, exists
+}
+
+func (e *MemoryEngine) Set(key string, kv *KeyValue) {
+	if old, exists := e.expires[key]; exists {
+		e.expirySum -= expirySeconds(old.ExpiresAt)
+	}
+	e.data[key] = kv
+	if kv.ExpiresAt != 0 {
+		e.expires[key] = kv
+		e.expirySum += expirySeconds(kv.ExpiresAt)
+	} else {
+		delete(e.expires, key)
+	}
+}
+
+func (e *MemoryEngine) Delete(key string) (*KeyValue, bool) {
+	kv, exists := e.data[key]
+	if !exists {
+		return nil, false
+	}
+	delete(e.data, key)
+	if kv.ExpiresAt != 0 {
+		delete(e.expires, key)
+		e.expirySum -= expirySeconds(kv.ExpiresAt)
+	}
+	return kv, true
+}
+
+// Touch does nothing, as the entries handed out are the stored ones
+func (e *MemoryEngine) Touch(key string, kv *KeyValue) {}
+
+func (e *MemoryEngine) Expire(key string, expiresAt int64) bool {
+	kv, exists := e.data[key]
+	if !exists {
+		return false
+	}
+	// The entry is updated in place, so its former expiry is accounted for first
+	if kv.ExpiresAt != 0 {
+		delete(e.expires, key)
+		e.expirySum -= expirySeconds(kv.ExpiresAt)
+	}
+	kv.ExpiresAt = expiresAt
+	e.Set(key, kv)
+	return true
+}
+
+func (e *MemoryEngine) Len() int {
+	return len(e.data)
+}
+
+func (e *MemoryEngine) VolatileLen() int {
+	return len(e.expires)
+}
+
+func (e *MemoryEngine) ExpirySum() int64 {
+	return e.expirySum
+}
+
+func (e *MemoryEngine) Iterate(fn func(key string, kv *KeyValue) bool) {
+	for key, kv := range e.data {
+		if !fn(key, kv) {
+			return
+		}
+	}
+}
+
+// Sample relies on Go map iteration starting at a random position
+func (e *MemoryEngine) Sample(volatile bool, fn func(key string, kv *KeyValue) bool) {
+	pool := e.data
+	if volatile {
+		pool = e.expires
+	}
+	for key, kv := range pool {
+		if !fn(key, kv) {
+			return
+		}
+	}
+}
+
+// Snapshot ranges over the live map, which the Go specification allows to be
+// modified between steps with exactly the guarantees Engine asks for
+func (e *MemoryEngine) Snapshot() (iter.Seq2[string, *KeyValue], bool) {
+	return maps.All(e.data), false
+}
+
+// Flush swaps in new maps, leaving the old ones to open snapshots
+// Flush swaps in empty maps, leaving the former ones to open snapshots and the
+// garbage collector
+func (e *MemoryEngine) Flush() {
+	e.data = make(map[string]*KeyValue)
+	e.expires = make(map[string]*KeyValue)
+	e.expirySum = 0
+}
+
+func (e *MemoryEngine) Close() error {
+	return nil
+}
@@ -0,0 +1,54 @@
+package store
+
+// KeyValue represents a stored value with optional expiry
+type KeyValue struct {
+	Value Object
+	// ExpiresAt is the unix time in milliseconds when the key expires, 0 if it never does
+	ExpiresAt int64
+	// AccessedAt is the unix time in milliseconds of the last access, used for LRU eviction
+	AccessedAt int64
+	// Freq is the logarithmic access counter used for LFU eviction
+	Freq uint8
+	// FreqDecayedAt is the unix time in minutes when Freq was last decayed
+	FreqDecayedAt int64
+
+	// SnapshotID is the id of the last snapshot that returned this entry
+	SnapshotID uint64
+}
+
+// entrySlabSize is the number of entries allocated together in one slab
+const entrySlabSize = 256
+
+// maxFreeEntries bounds the free list so a mass delete doesn't pin memory forever
+const maxFreeEntries = 64 * 1024
+
+// Allocator hands out KeyValue structs carved from slabs and recycles released
+// ones, so a write-heavy workload makes one allocation per slab instead of one per
+// SET. Must be used with the server mutex held for writing.
+type Allocator struct {
+	slab []KeyValue
+	free []*KeyValue
+}
+
+// New returns a zeroed entry
+func (a *Allocator) New() *KeyValue {
+	if n := len(a.free); n > 0 {
+		kv := a.free[n-1]
+		a.free = a.free[:n-1]
+		return kv
+	}
+	if len(a.slab) == 0 {
+		a.slab = make([]KeyValue, entrySlabSize)
+	}
+	kv := &a.slab[0]
+	a.slab = a.slab[1:]
+	return kv
+}
+
+// Release returns an entry that is no longer referenced by the keyspace
+func (a *Allocator) Release(kv *KeyValue) {
+	*kv = KeyValue{}
+	if len(a.free) < maxFreeEntries {
+		a.free = append(a.free, kv)
+	}
+}
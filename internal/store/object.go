@@ -0,0 +1,75 @@
+package store
+
+// ObjectType is the type of the value stored under a key
+type ObjectType uint8
+
+// The types of Redis, in the order of its own. Only strings are implemented yet; the
+// others are declared so that the commands and the type checks of every data
+// structure share them.
+const (
+	// ObjString is a binary-safe string, which INCR and friends read as an integer
+	ObjString ObjectType = iota
+	// ObjList is a list of strings, in insertion order
+	ObjList
+	// ObjSet is an unordered set of unique strings
+	ObjSet
+	// ObjZSet is a set of unique strings ordered by score
+	ObjZSet
+	// ObjHash is a map of fields to strings
+	ObjHash
+	// ObjStream is an append-only log of entries
+	ObjStream
+)
+
+// String returns the name TYPE reports for t
+func (t ObjectType) String() string {
+	switch t {
+	case ObjString:
+		return "string"
+	case ObjList:
+		return "list"
+	case ObjSet:
+		return "set"
+	case ObjZSet:
+		return "zset"
+	case ObjHash:
+		return "hash"
+	case ObjStream:
+		return "stream"
+	default:
+		return "unknown"
+	}
+}
+
+// Object is a value stored under a key. Each type of value implements it, so
+// commands check the type of a key before touching its value.
+type Object interface {
+	// Type returns the type of the value
+	Type() ObjectType
+	// Size estimates the memory held by the value, in bytes
+	Size() int64
+}
+
+// StringObject is a string value. It is immutable: writes replace the object.
+type StringObject struct {
+	Value string
+	// Shared is set when Value references a shared integer string
+	Shared bool
+}
+
+// NewString returns a string object holding value
+func NewString(value string) *StringObject {
+	return &StringObject{Value: value}
+}
+
+func (o *StringObject) Type() ObjectType {
+	return ObjString
+}
+
+// Size is zero for shared integers, which are owned by the shared table
+func (o *StringObject) Size() int64 {
+	if o.Shared {
+		return 0
+	}
+	return int64(len(o.Value))
+}
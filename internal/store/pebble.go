@@ -0,0 +1,362 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"iter"
+	"math/rand/v2"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// Key layout of the disk engine. Every key has a record under the data prefix; keys
+// with an expiry also have an entry in the expiry column, so that volatile keys can
+// be sampled without scanning the whole keyspace. The counters live under meta.
+const (
+	diskDataPrefix   = 'k'
+	diskExpiryPrefix = 'x'
+	diskMetaPrefix   = 'm'
+)
+
+var (
+	diskLenKey       = []byte{diskMetaPrefix, 'l'}
+	diskVolatileKey  = []byte{diskMetaPrefix, 'v'}
+	diskExpirySumKey = []byte{diskMetaPrefix, 's'}
+)
+
+// diskRecordHeader is the size of the fields stored ahead of the value: the expiry
+// in unix milliseconds and a byte holding the flags and, in its high nibble, the
+// object type
+const diskRecordHeader = 9
+
+// diskRecordShared flags a value that was a shared integer when stored
+const diskRecordShared = 1
+
+// diskRecordAccess flags a record whose header goes on with the access metadata:
+// the last access in unix milliseconds, the time Freq was last decayed in unix
+// minutes and Freq itself. Records written before it was added have none.
+const diskRecordAccess = 2
+
+// diskRecordAccessSize is the size of the access metadata
+const diskRecordAccessSize = 17
+
+// diskRecordTypeShift positions the object type in the flags byte
+const diskRecordTypeShift = 4
+
+// DiskEngine is an Engine backed by Pebble, an embedded LSM store: only the block
+// cache and memtables stay in memory, so the dataset can outgrow RAM. Writes go to
+// the write-ahead log without an fsync, so a machine crash may lose the last writes
+// but a process crash doesn't. Storage failures panic, as the keyspace can't be
+// trusted any more.
+type DiskEngine struct {
+	db *pebble.DB
+
+	// Key counts and the sum of the expiry times, mirrored in the meta records
+	keys      int
+	volatile  int
+	expirySum int64
+}
+
+// OpenDiskEngine opens or creates the engine stored in dir, with a block cache of
+// cacheSize bytes
+func OpenDiskEngine(dir string, cacheSize int64) (*DiskEngine, error) {
+	cache := pebble.NewCache(cacheSize)
+	defer cache.Unref()
+
+	db, err := pebble.Open(dir, &pebble.Options{Cache: cache})
+	if err != nil {
+		return nil, err
+	}
+	e := &DiskEngine{db: db}
+	if e.keys, err = e.readCounter(diskLenKey); err == nil {
+		e.volatile, err = e.readCounter(diskVolatileKey)
+	}
+	if err == nil {
+		e.expirySum, err = e.readExpirySum()
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// readCounter returns the meta counter stored under key, 0 if there is none
+func (e *DiskEngine) readCounter(key []byte) (int, error) {
+	value, closer, err := e.db.Get(key)
+	if errors.Is(err, pebble.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer closer.Close()
+	if len(value) != 8 {
+		return 0, fmt.Errorf("corrupt counter %q", key)
+	}
+	return int(binary.LittleEndian.Uint64(value)), nil
+}
+
+// readExpirySum returns the sum of the expiry times, computed from the expiry column
+// for stores written before it had a counter
+func (e *DiskEngine) readExpirySum() (int64, error) {
+	value, closer, err := e.db.Get(diskExpirySumKey)
+	if err == nil {
+		defer closer.Close()
+		if len(value) != 8 {
+			return 0, fmt.Errorf("corrupt counter %q", diskExpirySumKey)
+		}
+		return int64(binary.LittleEndian.Uint64(value)), nil
+	}
+	if !errors.Is(err, pebble.ErrNotFound) {
+		return 0, err
+	}
+
+	it, err := e.db.NewIter(prefixBounds(diskExpiryPrefix))
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+	var sum int64
+	for valid := it.First(); valid; valid = it.Next() {
+		sum += expirySeconds(int64(binary.LittleEndian.Uint64(it.Value())))
+	}
+	return sum, it.Error()
+}
+
+// prefixed returns key under the given prefix
+func prefixed(prefix byte, key string) []byte {
+	b := make([]byte, 0, len(key)+1)
+	b = append(b, prefix)
+	return append(b, key...)
+}
+
+// prefixBounds returns the iterator bounds covering every key under prefix
+func prefixBounds(prefix byte) *pebble.IterOptions {
+	return &pebble.IterOptions{LowerBound: []byte{prefix}, UpperBound: []byte{prefix + 1}}
+}
+
+// encodeRecord lays out an entry as stored under the data prefix
+func encodeRecord(kv *KeyValue) []byte {
+	str, ok := kv.Value.(*StringObject)
+	if !ok {
+		panic(fmt.Sprintf("storage engine: can't store %s values", kv.Value.Type()))
+	}
+	b := make([]byte, diskRecordHeader, diskRecordHeader+diskRecordAccessSize+len(str.Value))
+	binary.LittleEndian.PutUint64(b, uint64(kv.ExpiresAt))
+	b[8] = byte(ObjString)<<diskRecordTypeShift | diskRecordAccess
+	if str.Shared {
+		b[8] |= diskRecordShared
+	}
+	b = binary.LittleEndian.AppendUint64(b, uint64(kv.AccessedAt))
+	b = binary.LittleEndian.AppendUint64(b, uint64(kv.FreqDecayedAt))
+	b = append(b, kv.Freq)
+	return append(b, str.Value...)
+}
+
+// decodeRecord rebuilds an entry from its stored record
+func decodeRecord(b []byte) *KeyValue {
+	if len(b) < diskRecordHeader {
+		panic(fmt.Sprintf("storage engine: corrupt record of %d bytes", len(b)))
+	}
+	if typ := ObjectType(b[8] >> diskRecordTypeShift); typ != ObjString {
+		panic(fmt.Sprintf("storage engine: corrupt record of type %d", typ))
+	}
+	kv := &KeyValue{ExpiresAt: int64(binary.LittleEndian.Uint64(b))}
+	flags, value := b[8], b[diskRecordHeader:]
+	if flags&diskRecordAccess != 0 {
+		if len(value) < diskRecordAccessSize {
+			panic(fmt.Sprintf("storage engine: corrupt record of %d bytes", len(b)))
+		}
+		kv.AccessedAt = int64(binary.LittleEndian.Uint64(value))
+		kv.FreqDecayedAt = int64(binary.LittleEndian.Uint64(value[8:]))
+		kv.Freq = value[16]
+		value = value[diskRecordAccessSize:]
+	}
+	kv.Value = &StringObject{Value: string(value), Shared: flags&diskRecordShared != 0}
+	return kv
+}
+
+// check panics on storage errors
+func check(err error) {
+	if err != nil {
+		panic(fmt.Sprintf("storage engine: %v", err))
+	}
+}
+
+func (e *DiskEngine) Get(key string) (*KeyValue, bool) {
+	value, closer, err := e.db.Get(prefixed(diskDataPrefix, key))
+	if errors.Is(err, pebble.ErrNotFound) {
+		return nil, false
+	}
+	check(err)
+	defer closer.Close()
+	return decodeRecord(value), true
+}
+
+func (e *DiskEngine) Set(key string, kv *KeyValue) {
+	keys, volatile, expirySum := e.keys, e.volatile, e.expirySum
+	if old, exists := e.Get(key); exists {
+		if old.ExpiresAt != 0 {
+			volatile--
+			expirySum -= expirySeconds(old.ExpiresAt)
+		}
+	} else {
+		keys++
+	}
+
+	batch := e.db.NewBatch()
+	defer batch.Close()
+	check(batch.Set(prefixed(diskDataPrefix, key), encodeRecord(kv), nil))
+	if kv.ExpiresAt != 0 {
+		volatile++
+		expirySum += expirySeconds(kv.ExpiresAt)
+		check(batch.Set(prefixed(diskExpiryPrefix, key), binary.LittleEndian.AppendUint64(nil, uint64(kv.ExpiresAt)), nil))
+	} else {
+		check(batch.Delete(prefixed(diskExpiryPrefix, key), nil))
+	}
+	e.commit(batch, keys, volatile, expirySum)
+}
+
+func (e *DiskEngine) Delete(key string) (*KeyValue, bool) {
+	kv, exists := e.Get(key)
+	if !exists {
+		return nil, false
+	}
+	volatile, expirySum := e.volatile, e.expirySum
+	if kv.ExpiresAt != 0 {
+		volatile--
+		expirySum -= expirySeconds(kv.ExpiresAt)
+	}
+
+	batch := e.db.NewBatch()
+	defer batch.Close()
+	check(batch.Delete(prefixed(diskDataPrefix, key), nil))
+	check(batch.Delete(prefixed(diskExpiryPrefix, key), nil))
+	e.commit(batch, e.keys-1, volatile, expirySum)
+	return kv, true
+}
+
+func (e *DiskEngine) Touch(key string, kv *KeyValue) {
+	check(e.db.Set(prefixed(diskDataPrefix, key), encodeRecord(kv), pebble.NoSync))
+}
+
+func (e *DiskEngine) Expire(key string, expiresAt int64) bool {
+	kv, exists := e.Get(key)
+	if !exists {
+		return false
+	}
+	kv.ExpiresAt = expiresAt
+	e.Set(key, kv)
+	return true
+}
+
+// commit applies batch along with the updated counters
+func (e *DiskEngine) commit(batch *pebble.Batch, keys, volatile int, expirySum int64) {
+	check(batch.Set(diskLenKey, binary.LittleEndian.AppendUint64(nil, uint64(keys)), nil))
+	check(batch.Set(diskVolatileKey, binary.LittleEndian.AppendUint64(nil, uint64(volatile)), nil))
+	check(batch.Set(diskExpirySumKey, binary.LittleEndian.AppendUint64(nil, uint64(expirySum)), nil))
+	check(batch.Commit(pebble.NoSync))
+	e.keys, e.volatile, e.expirySum = keys, volatile, expirySum
+}
+
+func (e *DiskEngine) Len() int {
+	return e.keys
+}
+
+func (e *DiskEngine) VolatileLen() int {
+	return e.volatile
+}
+
+func (e *DiskEngine) ExpirySum() int64 {
+	return e.expirySum
+}
+
+func (e *DiskEngine) Iterate(fn func(key string, kv *KeyValue) bool) {
+	it, err := e.db.NewIter(prefixBounds(diskDataPrefix))
+	check(err)
+	defer it.Close()
+	for valid := it.First(); valid; valid = it.Next() {
+		if !fn(string(it.Key()[1:]), decodeRecord(it.Value())) {
+			return
+		}
+	}
+	check(it.Error())
+}
+
+// Sample seeks to a random position and wraps around at the end of the column
+func (e *DiskEngine) Sample(volatile bool, fn func(key string, kv *KeyValue) bool) {
+	prefix := byte(diskDataPrefix)
+	if volatile {
+		prefix = diskExpiryPrefix
+	}
+	it, err := e.db.NewIter(prefixBounds(prefix))
+	check(err)
+	defer it.Close()
+
+	start := binary.BigEndian.AppendUint64([]byte{prefix}, rand.Uint64())
+	valid := it.SeekGE(start)
+	for wrapped := false; ; valid = it.Next() {
+		if !valid {
+			if wrapped {
+				break
+			}
+			wrapped = true
+			if valid = it.First(); !valid {
+				break
+			}
+		}
+		// Back at the start position: every key has been visited
+		if wrapped && string(it.Key()) >= string(start) {
+			break
+		}
+
+		key := string(it.Key()[1:])
+		kv, exists := e.Get(key)
+		if !volatile {
+			kv, exists = decodeRecord(it.Value()), true
+		}
+		if exists && !fn(key, kv) {
+			return
+		}
+	}
+	check(it.Error())
+}
+
+// Snapshot iterates a Pebble snapshot, which already returns every key as it was
+// when Snapshot was called
+func (e *DiskEngine) Snapshot() (iter.Seq2[string, *KeyValue], bool) {
+	snap := e.db.NewSnapshot()
+	return func(yield func(string, *KeyValue) bool) {
+		defer snap.Close()
+		it, err := snap.NewIter(prefixBounds(diskDataPrefix))
+		check(err)
+		defer it.Close()
+		for valid := it.First(); valid; valid = it.Next() {
+			if !yield(string(it.Key()[1:]), decodeRecord(it.Value())) {
+				return
+			}
+		}
+		check(it.Error())
+	}, true
+}
+
+// Flush deletes the data and expiry columns with range tombstones; the space is
+// reclaimed by compactions, so there is nothing left to release
+func (e *DiskEngine) Flush() {
+	batch := e.db.NewBatch()
+	defer batch.Close()
+	check(batch.DeleteRange([]byte{diskDataPrefix}, []byte{diskDataPrefix + 1}, nil))
+	check(batch.DeleteRange([]byte{diskExpiryPrefix}, []byte{diskExpiryPrefix + 1}, nil))
+	e.commit(batch, 0, 0, 0)
+}
+
+// Close flushes the memtables and closes the database
+func (e *DiskEngine) Close() error {
+	if err := e.db.Flush(); err != nil {
+		e.db.Close()
+		return err
+	}
+	return e.db.Close()
+}
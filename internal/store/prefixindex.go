@@ -0,0 +1,193 @@
+package store
+
+import (
+	"sort"
+	"strings"
+)
+
+// PrefixIndex is a radix tree over key names. It lets KEYS and SCAN visit only the
+// keys under a literal pattern prefix, in lexicographic order, instead of the
+// whole keyspace.
+type PrefixIndex struct {
+	root  radixNode
+	size  int
+	nodes int
+}
+
+// radixNode is a tree node; prefix is the edge label leading to it from its parent
+type radixNode struct {
+	prefix   string
+	leaf     bool
+	children []*radixNode // sorted by first byte of prefix
+}
+
+// NewPrefixIndex creates an empty index
+func NewPrefixIndex() *PrefixIndex {
+	return &PrefixIndex{}
+}
+
+// Len returns the number of indexed keys
+func (t *PrefixIndex) Len() int {
+	return t.size
+}
+
+// Nodes returns the number of tree nodes, which dominates the index memory cost. A
+// nil index, as kept while the index is disabled, has none.
+func (t *PrefixIndex) Nodes() int {
+	if t == nil {
+		return 0
+	}
+	return t.nodes
+}
+
+// child returns the position of the child starting with b and the child itself, if any
+func (n *radixNode) child(b byte) (int, *radixNode) {
+	i := sort.Search(len(n.children), func(i int) bool { return n.children[i].prefix[0] >= b })
+	if i < len(n.children) && n.children[i].prefix[0] == b {
+		return i, n.children[i]
+	}
+	return i, nil
+}
+
+// commonPrefixLen returns the length of the longest common prefix of a and b
+func commonPrefixLen(a, b string) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// Insert adds a key and reports whether it was not already present
+func (t *PrefixIndex) Insert(key string) bool {
+	n := &t.root
+	for key != "" {
+		i, child := n.child(key[0])
+		if child == nil {
+			n.children = append(n.children, nil)
+			copy(n.children[i+1:], n.children[i:])
+			n.children[i] = &radixNode{prefix: key, leaf: true}
+			t.nodes++
+			t.size++
+			return true
+		}
+
+		common := commonPrefixLen(child.prefix, key)
+		if common < len(child.prefix) {
+			// Split the edge at the point where the key diverges
+			split := &radixNode{prefix: child.prefix[:common], children: []*radixNode{child}}
+			child.prefix = child.prefix[common:]
+			n.children[i] = split
+			t.nodes++
+			child = split
+		}
+		n = child
+		key = key[common:]
+	}
+
+	if n.leaf {
+		return false
+	}
+	n.leaf = true
+	t.size++
+	return true
+}
+
+// Delete removes a key and reports whether it was present
+func (t *PrefixIndex) Delete(key string) bool {
+	var parent *radixNode
+	n := &t.root
+	for key != "" {
+		_, child := n.child(key[0])
+		if child == nil || !strings.HasPrefix(key, child.prefix) {
+			return false
+		}
+		parent = n
+		n = child
+		key = key[len(child.prefix):]
+	}
+	if !n.leaf {
+		return false
+	}
+	n.leaf = false
+	t.size--
+
+	if parent == nil {
+		return true
+	}
+	switch len(n.children) {
+	case 0:
+		i, _ := parent.child(n.prefix[0])
+		parent.children = append(parent.children[:i], parent.children[i+1:]...)
+		t.nodes--
+		if parent != &t.root && !parent.leaf && len(parent.children) == 1 {
+			t.merge(parent)
+		}
+	case 1:
+		t.merge(n)
+	}
+	return true
+}
+
+// merge folds the only child of a non-leaf node into it
+func (t *PrefixIndex) merge(n *radixNode) {
+	child := n.children[0]
+	n.prefix += child.prefix
+	n.leaf = child.leaf
+	n.children = child.children
+	t.nodes--
+}
+
+// Walk calls fn for every key that starts with prefix and sorts at or after from,
+// in lexicographic order, until fn returns false
+func (t *PrefixIndex) Walk(prefix, from string, fn func(key string) bool) {
+	n := &t.root
+	path := ""
+	for rest := prefix; rest != ""; {
+		_, child := n.child(rest[0])
+		if child == nil {
+			return
+		}
+		switch {
+		case strings.HasPrefix(rest, child.prefix):
+			rest = rest[len(child.prefix):]
+		case strings.HasPrefix(child.prefix, rest):
+			rest = ""
+		default:
+			return
+		}
+		path += child.prefix
+		n = child
+	}
+	walkNode(n, path, from, fn)
+}
+
+// walkNode visits the subtree of n, whose keys all start with path. It returns
+// false once fn has asked to stop.
+func walkNode(n *radixNode, path, from string, fn func(key string) bool) bool {
+	// Every key in this subtree sorts before from
+	m := min(len(path), len(from))
+	if path[:m] < from[:m] {
+		return true
+	}
+
+	if n.leaf && path >= from && !fn(path) {
+		return false
+	}
+	for _, child := range n.children {
+		if !walkNode(child, path+child.prefix, from, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// LiteralPrefix returns the part of a glob pattern before its first special character
+func LiteralPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, "*?[\\"); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
@@ -0,0 +1,196 @@
+// Package redisclient is a client for this server and Redis 6 or later, kept in the
+// same module as the server so the two speak exactly the same protocol. It pools
+// connections, pipelines commands, speaks RESP2 or RESP3 and has typed methods for
+// the commands the server implements.
+package redisclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// DefaultPoolSize is the default number of connections a Client keeps open at most
+const DefaultPoolSize = 10
+
+var (
+	// ErrNil is returned by the typed methods when the key doesn't exist
+	ErrNil = errors.New("redisclient: nil reply")
+	// ErrClosed is returned once the client is closed
+	ErrClosed = errors.New("redisclient: client closed")
+)
+
+// Error is an error reply from the server, e.g. "WRONGTYPE ..." or "ERR ..."
+type Error = resp.ErrorReply
+
+// Options configures a Client
+type Options struct {
+	// Addr is the host:port of the server
+	Addr string
+
+	// Username and Password authenticate every connection when Password is set.
+	// Username defaults to "default".
+	Username string
+	Password string
+
+	// ClientName names every connection, as reported to the server's hooks
+	ClientName string
+
+	// Protocol is resp.RESP2 or resp.RESP3, RESP2 when zero
+	Protocol int
+
+	// PoolSize caps the number of open connections, DefaultPoolSize when zero.
+	// Callers wait for a connection once they are all in use.
+	PoolSize int
+
+	// Dialer opens connections, a plain net.Dialer when nil
+	Dialer func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Client is a pool of connections to a server, safe for concurrent use
+type Client struct {
+	opts Options
+
+	// slots holds a token for every open connection, idle the connections not in use
+	slots chan struct{}
+	idle  chan *conn
+
+	mutex  sync.Mutex
+	closed bool
+}
+
+// New returns a client for the server at opts.Addr; connections are opened on demand
+func New(opts Options) (*Client, error) {
+	if opts.Addr == "" {
+		return nil, errors.New("missing address")
+	}
+	switch opts.Protocol {
+	case 0:
+		opts.Protocol = resp.RESP2
+	case resp.RESP2, resp.RESP3:
+	default:
+		return nil, errors.New("protocol must be 2 or 3")
+	}
+	if opts.Username == "" {
+		opts.Username = "default"
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = DefaultPoolSize
+	}
+	if opts.Dialer == nil {
+		opts.Dialer = (&net.Dialer{}).DialContext
+	}
+	return &Client{
+		opts:  opts,
+		slots: make(chan struct{}, opts.PoolSize),
+		idle:  make(chan *conn, opts.PoolSize),
+	}, nil
+}
+
+// get returns an idle connection, or opens one when the pool has room
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	c.mutex.Lock()
+	closed := c.closed
+	c.mutex.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	case c.slots <- struct{}{}:
+		cn, err := dial(ctx, &c.opts)
+		if err != nil {
+			<-c.slots
+			return nil, err
+		}
+		return cn, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// put returns a connection to the pool, closing it when it is broken or the client
+// is closed
+func (c *Client) put(cn *conn) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if cn.broken || c.closed {
+		cn.Close()
+		<-c.slots
+		return
+	}
+	c.idle <- cn
+}
+
+// roundTrip runs a pipeline of commands on a pooled connection
+func (c *Client) roundTrip(ctx context.Context, commands [][]string) ([]resp.Value, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.put(cn)
+	return cn.roundTrip(ctx, commands)
+}
+
+// Do runs a command and returns its reply as native Go values: strings, int64,
+// float64, bool, nil, []any and map[string]any, see resp.Unmarshal. Error replies
+// are returned as an Error. ctx bounds the whole round trip.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	replies, err := c.roundTrip(ctx, [][]string{args})
+	if err != nil {
+		return nil, err
+	}
+	return decode(replies[0])
+}
+
+// DoReply runs a command and returns its reply as the server sent it, for tools that
+// show replies with their RESP type. Error replies are values of type resp.Error, not
+// errors.
+func (c *Client) DoReply(ctx context.Context, args ...string) (resp.Value, error) {
+	replies, err := c.roundTrip(ctx, [][]string{args})
+	if err != nil {
+		return resp.Value{}, err
+	}
+	return replies[0], nil
+}
+
+// Close closes the idle connections, and the others once they are released
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.Close()
+			<-c.slots
+		default:
+			return nil
+		}
+	}
+}
+
+// decode converts a reply into native Go values, turning error replies into errors
+func decode(v resp.Value) (any, error) {
+	reply, err := resp.Unmarshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := reply.(resp.ErrorReply); ok {
+		return nil, replyErr
+	}
+	return reply, nil
+}
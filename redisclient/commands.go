@@ -0,0 +1,196 @@
+package redisclient
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Ping checks that the server answers
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Get returns the value of key, ErrNil when it doesn't exist
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	reply, err := c.Do(ctx, "GET", key)
+	if err != nil {
+		return "", err
+	}
+	if reply == nil {
+		return "", ErrNil
+	}
+	return asString(reply)
+}
+
+// Set stores value under key, expiring after ttl unless it is 0
+func (c *Client) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	args := []string{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// Del removes keys and returns how many existed
+func (c *Client) Del(ctx context.Context, keys ...string) (int64, error) {
+	return c.intCommand(ctx, append([]string{"DEL"}, keys...))
+}
+
+// Unlink is Del with the values freed in the background
+func (c *Client) Unlink(ctx context.Context, keys ...string) (int64, error) {
+	return c.intCommand(ctx, append([]string{"UNLINK"}, keys...))
+}
+
+// Incr increments the integer stored under key and returns the new value
+func (c *Client) Incr(ctx context.Context, key string) (int64, error) {
+	return c.intCommand(ctx, []string{"INCR", key})
+}
+
+// IncrBy adds delta to the integer stored under key and returns the new value
+func (c *Client) IncrBy(ctx context.Context, key string, delta int64) (int64, error) {
+	return c.intCommand(ctx, []string{"INCRBY", key, strconv.FormatInt(delta, 10)})
+}
+
+// TTL returns the time left before key expires, or the codes TTL replies with as is:
+// -1 when the key has no expiry and -2 when it doesn't exist
+func (c *Client) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := c.intCommand(ctx, []string{"TTL", key})
+	if err != nil || ttl < 0 {
+		return time.Duration(ttl), err
+	}
+	return time.Duration(ttl) * time.Second, nil
+}
+
+// Keys returns the keys matching a glob-style pattern
+func (c *Client) Keys(ctx context.Context, pattern string) ([]string, error) {
+	reply, err := c.Do(ctx, "KEYS", pattern)
+	if err != nil {
+		return nil, err
+	}
+	return asStrings(reply)
+}
+
+// Scan returns a batch of keys matching pattern and the cursor of the next batch,
+// 0 once the iteration is complete. An empty pattern matches every key.
+func (c *Client) Scan(ctx context.Context, cursor uint64, pattern string, count int) ([]string, uint64, error) {
+	args := []string{"SCAN", strconv.FormatUint(cursor, 10)}
+	if pattern != "" {
+		args = append(args, "MATCH", pattern)
+	}
+	if count > 0 {
+		args = append(args, "COUNT", strconv.Itoa(count))
+	}
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	parts, ok := reply.([]any)
+	if !ok || len(parts) != 2 {
+		return nil, 0, fmt.Errorf("unexpected SCAN reply %v", reply)
+	}
+	next, err := asString(parts[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	nextCursor, err := strconv.ParseUint(next, 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid SCAN cursor %q", next)
+	}
+	keys, err := asStrings(parts[1])
+	return keys, nextCursor, err
+}
+
+// Publish sends message to channel and returns the number of clients that received it
+func (c *Client) Publish(ctx context.Context, channel, message string) (int64, error) {
+	return c.intCommand(ctx, []string{"PUBLISH", channel, message})
+}
+
+// ConfigGet returns the configuration directives matching pattern
+func (c *Client) ConfigGet(ctx context.Context, pattern string) (map[string]string, error) {
+	reply, err := c.Do(ctx, "CONFIG", "GET", pattern)
+	if err != nil {
+		return nil, err
+	}
+	config := make(map[string]string)
+	switch reply := reply.(type) {
+	case map[string]any: // RESP3
+		for name, value := range reply {
+			if config[name], err = asString(value); err != nil {
+				return nil, err
+			}
+		}
+	default: // RESP2: names and values alternate
+		pairs, err := asStrings(reply)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i+1 < len(pairs); i += 2 {
+			config[pairs[i]] = pairs[i+1]
+		}
+	}
+	return config, nil
+}
+
+// ConfigSet changes a configuration directive at runtime
+func (c *Client) ConfigSet(ctx context.Context, name, value string) error {
+	_, err := c.Do(ctx, "CONFIG", "SET", name, value)
+	return err
+}
+
+// Info returns the INFO report, restricted to the given sections when there are any
+func (c *Client) Info(ctx context.Context, sections ...string) (string, error) {
+	reply, err := c.Do(ctx, append([]string{"INFO"}, sections...)...)
+	if err != nil {
+		return "", err
+	}
+	return asString(reply)
+}
+
+// FlushAll removes every key
+func (c *Client) FlushAll(ctx context.Context) error {
+	_, err := c.Do(ctx, "FLUSHALL")
+	return err
+}
+
+// intCommand runs a command that replies with an integer
+func (c *Client) intCommand(ctx context.Context, args []string) (int64, error) {
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected reply type %T", reply)
+	}
+	return n, nil
+}
+
+// asString converts a reply expected to be a string
+func asString(reply any) (string, error) {
+	s, ok := reply.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected reply type %T", reply)
+	}
+	return s, nil
+}
+
+// asStrings converts a reply expected to be an array of strings
+func asStrings(reply any) ([]string, error) {
+	array, ok := reply.([]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected reply type %T", reply)
+	}
+	strs := make([]string, len(array))
+	for i, elem := range array {
+		s, err := asString(elem)
+		if err != nil {
+			return nil, err
+		}
+		strs[i] = s
+	}
+	return strs, nil
+}
@@ -0,0 +1,140 @@
+package redisclient
+
+import (
+	"bufio"
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// replyLimits are the parser limits for replies, which come from a trusted server
+// and may be much larger than any command
+var replyLimits = resp.ParserLimits{
+	MaxBulkLen:         resp.DefaultMaxBulkLen,
+	QueryBufferLimit:   math.MaxInt,
+	LargeBulkThreshold: resp.DefaultLargeBulkThreshold,
+	MaxMultibulkLen:    math.MaxInt32,
+	MaxNestingDepth:    resp.DefaultMaxNestingDepth,
+}
+
+// conn is a connection to the server, used by one caller at a time
+type conn struct {
+	netConn net.Conn
+	parser  *resp.Parser
+	writer  *bufio.Writer
+	scratch []byte // reused to encode commands
+
+	// broken is set after an I/O error, which may leave a reply half read
+	broken bool
+}
+
+// dial connects to the server and negotiates the protocol, authenticating and
+// naming the connection on the way
+func dial(ctx context.Context, opts *Options) (*conn, error) {
+	netConn, err := opts.Dialer(ctx, "tcp", opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+	parser := resp.NewParser(bufio.NewReader(netConn))
+	parser.SetLimits(replyLimits)
+	cn := &conn{netConn: netConn, parser: parser, writer: bufio.NewWriter(netConn)}
+
+	hello := []string{"HELLO", strconv.Itoa(opts.Protocol)}
+	if opts.Password != "" {
+		hello = append(hello, "AUTH", opts.Username, opts.Password)
+	}
+	if opts.ClientName != "" {
+		hello = append(hello, "SETNAME", opts.ClientName)
+	}
+	replies, err := cn.roundTrip(ctx, [][]string{hello})
+	if err == nil && replies[0].Type == resp.Error {
+		err = resp.ErrorReply(replies[0].Str)
+	}
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return cn, nil
+}
+
+// roundTrip sends a pipeline of commands and returns their replies. Error replies
+// are returned as values; the error is for I/O failures, after which the connection
+// is broken.
+func (cn *conn) roundTrip(ctx context.Context, commands [][]string) ([]resp.Value, error) {
+	var replies []resp.Value
+	err := cn.withContext(ctx, func() error {
+		if err := cn.send(commands); err != nil {
+			return err
+		}
+		replies = make([]resp.Value, 0, len(commands))
+		for range commands {
+			reply, err := cn.receive()
+			if err != nil {
+				return err
+			}
+			replies = append(replies, reply)
+		}
+		return nil
+	})
+	return replies, err
+}
+
+// send writes and flushes commands
+func (cn *conn) send(commands [][]string) error {
+	for _, args := range commands {
+		cn.scratch = append(cn.scratch[:0], byte(resp.Array))
+		cn.scratch = strconv.AppendInt(cn.scratch, int64(len(args)), 10)
+		cn.scratch = append(cn.scratch, '\r', '\n')
+		for _, arg := range args {
+			cn.scratch = resp.AppendBulkString(cn.scratch, arg)
+		}
+		if _, err := cn.writer.Write(cn.scratch); err != nil {
+			return err
+		}
+	}
+	return cn.writer.Flush()
+}
+
+// receive reads the next reply, skipping the pushes the server may interleave
+func (cn *conn) receive() (resp.Value, error) {
+	for {
+		reply, err := cn.parser.Parse()
+		if err != nil || reply.Type != resp.Push {
+			return reply, err
+		}
+	}
+}
+
+// withContext runs fn under the deadline of ctx, aborting its I/O when ctx is
+// cancelled. Any failure breaks the connection.
+func (cn *conn) withContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	cn.netConn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		cn.netConn.SetDeadline(time.Unix(1, 0))
+	})
+	err := fn()
+	if !stop() && err == nil {
+		// Cancelled just as fn returned: the deadline set meanwhile poisons the connection
+		err = ctx.Err()
+	}
+	if err != nil {
+		cn.broken = true
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// Close closes the connection
+func (cn *conn) Close() error {
+	return cn.netConn.Close()
+}
@@ -0,0 +1,50 @@
+package redisclient
+
+import "context"
+
+// Pipeline queues commands to send them in a single write and read their replies
+// together, saving a round trip per command. It isn't safe for concurrent use.
+type Pipeline struct {
+	client   *Client
+	commands [][]string
+}
+
+// Pipeline returns an empty pipeline
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{client: c}
+}
+
+// Do queues a command
+func (p *Pipeline) Do(args ...string) {
+	p.commands = append(p.commands, args)
+}
+
+// Len returns the number of queued commands
+func (p *Pipeline) Len() int {
+	return len(p.commands)
+}
+
+// Exec sends the queued commands on one connection and returns their replies in
+// order, as Do would, with error replies as Error values in place. The error only
+// reports a failure to talk to the server. The pipeline is empty afterwards.
+func (p *Pipeline) Exec(ctx context.Context) ([]any, error) {
+	commands := p.commands
+	p.commands = nil
+	if len(commands) == 0 {
+		return nil, nil
+	}
+
+	replies, err := p.client.roundTrip(ctx, commands)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]any, len(replies))
+	for i, reply := range replies {
+		result, err := decode(reply)
+		if err != nil {
+			result = err
+		}
+		results[i] = result
+	}
+	return results, nil
+}
@@ -0,0 +1,159 @@
+package redisclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// Message is a message published to a channel the client subscribed to
+type Message struct {
+	// Pattern is the pattern that matched the channel, empty for channel subscriptions
+	Pattern string
+	Channel string
+	Payload string
+}
+
+// PubSub is a connection dedicated to receiving messages, outside the pool.
+// Subscription changes and Receive are safe to call concurrently.
+type PubSub struct {
+	cn *conn
+
+	writeMutex sync.Mutex
+	messages   chan Message
+	done       chan struct{} // closed once the connection is lost or closed
+	err        error         // why, valid once done is closed
+	closeOnce  sync.Once
+}
+
+// Subscribe opens a connection subscribed to channels
+func (c *Client) Subscribe(ctx context.Context, channels ...string) (*PubSub, error) {
+	return c.subscribe(ctx, "SUBSCRIBE", channels)
+}
+
+// PSubscribe opens a connection subscribed to the channels matching patterns
+func (c *Client) PSubscribe(ctx context.Context, patterns ...string) (*PubSub, error) {
+	return c.subscribe(ctx, "PSUBSCRIBE", patterns)
+}
+
+// subscribe dials a connection for a PubSub and sends the first subscription
+func (c *Client) subscribe(ctx context.Context, command string, names []string) (*PubSub, error) {
+	cn, err := dial(ctx, &c.opts)
+	if err != nil {
+		return nil, err
+	}
+	cn.netConn.SetDeadline(time.Time{}) // messages may take any time to come
+	ps := &PubSub{cn: cn, messages: make(chan Message), done: make(chan struct{})}
+	if err := ps.send(ctx, command, names); err != nil {
+		cn.Close()
+		return nil, err
+	}
+	go ps.receive()
+	return ps, nil
+}
+
+// send writes a subscription command, whose confirmations Receive skips
+func (ps *PubSub) send(ctx context.Context, command string, names []string) error {
+	ps.writeMutex.Lock()
+	defer ps.writeMutex.Unlock()
+	// The read side runs without a deadline, so only the write is bounded by ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		ps.cn.netConn.SetWriteDeadline(deadline)
+		defer ps.cn.netConn.SetWriteDeadline(time.Time{})
+	}
+	return ps.cn.send([][]string{append([]string{command}, names...)})
+}
+
+// Subscribe adds channel subscriptions
+func (ps *PubSub) Subscribe(ctx context.Context, channels ...string) error {
+	return ps.send(ctx, "SUBSCRIBE", channels)
+}
+
+// PSubscribe adds pattern subscriptions
+func (ps *PubSub) PSubscribe(ctx context.Context, patterns ...string) error {
+	return ps.send(ctx, "PSUBSCRIBE", patterns)
+}
+
+// Unsubscribe drops channel subscriptions, every one when none is given
+func (ps *PubSub) Unsubscribe(ctx context.Context, channels ...string) error {
+	return ps.send(ctx, "UNSUBSCRIBE", channels)
+}
+
+// PUnsubscribe drops pattern subscriptions, every one when none is given
+func (ps *PubSub) PUnsubscribe(ctx context.Context, patterns ...string) error {
+	return ps.send(ctx, "PUNSUBSCRIBE", patterns)
+}
+
+// receive reads frames until the connection fails, handing messages to Receive
+func (ps *PubSub) receive() {
+	var err error
+	for {
+		var frame resp.Value
+		if frame, err = ps.cn.parser.Parse(); err != nil {
+			break
+		}
+		if frame.Type == resp.Error {
+			err = resp.ErrorReply(frame.Str)
+			break
+		}
+		message, ok := parseMessage(frame)
+		if !ok {
+			continue // a subscription confirmation, or a PING reply
+		}
+		select {
+		case ps.messages <- message:
+		case <-ps.done:
+			return
+		}
+	}
+	ps.closeWith(err)
+}
+
+// parseMessage extracts a published message from a pub/sub frame: an array in RESP2,
+// a push in RESP3
+func parseMessage(frame resp.Value) (Message, bool) {
+	if frame.Type != resp.Array && frame.Type != resp.Push {
+		return Message{}, false
+	}
+	parts := make([]string, len(frame.Array))
+	for i, part := range frame.Array {
+		parts[i] = part.Bulk
+	}
+	switch {
+	case len(parts) == 3 && parts[0] == "message":
+		return Message{Channel: parts[1], Payload: parts[2]}, true
+	case len(parts) == 4 && parts[0] == "pmessage":
+		return Message{Pattern: parts[1], Channel: parts[2], Payload: parts[3]}, true
+	}
+	return Message{}, false
+}
+
+// Receive waits for the next message. Messages aren't queued on the client side, so
+// a slow receiver makes the server buffer them, up to its pubsub output limit.
+func (ps *PubSub) Receive(ctx context.Context) (Message, error) {
+	select {
+	case message := <-ps.messages:
+		return message, nil
+	case <-ps.done:
+		return Message{}, ps.err
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	}
+}
+
+// closeWith closes the connection once, recording why
+func (ps *PubSub) closeWith(err error) {
+	ps.closeOnce.Do(func() {
+		ps.err = err
+		ps.cn.Close()
+		close(ps.done)
+	})
+}
+
+// Close closes the connection; Receive then returns ErrClosed
+func (ps *PubSub) Close() error {
+	ps.closeWith(ErrClosed)
+	return nil
+}
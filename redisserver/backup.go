@@ -0,0 +1,63 @@
+package redisserver
+
+import (
+	"context"
+	"iter"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/server"
+)
+
+// ErrBusyKey is returned by RestoreEntry when the key exists and replace isn't set
+var ErrBusyKey = server.ErrBusyKey
+
+// Entry is a key as read from or written to a backup
+type Entry struct {
+	Key   string
+	Value string
+	// ExpiresAt is the absolute expiry of the key, the zero time when it has none
+	ExpiresAt time.Time
+}
+
+// Snapshot streams a consistent copy of the dataset for backup tools, whichever the
+// storage engine: every key as it was when the iteration started, keys already
+// expired excepted. Clients keep being served meanwhile. A single snapshot runs at a
+// time, BGSAVE included, so it fails while another is in progress. Iteration stops
+// at the first error, cancellation of ctx included.
+func (s *Server) Snapshot(ctx context.Context) iter.Seq2[Entry, error] {
+	return func(yield func(Entry, error) bool) {
+		inner, err := s.running()
+		if err != nil {
+			yield(Entry{}, err)
+			return
+		}
+		for entry, err := range inner.Entries(ctx) {
+			if err != nil {
+				yield(Entry{}, err)
+				return
+			}
+			var expiresAt time.Time
+			if entry.ExpiresAt != 0 {
+				expiresAt = time.UnixMilli(entry.ExpiresAt)
+			}
+			if !yield(Entry{Key: entry.Key, Value: entry.Value, ExpiresAt: expiresAt}, nil) {
+				return
+			}
+		}
+	}
+}
+
+// RestoreEntry writes a key read from a backup, as RESTORE does: an existing key is
+// only overwritten when replace is set, and an entry whose expiry has passed isn't
+// restored, deleting the existing key instead. Restored keys count against maxmemory.
+func (s *Server) RestoreEntry(entry Entry, replace bool) error {
+	inner, err := s.running()
+	if err != nil {
+		return err
+	}
+	var expiresAt int64
+	if !entry.ExpiresAt.IsZero() {
+		expiresAt = entry.ExpiresAt.UnixMilli()
+	}
+	return inner.RestoreEntry(server.SnapshotEntry{Key: entry.Key, Value: entry.Value, ExpiresAt: expiresAt}, replace)
+}
@@ -0,0 +1,174 @@
+package redisserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/server"
+	"github.com/codecrafters-io/redis-starter-go/resp"
+)
+
+// ErrNil is returned by the typed Client methods when the key doesn't exist
+var ErrNil = errors.New("redisserver: nil reply")
+
+// Error is an error reply from the server, e.g. "WRONGTYPE ..." or "ERR ..."
+type Error = resp.ErrorReply
+
+// Message is a message published to a channel the client subscribed to
+type Message struct {
+	// Pattern is the pattern that matched the channel, empty for channel subscriptions
+	Pattern string
+	Channel string
+	Payload string
+}
+
+// Client runs commands against an embedded server from the same process, without a
+// connection, so the application shares the keyspace, pub/sub channels and command
+// semantics of its network clients. It is trusted and never needs to authenticate.
+// A Client is safe for concurrent use, its commands running one at a time; open
+// several for parallelism.
+type Client struct {
+	local *server.LocalClient
+}
+
+// NewClient connects an in-process client to a started server
+func (s *Server) NewClient() (*Client, error) {
+	inner, err := s.running()
+	if err != nil {
+		return nil, err
+	}
+	return &Client{local: inner.NewLocalClient()}, nil
+}
+
+// running returns the inner server once started
+func (s *Server) running() (*server.RedisServer, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.inner == nil {
+		return nil, errors.New("server not started")
+	}
+	return s.inner, nil
+}
+
+// Do runs a command and returns its reply as native Go values: strings, int64,
+// float64, bool, nil, []any and map[string]any, see resp.Unmarshal. Error replies are
+// returned as an Error. SUBSCRIBE and the like return the last confirmation. Commands
+// always run to completion; ctx is only checked before starting.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	replies, err := c.local.Do(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(replies) == 0 {
+		return nil, nil
+	}
+	reply, err := resp.Unmarshal(replies[len(replies)-1])
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := reply.(resp.ErrorReply); ok {
+		return nil, replyErr
+	}
+	return reply, nil
+}
+
+// Get returns the value of key, ErrNil when it doesn't exist
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	reply, err := c.Do(ctx, "GET", key)
+	if err != nil {
+		return "", err
+	}
+	if reply == nil {
+		return "", ErrNil
+	}
+	return asString(reply)
+}
+
+// Set stores value under key, expiring after ttl unless it is 0
+func (c *Client) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	args := []string{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// Del removes keys and returns how many existed
+func (c *Client) Del(ctx context.Context, keys ...string) (int64, error) {
+	reply, err := c.Do(ctx, append([]string{"DEL"}, keys...)...)
+	if err != nil {
+		return 0, err
+	}
+	return asInt(reply)
+}
+
+// Publish sends message to channel and returns the number of clients that received it
+func (c *Client) Publish(ctx context.Context, channel, message string) (int64, error) {
+	reply, err := c.Do(ctx, "PUBLISH", channel, message)
+	if err != nil {
+		return 0, err
+	}
+	return asInt(reply)
+}
+
+// Subscribe subscribes to channels, whose messages are then returned by Receive
+func (c *Client) Subscribe(ctx context.Context, channels ...string) error {
+	_, err := c.Do(ctx, append([]string{"SUBSCRIBE"}, channels...)...)
+	return err
+}
+
+// PSubscribe subscribes to the channels matching patterns
+func (c *Client) PSubscribe(ctx context.Context, patterns ...string) error {
+	_, err := c.Do(ctx, append([]string{"PSUBSCRIBE"}, patterns...)...)
+	return err
+}
+
+// Receive waits for the next message published to a subscribed channel. Messages
+// are queued until received, so a subscribed client must keep receiving.
+func (c *Client) Receive(ctx context.Context) (Message, error) {
+	frame, err := c.local.Receive(ctx)
+	if err != nil {
+		return Message{}, err
+	}
+	parts := make([]string, len(frame.Array))
+	for i, part := range frame.Array {
+		parts[i] = part.Bulk
+	}
+	switch {
+	case len(parts) == 3 && parts[0] == "message":
+		return Message{Channel: parts[1], Payload: parts[2]}, nil
+	case len(parts) == 4 && parts[0] == "pmessage":
+		return Message{Pattern: parts[1], Channel: parts[2], Payload: parts[3]}, nil
+	}
+	return Message{}, fmt.Errorf("unexpected message frame %v", parts)
+}
+
+// Close unsubscribes the client and disconnects it
+func (c *Client) Close() error {
+	return c.local.Close()
+}
+
+// asString converts a reply expected to be a string
+func asString(reply any) (string, error) {
+	s, ok := reply.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected reply type %T", reply)
+	}
+	return s, nil
+}
+
+// asInt converts a reply expected to be an integer
+func asInt(reply any) (int64, error) {
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected reply type %T", reply)
+	}
+	return n, nil
+}
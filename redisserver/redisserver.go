@@ -0,0 +1,491 @@
+// Package redisserver runs the server inside the current process, so that integration
+// tests can talk to a real Redis-compatible server without spawning one.
+package redisserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/server"
+	"github.com/codecrafters-io/redis-starter-go/resp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultAddr listens on a free port of the loopback interface
+const DefaultAddr = "127.0.0.1:0"
+
+// Options configures an embedded server
+type Options struct {
+	// Addr is the TCP address to listen on, DefaultAddr when empty
+	Addr string
+
+	// Password is required from clients, through AUTH or HELLO AUTH, before any
+	// other command. Empty disables authentication.
+	Password string
+
+	// MaxMemory caps the dataset in bytes, 0 for no limit
+	MaxMemory int64
+
+	// Dir holds the RDB file, loaded on Start when it exists. Empty keeps the
+	// dataset in memory only.
+	Dir string
+
+	// Config sets any other directive by name, as with redis-server --name value
+	Config map[string]string
+
+	// Logger receives the server's log, still filtered by the loglevel directive.
+	// When nil the server logs as configured by logfile and log-format.
+	Logger *slog.Logger
+
+	// TracerProvider receives a span per command and per RDB save or load. When nil,
+	// the tracing-endpoint directive sets up OTLP export.
+	TracerProvider trace.TracerProvider
+
+	// Clock tells the time to the keyspace, for expiry, TTLs, TIME and eviction. Tests
+	// pass a MockClock to expire keys without waiting. Nil uses the system clock.
+	Clock Clock
+}
+
+// CommandHandler executes a custom command. args holds the command name followed by
+// its arguments, and the reply is written to writer. ctx is cancelled once the
+// client disconnects or the server shuts down; ClientFromContext describes the client.
+type CommandHandler = server.CommandHandler
+
+// CommandFunc adapts a function to CommandHandler
+type CommandFunc func(ctx context.Context, args []string, writer *resp.Writer) error
+
+func (f CommandFunc) Handle(ctx context.Context, args []string, writer *resp.Writer) error {
+	return f(ctx, args, writer)
+}
+
+// ClientFromContext describes the client running the command ctx was passed to
+func ClientFromContext(ctx context.Context) (ClientInfo, bool) {
+	return server.ClientFromContext(ctx)
+}
+
+// CommandFlags describes a custom command to the dispatcher and to COMMAND
+type CommandFlags = server.CommandFlags
+
+const (
+	// FlagWrite marks commands that may modify the keyspace
+	FlagWrite = server.FlagWrite
+	// FlagDenyOOM marks commands refused while over maxmemory
+	FlagDenyOOM = server.FlagDenyOOM
+	// FlagReadOnly marks commands that only read the keyspace
+	FlagReadOnly = server.FlagReadOnly
+	// FlagAdmin marks administrative commands
+	FlagAdmin = server.FlagAdmin
+	// FlagPubSub marks publish/subscribe commands
+	FlagPubSub = server.FlagPubSub
+	// FlagNoAuth marks commands allowed before the client authenticates
+	FlagNoAuth = server.FlagNoAuth
+	// FlagFast marks commands that run in constant or logarithmic time
+	FlagFast = server.FlagFast
+	// FlagLoading marks commands allowed while lazy-loading loads the dataset
+	FlagLoading = server.FlagLoading
+)
+
+// KeySpec locates the key arguments of a custom command, see COMMAND INFO
+type KeySpec = server.KeySpec
+
+// ClientInfo describes the client running a command, for command hooks
+type ClientInfo = server.ClientInfo
+
+// PreCommandHook runs before each command. It may modify the elements of args in
+// place; an error rejects the command and is sent to the client as an error reply.
+type PreCommandHook = server.PreCommandHook
+
+// PostCommandHook runs after each command, rejected ones included, with the RESP
+// encoding of the reply and the time spent executing the command
+type PostCommandHook = server.PostCommandHook
+
+// SetHook is called whenever a key is written, with its new value and its expiry,
+// the zero time when it has none
+type SetHook = server.SetHook
+
+// KeyHook is called when a key goes away
+type KeyHook = server.KeyHook
+
+// Loader fetches a key missing from the keyspace from a backing store, with its
+// TTL, 0 for none; found is false when the backing store doesn't have it either
+type Loader = server.Loader
+
+// Writer writes a change made by a command through to a backing store
+type Writer = server.Writer
+
+// StoreWrite is a change passed to a Writer: Key set to Value, or deleted
+type StoreWrite = server.StoreWrite
+
+// Clock tells the time to the keyspace
+type Clock = server.Clock
+
+// MockClock is a Clock that only moves when told to, through Set and Advance
+type MockClock = server.MockClock
+
+// NewMockClock returns a clock stopped at now
+func NewMockClock(now time.Time) *MockClock {
+	return server.NewMockClock(now)
+}
+
+// customCommand is a command registered before Start
+type customCommand struct {
+	name    string
+	arity   int
+	flags   CommandFlags
+	keys    KeySpec
+	handler CommandHandler
+}
+
+// Server is an embedded server. Its zero value isn't usable; create one with New.
+type Server struct {
+	config      *server.Config
+	addr        string
+	persistence bool
+	logger      *slog.Logger
+	clock       Clock
+	tracer      trace.TracerProvider
+
+	mutex     sync.Mutex
+	started   bool
+	commands  []customCommand
+	preHooks  []PreCommandHook
+	postHooks []PostCommandHook
+	keyHooks  []func(inner *server.RedisServer) // registrations of keyspace hooks
+	listener  net.Listener
+	inner     *server.RedisServer
+
+	ready chan struct{}
+
+	// stopping is closed when the first shutdown starts, done once it is over
+	stopOnce sync.Once
+	stopping chan struct{}
+	done     chan struct{}
+	err      error
+}
+
+// New validates opts and returns a server ready to be started
+func New(opts Options) (*Server, error) {
+	config := server.DefaultConfig()
+	addr := opts.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if host == "" {
+		host = "*"
+	}
+
+	settings := []struct{ name, value string }{
+		{"bind", host},
+		{"requirepass", opts.Password},
+		{"maxmemory", strconv.FormatInt(opts.MaxMemory, 10)},
+	}
+	if opts.Dir != "" {
+		settings = append(settings, struct{ name, value string }{"dir", opts.Dir})
+	}
+	for _, setting := range settings {
+		if err := config.Set(setting.name, setting.value); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", setting.name, err)
+		}
+	}
+	for name, value := range opts.Config {
+		if err := config.Set(name, value); err != nil {
+			return nil, fmt.Errorf("invalid value for '%s': %w", name, err)
+		}
+	}
+
+	return &Server{
+		config:      config,
+		addr:        addr,
+		persistence: opts.Dir != "",
+		logger:      opts.Logger,
+		clock:       opts.Clock,
+		tracer:      opts.TracerProvider,
+		ready:       make(chan struct{}),
+		stopping:    make(chan struct{}),
+		done:        make(chan struct{}),
+	}, nil
+}
+
+// Start listens, loads the RDB file when there is one and serves clients in the
+// background. It returns once the server accepts connections; the server then runs
+// until Shutdown is called, ctx is cancelled or a client sends SHUTDOWN.
+func (s *Server) Start(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.started {
+		return errors.New("server already started")
+	}
+	s.started = true
+
+	var listenConfig net.ListenConfig
+	listener, err := listenConfig.Listen(ctx, "tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+	}
+	// INFO and CONFIG GET report the port actually bound
+	s.config.Port = listener.Addr().(*net.TCPAddr).Port
+
+	inner := server.NewRedisServer(s.config)
+	if s.logger != nil {
+		inner.SetLogger(s.logger)
+	} else if err := inner.OpenLog(); err != nil {
+		listener.Close()
+		inner.Shutdown(context.Background(), false)
+		return fmt.Errorf("failed to open the log file: %w", err)
+	}
+	if err := inner.OpenAudit(); err != nil {
+		listener.Close()
+		inner.Shutdown(context.Background(), false)
+		return fmt.Errorf("failed to open the audit log: %w", err)
+	}
+	if s.clock != nil {
+		inner.SetClock(s.clock)
+	}
+	if s.tracer != nil {
+		inner.SetTracerProvider(s.tracer)
+	} else if err := inner.OpenTracing(ctx); err != nil {
+		listener.Close()
+		inner.Shutdown(context.Background(), false)
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	if err := inner.OpenStorage(); err != nil {
+		listener.Close()
+		inner.Shutdown(context.Background(), false)
+		return fmt.Errorf("failed to open the storage engine: %w", err)
+	}
+	for _, c := range s.commands {
+		if err := inner.RegisterCommand(c.name, c.arity, c.flags, c.keys, c.handler); err != nil {
+			listener.Close()
+			inner.Shutdown(context.Background(), false)
+			return fmt.Errorf("failed to register command '%s': %w", c.name, err)
+		}
+	}
+	if err := inner.CheckAliases(); err != nil {
+		listener.Close()
+		inner.Shutdown(context.Background(), false)
+		return err
+	}
+	for _, hook := range s.preHooks {
+		inner.AddPreCommandHook(hook)
+	}
+	for _, hook := range s.postHooks {
+		inner.AddPostCommandHook(hook)
+	}
+	for _, register := range s.keyHooks {
+		register(inner)
+	}
+	adminListener, err := server.ListenAdmin(s.config)
+	if err != nil {
+		listener.Close()
+		inner.Shutdown(context.Background(), false)
+		return fmt.Errorf("failed to listen on admin port %d: %w", s.config.AdminPort, err)
+	}
+	if adminListener != nil {
+		inner.ServeAdmin(adminListener)
+	}
+	if s.persistence && s.config.LazyLoading {
+		// Clients are served meanwhile; a failure shuts the server down
+		inner.LoadRDBInBackground(func(int, error) {})
+	} else if s.persistence {
+		if _, err := inner.LoadRDB(); err != nil {
+			listener.Close()
+			inner.Shutdown(context.Background(), false)
+			return fmt.Errorf("failed to load the RDB file: %w", err)
+		}
+	}
+	s.listener, s.inner = listener, inner
+	inner.Serve([]net.Listener{listener}, nil)
+	close(s.ready)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.stop(context.Background(), inner.SaveOnShutdown())
+		case save := <-inner.ShutdownRequests():
+			s.stop(context.Background(), save)
+		case <-s.stopping:
+		}
+	}()
+	return nil
+}
+
+// RegisterCommand adds a custom command, dispatched like the built-in ones: arity,
+// authentication and maxmemory are checked before handler runs, and COMMAND lists
+// it. arity counts the command name and is a minimum when negative. Commands must
+// be registered before Start, which reports invalid ones.
+func (s *Server) RegisterCommand(name string, arity int, flags CommandFlags, keys KeySpec, handler CommandHandler) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.started {
+		return errors.New("commands must be registered before Start")
+	}
+	s.commands = append(s.commands, customCommand{name, arity, flags, keys, handler})
+	return nil
+}
+
+// AddPreCommandHook registers a hook run before every command, for auditing,
+// rewriting or rejecting commands. Hooks run in registration order and must be
+// added before Start.
+func (s *Server) AddPreCommandHook(hook PreCommandHook) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.started {
+		return errors.New("hooks must be added before Start")
+	}
+	s.preHooks = append(s.preHooks, hook)
+	return nil
+}
+
+// AddPostCommandHook registers a hook run after every command, for metrics or
+// logging. Hooks run in registration order and must be added before Start.
+func (s *Server) AddPostCommandHook(hook PostCommandHook) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.started {
+		return errors.New("hooks must be added before Start")
+	}
+	s.postHooks = append(s.postHooks, hook)
+	return nil
+}
+
+// OnSet registers a hook run whenever a key is written, by any command, including the
+// ones changing only its expiry, and for every key loaded on Start, to mirror the keyspace into the application's own caches or
+// indices. Keyspace hooks run synchronously with the keyspace locked, in the order
+// of the changes, so they must be quick and must not call back into the server, not
+// even through an in-process client. They must be added before Start.
+func (s *Server) OnSet(hook SetHook) error {
+	return s.addKeyHook(func(inner *server.RedisServer) { inner.OnSet(hook) })
+}
+
+// OnDelete registers a hook run when DEL or UNLINK removes a key
+func (s *Server) OnDelete(hook KeyHook) error {
+	return s.addKeyHook(func(inner *server.RedisServer) { inner.OnDelete(hook) })
+}
+
+// OnExpire registers a hook run when an expired key is removed. Keys expire lazily,
+// when they are next accessed, so the hook may run well after the expiry time.
+func (s *Server) OnExpire(hook KeyHook) error {
+	return s.addKeyHook(func(inner *server.RedisServer) { inner.OnExpire(hook) })
+}
+
+// OnEvict registers a hook run when a key is evicted to stay under maxmemory
+func (s *Server) OnEvict(hook KeyHook) error {
+	return s.addKeyHook(func(inner *server.RedisServer) { inner.OnEvict(hook) })
+}
+
+// OnFlush registers a hook run when FLUSHDB or FLUSHALL removes every key at once,
+// without calling the per-key hooks
+func (s *Server) OnFlush(hook func()) error {
+	return s.addKeyHook(func(inner *server.RedisServer) { inner.OnFlush(hook) })
+}
+
+// SetLoader makes the server a read-through cache: GET of a missing key calls the
+// loader, stores the key it finds with its TTL, and replies with it. Concurrent
+// misses of a key share a single call, made without the keyspace locked, and a
+// failed load is replied as an error. Only GET loads keys. It must be set before
+// Start.
+func (s *Server) SetLoader(loader Loader) error {
+	return s.addKeyHook(func(inner *server.RedisServer) { inner.SetLoader(loader) })
+}
+
+// SetWriter makes the server a write-through cache: the keys written by SET and INCR
+// and its variants, and the keys named by DEL and UNLINK, are passed to the writer
+// in order by a background goroutine, so commands don't wait for the backing store.
+// Writes beyond a queue of 10000 are dropped, and those still queued on Shutdown get
+// until its context is done. Keys that expire, are evicted or flushed aren't
+// written through. It must be set before Start.
+func (s *Server) SetWriter(writer Writer) error {
+	return s.addKeyHook(func(inner *server.RedisServer) { inner.SetWriter(writer) })
+}
+
+// addKeyHook queues the registration of a keyspace hook until Start
+func (s *Server) addKeyHook(register func(inner *server.RedisServer)) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.started {
+		return errors.New("hooks must be added before Start")
+	}
+	s.keyHooks = append(s.keyHooks, register)
+	return nil
+}
+
+// MetricsHandler serves the server's metrics in the Prometheus text format, for
+// applications exposing them on their own HTTP server rather than on admin-port.
+// It replies 503 Service Unavailable until the server is started.
+func (s *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner, err := s.running()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		inner.MetricsHandler().ServeHTTP(w, r)
+	})
+}
+
+// Ready is closed once the server accepts connections
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Done is closed once the server has stopped
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
+
+// Addr returns the address the server listens on, with the port it picked when
+// Options.Addr asked for port 0. It is only valid once Ready is closed.
+func (s *Server) Addr() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// Shutdown stops accepting connections and waits for connected clients to leave,
+// closing those still connected once ctx is done. The dataset is saved when
+// save-on-shutdown is set. Calling Shutdown again waits for the first call.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	inner := s.inner
+	s.mutex.Unlock()
+	if inner == nil {
+		return errors.New("server not started")
+	}
+	return s.stop(ctx, inner.SaveOnShutdown())
+}
+
+// stop shuts the server down once, and returns the outcome of that shutdown
+func (s *Server) stop(ctx context.Context, save bool) error {
+	s.stopOnce.Do(func() {
+		close(s.stopping)
+		s.listener.Close()
+
+		// Without a context deadline, clients get the configured shutdown-timeout
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, s.inner.ShutdownTimeout())
+			defer cancel()
+		}
+		s.err = s.inner.Shutdown(ctx, save && s.persistence)
+		s.inner.CloseTracing(context.Background())
+		s.inner.CloseAudit()
+		s.inner.CloseLog()
+		close(s.done)
+	})
+	<-s.done
+	return s.err
+}
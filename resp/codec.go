@@ -0,0 +1,178 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+)
+
+// Encode returns the wire encoding of v for a connection speaking protocol (RESP2 or
+// RESP3), with RESP3 types downgraded for RESP2 as they are for clients
+func Encode(v Value, protocol int) ([]byte, error) {
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	w := NewWriter(bw)
+	w.SetProtocol(protocol)
+	if err := w.WriteValue(v); err != nil {
+		return nil, err
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode parses the first value in data and returns it along with the number of bytes
+// it took. io.EOF or io.ErrUnexpectedEOF means data holds an incomplete value. Lines
+// that don't start with a RESP type byte are decoded as inline commands.
+func Decode(data []byte) (Value, int, error) {
+	source := bytes.NewReader(data)
+	reader := bufio.NewReader(source)
+	value, err := NewParser(reader).Parse()
+	if err != nil {
+		return Value{}, 0, err
+	}
+	return value, len(data) - source.Len() - reader.Buffered(), nil
+}
+
+// Marshal converts a native Go value into a Value: strings and byte slices become
+// bulk strings, integers integers, floats doubles, bools booleans, nil the null, errors
+// error replies, *big.Int big numbers, slices arrays and maps with string keys maps,
+// their keys sorted. A Value is returned as is.
+func Marshal(v any) (Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return Value{Type: Null}, nil
+	case Value:
+		return v, nil
+	case string:
+		return Value{Type: BulkString, Bulk: v}, nil
+	case []byte:
+		return Value{Type: BulkString, Bulk: string(v)}, nil
+	case bool:
+		return Value{Type: Boolean, Num: boolToInt(v)}, nil
+	case error:
+		return Value{Type: Error, Str: v.Error()}, nil
+	case *big.Int:
+		if v == nil {
+			return Value{Type: Null}, nil
+		}
+		return Value{Type: BigNumber, Str: v.String()}, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Value{Type: Integer, Num: int(rv.Int())}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n := rv.Uint()
+		if n > uint64(^uint(0)>>1) {
+			// Too large for an integer reply
+			return Value{Type: BigNumber, Str: new(big.Int).SetUint64(n).String()}, nil
+		}
+		return Value{Type: Integer, Num: int(n)}, nil
+	case reflect.Float32, reflect.Float64:
+		return Value{Type: Double, Float: rv.Float()}, nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return Value{Type: Array, IsNull: true}, nil
+		}
+		array := make([]Value, rv.Len())
+		for i := range array {
+			elem, err := Marshal(rv.Index(i).Interface())
+			if err != nil {
+				return Value{}, err
+			}
+			array[i] = elem
+		}
+		return Value{Type: Array, Array: array}, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return Value{}, fmt.Errorf("cannot marshal %T: map keys must be strings", v)
+		}
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		entries := make([]Value, 0, 2*len(keys))
+		for _, key := range keys {
+			value, err := Marshal(rv.MapIndex(key).Interface())
+			if err != nil {
+				return Value{}, err
+			}
+			entries = append(entries, Value{Type: BulkString, Bulk: key.String()}, value)
+		}
+		return Value{Type: Map, Array: entries}, nil
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return Value{Type: Null}, nil
+		}
+		return Marshal(rv.Elem().Interface())
+	}
+	return Value{}, fmt.Errorf("cannot marshal %T", v)
+}
+
+// Unmarshal converts a Value into native Go values, the reverse of Marshal: bulk,
+// simple and verbatim strings become strings, integers int64, doubles float64,
+// booleans bool, nulls nil, error replies errors, big numbers *big.Int, arrays, sets
+// and pushes []any and maps map[string]any. Attributes are dropped.
+func Unmarshal(v Value) (any, error) {
+	if v.IsNull {
+		return nil, nil
+	}
+	switch v.Type {
+	case Null:
+		return nil, nil
+	case BulkString, VerbatimString:
+		return v.Bulk, nil
+	case SimpleString:
+		return v.Str, nil
+	case Error:
+		return ErrorReply(v.Str), nil
+	case Integer:
+		return int64(v.Num), nil
+	case Double:
+		return v.Float, nil
+	case Boolean:
+		return v.Num != 0, nil
+	case BigNumber:
+		n, ok := new(big.Int).SetString(v.Str, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid big number %q", v.Str)
+		}
+		return n, nil
+	case Array, Set, Push:
+		array := make([]any, len(v.Array))
+		for i, elem := range v.Array {
+			value, err := Unmarshal(elem)
+			if err != nil {
+				return nil, err
+			}
+			array[i] = value
+		}
+		return array, nil
+	case Map:
+		m := make(map[string]any, len(v.Array)/2)
+		for i := 0; i+1 < len(v.Array); i += 2 {
+			key, err := Unmarshal(v.Array[i])
+			if err != nil {
+				return nil, err
+			}
+			value, err := Unmarshal(v.Array[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(key)] = value
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("cannot unmarshal RESP type %q", v.Type)
+}
+
+// ErrorReply is an error reply, as returned by Unmarshal
+type ErrorReply string
+
+func (e ErrorReply) Error() string {
+	return string(e)
+}
@@ -0,0 +1,145 @@
+package resp
+
+import "bytes"
+
+// frameScan is how far Ready got through the frame at the start of its input
+type frameScan struct {
+	pos     int   // bytes of the frame scanned so far
+	open    []int // elements still expected by each enclosing aggregate
+	pending int   // payload bytes announced so far, as Parse counts them
+}
+
+// Ready reports whether buf, the input the next call to Parse reads, holds a whole
+// frame, or anything Parse has to look at to reject. It only reads the headers,
+// skipping over bulk payloads, and resumes where its previous call stopped, so that
+// a command arriving a read at a time is scanned once rather than parsed again from
+// its first byte on every read. buf must only grow between calls, until Parse is
+// called, which starts the next scan over.
+func (p *Parser) Ready(buf []byte) bool {
+	if p.resyncing {
+		return true
+	}
+	s := &p.scan
+	for {
+		if s.pos >= len(buf) {
+			return false
+		}
+		typeByte := buf[s.pos]
+		switch Type(typeByte) {
+		case '\r', '\n':
+			if p.limits.Strict {
+				return true
+			}
+			s.pos++ // stray bytes, which Parse skips
+			continue
+		case Array, Map, Set, Push, Attribute, BulkString, VerbatimString,
+			SimpleString, Error, Integer, Null, Double, Boolean, BigNumber:
+		default:
+			if len(s.open) > 0 {
+				return true // rejected by Parse without reading further
+			}
+		}
+
+		end := bytes.IndexByte(buf[s.pos:], '\n')
+		if end < 0 {
+			// Parse rejects a header without a newline in sight once beyond the limit
+			return len(buf)-s.pos > maxLineLen
+		}
+		if end > maxLineLen {
+			return true
+		}
+		line := buf[s.pos+1 : s.pos+end]
+		if p.limits.Strict && (!bytes.HasSuffix(line, []byte{'\r'}) || bytes.IndexByte(line, '\r') < len(line)-1) {
+			return true
+		}
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+		next := s.pos + end + 1
+
+		switch kind := Type(typeByte); kind {
+		case Array, Map, Set, Push, Attribute:
+			count, err := parseInt(line)
+			if err != nil || count < -1 || (count == -1 && kind != Array) {
+				return true
+			}
+			if kind == Map || kind == Attribute {
+				if count > p.limits.MaxMultibulkLen/2 {
+					return true
+				}
+				count *= 2
+			}
+			if count > p.limits.MaxMultibulkLen {
+				return true
+			}
+			s.pending += max(count, 0) * 4
+			if s.pending > p.limits.QueryBufferLimit || (count > 0 && len(s.open) >= p.limits.MaxNestingDepth) {
+				return true
+			}
+			if kind == Attribute {
+				count++ // the value the attributes annotate follows them
+			}
+			s.pos = next
+			if count > 0 {
+				s.open = append(s.open, count)
+				continue
+			}
+		case BulkString, VerbatimString:
+			length, err := parseInt(line)
+			if err != nil || length < -1 || length > p.limits.MaxBulkLen {
+				return true
+			}
+			if length >= 0 {
+				s.pending += length
+				if s.pending > p.limits.QueryBufferLimit {
+					return true
+				}
+				// The payload isn't scanned: the header is read again until it's all there
+				if len(buf)-next < length+2 {
+					s.pending -= length
+					return false
+				}
+				if p.limits.Strict && !bytes.Equal(buf[next+length:next+length+2], sharedCRLF) {
+					return true
+				}
+				next += length + 2
+			}
+			s.pos = next
+		case SimpleString, Error, Null:
+			s.pos = next
+		case Integer, Double, Boolean, BigNumber:
+			if !validLine(kind, line) {
+				return true
+			}
+			s.pos = next
+		default:
+			return true // an inline command, whose line is all there
+		}
+
+		// An element is complete: so are the aggregates it was the last element of
+		for len(s.open) > 0 {
+			s.open[len(s.open)-1]--
+			if s.open[len(s.open)-1] > 0 {
+				break
+			}
+			s.open = s.open[:len(s.open)-1]
+		}
+		if len(s.open) == 0 {
+			return true
+		}
+	}
+}
+
+// validLine reports whether Parse accepts line as a value of kind
+func validLine(kind Type, line []byte) bool {
+	var err error
+	switch kind {
+	case Integer:
+		_, err = integerValue(line)
+	case Double:
+		_, err = doubleValue(line)
+	case Boolean:
+		_, err = booleanValue(line)
+	case BigNumber:
+		_, err = bigNumberValue(line)
+	}
+	return err == nil
+}
@@ -0,0 +1,90 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"runtime"
+	"testing"
+)
+
+// fuzzLimits keep the parser's allocations small enough to measure
+var fuzzLimits = ParserLimits{
+	MaxBulkLen:         1 << 20,
+	QueryBufferLimit:   4 << 20,
+	LargeBulkThreshold: 64 << 10,
+	MaxMultibulkLen:    1 << 16,
+	MaxNestingDepth:    DefaultMaxNestingDepth,
+}
+
+// fuzzAllocBudget is what parsing may allocate beyond a multiple of the input size:
+// a bulk string or array announced by a few bytes is allocated up to the limits
+// before its content arrives
+const fuzzAllocBudget = 16 << 20
+
+// FuzzParse feeds arbitrary bytes to the parser, in RESP2, RESP3 or inline, checking
+// that it neither panics nor allocates beyond its limits, and that every value it
+// returns encodes the same once decoded again. Input Ready holds back must be
+// incomplete for Parse too.
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{
+		"*2\r\n$4\r\nECHO\r\n$5\r\nhello\r\n",
+		"PING\r\n",
+		"set \"a\\x00b\" 'c d'\r\n",
+		"+OK\r\n-ERR bad\r\n:42\r\n$-1\r\n*-1\r\n",
+		"%1\r\n+key\r\n*2\r\n:1\r\n,1.5\r\n",
+		"|1\r\n+ttl\r\n:10\r\n$3\r\nfoo\r\n",
+		"~2\r\n#t\r\n#f\r\n>2\r\n+a\r\n_\r\n",
+		"(12345678901234567890\r\n=7\r\ntxt:abc\r\n,inf\r\n,nan\r\n",
+		"*1\r\n*1\r\n*1\r\n*0\r\n",
+		"*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$100000\r\n",
+		"*1048577\r\n",
+		"%4611686018427387904\r\n",
+		"$9999999999\r\n",
+		"%1\n0",
+		"%1\n#0\n",
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parser := NewParser(bufio.NewReader(bytes.NewReader(data)))
+		parser.SetLimits(fuzzLimits)
+		if !parser.Ready(data) {
+			if _, err := parser.Parse(); err != io.EOF && err != io.ErrUnexpectedEOF {
+				t.Fatalf("Ready(%q) = false, while Parse returns %v", data, err)
+			}
+			parser.Reset(bytes.NewReader(data))
+		}
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		// Every call consumes input or fails, so the input bounds the calls
+		for range len(data) + 1 {
+			value, err := parser.Parse()
+			if err != nil {
+				if perr := AsProtocolError(err); perr != nil && !perr.Fatal {
+					continue
+				}
+				break
+			}
+
+			encoded, err := Encode(value, RESP3)
+			if err != nil {
+				t.Fatalf("encoding %#v: %v", value, err)
+			}
+			decoded, n, err := Decode(encoded)
+			if err != nil || n != len(encoded) {
+				t.Fatalf("decoding %q: %d bytes, %v", encoded, n, err)
+			}
+			if again, _ := Encode(decoded, RESP3); !bytes.Equal(again, encoded) {
+				t.Fatalf("%q encodes as %q once decoded", encoded, again)
+			}
+		}
+		runtime.ReadMemStats(&after)
+
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > fuzzAllocBudget+64*uint64(len(data)) {
+			t.Fatalf("parsing %d bytes allocated %d bytes", len(data), allocated)
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// maxInlineLen is the longest inline command accepted, as in Redis
+const maxInlineLen = 64 * 1024
+
+// maxLineLen is the longest line of a type and its length, or of a simple value,
+// accepted, as Redis bounds the headers of requests like their inline form
+const maxLineLen = maxInlineLen
+
+var (
+	errInlineTooLarge   = &ProtocolError{msg: "too big inline request", Fatal: true}
+	errUnbalancedQuotes = &ProtocolError{msg: "unbalanced quotes in request", aligned: true}
+	errInlineTerminator = &ProtocolError{msg: "expected CRLF line terminator", aligned: true}
+)
+
+// parseInline parses an inline command: a line of space-separated arguments, as sent
+// by telnet users and redis-cli in raw mode. It is returned as an array of bulk strings.
+func (p *Parser) parseInline() (Value, error) {
+	var line []byte
+	for {
+		chunk, err := p.reader.ReadSlice('\n')
+		if len(line)+len(chunk) > maxInlineLen {
+			return Value{}, errInlineTooLarge
+		}
+		if err == bufio.ErrBufferFull {
+			line = append(line, chunk...)
+			continue
+		}
+		if err != nil {
+			return Value{}, err
+		}
+		if line == nil {
+			line = chunk // the common case: the line is in the reader's buffer
+		} else {
+			line = append(line, chunk...)
+		}
+		break
+	}
+
+	if p.limits.Strict && !bytes.HasSuffix(line, sharedCRLF) {
+		return Value{}, errInlineTerminator
+	}
+	args, err := splitInlineArgs(strings.TrimRight(string(line), "\r\n"))
+	if err != nil {
+		return Value{}, err
+	}
+	array := make([]Value, len(args))
+	for i, arg := range args {
+		array[i] = Value{Type: BulkString, Bulk: arg}
+	}
+	return Value{Type: Array, Array: array}, nil
+}
+
+// SplitArgs splits a command line into arguments as the server does inline commands,
+// for tools reading commands typed by a person
+func SplitArgs(line string) ([]string, error) {
+	return splitInlineArgs(line)
+}
+
+// splitInlineArgs splits an inline command into arguments with the quoting rules of
+// redis-cli: double quotes support \n, \r, \t, \b, \a, \\, \" and \xHH escapes, and
+// single quotes only \'. A closing quote must end the argument.
+func splitInlineArgs(line string) ([]string, error) {
+	var args []string
+	for i := 0; ; {
+		for i < len(line) && isInlineSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+
+		var arg strings.Builder
+		switch quote := line[i]; quote {
+		case '"', '\'':
+			i++
+			for {
+				if i == len(line) {
+					return nil, errUnbalancedQuotes
+				}
+				c := line[i]
+				if c == quote {
+					i++
+					break
+				}
+				if c == '\\' && i+1 < len(line) {
+					i++
+					c = line[i]
+					if quote == '"' {
+						if c == 'x' && i+2 < len(line) && isHexDigit(line[i+1]) && isHexDigit(line[i+2]) {
+							c = hexValue(line[i+1])<<4 | hexValue(line[i+2])
+							i += 2
+						} else {
+							c = unescapeInline(c)
+						}
+					} else if c != '\'' {
+						arg.WriteByte('\\')
+					}
+				}
+				arg.WriteByte(c)
+				i++
+			}
+			if i < len(line) && !isInlineSpace(line[i]) {
+				return nil, errUnbalancedQuotes
+			}
+		default:
+			for i < len(line) && !isInlineSpace(line[i]) {
+				arg.WriteByte(line[i])
+				i++
+			}
+		}
+		args = append(args, arg.String())
+	}
+}
+
+// unescapeInline returns the byte a backslash escape in double quotes stands for
+func unescapeInline(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'a':
+		return '\a'
+	}
+	return c
+}
+
+func isInlineSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// hexValue returns the value of a hexadecimal digit
+func hexValue(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
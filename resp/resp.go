@@ -0,0 +1,1185 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// errWriterClosed is returned when writing to a client whose connection has been torn down
+var errWriterClosed = errors.New("writer closed")
+
+// Type represents the type of RESP data
+type Type byte
+
+const (
+	SimpleString Type = '+'
+	Error        Type = '-'
+	Integer      Type = ':'
+	BulkString   Type = '$'
+	Array        Type = '*'
+
+	// RESP3 types, written as their RESP2 equivalent to clients that didn't negotiate
+	// protocol 3 with HELLO
+	Null           Type = '_'
+	Boolean        Type = '#'
+	Double         Type = ','
+	BigNumber      Type = '('
+	VerbatimString Type = '='
+	Map            Type = '%'
+	Set            Type = '~'
+	Push           Type = '>'
+	Attribute      Type = '|'
+)
+
+// Value represents a RESP protocol value. A Map holds its keys and values
+// alternately in Array, a Boolean is stored in Num as 0 or 1, a BigNumber as decimal
+// digits in Str and a VerbatimString as its text in Bulk and its three-letter format
+// (such as "txt") in Str. IsNull marks the RESP2 null bulk string ($-1) and null
+// array (*-1), which are distinct from an empty string or array. Attrs holds RESP3
+// attributes sent ahead of the value as alternating keys and values; they are
+// out-of-band metadata, dropped for RESP2 clients.
+type Value struct {
+	Type   Type
+	Str    string
+	Num    int
+	Float  float64
+	Bulk   string
+	Array  []Value
+	IsNull bool
+	Attrs  []Value
+}
+
+// Protocol versions negotiated with HELLO
+const (
+	RESP2 = 2
+	RESP3 = 3
+)
+
+// Protocol limit defaults, as in Redis
+const (
+	// DefaultMaxBulkLen is the default proto-max-bulk-len (512MB)
+	DefaultMaxBulkLen = 512 * 1024 * 1024
+	// DefaultQueryBufferLimit is the default client-query-buffer-limit (1GB)
+	DefaultQueryBufferLimit = 1024 * 1024 * 1024
+	// DefaultLargeBulkThreshold is the default large-bulk-threshold (64KB)
+	DefaultLargeBulkThreshold = 64 * 1024
+	// DefaultMaxMultibulkLen is the default proto-max-multibulk-len (1M elements)
+	DefaultMaxMultibulkLen = 1024 * 1024
+	// DefaultMaxNestingDepth is the default proto-max-nesting-depth
+	DefaultMaxNestingDepth = 32
+)
+
+// ProtocolError is malformed client input, reported to the client as an error reply.
+// After a recoverable one the parser skips ahead to the next command, unless it is
+// aligned, having consumed exactly the bad command; a fatal one, such as input beyond
+// the protocol limits, closes the connection.
+type ProtocolError struct {
+	msg     string
+	Fatal   bool
+	aligned bool
+}
+
+func (e *ProtocolError) Error() string {
+	return "Protocol error: " + e.msg
+}
+
+// Protocol errors
+var (
+	errInvalidBulkLength      = &ProtocolError{msg: "invalid bulk length"}
+	errInvalidMultibulkLength = &ProtocolError{msg: "invalid multibulk length"}
+	errInvalidInteger         = &ProtocolError{msg: "invalid integer"}
+	errBulkTooLarge           = &ProtocolError{msg: "invalid bulk length", Fatal: true}
+	errMultibulkTooLarge      = &ProtocolError{msg: "invalid multibulk length", Fatal: true}
+	errNestingTooDeep         = &ProtocolError{msg: "too many nested aggregates", Fatal: true}
+	errInvalidDouble          = &ProtocolError{msg: "invalid double"}
+	errInvalidBoolean         = &ProtocolError{msg: "invalid boolean"}
+	errInvalidBigNumber       = &ProtocolError{msg: "invalid big number"}
+	errInvalidVerbatim        = &ProtocolError{msg: "invalid verbatim string"}
+	errInvalidTerminator      = &ProtocolError{msg: "expected CRLF line terminator"}
+	errBulkLengthMismatch     = &ProtocolError{msg: "bulk length doesn't match the payload"}
+	errStrayBytes             = &ProtocolError{msg: "unexpected CR or LF between frames"}
+	errUnsynchronized         = &ProtocolError{msg: "unable to find the next command", Fatal: true}
+	errLineTooLarge           = &ProtocolError{msg: "too big line", Fatal: true}
+)
+
+// AsProtocolError returns err as a protocol error, or nil when it is an I/O error
+func AsProtocolError(err error) *ProtocolError {
+	var protoErr *ProtocolError
+	if errors.As(err, &protoErr) {
+		return protoErr
+	}
+	return nil
+}
+
+// ParserLimits bounds what a parser accepts from a single client
+type ParserLimits struct {
+	// MaxBulkLen is the largest bulk string accepted
+	MaxBulkLen int
+	// QueryBufferLimit is the largest total payload of a single command
+	QueryBufferLimit int
+	// LargeBulkThreshold is the size above which bulk strings are read straight into
+	// their own allocation instead of through the parser's scratch buffer
+	LargeBulkThreshold int
+	// MaxMultibulkLen is the largest number of elements accepted in an array
+	MaxMultibulkLen int
+	// MaxNestingDepth is how deeply arrays may be nested, a command being one level
+	MaxNestingDepth int
+	// Strict rejects what the parser otherwise tolerates: lines not ending in exactly
+	// CRLF, CR or LF between frames and bulk payloads not followed by CRLF
+	Strict bool
+}
+
+// Parser handles parsing RESP protocol messages
+type Parser struct {
+	reader  *bufio.Reader
+	scratch []byte // reused to read bulk payloads before they are copied into a string
+	limits  ParserLimits
+	pending int // payload bytes announced by the command being parsed
+	depth   int // arrays enclosing the value being parsed
+
+	// After a recoverable protocol error the parser discards input up to the next line
+	// that starts with '*'. midLine is set when the discarded input ended inside a line.
+	resyncing bool
+	midLine   bool
+	skipped   int // bytes discarded while resynchronizing
+	discarded int // bytes discarded by the current call to Parse
+
+	scan frameScan // progress of Ready through the next frame
+}
+
+// NewParser creates a new RESP parser
+func NewParser(reader *bufio.Reader) *Parser {
+	return &Parser{reader: reader, limits: ParserLimits{
+		MaxBulkLen:         DefaultMaxBulkLen,
+		QueryBufferLimit:   DefaultQueryBufferLimit,
+		LargeBulkThreshold: DefaultLargeBulkThreshold,
+		MaxMultibulkLen:    DefaultMaxMultibulkLen,
+		MaxNestingDepth:    DefaultMaxNestingDepth,
+	}}
+}
+
+// SetLimits replaces the parser's protocol limits
+func (p *Parser) SetLimits(limits ParserLimits) {
+	p.limits = limits
+}
+
+// Buffered returns the number of bytes read from the source but not parsed yet
+func (p *Parser) Buffered() int {
+	return p.reader.Buffered()
+}
+
+// Reset discards any buffered input and switches the parser to reading from r
+func (p *Parser) Reset(r io.Reader) {
+	p.reader.Reset(r)
+}
+
+// Close detaches and returns the parser's buffered reader, so it can be reused
+func (p *Parser) Close() *bufio.Reader {
+	reader := p.reader
+	p.reader = nil
+	return reader
+}
+
+// Parse reads and parses a RESP value from the connection. A recoverable protocol
+// error leaves the parser resynchronizing, so the next call starts at the next command.
+func (p *Parser) Parse() (Value, error) {
+	p.pending, p.depth, p.discarded = 0, 0, 0
+	p.scan = frameScan{open: p.scan.open[:0]}
+	if p.resyncing {
+		if err := p.resync(); err != nil {
+			return Value{}, err
+		}
+	}
+
+	value, err := p.parse()
+	if protoErr := AsProtocolError(err); protoErr != nil && !protoErr.Fatal && !protoErr.aligned {
+		p.resyncing, p.midLine, p.skipped = true, false, 0
+	}
+	return value, err
+}
+
+// Discarded returns how many bytes the last call to Parse skipped while resynchronizing,
+// which are gone even when it ran out of input
+func (p *Parser) Discarded() int {
+	return p.discarded
+}
+
+// resync discards input up to the next line that starts with '*', giving up once more
+// has been skipped than a whole command may hold
+func (p *Parser) resync() error {
+	for {
+		if !p.midLine {
+			next, err := p.reader.Peek(1)
+			if err != nil {
+				return err
+			}
+			if next[0] == byte(Array) {
+				p.resyncing = false
+				return nil
+			}
+		}
+
+		line, err := p.reader.ReadSlice('\n')
+		p.skipped += len(line)
+		p.discarded += len(line)
+		if p.skipped > p.limits.QueryBufferLimit {
+			return errUnsynchronized
+		}
+		switch {
+		case err == nil:
+			p.midLine = false
+		case err == bufio.ErrBufferFull || len(line) > 0:
+			p.midLine = true
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return err
+		}
+	}
+}
+
+// parse reads a single value, which may be nested in the command being parsed
+func (p *Parser) parse() (Value, error) {
+	for {
+		typeByte, err := p.reader.ReadByte()
+		if err != nil {
+			return Value{}, err
+		}
+
+		// Skip stray \r or \n characters, which strict mode doesn't allow between frames
+		if typeByte == '\r' || typeByte == '\n' {
+			if p.limits.Strict {
+				return Value{}, errStrayBytes
+			}
+			continue
+		}
+
+		switch kind := Type(typeByte); kind {
+		case Array, Map, Set, Push:
+			return p.parseAggregate(kind)
+		case Attribute:
+			return p.parseAttributed()
+		case BulkString:
+			return p.parseBulkString()
+		case SimpleString:
+			return p.parseSimpleString()
+		case Error:
+			return p.parseError()
+		case Integer:
+			return p.parseInteger()
+		case Null:
+			_, err := p.readLine()
+			return Value{Type: Null}, err
+		case Double:
+			return p.parseDouble()
+		case Boolean:
+			return p.parseBoolean()
+		case BigNumber:
+			return p.parseBigNumber()
+		case VerbatimString:
+			return p.parseVerbatimString()
+		default:
+			if p.depth == 0 {
+				p.reader.UnreadByte()
+				return p.parseInline()
+			}
+			// Drop the rest of the line so resynchronizing starts at the next one
+			p.readLine()
+			return Value{}, &ProtocolError{msg: fmt.Sprintf("expected '$', got '%c'", typeByte)}
+		}
+	}
+}
+
+// parseAggregate parses an array, or a RESP3 map, set or push. A map's count is of
+// key-value pairs, read into Array alternately.
+func (p *Parser) parseAggregate(kind Type) (Value, error) {
+	line, err := p.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+
+	count, err := parseInt(line)
+	if err != nil || count < -1 || (count == -1 && kind != Array) {
+		return Value{}, errInvalidMultibulkLength
+	}
+	if count == -1 {
+		return Value{Type: Array, IsNull: true}, nil
+	}
+	// A map's count is doubled into elements, so it is bounded first lest it overflows
+	if kind == Map || kind == Attribute {
+		if count > p.limits.MaxMultibulkLen/2 {
+			return Value{}, errMultibulkTooLarge
+		}
+		count *= 2
+	}
+	if count > p.limits.MaxMultibulkLen {
+		return Value{}, errMultibulkTooLarge
+	}
+
+	// Every element takes at least 4 bytes ("$0\r\n"), so reject counts that can't fit
+	p.pending += count * 4
+	if p.pending > p.limits.QueryBufferLimit {
+		return Value{}, errMultibulkTooLarge
+	}
+
+	// Each level of nesting costs stack, so bound it before descending
+	if count > 0 && p.depth >= p.limits.MaxNestingDepth {
+		return Value{}, errNestingTooDeep
+	}
+
+	// The count is only a claim until the elements arrive, so don't trust it for allocation
+	array := make([]Value, 0, min(count, 1024))
+	p.depth++
+	for i := 0; i < count; i++ {
+		val, err := p.parse()
+		if err != nil {
+			return Value{}, err
+		}
+		array = append(array, val)
+	}
+	p.depth--
+
+	return Value{Type: kind, Array: array}, nil
+}
+
+// parseAttributed parses a RESP3 attribute map and the value it annotates, which
+// follows it. Replies a client doesn't expect attributes on stay usable unchanged.
+func (p *Parser) parseAttributed() (Value, error) {
+	attrs, err := p.parseAggregate(Attribute)
+	if err != nil {
+		return Value{}, err
+	}
+	value, err := p.parse()
+	if err != nil {
+		return Value{}, err
+	}
+	value.Attrs = attrs.Array
+	return value, nil
+}
+
+// parseDouble parses a RESP3 double, including inf, -inf and nan
+func (p *Parser) parseDouble() (Value, error) {
+	line, err := p.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+	return doubleValue(line)
+}
+
+// doubleValue parses the line of a RESP3 double
+func doubleValue(line []byte) (Value, error) {
+	f, err := strconv.ParseFloat(string(line), 64)
+	if err != nil {
+		return Value{}, errInvalidDouble
+	}
+	return Value{Type: Double, Float: f}, nil
+}
+
+// parseBoolean parses a RESP3 boolean, t or f
+func (p *Parser) parseBoolean() (Value, error) {
+	line, err := p.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+	return booleanValue(line)
+}
+
+// booleanValue parses the line of a RESP3 boolean
+func booleanValue(line []byte) (Value, error) {
+	switch string(line) {
+	case "t":
+		return Value{Type: Boolean, Num: 1}, nil
+	case "f":
+		return Value{Type: Boolean, Num: 0}, nil
+	}
+	return Value{}, errInvalidBoolean
+}
+
+// parseBigNumber parses a RESP3 big number, keeping its digits as they are
+func (p *Parser) parseBigNumber() (Value, error) {
+	line, err := p.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+	return bigNumberValue(line)
+}
+
+// bigNumberValue parses the line of a RESP3 big number
+func bigNumberValue(line []byte) (Value, error) {
+	if _, ok := new(big.Int).SetString(string(line), 10); !ok {
+		return Value{}, errInvalidBigNumber
+	}
+	return Value{Type: BigNumber, Str: string(line)}, nil
+}
+
+// parseVerbatimString parses a RESP3 verbatim string, a bulk string whose payload
+// starts with a three-letter format and a colon
+func (p *Parser) parseVerbatimString() (Value, error) {
+	value, err := p.parseBulkString()
+	if err != nil {
+		return Value{}, err
+	}
+	if value.IsNull || len(value.Bulk) < 4 || value.Bulk[3] != ':' {
+		return Value{}, errInvalidVerbatim
+	}
+	return Value{Type: VerbatimString, Str: value.Bulk[:3], Bulk: value.Bulk[4:]}, nil
+}
+
+// parseBulkString parses a RESP bulk string
+func (p *Parser) parseBulkString() (Value, error) {
+	line, err := p.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+
+	length, err := parseInt(line)
+	if err != nil {
+		return Value{}, errInvalidBulkLength
+	}
+
+	if length == -1 {
+		return Value{Type: BulkString, IsNull: true}, nil
+	}
+	if length < 0 {
+		return Value{}, errInvalidBulkLength
+	}
+	if length > p.limits.MaxBulkLen {
+		return Value{}, errBulkTooLarge
+	}
+	p.pending += length
+	if p.pending > p.limits.QueryBufferLimit {
+		return Value{}, errMultibulkTooLarge
+	}
+
+	bulk, err := p.readBulk(length)
+	if err != nil {
+		return Value{}, err
+	}
+
+	// Read the trailing \r\n, which strict mode checks is really there: anything else
+	// means the announced length doesn't match the payload
+	if p.limits.Strict {
+		trailer, err := p.reader.Peek(2)
+		if err != nil {
+			return Value{}, err
+		}
+		if !bytes.Equal(trailer, sharedCRLF) {
+			return Value{}, errBulkLengthMismatch
+		}
+	}
+	if _, err := p.reader.Discard(2); err != nil {
+		return Value{}, err
+	}
+
+	return Value{Type: BulkString, Bulk: bulk}, nil
+}
+
+// readBulk reads exactly length payload bytes. Small payloads go through the scratch
+// buffer and are copied into a string. Payloads above the large-bulk threshold are
+// read into a buffer of their own, which bufio fills straight from the socket once
+// its buffer is drained, and the string aliases that buffer instead of copying it.
+func (p *Parser) readBulk(length int) (string, error) {
+	if length > p.limits.LargeBulkThreshold {
+		bulk := make([]byte, length)
+		if _, err := io.ReadFull(p.reader, bulk); err != nil {
+			return "", err
+		}
+		return unsafe.String(unsafe.SliceData(bulk), length), nil
+	}
+
+	if cap(p.scratch) < length {
+		p.scratch = make([]byte, min(max(length, 2*cap(p.scratch), 512), p.limits.LargeBulkThreshold))
+	}
+	bulk := p.scratch[:length]
+	if _, err := io.ReadFull(p.reader, bulk); err != nil {
+		return "", err
+	}
+	return string(bulk), nil
+}
+
+// parseSimpleString parses a RESP simple string
+func (p *Parser) parseSimpleString() (Value, error) {
+	line, err := p.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{Type: SimpleString, Str: string(line)}, nil
+}
+
+// parseError parses a RESP error
+func (p *Parser) parseError() (Value, error) {
+	line, err := p.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{Type: Error, Str: string(line)}, nil
+}
+
+// parseInteger parses a RESP integer
+func (p *Parser) parseInteger() (Value, error) {
+	line, err := p.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+	return integerValue(line)
+}
+
+// integerValue parses the line of a RESP integer
+func integerValue(line []byte) (Value, error) {
+	num, err := parseInt(line)
+	if err != nil {
+		return Value{}, errInvalidInteger
+	}
+	return Value{Type: Integer, Num: num}, nil
+}
+
+// readLine reads a line ending with \r\n. The returned slice points into the reader's
+// buffer and is only valid until the next read.
+func (p *Parser) readLine() ([]byte, error) {
+	line, err := p.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		// Line longer than the buffer: copy it a chunk at a time, up to maxLineLen
+		long := append([]byte(nil), line...)
+		for err == bufio.ErrBufferFull {
+			line, err = p.reader.ReadSlice('\n')
+			if len(long)+len(line) > maxLineLen {
+				return nil, errLineTooLarge
+			}
+			long = append(long, line...)
+		}
+		line = long
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.limits.Strict && (!bytes.HasSuffix(line, sharedCRLF) || bytes.IndexByte(line, '\r') < len(line)-2) {
+		return nil, errInvalidTerminator
+	}
+	return bytes.TrimSuffix(bytes.TrimSuffix(line, []byte{'\n'}), []byte{'\r'}), nil
+}
+
+// parseInt parses a decimal integer without the string conversion strconv.Atoi needs
+func parseInt(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, fmt.Errorf("invalid integer: empty")
+	}
+	negative := b[0] == '-'
+	digits := b
+	if negative {
+		digits = b[1:]
+		if len(digits) == 0 {
+			return 0, fmt.Errorf("invalid integer: %q", b)
+		}
+	}
+
+	// Accumulated as a magnitude, which reaches one more than math.MaxInt for math.MinInt
+	limit := uint(math.MaxInt)
+	if negative {
+		limit++
+	}
+	n := uint(0)
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("invalid integer: %q", b)
+		}
+		digit := uint(c - '0')
+		if n > (limit-digit)/10 {
+			return 0, fmt.Errorf("integer overflow: %q", b)
+		}
+		n = n*10 + digit
+	}
+	if negative {
+		return -int(n), nil
+	}
+	return int(n), nil
+}
+
+// Shared encodings for the most common replies, written without any formatting
+var (
+	sharedOK        = []byte("+OK\r\n")
+	sharedPong      = []byte("+PONG\r\n")
+	sharedNullBulk  = []byte("$-1\r\n")
+	sharedNullArray = []byte("*-1\r\n")
+	sharedNull      = []byte("_\r\n")
+	sharedCRLF      = []byte("\r\n")
+
+	// sharedIntReplies holds ":n\r\n" for n in [-2, sharedIntReplyMax): -1 and -2 are
+	// the TTL sentinels, small non-negative values cover counts and counters
+	sharedIntReplies = func() [][]byte {
+		replies := make([][]byte, sharedIntReplyMax+2)
+		for i := range replies {
+			replies[i] = []byte(":" + strconv.Itoa(i-2) + "\r\n")
+		}
+		return replies
+	}()
+)
+
+// sharedIntReplyMax bounds the pre-encoded integer replies
+const sharedIntReplyMax = 1024
+
+// Writer handles writing RESP protocol messages.
+// It is safe for concurrent use so pub/sub deliveries can interleave with command replies.
+type Writer struct {
+	writer *output
+	mutex  sync.Mutex
+	intBuf [20]byte // reused by strconv.AppendInt for lengths and integers
+	closed bool     // set once the buffers are returned to the pool
+
+	// errorCount and lastError track the error replies written
+	errorCount int64
+	lastError  string
+
+	// protocol is RESP2 or RESP3, as negotiated by the client. It is read without the
+	// mutex so publishers can pick a frame encoding without waiting for a slow client.
+	protocol atomic.Int32
+
+	// skip counts the commands left to end before replies are back on after CLIENT
+	// REPLY SKIP: the SKIP itself, then the command it silences
+	skip atomic.Int32
+}
+
+// ReplyMode is a reply mode of CLIENT REPLY
+type ReplyMode int
+
+const (
+	RepliesOn   ReplyMode = iota
+	RepliesOff            // replies are discarded until turned back on
+	RepliesSkip           // the reply to the next command is discarded
+)
+
+// NewWriter creates a new RESP writer, speaking RESP2 until HELLO says otherwise
+func NewWriter(writer *bufio.Writer) *Writer {
+	w := &Writer{writer: &output{Writer: writer}}
+	w.protocol.Store(RESP2)
+	return w
+}
+
+// output is the buffered output of a Writer. It counts the bytes written and, while
+// a capture is active, also keeps a copy of them. While discarding, bytes are
+// captured but never reach the buffer.
+type output struct {
+	*bufio.Writer
+	capturing  bool
+	captured   []byte
+	written    int64
+	discarding bool
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	if o.capturing {
+		o.captured = append(o.captured, p...)
+	}
+	if o.discarding {
+		return len(p), nil
+	}
+	n, err := o.Writer.Write(p)
+	o.written += int64(n)
+	return n, err
+}
+
+func (o *output) WriteString(s string) (int, error) {
+	if o.capturing {
+		o.captured = append(o.captured, s...)
+	}
+	if o.discarding {
+		return len(s), nil
+	}
+	n, err := o.Writer.WriteString(s)
+	o.written += int64(n)
+	return n, err
+}
+
+func (o *output) WriteByte(c byte) error {
+	if o.capturing {
+		o.captured = append(o.captured, c)
+	}
+	if o.discarding {
+		return nil
+	}
+	err := o.Writer.WriteByte(c)
+	if err == nil {
+		o.written++
+	}
+	return err
+}
+
+// ReadFrom copies r through Write while capturing, so the copy isn't bypassed
+func (o *output) ReadFrom(r io.Reader) (int64, error) {
+	if !o.capturing && !o.discarding {
+		n, err := o.Writer.ReadFrom(r)
+		o.written += n
+		return n, err
+	}
+	return io.Copy(struct{ io.Writer }{o}, r)
+}
+
+// StartCapture keeps a copy of every reply written from now on, until StopCapture
+func (w *Writer) StartCapture() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !w.closed {
+		w.writer.capturing = true
+		w.writer.captured = nil
+	}
+}
+
+// StopCapture ends the capture and returns the RESP encoding of the replies written
+// since StartCapture, including any pushed to the client meanwhile
+func (w *Writer) StopCapture() []byte {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	captured := w.writer.captured
+	w.writer.capturing = false
+	w.writer.captured = nil
+	return captured
+}
+
+// Written returns the number of reply bytes written so far, pushes included
+func (w *Writer) Written() int64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.writer.written
+}
+
+// Errors returns the number of error replies written so far and the last one
+func (w *Writer) Errors() (count int64, last string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.errorCount, w.lastError
+}
+
+// Protocol returns the protocol version negotiated by the client
+func (w *Writer) Protocol() int {
+	return int(w.protocol.Load())
+}
+
+// SetProtocol switches the encoding of the following replies
+func (w *Writer) SetProtocol(protocol int) {
+	w.protocol.Store(int32(protocol))
+}
+
+// SetReplyMode switches replies on or off as CLIENT REPLY does. Pushes written with
+// WritePush are delivered whatever the mode. SKIP is ignored while replies are off.
+func (w *Writer) SetReplyMode(mode ReplyMode) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return
+	}
+	switch mode {
+	case RepliesOn:
+		w.skip.Store(0)
+		w.writer.discarding = false
+	case RepliesOff:
+		w.skip.Store(0)
+		w.writer.discarding = true
+	case RepliesSkip:
+		if !w.writer.discarding || w.skip.Load() > 0 {
+			w.skip.Store(2)
+			w.writer.discarding = true
+		}
+	}
+}
+
+// EndCommand marks the end of a command's reply, turning replies back on once the
+// command silenced by CLIENT REPLY SKIP is done
+func (w *Writer) EndCommand() {
+	if w.skip.Load() == 0 {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !w.closed && w.skip.Load() > 0 && w.skip.Add(-1) == 0 {
+		w.writer.discarding = false
+	}
+}
+
+// writePrefixed writes a type byte followed by a decimal number and CRLF, e.g. "$5\r\n".
+// bufio.Writer errors are sticky, so callers only need to check the last write.
+func (w *Writer) writePrefixed(prefix byte, n int) error {
+	w.writer.WriteByte(prefix)
+	w.writer.Write(strconv.AppendInt(w.intBuf[:0], int64(n), 10))
+	_, err := w.writer.Write(sharedCRLF)
+	return err
+}
+
+// AppendBulkString appends the encoding of a bulk string to dst
+func AppendBulkString(dst []byte, s string) []byte {
+	dst = append(dst, byte(BulkString))
+	dst = strconv.AppendInt(dst, int64(len(s)), 10)
+	dst = append(dst, sharedCRLF...)
+	dst = append(dst, s...)
+	return append(dst, sharedCRLF...)
+}
+
+// writeBulk writes a bulk string body including its length header
+func (w *Writer) writeBulk(s string) error {
+	w.writePrefixed(byte(BulkString), len(s))
+	w.writer.WriteString(s)
+	_, err := w.writer.Write(sharedCRLF)
+	return err
+}
+
+// writeLine writes a type byte followed by a line of text, e.g. "+OK\r\n"
+func (w *Writer) writeLine(prefix byte, s string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return errWriterClosed
+	}
+	return w.writeText(Type(prefix), s)
+}
+
+// lineBreakReplacer turns the line breaks of an error message into spaces
+var lineBreakReplacer = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// writeText writes a simple string or error. Neither may contain CR or LF, which would
+// end the line early and desynchronize the client, so a simple string that does is
+// sent as a bulk string instead and the line breaks of an error become spaces.
+func (w *Writer) writeText(kind Type, s string) error {
+	if strings.ContainsAny(s, "\r\n") {
+		if kind == SimpleString {
+			return w.writeBulk(s)
+		}
+		s = lineBreakReplacer.Replace(s)
+	}
+	if kind == Error {
+		w.errorCount++
+		w.lastError = s
+	}
+	w.writer.WriteByte(byte(kind))
+	w.writer.WriteString(s)
+	_, err := w.writer.Write(sharedCRLF)
+	return err
+}
+
+// WriteSimpleString writes a RESP simple string
+func (w *Writer) WriteSimpleString(s string) error {
+	switch s {
+	case "OK":
+		return w.WriteRaw(sharedOK)
+	case "PONG":
+		return w.WriteRaw(sharedPong)
+	}
+	return w.writeLine(byte(SimpleString), s)
+}
+
+// WriteError writes a RESP error
+func (w *Writer) WriteError(msg string) error {
+	return w.writeLine(byte(Error), msg)
+}
+
+// WriteBulkString writes a RESP bulk string
+func (w *Writer) WriteBulkString(s string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return errWriterClosed
+	}
+	return w.writeBulk(s)
+}
+
+// WriteInteger writes a RESP integer
+func (w *Writer) WriteInteger(num int) error {
+	if num >= -2 && num < sharedIntReplyMax {
+		return w.WriteRaw(sharedIntReplies[num+2])
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return errWriterClosed
+	}
+	return w.writePrefixed(byte(Integer), num)
+}
+
+// WriteNullBulkString writes a RESP null bulk string, or the RESP3 null
+func (w *Writer) WriteNullBulkString() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return errWriterClosed
+	}
+	return w.writeNull(sharedNullBulk)
+}
+
+// WriteBulkStringArray writes a RESP array of bulk strings
+func (w *Writer) WriteBulkStringArray(items []string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return errWriterClosed
+	}
+	err := w.writePrefixed(byte(Array), len(items))
+	for _, item := range items {
+		err = w.writeBulk(item)
+	}
+	return err
+}
+
+// WriteArray writes a RESP array of arbitrary values
+func (w *Writer) WriteArray(values []Value) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return errWriterClosed
+	}
+	return w.writeValue(Value{Type: Array, Array: values})
+}
+
+// WriteValue writes a value of any type, downgrading RESP3 types for RESP2 clients
+func (w *Writer) WriteValue(v Value) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return errWriterClosed
+	}
+	return w.writeValue(v)
+}
+
+// WriteMap writes a map given as alternating keys and values; RESP2 clients get a flat array
+func (w *Writer) WriteMap(entries []Value) error {
+	return w.WriteValue(Value{Type: Map, Array: entries})
+}
+
+// WriteSet writes a set of unique values; RESP2 clients get an array
+func (w *Writer) WriteSet(items []Value) error {
+	return w.WriteValue(Value{Type: Set, Array: items})
+}
+
+// WriteDouble writes a floating point number; RESP2 clients get a bulk string
+func (w *Writer) WriteDouble(f float64) error {
+	return w.WriteValue(Value{Type: Double, Float: f})
+}
+
+// WriteBoolean writes a boolean; RESP2 clients get the integer 1 or 0
+func (w *Writer) WriteBoolean(b bool) error {
+	return w.WriteValue(Value{Type: Boolean, Num: boolToInt(b)})
+}
+
+// WriteBigNumber writes an integer of arbitrary size; RESP2 clients get a bulk string
+func (w *Writer) WriteBigNumber(n *big.Int) error {
+	return w.WriteValue(Value{Type: BigNumber, Str: n.String()})
+}
+
+// WriteVerbatimString writes text along with its three-letter format, such as "txt"
+// or "mkd", so clients can display it as is; RESP2 clients get a bulk string
+func (w *Writer) WriteVerbatimString(format, text string) error {
+	if len(format) != 3 {
+		return fmt.Errorf("verbatim string format must be three characters, got %q", format)
+	}
+	return w.WriteValue(Value{Type: VerbatimString, Str: format, Bulk: text})
+}
+
+// WriteAttributed writes v preceded by RESP3 attributes given as alternating keys and
+// values; RESP2 clients get v alone
+func (w *Writer) WriteAttributed(attrs []Value, v Value) error {
+	v.Attrs = attrs
+	return w.WriteValue(v)
+}
+
+// WriteNull writes the RESP3 null; RESP2 clients get a null bulk string
+func (w *Writer) WriteNull() error {
+	return w.WriteNullBulkString()
+}
+
+// writeValue encodes a value, recursing into arrays
+func (w *Writer) writeValue(v Value) error {
+	if len(v.Attrs) > 0 && w.Protocol() == RESP3 {
+		w.writeAggregate(Attribute, len(v.Attrs)/2, v.Attrs)
+	}
+
+	switch v.Type {
+	case SimpleString, Error:
+		return w.writeText(v.Type, v.Str)
+	case Integer:
+		return w.writePrefixed(byte(Integer), v.Num)
+	case BulkString:
+		if v.IsNull {
+			return w.writeNull(sharedNullBulk)
+		}
+		return w.writeBulk(v.Bulk)
+	case Array:
+		if v.IsNull {
+			return w.writeNull(sharedNullArray)
+		}
+		return w.writeAggregate(Array, len(v.Array), v.Array)
+	case Map:
+		// RESP2 clients get the keys and values as a flat array
+		if w.Protocol() == RESP3 {
+			return w.writeAggregate(Map, len(v.Array)/2, v.Array)
+		}
+		return w.writeAggregate(Array, len(v.Array), v.Array)
+	case Push:
+		// Out-of-band data such as pub/sub messages; RESP2 clients get an array
+		if w.Protocol() == RESP3 {
+			return w.writeAggregate(Push, len(v.Array), v.Array)
+		}
+		return w.writeAggregate(Array, len(v.Array), v.Array)
+	case Set:
+		if w.Protocol() == RESP3 {
+			return w.writeAggregate(Set, len(v.Array), v.Array)
+		}
+		return w.writeAggregate(Array, len(v.Array), v.Array)
+	case BigNumber:
+		if w.Protocol() == RESP3 {
+			w.writer.WriteByte(byte(BigNumber))
+			w.writer.WriteString(v.Str)
+			_, err := w.writer.Write(sharedCRLF)
+			return err
+		}
+		return w.writeBulk(v.Str)
+	case VerbatimString:
+		if w.Protocol() == RESP3 {
+			w.writePrefixed(byte(VerbatimString), len(v.Str)+1+len(v.Bulk))
+			w.writer.WriteString(v.Str)
+			w.writer.WriteByte(':')
+			w.writer.WriteString(v.Bulk)
+			_, err := w.writer.Write(sharedCRLF)
+			return err
+		}
+		return w.writeBulk(v.Bulk)
+	case Null:
+		return w.writeNull(sharedNullBulk)
+	case Boolean:
+		if w.Protocol() == RESP3 {
+			value := byte('f')
+			if v.Num != 0 {
+				value = 't'
+			}
+			w.writer.WriteByte(byte(Boolean))
+			w.writer.WriteByte(value)
+			_, err := w.writer.Write(sharedCRLF)
+			return err
+		}
+		return w.writePrefixed(byte(Integer), boolToInt(v.Num != 0))
+	case Double:
+		if w.Protocol() == RESP3 {
+			w.writer.WriteByte(byte(Double))
+			w.writer.WriteString(formatDouble(v.Float))
+			_, err := w.writer.Write(sharedCRLF)
+			return err
+		}
+		return w.writeBulk(formatDouble(v.Float))
+	}
+	return fmt.Errorf("cannot encode RESP type %q", v.Type)
+}
+
+// writeNull writes the RESP3 null, or the given RESP2 null encoding to RESP2 clients
+func (w *Writer) writeNull(resp2 []byte) error {
+	if w.Protocol() == RESP3 {
+		_, err := w.writer.Write(sharedNull)
+		return err
+	}
+	_, err := w.writer.Write(resp2)
+	return err
+}
+
+// writeAggregate writes an aggregate header announcing count entries, then elems
+func (w *Writer) writeAggregate(kind Type, count int, elems []Value) error {
+	err := w.writePrefixed(byte(kind), count)
+	for _, elem := range elems {
+		err = w.writeValue(elem)
+	}
+	return err
+}
+
+// boolToInt returns 1 for true and 0 for false, the RESP2 form of a boolean
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// formatDouble renders a float in its shortest exact form, with the inf, -inf and nan
+// spellings of RESP3
+func formatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// WriteRaw writes a reply that is already RESP encoded
+func (w *Writer) WriteRaw(data []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return errWriterClosed
+	}
+	_, err := w.writer.Write(data)
+	return err
+}
+
+// WritePush writes an out-of-band message that is already RESP encoded, such as a
+// pub/sub message: unlike a reply, it is delivered even while replies are off
+func (w *Writer) WritePush(data []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return errWriterClosed
+	}
+	discarding := w.writer.discarding
+	w.writer.discarding = false
+	_, err := w.writer.Write(data)
+	w.writer.discarding = discarding
+	return err
+}
+
+// Flush sends buffered replies to the client. Write methods only buffer, so a
+// pipeline of commands can be answered with a single write syscall.
+func (w *Writer) Flush() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return errWriterClosed
+	}
+	return w.writer.Flush()
+}
+
+// Close detaches the writer from its connection; later writes fail with errWriterClosed.
+// It returns the underlying buffer so the caller can recycle it.
+func (w *Writer) Close() *bufio.Writer {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.closed = true
+	if w.writer == nil {
+		return nil
+	}
+	buf := w.writer.Writer
+	w.writer = nil
+	return buf
+}
@@ -0,0 +1,172 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestParseOversizedAggregate checks that aggregate headers beyond the limits are
+// rejected, map counts included, whose doubling could overflow
+func TestParseOversizedAggregate(t *testing.T) {
+	for _, input := range []string{
+		"*4611686018427387904\r\n",
+		"%4611686018427387904\r\n",
+		"|4611686018427387904\r\n",
+		"%9223372036854775807\r\n",
+		"%1048577\r\n",
+		"*1048577\r\n",
+	} {
+		parser := NewParser(bufio.NewReader(strings.NewReader(input)))
+		_, err := parser.Parse()
+		if !errors.Is(err, errMultibulkTooLarge) {
+			t.Errorf("Parse(%q) = %v, want %v", input, err, errMultibulkTooLarge)
+		}
+	}
+}
+
+// TestParseOversizedLine checks that a header without a newline in sight is rejected
+// once beyond maxLineLen rather than read into memory until one comes
+func TestParseOversizedLine(t *testing.T) {
+	for _, input := range []string{
+		"*" + strings.Repeat("1", maxLineLen+1),
+		"$" + strings.Repeat("1", maxLineLen+1) + "\r\n",
+		"+" + strings.Repeat("a", 10*maxLineLen) + "\r\n",
+	} {
+		parser := NewParser(bufio.NewReader(strings.NewReader(input)))
+		_, err := parser.Parse()
+		if !errors.Is(err, errLineTooLarge) {
+			t.Errorf("Parse(%.10q...) = %v, want %v", input, err, errLineTooLarge)
+		}
+	}
+
+	// A header just within the limit is still read across several buffer fills
+	input := "+" + strings.Repeat("a", maxLineLen-3) + "\r\n"
+	parser := NewParser(bufio.NewReader(strings.NewReader(input)))
+	if value, err := parser.Parse(); err != nil || len(value.Str) != maxLineLen-3 {
+		t.Errorf("Parse of a %d byte line = %d bytes, %v", len(input), len(value.Str), err)
+	}
+}
+
+// TestReadyLargeBulkInChunks feeds a command with a large bulk a read at a time, as
+// the event loop receives it: Ready must hold the command back until the last read
+// completes it, so that it is parsed once
+func TestReadyLargeBulkInChunks(t *testing.T) {
+	const size, chunk = 10 << 20, 16 << 10
+	input := "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$10485760\r\n" + strings.Repeat("x", size) + "\r\n"
+
+	source := bytes.NewReader(nil)
+	parser := NewParser(bufio.NewReader(source))
+	var buf []byte
+	for len(buf) < len(input) {
+		buf = append(buf, input[len(buf):min(len(buf)+chunk, len(input))]...)
+		if ready := parser.Ready(buf); ready != (len(buf) == len(input)) {
+			t.Fatalf("Ready after %d of %d bytes = %v", len(buf), len(input), ready)
+		}
+	}
+	source.Reset(buf)
+	value, err := parser.Parse()
+	if err != nil || len(value.Array) != 3 || len(value.Array[2].Bulk) != size {
+		t.Fatalf("Parse = %d elements, %v", len(value.Array), err)
+	}
+}
+
+// TestReadyPrefixes checks, for every prefix of a few frames, that Ready only holds
+// back input Parse would run out of, and lets every whole frame through
+func TestReadyPrefixes(t *testing.T) {
+	for _, input := range []string{
+		"*2\r\n$4\r\nECHO\r\n$5\r\nhello\r\n",
+		"\r\n*1\r\n$4\r\nPING\r\n",
+		"PING\r\n",
+		"*2\r\n*1\r\n:1\r\n*0\r\n",
+		"%1\r\n+key\r\n~2\r\n#t\r\n_\r\n",
+		"|1\r\n+ttl\r\n:10\r\n$3\r\nfoo\r\n",
+		"*2\r\n$-1\r\n=7\r\ntxt:abc\r\n",
+		"*-1\r\n",
+		"*2\r\n$3\r\nabc\r\n$x\r\n",
+	} {
+		parser := NewParser(bufio.NewReader(nil))
+		for n := 1; n <= len(input); n++ {
+			prefix := []byte(input[:n])
+			if parser.Ready(prefix) {
+				if n < len(input) {
+					fresh := NewParser(bufio.NewReader(bytes.NewReader(prefix)))
+					if _, err := fresh.Parse(); err == io.EOF || err == io.ErrUnexpectedEOF {
+						t.Errorf("Ready(%q) with Parse out of input", prefix)
+					}
+				}
+				break
+			}
+			fresh := NewParser(bufio.NewReader(bytes.NewReader(prefix)))
+			if _, err := fresh.Parse(); err != io.EOF && err != io.ErrUnexpectedEOF {
+				t.Errorf("Ready(%q) = false, while Parse returns %v", prefix, err)
+			}
+			if n == len(input) {
+				t.Errorf("Ready(%q) = false for the whole frame", input)
+			}
+		}
+	}
+}
+
+// benchmarkWriter runs write b.N times on a writer whose output is discarded
+func benchmarkWriter(b *testing.B, write func(w *Writer) error) {
+	w := NewWriter(bufio.NewWriter(io.Discard))
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := write(w); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriterBulkString(b *testing.B) {
+	benchmarkWriter(b, func(w *Writer) error { return w.WriteBulkString("hello world") })
+}
+
+func BenchmarkWriterInteger(b *testing.B) {
+	benchmarkWriter(b, func(w *Writer) error { return w.WriteInteger(1234567) })
+}
+
+func BenchmarkWriterSimpleString(b *testing.B) {
+	benchmarkWriter(b, func(w *Writer) error { return w.WriteSimpleString("OK") })
+}
+
+func BenchmarkWriterArray(b *testing.B) {
+	values := []Value{
+		{Type: BulkString, Bulk: "key"},
+		{Type: Integer, Num: 42},
+		{Type: SimpleString, Str: "OK"},
+		{Type: BulkString, IsNull: true},
+	}
+	benchmarkWriter(b, func(w *Writer) error { return w.WriteArray(values) })
+}
+
+// benchmarkParse parses input b.N times
+func benchmarkParse(b *testing.B, input string) {
+	source := strings.NewReader(input)
+	parser := NewParser(bufio.NewReader(source))
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for b.Loop() {
+		source.Reset(input)
+		parser.Reset(source)
+		if _, err := parser.Parse(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseCommand(b *testing.B) {
+	benchmarkParse(b, "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n")
+}
+
+func BenchmarkParseInline(b *testing.B) {
+	benchmarkParse(b, "SET key value\r\n")
+}
+
+func BenchmarkParseLargeBulk(b *testing.B) {
+	benchmarkParse(b, "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$1048576\r\n"+strings.Repeat("x", 1<<20)+"\r\n")
+}
@@ -0,0 +1,80 @@
+package resp
+
+import (
+	"fmt"
+	"io"
+)
+
+// ReplyStream writes a single reply piece by piece, for replies too large to build
+// before sending. Pieces go through the connection's write buffer, which passes them
+// on to the socket whenever it fills, so memory stays bounded by the buffer size
+// rather than the reply size. The stream holds the writer until Close, so pub/sub
+// messages can't land in the middle of the reply.
+type ReplyStream struct {
+	w   *Writer
+	err error
+}
+
+// Stream starts a streamed reply; Close must be called once it is complete
+func (w *Writer) Stream() *ReplyStream {
+	w.mutex.Lock()
+	stream := &ReplyStream{w: w}
+	if w.closed {
+		stream.err = errWriterClosed
+	}
+	return stream
+}
+
+// ArrayHeader announces an array of n elements, which must follow
+func (s *ReplyStream) ArrayHeader(n int) error {
+	if s.err == nil {
+		s.err = s.w.writePrefixed(byte(Array), n)
+	}
+	return s.err
+}
+
+// BulkString writes one bulk string
+func (s *ReplyStream) BulkString(str string) error {
+	if s.err == nil {
+		s.err = s.w.writeBulk(str)
+	}
+	return s.err
+}
+
+// Value writes one value of any type
+func (s *ReplyStream) Value(v Value) error {
+	if s.err == nil {
+		s.err = s.w.writeValue(v)
+	}
+	return s.err
+}
+
+// BulkFrom writes a bulk string of length bytes read from r, copying it in
+// buffer-sized chunks. If r runs out early the reply can't be completed, the stream
+// fails and the connection should be closed.
+func (s *ReplyStream) BulkFrom(length int64, r io.Reader) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.w.writePrefixed(byte(BulkString), int(length))
+	if n, err := io.CopyN(s.w.writer, r, length); err != nil {
+		s.err = fmt.Errorf("streamed %d of %d bytes: %w", n, length, err)
+		return s.err
+	}
+	_, s.err = s.w.writer.Write(sharedCRLF)
+	return s.err
+}
+
+// Flush sends what has been written so far, for replies produced slowly
+func (s *ReplyStream) Flush() error {
+	if s.err == nil {
+		s.err = s.w.writer.Flush()
+	}
+	return s.err
+}
+
+// Close completes the reply and releases the writer
+func (s *ReplyStream) Close() error {
+	s.w.mutex.Unlock()
+	return s.err
+}